@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"pwnscanner/pkg/auth"
+	"pwnscanner/pkg/config"
+	"pwnscanner/pkg/database"
+	"pwnscanner/pkg/utils"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// authorizer applica l'autenticazione con chiavi API agli endpoint.
+type authorizer struct {
+	enabled       bool
+	authenticator *auth.Authenticator
+	anonymous     *auth.Principal
+}
+
+// newAuthorizer prepara l'autenticazione secondo la configurazione. Se il database non conserva
+// chiavi API sono ammesse solo le richieste anonime.
+func newAuthorizer(cfg config.AuthConfig, db database.Database) (*authorizer, error) {
+	if !cfg.Enabled {
+		log.Warn().Msg("Autenticazione disattivata (auth.enabled = false): tutte le richieste sono ammesse")
+		return &authorizer{anonymous: auth.Anonymous(auth.Scopes)}, nil
+	}
+
+	scopes, err := auth.ParseScopes(strings.Join(cfg.AnonymousScopes, ","))
+	if err != nil {
+		return nil, err
+	}
+
+	store, ok := db.(database.APIKeyStore)
+	if !ok {
+		log.Warn().Msg("Il database configurato non conserva chiavi API: sono ammesse solo le richieste anonime")
+	}
+	return &authorizer{
+		enabled:       true,
+		authenticator: auth.NewAuthenticator(store, cfg.CacheTTL()),
+		anonymous:     auth.Anonymous(scopes),
+	}, nil
+}
+
+// require protegge l'handler: la richiesta deve presentare una chiave valida con il permesso indicato,
+// oppure il permesso deve essere concesso alle richieste anonime. Il principal viene messo nel contesto
+// della richiesta insieme a un logger che riporta la chiave usata.
+func (a *authorizer) require(scope auth.Scope, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal := a.anonymous
+		if key := auth.KeyFromRequest(r); key != "" && a.enabled {
+			p, err := a.authenticator.Authenticate(r.Context(), key)
+			switch {
+			case errors.Is(err, auth.ErrInvalidKey), errors.Is(err, auth.ErrExpiredKey), errors.Is(err, auth.ErrRevokedKey):
+				log.Warn().Str("remote_addr", r.RemoteAddr).Str("path", r.URL.Path).Msgf("Autenticazione rifiutata: %v", err)
+				utils.WriteError(w, http.StatusUnauthorized, "Accesso non autorizzato")
+				return
+			case err != nil:
+				writeDatabaseError(w, r, err, "Errore durante la verifica della chiave API")
+				return
+			}
+			principal = p
+		}
+
+		if !principal.Has(scope) {
+			if principal.IsAnonymous() {
+				utils.WriteError(w, http.StatusUnauthorized, "Accesso non autorizzato")
+			} else {
+				utils.WriteError(w, http.StatusForbidden, "Permesso insufficiente per questa operazione")
+			}
+			return
+		}
+
+		ctx := auth.NewContext(r.Context(), principal)
+		logger := log.With().Str("key_id", principal.KeyID).Str("owner", principal.Owner).Logger()
+		next.ServeHTTP(w, r.WithContext(logger.WithContext(ctx)))
+	})
+}
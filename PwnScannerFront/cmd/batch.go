@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"pwnscanner/pkg/auth"
+	"pwnscanner/pkg/checker"
+	"pwnscanner/pkg/config"
+	"pwnscanner/pkg/database"
+	"pwnscanner/pkg/normalize"
+	"pwnscanner/pkg/ratelimit"
+	"pwnscanner/pkg/utils"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// maxEmailBytes è la dimensione massima di una riga del corpo di /check-emails, usata anche
+// per limitare la dimensione complessiva della richiesta in base al numero di email ammesse.
+const maxEmailBytes = 1024
+
+// errBatchTooLarge indica una richiesta con più email del limite consentito.
+var errBatchTooLarge = errors.New("troppe email nella richiesta")
+
+// batchResult è il risultato di un'email di /check-emails, scritto come una riga NDJSON.
+type batchResult struct {
+	// Email è l'email così come è stata inviata
+	Email string `json:"email"`
+	// Found indica se l'email compare in almeno un breach
+	Found bool `json:"found"`
+	// Breaches sono i breach dell'email in ordine alfabetico (vuoto se non trovata)
+	Breaches []string `json:"breaches"`
+	// Error è valorizzato se l'email non è stata verificata (ad esempio perché non valida)
+	Error string `json:"error,omitempty"`
+}
+
+// @Summary Verifica più email nei breach
+// @Description Verifica fino a batch.max_emails email (o al limite della chiave API) in una sola richiesta. Il corpo può essere
+// @Description un array JSON di stringhe (application/json), una email per riga in NDJSON
+// @Description (application/x-ndjson, come stringa JSON o come {"email": "..."}) oppure un CSV
+// @Description (text/csv, email nella prima colonna, intestazione "email" facoltativa).
+// @Description La risposta è NDJSON, una riga per email nell'ordine della richiesta, scritta appena disponibile;
+// @Description le email non trovate hanno found=false e quelle non valide o non verificate (ad esempio
+// @Description perché la richiesta è scaduta) un campo error.
+// @Description Ogni email consuma un gettone del rate limiting.
+// @Tags Email
+// @Accept json,text/csv,application/x-ndjson
+// @Produce application/x-ndjson
+// @Param emails body []string true "Email da verificare"
+// @Success 200 {object} batchResult "Una riga per ogni email"
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 413 {object} utils.ErrorResponse
+// @Failure 415 {object} utils.ErrorResponse
+// @Failure 429 {object} utils.ErrorResponse
+// @Failure 503 {object} utils.ErrorResponse
+// @Failure 504 {object} utils.ErrorResponse
+// @Router /check-emails [post]
+func handleCheckEmails(c *checker.Checker, cfg config.BatchConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := batchLimit(r, cfg)
+		r.Body = http.MaxBytesReader(w, r.Body, int64(limit+1)*maxEmailBytes)
+
+		emails, err := readBatchEmails(r, limit)
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.Is(err, errBatchTooLarge), errors.As(err, &maxBytesErr):
+			utils.WriteError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Troppe email nella richiesta (massimo %d)", limit))
+			return
+		case errors.Is(err, errUnsupportedBatchType):
+			utils.WriteError(w, http.StatusUnsupportedMediaType, "Formato non supportato: usare application/json, application/x-ndjson o text/csv")
+			return
+		case err != nil:
+			utils.WriteError(w, http.StatusBadRequest, "Richiesta non valida")
+			return
+		case len(emails) == 0:
+			utils.WriteError(w, http.StatusBadRequest, "Nessuna email nella richiesta")
+			return
+		}
+
+		// La richiesta ha già consumato un gettone: le altre email vengono addebitate al bucket del client
+		if err := ratelimit.Charge(r.Context(), float64(len(emails)-1)); err != nil {
+			zerolog.Ctx(r.Context()).Error().Err(err).Msg("Errore nell'addebito delle email al rate limiter")
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		streamBatch(r.Context(), w, c, emails, cfg.Concurrency)
+	}
+}
+
+// batchLimit restituisce il numero massimo di email ammesse per la richiesta:
+// quello della chiave API, se impostato, altrimenti quello della configurazione.
+func batchLimit(r *http.Request, cfg config.BatchConfig) int {
+	if p := auth.FromContext(r.Context()); p != nil && p.MaxBatch > 0 {
+		return p.MaxBatch
+	}
+	return cfg.MaxEmails
+}
+
+// streamBatch cerca le email con al massimo concurrency ricerche in corso e scrive i risultati
+// nell'ordine delle email. Si interrompe se il client si disconnette; se scade la richiesta,
+// le email non ancora verificate vengono scritte con un errore.
+func streamBatch(ctx context.Context, w http.ResponseWriter, c *checker.Checker, emails []string, concurrency int) {
+	requestCtx := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// pending contiene i risultati in arrivo nell'ordine delle email; sem limita le ricerche in corso
+	pending := make(chan chan batchResult, concurrency)
+	sem := make(chan struct{}, concurrency)
+	go func() {
+		defer close(pending)
+		for _, email := range emails {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			result := make(chan batchResult, 1)
+			go func() {
+				defer func() { <-sem }()
+				result <- checkBatchEmail(ctx, c, email)
+			}()
+			select {
+			case pending <- result:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	written := 0
+	for result := range pending {
+		if err := enc.Encode(<-result); err != nil {
+			// Il client non legge più: le ricerche rimanenti vengono annullate
+			cancel()
+			return
+		}
+		written++
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	// Scaduta la richiesta, il client riceve comunque una riga per ogni email
+	if errors.Is(requestCtx.Err(), context.DeadlineExceeded) {
+		for _, email := range emails[written:] {
+			if err := enc.Encode(batchResult{Email: email, Breaches: []string{}, Error: "Tempo scaduto"}); err != nil {
+				return
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// checkBatchEmail cerca una singola email di /check-emails.
+func checkBatchEmail(ctx context.Context, c *checker.Checker, email string) batchResult {
+	result := batchResult{Email: email, Breaches: []string{}}
+
+	breaches, err := c.FindEmailInBreaches(ctx, email)
+	switch {
+	case errors.Is(err, normalize.ErrInvalid):
+		result.Error = "Email non valida"
+	case errors.Is(err, context.DeadlineExceeded):
+		result.Error = "Tempo scaduto"
+	case errors.Is(err, database.ErrUnavailable):
+		result.Error = "Database non disponibile"
+	case err != nil:
+		if ctx.Err() == nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("Errore durante la verifica di un'email in /check-emails")
+		}
+		result.Error = "Errore interno del server"
+	case len(breaches) > 0:
+		result.Found = true
+		result.Breaches = breaches
+	}
+	return result
+}
+
+// errUnsupportedBatchType indica un Content-Type non gestito da /check-emails.
+var errUnsupportedBatchType = errors.New("formato non supportato")
+
+// readBatchEmails legge le email dal corpo nel formato indicato dal Content-Type
+// (application/json se assente), fallendo con errBatchTooLarge oltre limit email.
+func readBatchEmails(r *http.Request, limit int) ([]string, error) {
+	mediaType := "application/json"
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		var err error
+		if mediaType, _, err = mime.ParseMediaType(contentType); err != nil {
+			return nil, errUnsupportedBatchType
+		}
+	}
+
+	var emails []string
+	add := func(email string) error {
+		if len(emails) == limit {
+			return errBatchTooLarge
+		}
+		emails = append(emails, email)
+		return nil
+	}
+
+	var err error
+	switch mediaType {
+	case "application/json":
+		err = readJSONEmails(r.Body, add)
+	case "application/x-ndjson", "application/ndjson", "application/jsonl":
+		err = readNDJSONEmails(r.Body, add)
+	case "text/csv":
+		err = readCSVEmails(r.Body, add)
+	default:
+		err = errUnsupportedBatchType
+	}
+	return emails, err
+}
+
+// readJSONEmails legge un array JSON di stringhe, un elemento alla volta.
+func readJSONEmails(body io.Reader, add func(string) error) error {
+	dec := json.NewDecoder(body)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return fmt.Errorf("è atteso un array JSON di email")
+	}
+	for dec.More() {
+		var email string
+		if err := dec.Decode(&email); err != nil {
+			return err
+		}
+		if err := add(email); err != nil {
+			return err
+		}
+	}
+	_, err := dec.Token()
+	return err
+}
+
+// readNDJSONEmails legge una email per riga, come stringa JSON o come oggetto {"email": "..."}.
+// Le righe vuote sono ignorate.
+func readNDJSONEmails(body io.Reader, add func(string) error) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, maxEmailBytes), maxEmailBytes)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var email string
+		if strings.HasPrefix(line, "{") {
+			var item struct {
+				Email string `json:"email"`
+			}
+			if err := json.Unmarshal([]byte(line), &item); err != nil {
+				return err
+			}
+			email = item.Email
+		} else if err := json.Unmarshal([]byte(line), &email); err != nil {
+			return err
+		}
+		if err := add(email); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// readCSVEmails legge l'email dalla prima colonna di ogni riga, ignorando un'eventuale intestazione "email".
+func readCSVEmails(body io.Reader, add func(string) error) error {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		email := strings.TrimSpace(record[0])
+		if email == "" || (first && strings.EqualFold(email, "email")) {
+			continue
+		}
+		if err := add(email); err != nil {
+			return err
+		}
+	}
+}
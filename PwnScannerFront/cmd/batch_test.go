@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"pwnscanner/pkg/auth"
+	"pwnscanner/pkg/checker"
+	"pwnscanner/pkg/config"
+	"pwnscanner/pkg/database"
+	"pwnscanner/pkg/normalize"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readEmails legge le email di body con read, fallendo con errBatchTooLarge oltre limit email.
+func readEmails(read func(*strings.Reader, func(string) error) error, body string, limit int) ([]string, error) {
+	var emails []string
+	err := read(strings.NewReader(body), func(email string) error {
+		if len(emails) == limit {
+			return errBatchTooLarge
+		}
+		emails = append(emails, email)
+		return nil
+	})
+	return emails, err
+}
+
+func TestReadBatchEmails(t *testing.T) {
+	jsonReader := func(r *strings.Reader, add func(string) error) error { return readJSONEmails(r, add) }
+	ndjsonReader := func(r *strings.Reader, add func(string) error) error { return readNDJSONEmails(r, add) }
+	csvReader := func(r *strings.Reader, add func(string) error) error { return readCSVEmails(r, add) }
+
+	for _, tc := range []struct {
+		name    string
+		read    func(*strings.Reader, func(string) error) error
+		body    string
+		want    []string
+		wantErr bool
+	}{
+		{"JSON", jsonReader, `["alice@example.com", "bob@example.com"]`, []string{"alice@example.com", "bob@example.com"}, false},
+		{"JSON vuoto", jsonReader, `[]`, nil, false},
+		{"JSON non array", jsonReader, `{"email": "alice@example.com"}`, nil, true},
+		{"JSON con un numero", jsonReader, `["alice@example.com", 42]`, []string{"alice@example.com"}, true},
+		{"NDJSON", ndjsonReader, "\"alice@example.com\"\n\n  \n{\"email\": \"bob@example.com\"}\n", []string{"alice@example.com", "bob@example.com"}, false},
+		{"NDJSON non valido", ndjsonReader, "alice@example.com\n", nil, true},
+		{"CSV con intestazione", csvReader, "Email,nome\nalice@example.com,Alice\n\nbob@example.com\n", []string{"alice@example.com", "bob@example.com"}, false},
+		{"CSV senza intestazione", csvReader, "alice@example.com\n , vuota\nbob@example.com,Bob\n", []string{"alice@example.com", "bob@example.com"}, false},
+		// Solo la prima riga può essere l'intestazione
+		{"CSV con email come valore", csvReader, "alice@example.com\nemail\n", []string{"alice@example.com", "email"}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := readEmails(tc.read, tc.body, 10)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("errore = %v, atteso errore: %t", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("email = %q, attese %q", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("oltre il limite", func(t *testing.T) {
+		body := `["a@example.com", "b@example.com", "c@example.com"]`
+		if _, err := readEmails(jsonReader, body, 2); !errors.Is(err, errBatchTooLarge) {
+			t.Errorf("errore = %v, atteso errBatchTooLarge", err)
+		}
+	})
+}
+
+// slowDatabase non risponde per le email in slow finché la richiesta non viene annullata.
+type slowDatabase struct {
+	*database.Memory
+	slow map[string]bool
+}
+
+func (db *slowDatabase) FindEmail(ctx context.Context, email string) ([]string, error) {
+	if db.slow[email] {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return db.Memory.FindEmail(ctx, email)
+}
+
+// newBatchHandler restituisce l'handler di /check-emails su db.
+func newBatchHandler(t *testing.T, db database.Database, cfg config.BatchConfig) http.HandlerFunc {
+	t.Helper()
+	c, err := checker.NewChecker(db, normalize.New(normalize.Options{}), 1, 0)
+	if err != nil {
+		t.Fatalf("NewChecker: errore inatteso: %v", err)
+	}
+	return handleCheckEmails(c, cfg)
+}
+
+// batchResults decodifica le righe NDJSON della risposta di /check-emails.
+func batchResults(t *testing.T, rec *httptest.ResponseRecorder) []batchResult {
+	t.Helper()
+	var results []batchResult
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		var result batchResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			t.Fatalf("riga non valida %q: %v", scanner.Text(), err)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func TestCheckEmails(t *testing.T) {
+	db := database.NewMemory()
+	db.Add("alice@example.com", "Adobe", "LinkedIn")
+	db.Add("carol@example.com", "Adobe")
+	handler := newBatchHandler(t, db, config.BatchConfig{MaxEmails: 3, Concurrency: 2})
+
+	post := func(contentType, body string, principal *auth.Principal) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/check-emails", strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if principal != nil {
+			req = req.WithContext(auth.NewContext(req.Context(), principal))
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	for _, tc := range []struct {
+		name        string
+		contentType string
+		body        string
+		principal   *auth.Principal
+		status      int
+	}{
+		{"JSON senza Content-Type", "", `["alice@example.com"]`, nil, http.StatusOK},
+		{"NDJSON", "application/x-ndjson", "{\"email\": \"alice@example.com\"}\n", nil, http.StatusOK},
+		{"CSV con charset", "text/csv; charset=utf-8", "email\nalice@example.com\n", nil, http.StatusOK},
+		{"oltre il limite della configurazione", "application/json", `["a@example.com", "b@example.com", "c@example.com", "d@example.com"]`, nil, http.StatusRequestEntityTooLarge},
+		{"entro il limite della chiave", "application/json", `["a@example.com", "b@example.com", "c@example.com", "d@example.com"]`, &auth.Principal{KeyID: "k", MaxBatch: 5}, http.StatusOK},
+		{"oltre il limite della chiave", "application/json", `["a@example.com", "b@example.com"]`, &auth.Principal{KeyID: "k", MaxBatch: 1}, http.StatusRequestEntityTooLarge},
+		{"corpo oltre la dimensione massima", "text/csv", strings.Repeat("a", 5*maxEmailBytes), nil, http.StatusRequestEntityTooLarge},
+		{"formato non supportato", "text/plain", "alice@example.com", nil, http.StatusUnsupportedMediaType},
+		{"Content-Type non valido", "application/", `["alice@example.com"]`, nil, http.StatusUnsupportedMediaType},
+		{"JSON non valido", "application/json", `["alice@example.com"`, nil, http.StatusBadRequest},
+		{"nessuna email", "application/json", `[]`, nil, http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if rec := post(tc.contentType, tc.body, tc.principal); rec.Code != tc.status {
+				t.Errorf("stato = %d, atteso %d (%s)", rec.Code, tc.status, rec.Body)
+			}
+		})
+	}
+
+	t.Run("risultati in ordine", func(t *testing.T) {
+		rec := post("application/json", `["bob@example.com", "Alice@Example.com", "non valida"]`, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("stato = %d, atteso 200 (%s)", rec.Code, rec.Body)
+		}
+		if got := rec.Header().Get("Content-Type"); got != "application/x-ndjson" {
+			t.Errorf("Content-Type = %q, atteso application/x-ndjson", got)
+		}
+		want := []batchResult{
+			{Email: "bob@example.com", Breaches: []string{}},
+			{Email: "Alice@Example.com", Found: true, Breaches: []string{"Adobe", "LinkedIn"}},
+			{Email: "non valida", Breaches: []string{}, Error: "Email non valida"},
+		}
+		if got := batchResults(t, rec); !reflect.DeepEqual(got, want) {
+			t.Errorf("risultati = %+v, attesi %+v", got, want)
+		}
+	})
+}
+
+// Scaduta la richiesta, l'email in corso e quelle successive vengono scritte con "Tempo scaduto",
+// dopo i risultati già disponibili e nell'ordine della richiesta.
+func TestCheckEmailsDeadline(t *testing.T) {
+	memory := database.NewMemory()
+	memory.Add("alice@example.com", "Adobe")
+	memory.Add("carol@example.com", "LinkedIn")
+	db := &slowDatabase{Memory: memory, slow: map[string]bool{"bob@example.com": true}}
+	handler := newBatchHandler(t, db, config.BatchConfig{MaxEmails: 10, Concurrency: 1})
+
+	body := `["alice@example.com", "bob@example.com", "carol@example.com", "dave@example.com"]`
+	req := httptest.NewRequest(http.MethodPost, "/check-emails", strings.NewReader(body))
+	ctx, cancel := context.WithTimeout(req.Context(), 50*time.Millisecond)
+	defer cancel()
+	rec := httptest.NewRecorder()
+	handler(rec, req.WithContext(ctx))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("stato = %d, atteso 200 (%s)", rec.Code, rec.Body)
+	}
+	want := []batchResult{
+		{Email: "alice@example.com", Found: true, Breaches: []string{"Adobe"}},
+		{Email: "bob@example.com", Breaches: []string{}, Error: "Tempo scaduto"},
+		{Email: "carol@example.com", Breaches: []string{}, Error: "Tempo scaduto"},
+		{Email: "dave@example.com", Breaches: []string{}, Error: "Tempo scaduto"},
+	}
+	if got := batchResults(t, rec); !reflect.DeepEqual(got, want) {
+		t.Errorf("risultati = %+v, attesi %+v", got, want)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"pwnscanner/pkg/database"
+	"pwnscanner/pkg/utils"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// breachResponse è un breach del catalogo con il numero di email effettivamente presenti nel database.
+type breachResponse struct {
+	database.Breach
+	// Accounts è il numero di email del breach presenti nel database (dalle statistiche)
+	Accounts int64 `json:"accounts"`
+}
+
+// @Summary Ottiene tutti i breach disponibili
+// @Description Restituisce tutti i breach registrati nel sistema, in ordine alfabetico, con i metadati del catalogo
+// @Description e il numero di email presenti. I breach senza una voce nel catalogo contengono solo il nome
+// @Description (e il logo predefinito, se esiste).
+// @Tags Breach
+// @Accept json
+// @Produce json
+// @Success 200 {array} breachResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 429 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Failure 503 {object} utils.ErrorResponse
+// @Failure 504 {object} utils.ErrorResponse
+// @Router /breaches [get]
+func handleGetBreaches(db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			utils.WriteError(w, http.StatusMethodNotAllowed, "Metodo non supportato")
+			return
+		}
+
+		stats, err := breachStats(r.Context(), db)
+		if err != nil {
+			writeDatabaseError(w, r, err, "Errore nel recupero dei breach")
+			return
+		}
+
+		catalog := map[string]database.Breach{}
+		if c, ok := db.(database.BreachCatalog); ok {
+			list, err := c.ListBreaches(r.Context())
+			if err != nil {
+				writeDatabaseError(w, r, err, "Errore nel recupero dei breach")
+				return
+			}
+			for _, breach := range list {
+				catalog[breach.Name] = breach
+			}
+		}
+
+		breaches := make([]breachResponse, 0, len(stats))
+		for _, stat := range stats {
+			breach, found := catalog[stat.Name]
+			if !found {
+				breach = database.Breach{Name: stat.Name}
+			}
+			breaches = append(breaches, breachResponse{Breach: withDefaults(breach), Accounts: stat.Accounts})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(breaches)
+	}
+}
+
+// @Summary Ottiene i dettagli di un breach
+// @Description Restituisce i metadati del breach indicato. Un breach presente nel database ma non ancora
+// @Description descritto nel catalogo viene restituito con il solo nome.
+// @Tags Breach
+// @Accept json
+// @Produce json
+// @Param name path string true "Nome del breach"
+// @Success 200 {object} breachResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 429 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Failure 503 {object} utils.ErrorResponse
+// @Failure 504 {object} utils.ErrorResponse
+// @Router /breaches/{name} [get]
+func handleGetBreach(db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+
+		var breach *database.Breach
+		if c, ok := db.(database.BreachCatalog); ok {
+			var err error
+			breach, err = c.GetBreach(r.Context(), name)
+			if err != nil {
+				writeDatabaseError(w, r, err, "Errore nel recupero del breach")
+				return
+			}
+		}
+
+		stats, err := breachStats(r.Context(), db)
+		if err != nil {
+			writeDatabaseError(w, r, err, "Errore nel recupero del breach")
+			return
+		}
+		i, found := slices.BinarySearchFunc(stats, name, func(stat database.BreachStat, name string) int {
+			return strings.Compare(stat.Name, name)
+		})
+
+		var accounts int64
+		if found {
+			accounts = stats[i].Accounts
+		}
+		if breach == nil {
+			if !found {
+				utils.WriteError(w, http.StatusNotFound, "Breach non trovato")
+				return
+			}
+			breach = &database.Breach{Name: name}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(breachResponse{Breach: withDefaults(*breach), Accounts: accounts})
+	}
+}
+
+// breachStats restituisce i breach con il numero di email, in ordine alfabetico. Se il database
+// non mantiene le statistiche, i breach vengono letti con GetAllBreaches e il numero resta a zero.
+func breachStats(ctx context.Context, db database.Database) ([]database.BreachStat, error) {
+	if reader, ok := db.(database.StatsReader); ok {
+		return reader.BreachStats(ctx)
+	}
+
+	names, err := db.GetAllBreaches(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stats := make([]database.BreachStat, 0, len(names))
+	for _, name := range names {
+		stats = append(stats, database.BreachStat{Name: name})
+	}
+	return stats, nil
+}
+
+// withDefaults completa i campi facoltativi mancanti: il titolo è il nome del breach e il logo,
+// se non indicato nel catalogo, è media/img/<nome in minuscolo senza simboli>.png quando il file esiste.
+func withDefaults(breach database.Breach) database.Breach {
+	if breach.Title == "" {
+		breach.Title = breach.Name
+	}
+	if breach.DataClasses == nil {
+		breach.DataClasses = []string{}
+	}
+	if breach.LogoPath == "" {
+		slug := strings.Map(func(r rune) rune {
+			if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+				return unicode.ToLower(r)
+			}
+			return -1
+		}, breach.Name)
+		if slug != "" {
+			if _, err := os.Stat(filepath.Join(staticDir, "media", "img", slug+".png")); err == nil {
+				breach.LogoPath = "/media/img/" + slug + ".png"
+			}
+		}
+	}
+	return breach
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"pwnscanner/pkg/auth"
+	"pwnscanner/pkg/database"
+	"pwnscanner/pkg/normalize"
+	"pwnscanner/pkg/utils"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// Numero di email per pagina di /domains/{domain}/breached-accounts, predefinito e massimo
+const (
+	defaultDomainAccounts = 1000
+	maxDomainAccounts     = 10000
+)
+
+// domainSearchResponse è la risposta JSON di /domains/{domain}/breached-accounts.
+type domainSearchResponse struct {
+	// Domain è il dominio cercato, in forma canonica
+	Domain string `json:"domain"`
+	// Accounts sono le email della pagina con i loro breach, in ordine di email
+	Accounts []database.Record `json:"accounts"`
+	// Breaches è il numero di email del dominio in ogni breach, solo nella prima pagina e con stats=true
+	Breaches []database.BreachStat `json:"breaches,omitempty"`
+	// NextCursor è il cursore della pagina successiva; assente nell'ultima pagina
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// @Summary Cerca le email di un dominio nei breach
+// @Description Restituisce, in ordine di email, le email del dominio presenti nei breach con i breach di
+// @Description ciascuna. Richiede il permesso domain_search e una chiave API a cui è stato assegnato il dominio,
+// @Description dopo la verifica del possesso (le chiavi admin possono cercare qualsiasi dominio).
+// @Description Le email sono divise in pagine: il campo next_cursor (o l'header X-Next-Cursor) va passato
+// @Description come parametro cursor per ottenere la pagina successiva. Con stats=true la prima pagina in JSON
+// @Description contiene anche il numero di email del dominio in ogni breach, che richiede di scorrere tutte
+// @Description le email del dominio. Con format=csv, o con "Accept: text/csv", la risposta è un CSV con le
+// @Description colonne email e breaches (separati da ';').
+// @Tags Domini
+// @Produce json,text/csv
+// @Param domain path string true "Dominio da cercare"
+// @Param cursor query string false "Cursore restituito dalla pagina precedente"
+// @Param limit query int false "Email per pagina (predefinito 1000, massimo 10000)"
+// @Param format query string false "Formato della risposta" Enums(json, csv)
+// @Param stats query bool false "Aggiunge alla prima pagina in JSON il numero di email del dominio in ogni breach"
+// @Success 200 {object} domainSearchResponse
+// @Header 200 {string} X-Next-Cursor "Cursore della pagina successiva, assente nell'ultima pagina"
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 429 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Failure 501 {object} utils.ErrorResponse
+// @Failure 503 {object} utils.ErrorResponse
+// @Failure 504 {object} utils.ErrorResponse
+// @Router /domains/{domain}/breached-accounts [get]
+func handleDomainSearch(db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		searcher, ok := db.(database.DomainSearcher)
+		if !ok {
+			utils.WriteError(w, http.StatusNotImplemented, "Il database configurato non supporta la ricerca per dominio")
+			return
+		}
+
+		domain, err := normalize.Domain(r.PathValue("domain"))
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Dominio non valido")
+			return
+		}
+		p := auth.FromContext(r.Context())
+		if p == nil || !p.CanSearchDomain(domain) {
+			utils.WriteError(w, http.StatusForbidden, "La chiave API non è autorizzata a cercare le email di questo dominio")
+			return
+		}
+
+		query := r.URL.Query()
+		limit := defaultDomainAccounts
+		if value := query.Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > maxDomainAccounts {
+				utils.WriteError(w, http.StatusBadRequest, "Parametro limit non valido")
+				return
+			}
+			limit = n
+		}
+		after, err := base64.RawURLEncoding.DecodeString(query.Get("cursor"))
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Parametro cursor non valido")
+			return
+		}
+		csvFormat, err := domainSearchCSV(r)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Parametro format non valido: usare json o csv")
+			return
+		}
+		// Il conteggio per breach scorre tutte le email del dominio: si calcola solo se richiesto
+		withStats := false
+		if value := query.Get("stats"); value != "" {
+			withStats, err = strconv.ParseBool(value)
+			if err != nil {
+				utils.WriteError(w, http.StatusBadRequest, "Parametro stats non valido: usare true o false")
+				return
+			}
+		}
+
+		// Una email in più del limite indica che esiste una pagina successiva
+		accounts, err := searcher.FindDomainEmails(r.Context(), domain, string(after), limit+1)
+		if errors.Is(err, database.ErrHashedEmails) {
+			utils.WriteError(w, http.StatusNotImplemented, "Il database conserva le email come HMAC e non può restituirle in chiaro")
+			return
+		}
+		if err != nil {
+			writeDatabaseError(w, r, err, "Errore nella ricerca delle email del dominio")
+			return
+		}
+		response := domainSearchResponse{Domain: domain, Accounts: accounts}
+		if len(accounts) > limit {
+			response.Accounts = accounts[:limit]
+			response.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(accounts[limit-1].Email))
+			w.Header().Set("X-Next-Cursor", response.NextCursor)
+		}
+		if withStats && len(after) == 0 && !csvFormat {
+			response.Breaches, err = searcher.DomainBreachStats(r.Context(), domain)
+			if err != nil {
+				writeDatabaseError(w, r, err, "Errore nel conteggio delle email del dominio")
+				return
+			}
+		}
+
+		// Le email di un dominio sono dati personali: ogni consultazione resta nei log
+		zerolog.Ctx(r.Context()).Info().
+			Str("domain", domain).
+			Int("accounts", len(response.Accounts)).
+			Msg("Ricerca delle email di un dominio")
+
+		if csvFormat {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			writer := csv.NewWriter(w)
+			writer.Write([]string{"email", "breaches"})
+			for _, account := range response.Accounts {
+				writer.Write([]string{account.Email, strings.Join(account.Breaches, ";")})
+			}
+			writer.Flush()
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// domainSearchCSV indica se la risposta va scritta in CSV: il parametro format prevale sull'header Accept.
+func domainSearchCSV(r *http.Request) (bool, error) {
+	switch r.URL.Query().Get("format") {
+	case "csv":
+		return true, nil
+	case "json":
+		return false, nil
+	case "":
+	default:
+		return false, errors.New("formato sconosciuto")
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept)); err == nil && mediaType == "text/csv" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
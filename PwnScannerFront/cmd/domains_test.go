@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"pwnscanner/pkg/auth"
+	"pwnscanner/pkg/database"
+	"reflect"
+	"testing"
+)
+
+func TestDomainSearchStats(t *testing.T) {
+	db := database.NewMemory()
+	db.Add("alice@example.com", "Adobe", "LinkedIn")
+	db.Add("bob@example.com", "Adobe")
+	db.Add("carol@other.org", "Adobe")
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /domains/{domain}/breached-accounts", handleDomainSearch(db))
+	principal := &auth.Principal{KeyID: "k", Owner: "example", Scopes: []auth.Scope{auth.ScopeDomainSearch}, Domains: []string{"example.com"}}
+	search := func(target string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req = req.WithContext(auth.NewContext(req.Context(), principal))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	stats := []database.BreachStat{{Name: "Adobe", Accounts: 2}, {Name: "LinkedIn", Accounts: 1}}
+	for _, tc := range []struct {
+		name   string
+		target string
+		status int
+		want   []database.BreachStat
+	}{
+		{"senza stats", "/domains/example.com/breached-accounts", http.StatusOK, nil},
+		{"stats=false", "/domains/example.com/breached-accounts?stats=false", http.StatusOK, nil},
+		{"stats=true", "/domains/example.com/breached-accounts?stats=true", http.StatusOK, stats},
+		// Il conteggio accompagna solo la prima pagina
+		{"pagina successiva", "/domains/example.com/breached-accounts?stats=true&limit=1&cursor=YWxpY2VAZXhhbXBsZS5jb20", http.StatusOK, nil},
+		{"stats non valido", "/domains/example.com/breached-accounts?stats=forse", http.StatusBadRequest, nil},
+		{"dominio non assegnato", "/domains/other.org/breached-accounts?stats=true", http.StatusForbidden, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := search(tc.target)
+			if rec.Code != tc.status {
+				t.Fatalf("stato = %d, atteso %d (%s)", rec.Code, tc.status, rec.Body)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			var response domainSearchResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("risposta non valida: %v", err)
+			}
+			if !reflect.DeepEqual(response.Breaches, tc.want) {
+				t.Errorf("breaches = %v, atteso %v", response.Breaches, tc.want)
+			}
+		})
+	}
+}
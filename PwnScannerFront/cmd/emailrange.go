@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"pwnscanner/pkg/database"
+	"pwnscanner/pkg/utils"
+	"strings"
+)
+
+// @Summary Cerca un'email con k-anonymity
+// @Description Restituisce le email presenti nei breach il cui hash inizia con il prefisso indicato, con il
+// @Description suffisso dell'hash e i breach di ciascuna, in ordine di hash. L'hash è lo SHA-256 dell'email
+// @Description normalizzata, in esadecimale maiuscolo: il client lo calcola, invia da 5 a 8 cifre iniziali e
+// @Description cerca localmente il resto nella risposta, così il server non riceve mai l'indirizzo
+// @Description (vedi il pacchetto pwnscanner/pkg/client). L'email va normalizzata con le stesse regole del server.
+// @Tags Email
+// @Produce json
+// @Param prefix path string true "Prime 5-8 cifre esadecimali dello SHA-256 dell'email normalizzata"
+// @Success 200 {array} database.EmailHashMatch
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 429 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Failure 501 {object} utils.ErrorResponse
+// @Failure 503 {object} utils.ErrorResponse
+// @Failure 504 {object} utils.ErrorResponse
+// @Router /email-range/{prefix} [get]
+func handleEmailRange(db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reader, ok := db.(database.EmailRangeReader)
+		if !ok {
+			utils.WriteError(w, http.StatusNotImplemented, "Il database configurato non conserva gli hash delle email")
+			return
+		}
+
+		prefix := r.PathValue("prefix")
+		if !database.IsEmailPrefix(prefix) {
+			utils.WriteError(w, http.StatusBadRequest, "Il prefisso deve essere di 5-8 cifre esadecimali")
+			return
+		}
+
+		matches, err := reader.FindEmailRange(r.Context(), strings.ToUpper(prefix))
+		if errors.Is(err, database.ErrHashedEmails) {
+			utils.WriteError(w, http.StatusNotImplemented, "Il database conserva le email come HMAC, senza il loro hash SHA-256")
+			return
+		}
+		if err != nil {
+			writeDatabaseError(w, r, err, "Errore nella ricerca degli hash delle email")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(matches)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"pwnscanner/pkg/client"
+	"pwnscanner/pkg/database"
+	"pwnscanner/pkg/normalize"
+	"reflect"
+	"testing"
+)
+
+// TestEmailRangeClient verifica che pkg/client trovi le email servite da handleEmailRange.
+func TestEmailRangeClient(t *testing.T) {
+	db := database.NewMemory()
+	db.Add("alice@example.com", "Adobe", "LinkedIn")
+	db.Add("bob@example.com", "Adobe")
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /email-range/{prefix}", handleEmailRange(db))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for _, length := range []int{client.MinPrefixLength, client.MaxPrefixLength} {
+		c := client.New(server.URL, normalize.New(normalize.Options{}))
+		c.PrefixLength = length
+		got, err := c.CheckEmails(context.Background(), []string{" Alice@Example.com", "carol@example.com"})
+		if err != nil {
+			t.Fatalf("CheckEmails con prefisso di %d cifre: errore inatteso: %v", length, err)
+		}
+		want := map[string][]string{" Alice@Example.com": {"Adobe", "LinkedIn"}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("CheckEmails con prefisso di %d cifre = %v, atteso %v", length, got, want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"pwnscanner/pkg/checker"
+	"pwnscanner/pkg/database"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// readinessTimeout è il tempo massimo concesso al ping del database da /readyz.
+const readinessTimeout = 2 * time.Second
+
+// health fornisce gli endpoint di liveness e readiness. draining diventa true
+// alla ricezione del segnale di arresto.
+type health struct {
+	db       database.Database
+	checker  *checker.Checker
+	draining atomic.Bool
+}
+
+// databaseCheck è l'esito della verifica del database in /readyz.
+type databaseCheck struct {
+	// Status è "ok" oppure "error"
+	Status string `json:"status"`
+	// LatencyMS è la durata del ping in millisecondi (0 se il database non supporta il ping)
+	LatencyMS float64 `json:"latency_ms"`
+	// Error descrive il fallimento; il dettaglio dell'errore è solo nei log
+	Error string `json:"error,omitempty"`
+}
+
+// readinessResponse è la risposta di /readyz.
+type readinessResponse struct {
+	// Status è "ready", "not_ready" (database non raggiungibile) o "draining" (arresto in corso)
+	Status   string             `json:"status"`
+	Database *databaseCheck     `json:"database,omitempty"`
+	Cache    checker.CacheStats `json:"cache"`
+}
+
+// @Summary Liveness
+// @Description Risponde 200 finché il processo è in grado di servire richieste HTTP, anche durante l'arresto.
+// @Tags Salute
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Router /healthz [get]
+func (h *health) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// @Summary Readiness
+// @Description Verifica che il database risponda (ping) e riporta lo stato della cache del Checker.
+// @Description Risponde 503 se il database non è raggiungibile o se è in corso l'arresto del server.
+// @Tags Salute
+// @Produce json
+// @Success 200 {object} readinessResponse
+// @Failure 503 {object} readinessResponse
+// @Router /readyz [get]
+func (h *health) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	response := readinessResponse{Status: "ready", Cache: h.checker.CacheStats()}
+	status := http.StatusOK
+
+	if h.draining.Load() {
+		response.Status = "draining"
+		status = http.StatusServiceUnavailable
+	} else {
+		check := h.pingDatabase(r.Context())
+		response.Database = &check
+		if check.Status != "ok" {
+			response.Status = "not_ready"
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// pingDatabase verifica il database entro readinessTimeout. I database senza Ping sono sempre pronti.
+func (h *health) pingDatabase(ctx context.Context) databaseCheck {
+	pinger, ok := h.db.(database.Pinger)
+	if !ok {
+		return databaseCheck{Status: "ok"}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+	start := time.Now()
+	err := pinger.Ping(ctx)
+	check := databaseCheck{Status: "ok", LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		log.Warn().Err(err).Msg("Readiness: il database non risponde")
+		check.Status = "error"
+		check.Error = "database non raggiungibile"
+		if errors.Is(err, context.DeadlineExceeded) {
+			check.Error = "il database non ha risposto in tempo"
+		}
+	}
+	return check
+}
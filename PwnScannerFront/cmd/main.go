@@ -3,11 +3,19 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"pwnscanner/pkg/auth"
+	"pwnscanner/pkg/config"
 	"pwnscanner/pkg/database"
-	"strconv"
+	"pwnscanner/pkg/normalize"
+	"pwnscanner/pkg/snapshot"
+	"syscall"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
@@ -22,125 +30,261 @@ import (
 
 var db database.Database
 
+// staticDir è la cartella dei file statici serviti su /
+const staticDir = "./web"
+
 func main() {
-	// Carica la configurazione dalle variabili d'ambiente
-	if err := loadConfig(); err != nil {
-		fmt.Printf("Errore nel caricamento della configurazione: %v\n", err)
+	// Carica la configurazione dal file YAML e dalle variabili d'ambiente
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Errore nel caricamento della configurazione:\n%v\n", err)
 		os.Exit(1)
 	}
 
 	// Configura il logger
-	setupLogger()
+	setupLogger(cfg.Logging)
 	log.Info().Msg("Avvio di PwnScannerFront...")
 
-	// Inizializza il contesto
-	ctx := context.Background()
+	// Il contesto viene annullato alla ricezione di SIGINT o SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// Inizializza il database
-	var err error
-	dbType := os.Getenv("DB_TYPE")
-	if dbType == "" {
-		dbType = "mongodb"
-	}
-
-	switch dbType {
-	case "mongodb":
-		dbHost := os.Getenv("DB_HOST")
-		dbPortStr := os.Getenv("DB_PORT")
-		dbUser := os.Getenv("DB_USERNAME")
-		dbPassword := os.Getenv("DB_PASSWORD")
-		dbName := os.Getenv("DB_NAME")
-
-		if dbHost == "" || dbPortStr == "" || dbUser == "" || dbPassword == "" || dbName == "" {
-			log.Fatal().Msg("Variabili d'ambiente del database mancanti")
-		}
-
-		dbPort, err := strconv.Atoi(dbPortStr)
-		if err != nil {
-			log.Fatal().Err(err).Msg("Porta del database non valida")
-		}
-
-		db, err = database.NewMongoDB(
-			ctx,
-			dbHost,
-			dbPort,
-			dbUser,
-			dbPassword,
-			dbName,
-			"breaches",
-		)
-	default:
-		log.Fatal().Msg("Tipo di database non supportato")
-	}
+	db, err = openDatabase(ctx, cfg.Database)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Errore durante l'inizializzazione del database")
 	}
 	defer db.Close()
 
+	// Verifica la versione dello schema prima di servire le richieste
+	if err := prepareSchema(ctx, db, cfg.Database.AutoMigrate); err != nil {
+		log.Fatal().Err(err).Msg("Errore durante la verifica dello schema del database")
+	}
+
 	// Inizializza il Checker
-	cacheSizeMBStr := os.Getenv("CACHE_SIZE_MB")
-	if cacheSizeMBStr == "" {
-		cacheSizeMBStr = "100" // Valore di default
+	log.Info().Msgf("Inizializzazione del Checker con cache di %d MB...", cfg.Cache.SizeMB)
+	normalizer := normalize.New(normalize.Options{ProviderRules: cfg.Normalization.ProviderRules})
+	c, err := checker.NewChecker(db, normalizer, cfg.Cache.SizeMB, cfg.Cache.TTL())
+	if err != nil {
+		log.Fatal().Err(err).Msg("Errore durante l'inizializzazione del Checker")
 	}
-	cacheSizeMB, err := strconv.Atoi(cacheSizeMBStr)
+	log.Info().Msg("Checker inizializzato con successo.")
+
+	// Configura l'autenticazione con chiavi API
+	authz, err := newAuthorizer(cfg.Auth, db)
 	if err != nil {
-		log.Fatal().Err(err).Msg("Cache size non valida")
+		log.Fatal().Err(err).Msg("Errore nella configurazione dell'autenticazione")
 	}
 
-	log.Info().Msgf("Inizializzazione del Checker con cache di %d MB...", cacheSizeMB)
-	c, err := checker.NewChecker(db, cacheSizeMB)
+	// Configura il rate limiting, applicato dopo l'autenticazione
+	limiter, err := newRateLimiter(ctx, cfg.RateLimit, db)
 	if err != nil {
-		log.Fatal().Err(err).Msg("Errore durante l'inizializzazione del Checker")
+		log.Fatal().Err(err).Msg("Errore nella configurazione del rate limiting")
+	}
+	// La scadenza della richiesta include autenticazione e rate limiting, che possono leggere il database
+	timeouts := cfg.Server.EndpointTimeouts
+	protect := func(scope auth.Scope, timeout time.Duration, handler http.Handler) http.Handler {
+		return withTimeout(timeout, authz.require(scope, limiter.limit(handler)))
 	}
-	log.Info().Msg("Checker inizializzato con successo.")
 
 	// Configura e avvia gli endpoint
+	h := &health{db: db, checker: c}
+	http.HandleFunc("GET /healthz", h.handleHealthz)
+	http.HandleFunc("GET /readyz", h.handleReadyz)
 	http.Handle("/metrics", promhttp.Handler()) // Endpoint Prometheus
-	http.Handle("/check-email", authMiddleware(http.HandlerFunc(handleCheckEmail(c))))
-	http.Handle("/breaches", authMiddleware(http.HandlerFunc(handleGetBreaches(db))))
+	http.Handle("/check-email", protect(auth.ScopeCheck, timeouts.CheckEmail(), handleCheckEmail(c)))
+	http.Handle("POST /check-emails", protect(auth.ScopeBatch, timeouts.CheckEmails(), handleCheckEmails(c, cfg.Batch)))
+	http.Handle("/breaches", protect(auth.ScopeCheck, timeouts.Breaches(), handleGetBreaches(db)))
+	http.Handle("GET /breaches/{name}", protect(auth.ScopeCheck, timeouts.Breaches(), handleGetBreach(db)))
+	http.Handle("GET /stats", protect(auth.ScopeCheck, timeouts.Stats(), handleGetStats(db)))
+	http.Handle("GET /range/{prefix}", protect(auth.ScopeCheck, timeouts.Range(), handlePasswordRange(db)))
+	http.Handle("GET /email-range/{prefix}", protect(auth.ScopeCheck, timeouts.EmailRange(), handleEmailRange(db)))
+	http.Handle("GET /domains/{domain}/breached-accounts", protect(auth.ScopeDomainSearch, timeouts.DomainSearch(), handleDomainSearch(db)))
 	http.Handle("/swagger/", httpSwagger.WrapHandler) // Endpoint Swagger
 
 	// Servire file statici
-	fs := http.FileServer(http.Dir("./web"))
+	fs := http.FileServer(http.Dir(staticDir))
 	http.Handle("/", fs)
 
-	log.Info().Msg("Endpoint REST esposti: /check-email, /breaches, /metrics, /swagger/")
+	log.Info().Msg("Endpoint REST esposti: /check-email, /check-emails, /breaches, /breaches/{name}, /stats, /range/{prefix}, /email-range/{prefix}, /domains/{domain}/breached-accounts, /healthz, /readyz, /metrics, /swagger/")
 	log.Info().Msg("File statici serviti su /")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
+	server := &http.Server{
+		Addr:              cfg.Server.ListenAddr,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout(),
+		ReadTimeout:       cfg.Server.ReadTimeout(),
+		WriteTimeout:      cfg.Server.WriteTimeout(),
+		IdleTimeout:       cfg.Server.IdleTimeout(),
+	}
+	log.Info().Msgf("Server HTTP in ascolto su %s", cfg.Server.ListenAddr)
+	if err := serve(ctx, server, h, cfg.Server); err != nil {
 		log.Fatal().Err(err).Msg("Errore durante l'avvio del server HTTP")
 	}
+	log.Info().Msg("PwnScannerFront arrestato.")
+}
+
+// serve avvia il server e, quando ctx viene annullato dal segnale di arresto, lo spegne in modo ordinato:
+// /readyz inizia a rispondere 503, dopo cfg.ShutdownDrain() il server smette di accettare connessioni
+// e attende le richieste in corso fino a cfg.ShutdownTimeout() (0 = senza limite), poi chiude le connessioni rimaste.
+func serve(ctx context.Context, server *http.Server, h *health, cfg config.ServerConfig) error {
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Info().Msgf("Segnale di arresto ricevuto: /readyz risponde 503, chiusura del server tra %s", cfg.ShutdownDrain())
+	h.draining.Store(true)
+	time.Sleep(cfg.ShutdownDrain())
+
+	shutdownCtx := context.Background()
+	if timeout := cfg.ShutdownTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, timeout)
+		defer cancel()
+	}
+	log.Info().Msg("Attesa del completamento delle richieste in corso...")
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Warn().Err(err).Msg("Richieste ancora in corso allo scadere del tempo di arresto: connessioni chiuse")
+		server.Close()
+	}
+	return nil
 }
 
-// loadConfig carica le variabili d'ambiente
-func loadConfig() error {
-	// In questo caso, non abbiamo nulla da caricare
+// loadConfig carica la configurazione.
+// Il percorso del file si indica con il flag -config o con la variabile CONFIG_PATH;
+// le variabili d'ambiente sovrascrivono le singole chiavi del file.
+func loadConfig() (*config.Config, error) {
+	configPath := flag.String("config", os.Getenv("CONFIG_PATH"), "percorso del file di configurazione YAML")
+	flag.Parse()
+
+	return config.Load(*configPath)
+}
+
+// prepareSchema applica le migrazioni mancanti se migrate è true, altrimenti controlla soltanto
+// che lo schema non sia più recente di quello supportato. I database senza schema versionato sono ignorati.
+func prepareSchema(ctx context.Context, db database.Database, migrate bool) error {
+	migrator, ok := db.(database.Migrator)
+	if !ok {
+		return nil
+	}
+
+	if migrate {
+		applied, err := migrator.Migrate(ctx)
+		for _, m := range applied {
+			log.Info().Msgf("Migrazione %d applicata: %s", m.Version, m.Description)
+		}
+		return err
+	}
+
+	status, err := migrator.SchemaStatus(ctx)
+	if err != nil {
+		return err
+	}
+	if err := status.Check(); err != nil {
+		return err
+	}
+	if len(status.Pending) > 0 {
+		log.Warn().Msgf("Schema del database alla versione %d, %d migrazioni da applicare: eseguire \"./main migrate\" in pwnadmin o abilitare database.auto_migrate",
+			status.Current, len(status.Pending))
+	}
 	return nil
 }
 
+// openDatabase crea l'implementazione del database indicata dalla configurazione.
+func openDatabase(ctx context.Context, cfg config.DatabaseConfig) (database.Database, error) {
+	switch cfg.Type {
+	case "mongodb":
+		db, err := database.NewMongoDB(
+			ctx,
+			cfg.Host,
+			cfg.Port,
+			cfg.Username,
+			cfg.Password,
+			cfg.DatabaseName,
+			cfg.Collection,
+		)
+		if err != nil || cfg.EmailHMACKeys == "" {
+			return db, err
+		}
+		// Le chiavi sono già state validate con la configurazione
+		keys, err := database.ParseEmailKeys(cfg.EmailHMACKeys)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		keys.DualRead = cfg.EmailHMACDualRead
+		db.(*database.MongoDB).SetEmailKeys(keys)
+		log.Info().Msgf("Email cercate come HMAC con la chiave %s (lettura doppia: %t)", keys.Current(), keys.DualRead)
+		return db, nil
+	case "postgres":
+		return database.NewPostgres(ctx, database.PostgresURL(
+			cfg.Host,
+			cfg.Port,
+			cfg.Username,
+			cfg.Password,
+			cfg.DatabaseName,
+			cfg.SSLMode,
+		))
+	case "memory":
+		if cfg.FixturePath == "" {
+			log.Warn().Msg("Database in memoria avviato senza fixture: nessuna email presente")
+			return database.NewMemory(), nil
+		}
+		log.Info().Msgf("Caricamento della fixture %s nel database in memoria...", cfg.FixturePath)
+		return database.NewMemoryFromFile(cfg.FixturePath)
+	case "embedded":
+		return database.NewBolt(cfg.EmbeddedPath, true)
+	case "snapshot":
+		s, err := database.NewSnapshot(cfg.SnapshotPath, cfg.SnapshotReloadInterval(), func(info snapshot.Info, err error) {
+			if err != nil {
+				log.Error().Err(err).Msg("Nuovo snapshot non valido: resta in uso quello precedente")
+				return
+			}
+			log.Info().Msgf("Snapshot ricaricato: %s", info)
+		})
+		if err != nil {
+			return nil, err
+		}
+		log.Info().Msgf("Snapshot caricato: %s", s.Info())
+		return s, nil
+	default:
+		return nil, fmt.Errorf("tipo di database non supportato: %s", cfg.Type)
+	}
+}
+
 // setupLogger configura il logger globale
-func setupLogger() {
+func setupLogger(cfg config.LoggingConfig) {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
-	levelStr := os.Getenv("LOG_LEVEL")
-	if levelStr == "" {
-		levelStr = "info" // Livello di default
-	}
-	logLevel, err := zerolog.ParseLevel(levelStr)
+	logLevel, err := zerolog.ParseLevel(cfg.Level)
 	if err != nil {
 		logLevel = zerolog.InfoLevel
 	}
 	log.Logger = zerolog.New(os.Stdout).Level(logLevel).With().Timestamp().Logger()
+	// zerolog.Ctx usa il logger globale per le richieste che non ne hanno uno proprio
+	zerolog.DefaultContextLogger = &log.Logger
 }
 
 // @Summary Verifica un'email nei breach
-// @Description Cerca se un'email è presente in uno o più breach
+// @Description Cerca se un'email è presente in uno o più breach. Se il database le conserva, data_classes
+// @Description indica per ogni breach le classi di dati esposte (password, password_hash:<algoritmo>, username, phone, ip_address, name), mai i valori
 // @Tags Email
 // @Accept json
 // @Produce json
 // @Param email body string true "Email da verificare"
 // @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
 // @Failure 404 {object} utils.ErrorResponse
+// @Failure 429 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
+// @Failure 503 {object} utils.ErrorResponse
+// @Failure 504 {object} utils.ErrorResponse
 // @Router /check-email [post]
 func handleCheckEmail(c *checker.Checker) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -157,9 +301,13 @@ func handleCheckEmail(c *checker.Checker) http.HandlerFunc {
 			return
 		}
 
-		breaches, err := c.FindEmailInBreaches(context.Background(), req.Email)
+		breaches, err := c.FindEmailInBreaches(r.Context(), req.Email)
+		if errors.Is(err, normalize.ErrInvalid) {
+			utils.WriteError(w, http.StatusBadRequest, "Email non valida")
+			return
+		}
 		if err != nil {
-			utils.WriteError(w, http.StatusInternalServerError, "Errore interno del server")
+			writeDatabaseError(w, r, err, "Errore interno del server")
 			return
 		}
 
@@ -168,51 +316,22 @@ func handleCheckEmail(c *checker.Checker) http.HandlerFunc {
 			return
 		}
 
+		dataClasses, err := c.FindDataClasses(r.Context(), req.Email)
+		if err != nil {
+			writeDatabaseError(w, r, err, "Errore interno del server")
+			return
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(struct {
 			Email    string   `json:"email"`
 			Breaches []string `json:"breaches"`
+			// DataClasses contiene, per i breach in cui sono registrate, le classi di dati esposte
+			DataClasses map[string][]string `json:"data_classes,omitempty"`
 		}{
-			Email:    req.Email,
-			Breaches: breaches,
+			Email:       req.Email,
+			Breaches:    breaches,
+			DataClasses: dataClasses,
 		})
 	}
 }
-
-// @Summary Ottiene tutti i breach disponibili
-// @Description Restituisce un elenco di tutti i breach registrati nel sistema
-// @Tags Breach
-// @Accept json
-// @Produce json
-// @Success 200 {array} string
-// @Failure 500 {object} utils.ErrorResponse
-// @Router /breaches [get]
-func handleGetBreaches(db database.Database) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			utils.WriteError(w, http.StatusMethodNotAllowed, "Metodo non supportato")
-			return
-		}
-
-		breaches, err := db.GetAllBreaches(context.Background())
-		if err != nil {
-			utils.WriteError(w, http.StatusInternalServerError, "Errore nel recupero dei breach")
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(breaches)
-	}
-}
-
-// authMiddleware protegge gli endpoint con autenticazione basata su token
-func authMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token := r.Header.Get("Authorization")
-		if token != "Bearer YOUR_SECRET_TOKEN" {
-			utils.WriteError(w, http.StatusUnauthorized, "Accesso non autorizzato")
-			return
-		}
-		next.ServeHTTP(w, r)
-	})
-}
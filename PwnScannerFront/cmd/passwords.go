@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"math/rand/v2"
+	"net/http"
+	"pwnscanner/pkg/database"
+	"pwnscanner/pkg/utils"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Numero di righe, minimo e massimo, delle risposte di /range/{prefix} con il padding: il numero esatto
+// è casuale, così la dimensione della risposta non rivela quanti hash condividono il prefisso.
+const (
+	minRangePadding = 800
+	maxRangePadding = 1000
+)
+
+// @Summary Cerca una password con k-anonymity
+// @Description Restituisce i suffissi degli hash SHA-1 delle password comparse nei breach che iniziano con
+// @Description il prefisso indicato, una riga "SUFFISSO:OCCORRENZE" per hash, in ordine alfabetico.
+// @Description Il client calcola lo SHA-1 della password, invia le prime 5 cifre esadecimali e cerca
+// @Description localmente le restanti 35 nella risposta: il server non riceve mai l'hash completo.
+// @Description Con l'header "Add-Padding: true" la risposta viene completata con suffissi fittizi con
+// @Description 0 occorrenze, fino a un numero casuale di righe tra 800 e 1000, che il client deve ignorare.
+// @Tags Password
+// @Produce plain
+// @Param prefix path string true "Prime 5 cifre esadecimali dello SHA-1 della password"
+// @Param Add-Padding header bool false "Completa la risposta con suffissi fittizi"
+// @Success 200 {string} string "SUFFISSO:OCCORRENZE, una riga per hash"
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 429 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Failure 501 {object} utils.ErrorResponse
+// @Failure 503 {object} utils.ErrorResponse
+// @Failure 504 {object} utils.ErrorResponse
+// @Router /range/{prefix} [get]
+func handlePasswordRange(db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reader, ok := db.(database.PasswordRangeReader)
+		if !ok {
+			utils.WriteError(w, http.StatusNotImplemented, "Il database configurato non conserva gli hash delle password")
+			return
+		}
+
+		prefix := r.PathValue("prefix")
+		if !database.IsPasswordPrefix(prefix) {
+			utils.WriteError(w, http.StatusBadRequest, "Il prefisso deve essere di 5 cifre esadecimali")
+			return
+		}
+
+		hashes, err := reader.PasswordRange(r.Context(), strings.ToUpper(prefix))
+		if err != nil {
+			writeDatabaseError(w, r, err, "Errore nella ricerca degli hash delle password")
+			return
+		}
+		if strings.EqualFold(r.Header.Get("Add-Padding"), "true") {
+			hashes = padPasswordRange(hashes)
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		// La risposta dipende da Add-Padding: le cache non devono restituirla a chi non l'ha chiesto
+		w.Header().Set("Vary", "Add-Padding")
+		out := bufio.NewWriter(w)
+		for _, hash := range hashes {
+			out.WriteString(hash.Suffix)
+			out.WriteByte(':')
+			out.WriteString(strconv.FormatInt(hash.Count, 10))
+			out.WriteString("\r\n")
+		}
+		out.Flush()
+	}
+}
+
+// padPasswordRange aggiunge agli hash suffissi casuali con 0 occorrenze, fino a un numero di righe
+// casuale tra minRangePadding e maxRangePadding, e restituisce il risultato in ordine alfabetico.
+// Le risposte con più righe restano invariate.
+func padPasswordRange(hashes []database.PasswordHash) []database.PasswordHash {
+	target := minRangePadding + rand.IntN(maxRangePadding-minRangePadding+1)
+	if len(hashes) >= target {
+		return hashes
+	}
+
+	seen := make(map[string]bool, target)
+	for _, hash := range hashes {
+		seen[hash.Suffix] = true
+	}
+	buf := make([]byte, (database.PasswordHashLength-database.PasswordPrefixLength+1)/2)
+	for len(hashes) < target {
+		for i := range buf {
+			buf[i] = byte(rand.Uint32())
+		}
+		suffix := strings.ToUpper(hex.EncodeToString(buf))[:database.PasswordHashLength-database.PasswordPrefixLength]
+		if seen[suffix] {
+			continue
+		}
+		seen[suffix] = true
+		hashes = append(hashes, database.PasswordHash{Suffix: suffix})
+	}
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i].Suffix < hashes[j].Suffix })
+	return hashes
+}
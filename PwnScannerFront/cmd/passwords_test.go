@@ -0,0 +1,70 @@
+package main
+
+import (
+	"pwnscanner/pkg/database"
+	"sort"
+	"testing"
+)
+
+func TestPadPasswordRange(t *testing.T) {
+	suffixLength := database.PasswordHashLength - database.PasswordPrefixLength
+	known := []database.PasswordHash{
+		{Suffix: "1E4C9B93F3F0682250B6CF8331B7EE68FD8", Count: 5},
+		{Suffix: "0000000000000000000000000000000000F", Count: 1},
+	}
+	many := make([]database.PasswordHash, maxRangePadding+1)
+	for i := range many {
+		many[i] = database.PasswordHash{Suffix: "suffisso", Count: int64(i + 1)}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		hashes []database.PasswordHash
+	}{
+		{"vuoto", nil},
+		{"pochi hash", known},
+		{"oltre il massimo", many},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			input := append([]database.PasswordHash(nil), tc.hashes...)
+			got := padPasswordRange(input)
+
+			if len(tc.hashes) >= maxRangePadding {
+				if len(got) != len(tc.hashes) {
+					t.Fatalf("righe = %d, la risposta doveva restare invariata (%d)", len(got), len(tc.hashes))
+				}
+				return
+			}
+			if len(got) < minRangePadding || len(got) > maxRangePadding {
+				t.Fatalf("righe = %d, attese tra %d e %d", len(got), minRangePadding, maxRangePadding)
+			}
+			if !sort.SliceIsSorted(got, func(i, j int) bool { return got[i].Suffix < got[j].Suffix }) {
+				t.Error("gli hash non sono in ordine alfabetico")
+			}
+
+			seen := make(map[string]bool, len(got))
+			var padding int
+			for _, hash := range got {
+				if seen[hash.Suffix] {
+					t.Errorf("suffisso %s ripetuto", hash.Suffix)
+				}
+				seen[hash.Suffix] = true
+				if hash.Count != 0 {
+					continue
+				}
+				padding++
+				if len(hash.Suffix) != suffixLength || !database.IsPasswordHash(hash.Suffix+"00000") {
+					t.Errorf("suffisso di riempimento %q non valido", hash.Suffix)
+				}
+			}
+			if padding != len(got)-len(tc.hashes) {
+				t.Errorf("righe di riempimento = %d, attese %d", padding, len(got)-len(tc.hashes))
+			}
+			for _, hash := range tc.hashes {
+				if !seen[hash.Suffix] {
+					t.Errorf("l'hash %s è stato perso", hash.Suffix)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"pwnscanner/pkg/auth"
+	"pwnscanner/pkg/config"
+	"pwnscanner/pkg/database"
+	"pwnscanner/pkg/ratelimit"
+	"pwnscanner/pkg/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// rateLimitPruneInterval è l'intervallo di eliminazione dei bucket tornati pieni.
+const rateLimitPruneInterval = time.Minute
+
+// rateLimiter applica il rate limiting agli endpoint, dopo l'autenticazione.
+type rateLimiter struct {
+	limiter           *ratelimit.Limiter // nil se il rate limiting è disattivato
+	trustForwardedFor bool
+}
+
+// newRateLimiter prepara il rate limiting secondo la configurazione e avvia l'eliminazione
+// periodica dei bucket inutilizzati, che termina con ctx.
+func newRateLimiter(ctx context.Context, cfg config.RateLimitConfig, db database.Database) (*rateLimiter, error) {
+	if !cfg.Enabled {
+		log.Warn().Msg("Rate limiting disattivato (rate_limit.enabled = false)")
+		return &rateLimiter{}, nil
+	}
+
+	var store database.RateLimitStore
+	switch cfg.Store {
+	case "memory":
+		store = ratelimit.NewMemoryStore()
+	case "database":
+		var ok bool
+		if store, ok = db.(database.RateLimitStore); !ok {
+			return nil, fmt.Errorf("il database configurato non può conservare i bucket del rate limiting")
+		}
+	default:
+		return nil, fmt.Errorf("store del rate limiting non supportato: %s", cfg.Store)
+	}
+
+	tiers := make(map[string]database.TokenBucket, len(cfg.Tiers))
+	for name, tier := range cfg.Tiers {
+		tiers[name] = database.TokenBucket{Rate: tier.RequestsPerMinute / 60, Burst: float64(tier.Burst)}
+	}
+
+	limiter := ratelimit.New(store, tiers)
+	limiter.StartPruning(ctx, rateLimitPruneInterval, func(pruned int64, err error) {
+		if err != nil {
+			log.Error().Err(err).Msg("Errore durante l'eliminazione dei bucket del rate limiting")
+			return
+		}
+		log.Debug().Msgf("Eliminati %d bucket del rate limiting", pruned)
+	})
+	log.Info().Msgf("Rate limiting attivo con %d profili (store: %s)", len(tiers), cfg.Store)
+	return &rateLimiter{limiter: limiter, trustForwardedFor: cfg.TrustForwardedFor}, nil
+}
+
+// limit protegge l'handler con il bucket della chiave API della richiesta, o con quello dell'IP
+// del client per le richieste anonime. Va applicato dopo authorizer.require, che fornisce il principal.
+// Oltre il limite risponde 429 con Retry-After; ogni risposta riporta gli header X-RateLimit-*.
+func (l *rateLimiter) limit(next http.Handler) http.Handler {
+	if l.limiter == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, tier := "ip:"+clientIP(r, l.trustForwardedFor), ratelimit.AnonymousTier
+		if p := auth.FromContext(r.Context()); p != nil && !p.IsAnonymous() {
+			key, tier = "key:"+p.KeyID, p.Tier
+			if tier == "" {
+				tier = ratelimit.DefaultTier
+			}
+		}
+
+		result, err := l.limiter.Take(r.Context(), key, tier)
+		if err != nil {
+			// Un guasto dello store non deve rendere il servizio indisponibile: la richiesta è ammessa
+			zerolog.Ctx(r.Context()).Error().Err(err).Msg("Errore del rate limiter: richiesta ammessa senza limite")
+		}
+
+		header := w.Header()
+		header.Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+		header.Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		header.Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+		if !result.Allowed {
+			retryAfter := max(ceilSeconds(result.RetryAfter), 1)
+			header.Set("Retry-After", strconv.Itoa(retryAfter))
+			zerolog.Ctx(r.Context()).Debug().Str("bucket", key).Str("path", r.URL.Path).Msg("Richiesta rifiutata dal rate limiter")
+			utils.WriteError(w, http.StatusTooManyRequests, fmt.Sprintf("Troppe richieste: riprovare tra %d secondi", retryAfter))
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(ratelimit.NewContext(r.Context(), l.limiter, key, tier)))
+	})
+}
+
+// ceilSeconds arrotonda la durata al secondo superiore.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// clientIP restituisce l'indirizzo del client usato per il bucket delle richieste anonime.
+// Con trustForwardedFor viene preso l'ultimo indirizzo di X-Forwarded-For, cioè quello aggiunto dal proxy.
+// Gli indirizzi IPv6 sono raggruppati per /64, la rete assegnata di solito a un singolo cliente.
+func clientIP(r *http.Request, trustForwardedFor bool) string {
+	host := r.RemoteAddr
+	if h, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		host = h
+	}
+	if trustForwardedFor {
+		if hops := strings.Split(r.Header.Get("X-Forwarded-For"), ","); len(hops) > 0 {
+			if last := strings.TrimSpace(hops[len(hops)-1]); last != "" {
+				host = last
+			}
+		}
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	addr = addr.Unmap()
+	if addr.Is6() {
+		prefix, _ := addr.Prefix(64)
+		return prefix.String()
+	}
+	return addr.String()
+}
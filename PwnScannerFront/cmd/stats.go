@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"pwnscanner/pkg/database"
+	"pwnscanner/pkg/utils"
+	"strconv"
+)
+
+// Numero di domini restituiti da /stats, predefinito e massimo
+const (
+	defaultStatsDomains = 10
+	maxStatsDomains     = 1000
+)
+
+// statsResponse è la risposta di /stats.
+type statsResponse struct {
+	database.Stats
+	// TopDomains sono i domini con più email, dal più numeroso
+	TopDomains []database.DomainStat `json:"top_domains"`
+}
+
+// @Summary Statistiche del database
+// @Description Restituisce i contatori globali (email distinte, associazioni email-breach, breach)
+// @Description e i domini con più email. I contatori sono materializzati: la risposta non scorre le email.
+// @Tags Statistiche
+// @Accept json
+// @Produce json
+// @Param domains query int false "Numero di domini da restituire (predefinito 10, massimo 1000)"
+// @Success 200 {object} statsResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 429 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Failure 501 {object} utils.ErrorResponse
+// @Failure 503 {object} utils.ErrorResponse
+// @Failure 504 {object} utils.ErrorResponse
+// @Router /stats [get]
+func handleGetStats(db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reader, ok := db.(database.StatsReader)
+		if !ok {
+			utils.WriteError(w, http.StatusNotImplemented, "Il database configurato non fornisce statistiche")
+			return
+		}
+
+		limit := defaultStatsDomains
+		if value := r.URL.Query().Get("domains"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 || n > maxStatsDomains {
+				utils.WriteError(w, http.StatusBadRequest, "Parametro domains non valido")
+				return
+			}
+			limit = n
+		}
+
+		global, err := reader.GlobalStats(r.Context())
+		if err != nil {
+			writeDatabaseError(w, r, err, "Errore nel recupero delle statistiche")
+			return
+		}
+		domains, err := reader.TopDomains(r.Context(), limit)
+		if err != nil {
+			writeDatabaseError(w, r, err, "Errore nel recupero delle statistiche")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(statsResponse{Stats: global, TopDomains: domains})
+	}
+}
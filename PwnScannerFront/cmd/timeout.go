@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"pwnscanner/pkg/database"
+	"pwnscanner/pkg/utils"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// writeGrace è il tempo concesso oltre la scadenza della richiesta per scrivere la risposta di errore.
+const writeGrace = 5 * time.Second
+
+// unavailableRetryAfter è il valore di Retry-After delle risposte 503, in secondi.
+const unavailableRetryAfter = 5
+
+// withTimeout applica la scadenza timeout all'intera richiesta (autenticazione, rate limiting e handler):
+// allo scadere il contesto viene annullato e le operazioni sul database si interrompono.
+// La scadenza di scrittura del server viene sostituita da quella della richiesta, più writeGrace;
+// con timeout <= 0 la richiesta non ha scadenza e nemmeno la scrittura.
+func withTimeout(timeout time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var writeDeadline time.Time
+		if timeout > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+			writeDeadline = time.Now().Add(timeout + writeGrace)
+		}
+		if err := http.NewResponseController(w).SetWriteDeadline(writeDeadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			zerolog.Ctx(r.Context()).Debug().Err(err).Msg("Impossibile impostare la scadenza di scrittura della risposta")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeDatabaseError risponde a un errore del database: 504 se la richiesta è scaduta, 503 se il database
+// non è raggiungibile e 500 con il messaggio indicato negli altri casi. Se il client si è disconnesso
+// non scrive nulla.
+func writeDatabaseError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	logger := zerolog.Ctx(r.Context())
+	switch {
+	case errors.Is(err, context.Canceled) && r.Context().Err() != nil:
+		logger.Debug().Str("path", r.URL.Path).Msg("Richiesta interrotta dal client")
+	case errors.Is(err, context.DeadlineExceeded):
+		logger.Warn().Err(err).Str("path", r.URL.Path).Msg("Richiesta scaduta in attesa del database")
+		utils.WriteError(w, http.StatusGatewayTimeout, "Il database non ha risposto in tempo")
+	case errors.Is(err, database.ErrUnavailable):
+		logger.Error().Err(err).Str("path", r.URL.Path).Msg("Database non disponibile")
+		w.Header().Set("Retry-After", strconv.Itoa(unavailableRetryAfter))
+		utils.WriteError(w, http.StatusServiceUnavailable, "Database temporaneamente non disponibile")
+	default:
+		logger.Error().Err(err).Str("path", r.URL.Path).Msg(message)
+		utils.WriteError(w, http.StatusInternalServerError, message)
+	}
+}
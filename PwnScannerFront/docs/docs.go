@@ -17,7 +17,7 @@ const docTemplate = `{
     "paths": {
         "/breaches": {
             "get": {
-                "description": "Restituisce un elenco di tutti i breach registrati nel sistema",
+                "description": "Restituisce tutti i breach registrati nel sistema, in ordine alfabetico, con i metadati del catalogo\ne il numero di email presenti. I breach senza una voce nel catalogo contengono solo il nome\n(e il logo predefinito, se esiste).",
                 "consumes": [
                     "application/json"
                 ],
@@ -34,22 +34,126 @@ const docTemplate = `{
                         "schema": {
                             "type": "array",
                             "items": {
-                                "type": "string"
+                                "$ref": "#/definitions/main.breachResponse"
                             }
                         }
                     },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/breaches/{name}": {
+            "get": {
+                "description": "Restituisce i metadati del breach indicato. Un breach presente nel database ma non ancora\ndescritto nel catalogo viene restituito con il solo nome.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Breach"
+                ],
+                "summary": "Ottiene i dettagli di un breach",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Nome del breach",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.breachResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/utils.ErrorResponse"
                         }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
                     }
                 }
             }
         },
         "/check-email": {
             "post": {
-                "description": "Cerca se un'email è presente in uno o più breach",
+                "description": "Cerca se un'email è presente in uno o più breach. Se il database le conserva, data_classes\nindica per ogni breach le classi di dati esposte (password, password_hash:\u003calgoritmo\u003e, username, phone, ip_address, name), mai i valori",
                 "consumes": [
                     "application/json"
                 ],
@@ -85,23 +189,767 @@ const docTemplate = `{
                             "$ref": "#/definitions/utils.ErrorResponse"
                         }
                     },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
                     "404": {
                         "description": "Not Found",
                         "schema": {
                             "$ref": "#/definitions/utils.ErrorResponse"
                         }
                     },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/utils.ErrorResponse"
                         }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
+        },
+        "/check-emails": {
+            "post": {
+                "description": "Verifica fino a batch.max_emails email (o al limite della chiave API) in una sola richiesta. Il corpo può essere\nun array JSON di stringhe (application/json), una email per riga in NDJSON\n(application/x-ndjson, come stringa JSON o come {\"email\": \"...\"}) oppure un CSV\n(text/csv, email nella prima colonna, intestazione \"email\" facoltativa).\nLa risposta è NDJSON, una riga per email nell'ordine della richiesta, scritta appena disponibile;\nle email non trovate hanno found=false e quelle non valide o non verificate (ad esempio\nperché la richiesta è scaduta) un campo error.\nOgni email consuma un gettone del rate limiting.",
+                "consumes": [
+                    "application/json",
+                    "text/csv",
+                    "application/x-ndjson"
+                ],
+                "produces": [
+                    "application/x-ndjson"
+                ],
+                "tags": [
+                    "Email"
+                ],
+                "summary": "Verifica più email nei breach",
+                "parameters": [
+                    {
+                        "description": "Email da verificare",
+                        "name": "emails",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Una riga per ogni email",
+                        "schema": {
+                            "$ref": "#/definitions/main.batchResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/domains/{domain}/breached-accounts": {
+            "get": {
+                "description": "Restituisce, in ordine di email, le email del dominio presenti nei breach con i breach di\nciascuna. Richiede il permesso domain_search e una chiave API a cui è stato assegnato il dominio,\ndopo la verifica del possesso (le chiavi admin possono cercare qualsiasi dominio).\nLe email sono divise in pagine: il campo next_cursor (o l'header X-Next-Cursor) va passato\ncome parametro cursor per ottenere la pagina successiva. Con stats=true la prima pagina in JSON\ncontiene anche il numero di email del dominio in ogni breach, che richiede di scorrere tutte\nle email del dominio. Con format=csv, o con \"Accept: text/csv\", la risposta è un CSV con le\ncolonne email e breaches (separati da ';').",
+                "produces": [
+                    "application/json",
+                    "text/csv"
+                ],
+                "tags": [
+                    "Domini"
+                ],
+                "summary": "Cerca le email di un dominio nei breach",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Dominio da cercare",
+                        "name": "domain",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursore restituito dalla pagina precedente",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Email per pagina (predefinito 1000, massimo 10000)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "json",
+                            "csv"
+                        ],
+                        "type": "string",
+                        "description": "Formato della risposta",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Aggiunge alla prima pagina in JSON il numero di email del dominio in ogni breach",
+                        "name": "stats",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.domainSearchResponse"
+                        },
+                        "headers": {
+                            "X-Next-Cursor": {
+                                "type": "string",
+                                "description": "Cursore della pagina successiva, assente nell'ultima pagina"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "501": {
+                        "description": "Not Implemented",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/email-range/{prefix}": {
+            "get": {
+                "description": "Restituisce le email presenti nei breach il cui hash inizia con il prefisso indicato, con il\nsuffisso dell'hash e i breach di ciascuna, in ordine di hash. L'hash è lo SHA-256 dell'email\nnormalizzata, in esadecimale maiuscolo: il client lo calcola, invia da 5 a 8 cifre iniziali e\ncerca localmente il resto nella risposta, così il server non riceve mai l'indirizzo\n(vedi il pacchetto pwnscanner/pkg/client). L'email va normalizzata con le stesse regole del server.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Email"
+                ],
+                "summary": "Cerca un'email con k-anonymity",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Prime 5-8 cifre esadecimali dello SHA-256 dell'email normalizzata",
+                        "name": "prefix",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/database.EmailHashMatch"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "501": {
+                        "description": "Not Implemented",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/healthz": {
+            "get": {
+                "description": "Risponde 200 finché il processo è in grado di servire richieste HTTP, anche durante l'arresto.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Salute"
+                ],
+                "summary": "Liveness",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/range/{prefix}": {
+            "get": {
+                "description": "Restituisce i suffissi degli hash SHA-1 delle password comparse nei breach che iniziano con\nil prefisso indicato, una riga \"SUFFISSO:OCCORRENZE\" per hash, in ordine alfabetico.\nIl client calcola lo SHA-1 della password, invia le prime 5 cifre esadecimali e cerca\nlocalmente le restanti 35 nella risposta: il server non riceve mai l'hash completo.\nCon l'header \"Add-Padding: true\" la risposta viene completata con suffissi fittizi con\n0 occorrenze, fino a un numero casuale di righe tra 800 e 1000, che il client deve ignorare.",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Password"
+                ],
+                "summary": "Cerca una password con k-anonymity",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Prime 5 cifre esadecimali dello SHA-1 della password",
+                        "name": "prefix",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Completa la risposta con suffissi fittizi",
+                        "name": "Add-Padding",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "SUFFISSO:OCCORRENZE, una riga per hash",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "501": {
+                        "description": "Not Implemented",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/readyz": {
+            "get": {
+                "description": "Verifica che il database risponda (ping) e riporta lo stato della cache del Checker.\nRisponde 503 se il database non è raggiungibile o se è in corso l'arresto del server.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Salute"
+                ],
+                "summary": "Readiness",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.readinessResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.readinessResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/stats": {
+            "get": {
+                "description": "Restituisce i contatori globali (email distinte, associazioni email-breach, breach)\ne i domini con più email. I contatori sono materializzati: la risposta non scorre le email.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Statistiche"
+                ],
+                "summary": "Statistiche del database",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Numero di domini da restituire (predefinito 10, massimo 1000)",
+                        "name": "domains",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.statsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "501": {
+                        "description": "Not Implemented",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "checker.CacheStats": {
+            "type": "object",
+            "properties": {
+                "capacity": {
+                    "description": "Capacity è il numero massimo di email in cache",
+                    "type": "integer"
+                },
+                "entries": {
+                    "description": "Entries è il numero di email attualmente in cache",
+                    "type": "integer"
+                },
+                "ttl_seconds": {
+                    "description": "TTLSeconds è la durata di validità delle voci (0 = nessuna scadenza)",
+                    "type": "integer"
+                }
+            }
+        },
+        "database.BreachStat": {
+            "type": "object",
+            "properties": {
+                "accounts": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "database.DomainStat": {
+            "type": "object",
+            "properties": {
+                "accounts": {
+                    "type": "integer"
+                },
+                "domain": {
+                    "type": "string"
+                }
+            }
+        },
+        "database.EmailHashMatch": {
+            "type": "object",
+            "properties": {
+                "breaches": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "suffix": {
+                    "type": "string"
+                }
+            }
+        },
+        "database.Record": {
+            "type": "object",
+            "properties": {
+                "breaches": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "email": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.batchResult": {
+            "type": "object",
+            "properties": {
+                "breaches": {
+                    "description": "Breaches sono i breach dell'email in ordine alfabetico (vuoto se non trovata)",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "email": {
+                    "description": "Email è l'email così come è stata inviata",
+                    "type": "string"
+                },
+                "error": {
+                    "description": "Error è valorizzato se l'email non è stata verificata (ad esempio perché non valida)",
+                    "type": "string"
+                },
+                "found": {
+                    "description": "Found indica se l'email compare in almeno un breach",
+                    "type": "boolean"
+                }
+            }
+        },
+        "main.breachResponse": {
+            "type": "object",
+            "properties": {
+                "accounts": {
+                    "description": "Accounts è il numero di email del breach presenti nel database (dalle statistiche)",
+                    "type": "integer"
+                },
+                "added_date": {
+                    "type": "string"
+                },
+                "breach_date": {
+                    "description": "AAAA-MM-GG",
+                    "type": "string"
+                },
+                "data_classes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "description": {
+                    "type": "string"
+                },
+                "domain": {
+                    "type": "string"
+                },
+                "is_sensitive": {
+                    "type": "boolean"
+                },
+                "is_verified": {
+                    "type": "boolean"
+                },
+                "logo_path": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "pwn_count": {
+                    "type": "integer"
+                },
+                "title": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.databaseCheck": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "description": "Error descrive il fallimento; il dettaglio dell'errore è solo nei log",
+                    "type": "string"
+                },
+                "latency_ms": {
+                    "description": "LatencyMS è la durata del ping in millisecondi (0 se il database non supporta il ping)",
+                    "type": "number"
+                },
+                "status": {
+                    "description": "Status è \"ok\" oppure \"error\"",
+                    "type": "string"
+                }
+            }
+        },
+        "main.domainSearchResponse": {
+            "type": "object",
+            "properties": {
+                "accounts": {
+                    "description": "Accounts sono le email della pagina con i loro breach, in ordine di email",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/database.Record"
+                    }
+                },
+                "breaches": {
+                    "description": "Breaches è il numero di email del dominio in ogni breach, solo nella prima pagina e con stats=true",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/database.BreachStat"
+                    }
+                },
+                "domain": {
+                    "description": "Domain è il dominio cercato, in forma canonica",
+                    "type": "string"
+                },
+                "next_cursor": {
+                    "description": "NextCursor è il cursore della pagina successiva; assente nell'ultima pagina",
+                    "type": "string"
+                }
+            }
+        },
+        "main.readinessResponse": {
+            "type": "object",
+            "properties": {
+                "cache": {
+                    "$ref": "#/definitions/checker.CacheStats"
+                },
+                "database": {
+                    "$ref": "#/definitions/main.databaseCheck"
+                },
+                "status": {
+                    "description": "Status è \"ready\", \"not_ready\" (database non raggiungibile) o \"draining\" (arresto in corso)",
+                    "type": "string"
+                }
+            }
+        },
+        "main.statsResponse": {
+            "type": "object",
+            "properties": {
+                "associations": {
+                    "description": "Associations è il numero di coppie email-breach (un'email in tre breach conta tre volte)",
+                    "type": "integer"
+                },
+                "breaches": {
+                    "description": "Breaches è il numero di breach con almeno un'email",
+                    "type": "integer"
+                },
+                "emails": {
+                    "description": "Emails è il numero di email distinte presenti",
+                    "type": "integer"
+                },
+                "reconciled_at": {
+                    "description": "ReconciledAt è l'ultima ricostruzione completa dei contatori; zero se non è mai stata eseguita,\nnel qual caso i contatori non includono i dati caricati prima della loro introduzione",
+                    "type": "string"
+                },
+                "top_domains": {
+                    "description": "TopDomains sono i domini con più email, dal più numeroso",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/database.DomainStat"
+                    }
+                }
+            }
+        },
         "utils.ErrorResponse": {
             "type": "object",
             "properties": {
@@ -0,0 +1,185 @@
+// Package auth gestisce le chiavi API dei client di PwnScannerFront: generazione (in pwnadmin),
+// verifica delle chiavi presentate e principal associato alla richiesta.
+//
+// Una chiave ha la forma "pws_<id>_<segreto>". L'identificativo è pubblico e serve a cercarla nel database;
+// del segreto viene memorizzato solo lo SHA-256, sufficiente perché il segreto è casuale a 256 bit.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"pwnscanner/pkg/database"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Scope è un permesso di una chiave API.
+type Scope string
+
+// Permessi disponibili. ScopeAdmin include tutti gli altri.
+const (
+	ScopeCheck        Scope = "check"         // verifica di una singola email e consultazione dei breach
+	ScopeBatch        Scope = "batch"         // verifica di più email per richiesta (/check-emails)
+	ScopeDomainSearch Scope = "domain_search" // ricerca delle email di un dominio
+	ScopeAdmin        Scope = "admin"         // tutti i permessi
+)
+
+// Scopes elenca tutti i permessi, nell'ordine in cui vengono mostrati.
+var Scopes = []Scope{ScopeCheck, ScopeBatch, ScopeDomainSearch, ScopeAdmin}
+
+// keyPrefix è il prefisso di tutte le chiavi, utile per riconoscerle (ad esempio nei secret scanner).
+const keyPrefix = "pws_"
+
+// Errori restituiti dalla verifica di una chiave.
+var (
+	ErrInvalidKey = errors.New("chiave API non valida")
+	ErrExpiredKey = errors.New("chiave API scaduta")
+	ErrRevokedKey = errors.New("chiave API revocata")
+)
+
+// ParseScopes interpreta un elenco di permessi separati da virgole, ignorando spazi e duplicati.
+func ParseScopes(value string) ([]Scope, error) {
+	var scopes []Scope
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		scope := Scope(name)
+		if !slices.Contains(Scopes, scope) {
+			return nil, fmt.Errorf("permesso sconosciuto %q", name)
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+// NewKey genera una nuova chiave API. Restituisce la chiave in chiaro, da mostrare una sola volta,
+// e il record da salvare, che ne contiene solo l'hash.
+func NewKey(owner string, scopes []Scope, maxBatch int, expiresAt time.Time) (string, database.APIKey, error) {
+	if strings.TrimSpace(owner) == "" {
+		return "", database.APIKey{}, errors.New("il proprietario della chiave è obbligatorio")
+	}
+	if len(scopes) == 0 {
+		return "", database.APIKey{}, errors.New("la chiave deve avere almeno un permesso")
+	}
+
+	id := make([]byte, 6)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", database.APIKey{}, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", database.APIKey{}, err
+	}
+	encodedSecret := base64.RawURLEncoding.EncodeToString(secret)
+
+	key := database.APIKey{
+		ID:        hex.EncodeToString(id),
+		Hash:      hashSecret(encodedSecret),
+		Owner:     strings.TrimSpace(owner),
+		MaxBatch:  maxBatch,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: expiresAt,
+	}
+	for _, scope := range scopes {
+		key.Scopes = append(key.Scopes, string(scope))
+	}
+	return keyPrefix + key.ID + "_" + encodedSecret, key, nil
+}
+
+// hashSecret restituisce lo SHA-256 esadecimale del segreto.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// parseKey separa identificativo e segreto di una chiave in chiaro.
+func parseKey(plaintext string) (id, secret string, err error) {
+	rest, found := strings.CutPrefix(plaintext, keyPrefix)
+	if !found {
+		return "", "", ErrInvalidKey
+	}
+	id, secret, found = strings.Cut(rest, "_")
+	if !found || id == "" || secret == "" {
+		return "", "", ErrInvalidKey
+	}
+	return id, secret, nil
+}
+
+// verify controlla il segreto e lo stato del record rispetto all'istante now.
+func verify(key *database.APIKey, secret string, now time.Time) error {
+	if key == nil || subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(key.Hash)) != 1 {
+		return ErrInvalidKey
+	}
+	if !key.RevokedAt.IsZero() {
+		return ErrRevokedKey
+	}
+	if !key.ExpiresAt.IsZero() && !now.Before(key.ExpiresAt) {
+		return ErrExpiredKey
+	}
+	return nil
+}
+
+// Principal è il client autenticato di una richiesta.
+type Principal struct {
+	// KeyID è l'identificativo della chiave; vuoto per i client anonimi
+	KeyID string
+	// Owner è il proprietario della chiave, oppure "anonymous"
+	Owner string
+	// Scopes sono i permessi del client
+	Scopes []Scope
+	// MaxBatch è il limite di email per richiesta della chiave; 0 = limite della configurazione
+	MaxBatch int
+	// Tier è il profilo di rate limiting della chiave; vuoto = profilo predefinito
+	Tier string
+	// Domains sono i domini di cui la chiave può cercare le email
+	Domains []string
+}
+
+// Anonymous crea il principal delle richieste senza chiave, con i permessi indicati.
+func Anonymous(scopes []Scope) *Principal {
+	return &Principal{Owner: "anonymous", Scopes: scopes}
+}
+
+// Has indica se il principal ha il permesso; ScopeAdmin li include tutti.
+func (p *Principal) Has(scope Scope) bool {
+	return slices.Contains(p.Scopes, scope) || slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+// CanSearchDomain indica se il principal può cercare le email del dominio, in forma canonica:
+// il dominio deve essere assegnato alla chiave, tranne che per ScopeAdmin (e con l'autenticazione disattivata).
+func (p *Principal) CanSearchDomain(domain string) bool {
+	if slices.Contains(p.Scopes, ScopeAdmin) {
+		return true
+	}
+	return p.Has(ScopeDomainSearch) && slices.Contains(p.Domains, domain)
+}
+
+// IsAnonymous indica se la richiesta non ha presentato una chiave.
+func (p *Principal) IsAnonymous() bool {
+	return p.KeyID == ""
+}
+
+// principalKey è la chiave del principal nel contesto della richiesta.
+type principalKey struct{}
+
+// NewContext restituisce un contesto che trasporta il principal.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext restituisce il principal della richiesta, o nil se non è stata autenticata.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"pwnscanner/pkg/database"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+// cacheEntries è il numero massimo di chiavi tenute in cache dall'Authenticator.
+const cacheEntries = 10000
+
+// Authenticator risolve le chiavi API presentate dai client nel principal corrispondente.
+// I record letti dal database restano in cache per cacheTTL, incluse le chiavi inesistenti:
+// una revoca diventa effettiva entro lo stesso intervallo.
+type Authenticator struct {
+	store database.APIKeyStore
+	cache *expirable.LRU[string, *database.APIKey] // nil se la cache è disattivata
+}
+
+// NewAuthenticator crea un Authenticator che legge le chiavi da store; con cacheTTL <= 0
+// ogni richiesta legge la chiave dal database. Con store nil nessuna chiave è valida
+// e sono ammesse solo le richieste anonime.
+func NewAuthenticator(store database.APIKeyStore, cacheTTL time.Duration) *Authenticator {
+	a := &Authenticator{store: store}
+	if cacheTTL > 0 {
+		a.cache = expirable.NewLRU[string, *database.APIKey](cacheEntries, nil, cacheTTL)
+	}
+	return a
+}
+
+// Authenticate verifica la chiave in chiaro e restituisce il principal associato.
+// Gli errori di verifica sono ErrInvalidKey, ErrExpiredKey e ErrRevokedKey;
+// gli altri provengono dal database.
+func (a *Authenticator) Authenticate(ctx context.Context, plaintext string) (*Principal, error) {
+	id, secret, err := parseKey(plaintext)
+	if err != nil || a.store == nil {
+		return nil, ErrInvalidKey
+	}
+
+	var key *database.APIKey
+	found := false
+	if a.cache != nil {
+		key, found = a.cache.Get(id)
+	}
+	if !found {
+		key, err = a.store.GetAPIKey(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if a.cache != nil {
+			a.cache.Add(id, key)
+		}
+	}
+
+	if err := verify(key, secret, time.Now()); err != nil {
+		return nil, err
+	}
+
+	p := &Principal{KeyID: key.ID, Owner: key.Owner, MaxBatch: key.MaxBatch, Tier: key.Tier, Domains: key.Domains}
+	for _, scope := range key.Scopes {
+		p.Scopes = append(p.Scopes, Scope(scope))
+	}
+	return p, nil
+}
+
+// KeyFromRequest estrae la chiave dall'header "Authorization: Bearer <chiave>" o "X-API-Key".
+// Restituisce una stringa vuota se la richiesta non presenta una chiave.
+func KeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return strings.TrimSpace(key)
+	}
+	scheme, key, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if found && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(key)
+	}
+	return ""
+}
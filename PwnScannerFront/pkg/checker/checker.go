@@ -2,11 +2,13 @@ package checker
 
 import (
 	"context"
+	"fmt"
 	"pwnscanner/pkg/database"
+	"pwnscanner/pkg/normalize"
 	"sync"
 	"time"
 
-	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/hashicorp/golang-lru/v2/expirable"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -46,34 +48,68 @@ func init() {
 
 // Checker gestisce le query al database e la cache in memoria.
 type Checker struct {
-	db    database.Database
-	cache *lru.Cache[string, []string]
-	mu    sync.Mutex
+	db         database.Database
+	normalizer *normalize.Normalizer
+	cache      *expirable.LRU[string, []string]
+	cacheSize  int
+	ttl        time.Duration
+	mu         sync.Mutex
+}
+
+// CacheStats descrive lo stato della cache del Checker, riportato dall'endpoint di readiness.
+type CacheStats struct {
+	// Entries è il numero di email attualmente in cache
+	Entries int `json:"entries"`
+	// Capacity è il numero massimo di email in cache
+	Capacity int `json:"capacity"`
+	// TTLSeconds è la durata di validità delle voci (0 = nessuna scadenza)
+	TTLSeconds int `json:"ttl_seconds"`
 }
 
 // NewChecker crea un nuovo Checker con una cache LRU.
-// Accetta un'istanza del database e la dimensione massima della cache in MB.
-func NewChecker(db database.Database, cacheSizeMB int) (*Checker, error) {
+// Accetta un'istanza del database, il Normalizer con cui sono state importate le email,
+// la dimensione massima della cache in MB e la durata di validità delle voci (0 = nessuna scadenza).
+func NewChecker(db database.Database, normalizer *normalize.Normalizer, cacheSizeMB int, ttl time.Duration) (*Checker, error) {
 	cacheSize := (cacheSizeMB * 1024 * 1024) / 1024 // Calcola il numero massimo di elementi nella cache
-	cache, err := lru.New[string, []string](cacheSize)
-	if err != nil {
-		return nil, err
+	if cacheSize <= 0 {
+		return nil, fmt.Errorf("dimensione della cache non valida: %d MB", cacheSizeMB)
 	}
+	cache := expirable.NewLRU[string, []string](cacheSize, nil, ttl)
 
 	return &Checker{
-		db:    db,
-		cache: cache,
+		db:         db,
+		normalizer: normalizer,
+		cache:      cache,
+		cacheSize:  cacheSize,
+		ttl:        ttl,
 	}, nil
 }
 
-// FindEmailInBreaches cerca un'email nel database e utilizza la cache.
+// CacheStats restituisce lo stato attuale della cache.
+func (c *Checker) CacheStats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{
+		Entries:    c.cache.Len(),
+		Capacity:   c.cacheSize,
+		TTLSeconds: int(c.ttl.Seconds()),
+	}
+}
+
+// FindEmailInBreaches normalizza l'email, la cerca nel database e utilizza la cache.
 // Se l'email è presente nella cache, restituisce il risultato senza accedere al database.
+// Un'email non normalizzabile restituisce un errore che avvolge normalize.ErrInvalid.
 // Aggiorna le metriche Prometheus per registrare le richieste, hit/miss della cache e i tempi di risposta.
 func (c *Checker) FindEmailInBreaches(ctx context.Context, email string) ([]string, error) {
 	totalRequests.Inc() // Incrementa il numero totale di richieste
 
 	start := time.Now() // Inizia il timer per misurare il tempo di risposta
 
+	email, err := c.normalizer.Email(email)
+	if err != nil {
+		return nil, err
+	}
+
 	// Verifica se l'email è già presente nella cache
 	c.mu.Lock()
 	if breaches, found := c.cache.Get(email); found {
@@ -100,3 +136,18 @@ func (c *Checker) FindEmailInBreaches(ctx context.Context, email string) ([]stri
 	responseTimes.Observe(time.Since(start).Seconds())
 	return breaches, nil
 }
+
+// FindDataClasses normalizza l'email e restituisce le classi di dati che ha esposto in ogni breach,
+// se il database le conserva (database.DataClassReader); altrimenti restituisce nil.
+// Non usa la cache: viene chiamata solo per le email trovate in almeno un breach.
+func (c *Checker) FindDataClasses(ctx context.Context, email string) (map[string][]string, error) {
+	reader, ok := c.db.(database.DataClassReader)
+	if !ok {
+		return nil, nil
+	}
+	email, err := c.normalizer.Email(email)
+	if err != nil {
+		return nil, err
+	}
+	return reader.FindDataClasses(ctx, email)
+}
@@ -0,0 +1,171 @@
+// Package client esegue la parte client delle ricerche con k-anonymity di PwnScannerFront
+// (/email-range/{prefix}): l'email viene normalizzata e trasformata nel suo hash SHA-256 in locale,
+// al server viene inviato solo un prefisso dell'hash e il confronto con i suffissi restituiti
+// avviene qui. Il server non riceve mai l'indirizzo né l'hash completo.
+//
+// Esempio:
+//
+//	c := client.New("https://pwnscanner.example.com", normalize.New(normalize.Options{}))
+//	c.APIKey = os.Getenv("PWNSCANNER_API_KEY")
+//	breaches, err := c.CheckEmail(ctx, "mario.rossi@example.com")
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"pwnscanner/pkg/normalize"
+	"strings"
+)
+
+// Lunghezze dei prefissi accettate dal server (vedi database.MinEmailPrefixLength e MaxEmailPrefixLength).
+const (
+	MinPrefixLength = 5
+	MaxPrefixLength = 8
+)
+
+// maxErrorBytes è la dimensione massima letta dal corpo di una risposta di errore.
+const maxErrorBytes = 4096
+
+// Client interroga /email-range/{prefix} di un'istanza di PwnScannerFront.
+// I campi possono essere modificati prima del primo utilizzo; poi Client è sicuro per l'uso concorrente.
+type Client struct {
+	// BaseURL è l'indirizzo del server, ad esempio "https://pwnscanner.example.com"
+	BaseURL string
+	// APIKey è la chiave API inviata come "Authorization: Bearer"; vuota per le richieste anonime
+	APIKey string
+	// HTTPClient esegue le richieste; se nil viene usato http.DefaultClient
+	HTTPClient *http.Client
+	// Normalizer deve avere le stesse opzioni del server (normalization.provider_rules),
+	// altrimenti gli hash calcolati non corrispondono a quelli delle email importate
+	Normalizer *normalize.Normalizer
+	// PrefixLength è il numero di cifre dell'hash inviate al server, da MinPrefixLength a MaxPrefixLength:
+	// un prefisso più lungo riduce la risposta ma restringe l'insieme di email tra cui si nasconde quella cercata
+	PrefixLength int
+}
+
+// New crea un Client per il server baseURL con il prefisso più corto.
+func New(baseURL string, normalizer *normalize.Normalizer) *Client {
+	return &Client{BaseURL: baseURL, Normalizer: normalizer, PrefixLength: MinPrefixLength}
+}
+
+// Error è una risposta di errore del server.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("risposta %d dal server: %s", e.StatusCode, e.Message)
+}
+
+// match è un elemento della risposta di /email-range/{prefix}.
+type match struct {
+	Suffix   string   `json:"suffix"`
+	Breaches []string `json:"breaches"`
+}
+
+// Hash restituisce l'hash dell'email normalizzata, come lo calcola il server all'import.
+func (c *Client) Hash(email string) (string, error) {
+	normalized, err := c.Normalizer.Email(email)
+	if err != nil {
+		return "", err
+	}
+	return normalize.Hash(normalized), nil
+}
+
+// CheckEmail restituisce i breach in cui compare l'email, in ordine alfabetico, o nil se non compare.
+func (c *Client) CheckEmail(ctx context.Context, email string) ([]string, error) {
+	results, err := c.CheckEmails(ctx, []string{email})
+	if err != nil {
+		return nil, err
+	}
+	return results[email], nil
+}
+
+// CheckEmails restituisce i breach in cui compare ogni email (chiave della mappa, come passata);
+// le email non trovate non compaiono nella mappa. Le email con lo stesso prefisso vengono cercate
+// con una sola richiesta. Un'email non normalizzabile interrompe la ricerca con un errore che
+// avvolge normalize.ErrInvalid.
+func (c *Client) CheckEmails(ctx context.Context, emails []string) (map[string][]string, error) {
+	if c.PrefixLength < MinPrefixLength || c.PrefixLength > MaxPrefixLength {
+		return nil, fmt.Errorf("lunghezza del prefisso non valida: %d (ammessa da %d a %d)", c.PrefixLength, MinPrefixLength, MaxPrefixLength)
+	}
+
+	// prefisso -> suffisso dell'hash -> email che lo hanno
+	wanted := make(map[string]map[string][]string)
+	var prefixes []string
+	for _, email := range emails {
+		hash, err := c.Hash(email)
+		if err != nil {
+			return nil, err
+		}
+		prefix, suffix := hash[:c.PrefixLength], hash[c.PrefixLength:]
+		if wanted[prefix] == nil {
+			wanted[prefix] = make(map[string][]string)
+			prefixes = append(prefixes, prefix)
+		}
+		wanted[prefix][suffix] = append(wanted[prefix][suffix], email)
+	}
+
+	results := make(map[string][]string)
+	for _, prefix := range prefixes {
+		matches, err := c.emailRange(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			for _, email := range wanted[prefix][strings.ToUpper(m.Suffix)] {
+				results[email] = m.Breaches
+			}
+		}
+	}
+	return results, nil
+}
+
+// emailRange scarica le email con il prefisso indicato.
+func (c *Client) emailRange(ctx context.Context, prefix string) ([]match, error) {
+	endpoint, err := url.JoinPath(c.BaseURL, "email-range", prefix)
+	if err != nil {
+		return nil, fmt.Errorf("indirizzo del server non valido: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBytes))
+		var errorResponse struct {
+			Message string `json:"message"`
+		}
+		message := strings.TrimSpace(string(body))
+		if json.Unmarshal(body, &errorResponse) == nil && errorResponse.Message != "" {
+			message = errorResponse.Message
+		}
+		return nil, &Error{StatusCode: resp.StatusCode, Message: message}
+	}
+
+	var matches []match
+	if err := json.NewDecoder(resp.Body).Decode(&matches); err != nil {
+		return nil, fmt.Errorf("risposta del server non valida: %w", err)
+	}
+	return matches, nil
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"pwnscanner/pkg/database"
+	"pwnscanner/pkg/normalize"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// rangeServer serve /email-range/{prefix} da un database in memoria e registra i prefissi richiesti.
+type rangeServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	prefixes []string
+}
+
+func newRangeServer(t *testing.T, db *database.Memory) *rangeServer {
+	t.Helper()
+	s := &rangeServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /email-range/{prefix}", func(w http.ResponseWriter, r *http.Request) {
+		prefix := r.PathValue("prefix")
+		s.mu.Lock()
+		s.prefixes = append(s.prefixes, prefix)
+		s.mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer chiave" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"message": "Chiave API non valida"})
+			return
+		}
+		matches, err := db.FindEmailRange(r.Context(), strings.ToUpper(prefix))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(matches)
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestCheckEmailsRoundTrip(t *testing.T) {
+	db := database.NewMemory()
+	db.Add("alice@example.com", "Adobe", "LinkedIn")
+	db.Add("bob@example.com", "Adobe")
+	server := newRangeServer(t, db)
+
+	c := New(server.URL, normalize.New(normalize.Options{}))
+	c.APIKey = "chiave"
+	emails := []string{"Alice@Example.com", "bob@example.com", "carol@example.com"}
+	got, err := c.CheckEmails(context.Background(), emails)
+	if err != nil {
+		t.Fatalf("CheckEmails: errore inatteso: %v", err)
+	}
+	want := map[string][]string{
+		"Alice@Example.com": {"Adobe", "LinkedIn"},
+		"bob@example.com":   {"Adobe"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CheckEmails = %v, atteso %v", got, want)
+	}
+
+	// Il server riceve solo i prefissi degli hash, mai le email né gli hash completi
+	if len(server.prefixes) != len(emails) {
+		t.Fatalf("richieste = %v, attesa una per prefisso", server.prefixes)
+	}
+	for i, email := range []string{"alice@example.com", "bob@example.com", "carol@example.com"} {
+		if want := normalize.Hash(email)[:MinPrefixLength]; server.prefixes[i] != want {
+			t.Errorf("prefisso richiesto per %s = %s, atteso %s", email, server.prefixes[i], want)
+		}
+	}
+
+	breaches, err := c.CheckEmail(context.Background(), "carol@example.com")
+	if err != nil || breaches != nil {
+		t.Errorf("CheckEmail di un'email assente = %v, %v; atteso nil, nil", breaches, err)
+	}
+}
+
+func TestCheckEmailsSamePrefix(t *testing.T) {
+	server := newRangeServer(t, database.NewMemory())
+	c := New(server.URL, normalize.New(normalize.Options{}))
+	c.APIKey = "chiave"
+
+	// Le due forme hanno la stessa email canonica, quindi lo stesso prefisso: una sola richiesta
+	if _, err := c.CheckEmails(context.Background(), []string{"alice@example.com", "ALICE@example.com"}); err != nil {
+		t.Fatalf("CheckEmails: errore inatteso: %v", err)
+	}
+	if len(server.prefixes) != 1 {
+		t.Errorf("richieste = %v, attesa una sola", server.prefixes)
+	}
+}
+
+func TestCheckEmailsErrors(t *testing.T) {
+	server := newRangeServer(t, database.NewMemory())
+
+	t.Run("lunghezza del prefisso", func(t *testing.T) {
+		for _, length := range []int{MinPrefixLength - 1, MaxPrefixLength + 1} {
+			c := New(server.URL, normalize.New(normalize.Options{}))
+			c.PrefixLength = length
+			if _, err := c.CheckEmails(context.Background(), []string{"alice@example.com"}); err == nil {
+				t.Errorf("PrefixLength %d: atteso un errore", length)
+			}
+		}
+	})
+
+	t.Run("email non valida", func(t *testing.T) {
+		c := New(server.URL, normalize.New(normalize.Options{}))
+		_, err := c.CheckEmails(context.Background(), []string{"non-una-email"})
+		if !errors.Is(err, normalize.ErrInvalid) {
+			t.Errorf("errore = %v, atteso normalize.ErrInvalid", err)
+		}
+	})
+
+	t.Run("risposta di errore", func(t *testing.T) {
+		c := New(server.URL, normalize.New(normalize.Options{}))
+		c.APIKey = "sbagliata"
+		_, err := c.CheckEmail(context.Background(), "alice@example.com")
+		var serverErr *Error
+		if !errors.As(err, &serverErr) {
+			t.Fatalf("errore = %v, atteso *Error", err)
+		}
+		if serverErr.StatusCode != http.StatusUnauthorized || serverErr.Message != "Chiave API non valida" {
+			t.Errorf("errore = %+v, attesi 401 e il messaggio del server", serverErr)
+		}
+	})
+}
@@ -0,0 +1,676 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"pwnscanner/pkg/auth"
+	"pwnscanner/pkg/database"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPath è il percorso del file di configurazione usato quando non viene indicato altro.
+const DefaultPath = "config.yaml"
+
+// Config raccoglie tutta la configurazione di PwnScannerFront.
+type Config struct {
+	Server        ServerConfig        `yaml:"server"`
+	Cache         CacheConfig         `yaml:"cache"`
+	Batch         BatchConfig         `yaml:"batch"`
+	Logging       LoggingConfig       `yaml:"logging"`
+	Database      DatabaseConfig      `yaml:"database"`
+	Normalization NormalizationConfig `yaml:"normalization"`
+	Auth          AuthConfig          `yaml:"auth"`
+	RateLimit     RateLimitConfig     `yaml:"rate_limit"`
+}
+
+// ServerConfig contiene i parametri del server HTTP. I timeout sono in secondi; 0 = nessun limite.
+type ServerConfig struct {
+	ListenAddr string `yaml:"listen_addr"`
+	// ReadHeaderTimeoutSeconds è il tempo massimo per ricevere gli header di una richiesta
+	ReadHeaderTimeoutSeconds int `yaml:"read_header_timeout_seconds"`
+	// ReadTimeoutSeconds è il tempo massimo per ricevere l'intera richiesta, corpo compreso
+	ReadTimeoutSeconds int `yaml:"read_timeout_seconds"`
+	// WriteTimeoutSeconds è il tempo massimo per scrivere la risposta; gli endpoint REST lo sostituiscono
+	// con la propria scadenza (EndpointTimeouts)
+	WriteTimeoutSeconds int `yaml:"write_timeout_seconds"`
+	// IdleTimeoutSeconds è il tempo per cui una connessione keep-alive inattiva resta aperta
+	IdleTimeoutSeconds int `yaml:"idle_timeout_seconds"`
+	// EndpointTimeouts sono le scadenze delle richieste agli endpoint REST
+	EndpointTimeouts EndpointTimeouts `yaml:"endpoint_timeouts"`
+	// ShutdownDrainSeconds è l'attesa tra il segnale di arresto e la chiusura del listener, durante la quale
+	// /readyz risponde 503 e il bilanciatore smette di inviare richieste
+	ShutdownDrainSeconds int `yaml:"shutdown_drain_seconds"`
+	// ShutdownTimeoutSeconds è il tempo concesso alle richieste in corso per terminare, poi le connessioni vengono chiuse
+	ShutdownTimeoutSeconds int `yaml:"shutdown_timeout_seconds"`
+}
+
+// EndpointTimeouts contiene la scadenza, in secondi, di ogni endpoint REST (0 = nessuna scadenza).
+// Allo scadere le operazioni sul database vengono annullate e il client riceve 504.
+type EndpointTimeouts struct {
+	CheckEmailSeconds   int `yaml:"check_email_seconds"`
+	CheckEmailsSeconds  int `yaml:"check_emails_seconds"`
+	BreachesSeconds     int `yaml:"breaches_seconds"`
+	StatsSeconds        int `yaml:"stats_seconds"`
+	RangeSeconds        int `yaml:"range_seconds"`
+	EmailRangeSeconds   int `yaml:"email_range_seconds"`
+	DomainSearchSeconds int `yaml:"domain_search_seconds"`
+}
+
+// seconds converte un numero di secondi della configurazione in durata.
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
+}
+
+// ReadHeaderTimeout restituisce il tempo massimo per ricevere gli header.
+func (s ServerConfig) ReadHeaderTimeout() time.Duration {
+	return seconds(s.ReadHeaderTimeoutSeconds)
+}
+
+// ReadTimeout restituisce il tempo massimo per ricevere la richiesta.
+func (s ServerConfig) ReadTimeout() time.Duration {
+	return seconds(s.ReadTimeoutSeconds)
+}
+
+// WriteTimeout restituisce il tempo massimo per scrivere la risposta.
+func (s ServerConfig) WriteTimeout() time.Duration {
+	return seconds(s.WriteTimeoutSeconds)
+}
+
+// IdleTimeout restituisce la durata massima di una connessione inattiva.
+func (s ServerConfig) IdleTimeout() time.Duration {
+	return seconds(s.IdleTimeoutSeconds)
+}
+
+// ShutdownDrain restituisce l'attesa prima di smettere di accettare connessioni.
+func (s ServerConfig) ShutdownDrain() time.Duration {
+	return seconds(s.ShutdownDrainSeconds)
+}
+
+// ShutdownTimeout restituisce il tempo concesso alle richieste in corso durante l'arresto.
+func (s ServerConfig) ShutdownTimeout() time.Duration {
+	return seconds(s.ShutdownTimeoutSeconds)
+}
+
+// CheckEmail restituisce la scadenza di /check-email.
+func (e EndpointTimeouts) CheckEmail() time.Duration {
+	return seconds(e.CheckEmailSeconds)
+}
+
+// CheckEmails restituisce la scadenza di /check-emails.
+func (e EndpointTimeouts) CheckEmails() time.Duration {
+	return seconds(e.CheckEmailsSeconds)
+}
+
+// Breaches restituisce la scadenza di /breaches e /breaches/{name}.
+func (e EndpointTimeouts) Breaches() time.Duration {
+	return seconds(e.BreachesSeconds)
+}
+
+// Stats restituisce la scadenza di /stats.
+func (e EndpointTimeouts) Stats() time.Duration {
+	return seconds(e.StatsSeconds)
+}
+
+// Range restituisce la scadenza di /range/{prefix}.
+func (e EndpointTimeouts) Range() time.Duration {
+	return seconds(e.RangeSeconds)
+}
+
+// EmailRange restituisce la scadenza di /email-range/{prefix}.
+func (e EndpointTimeouts) EmailRange() time.Duration {
+	return seconds(e.EmailRangeSeconds)
+}
+
+// DomainSearch restituisce la scadenza di /domains/{domain}/breached-accounts.
+func (e EndpointTimeouts) DomainSearch() time.Duration {
+	return seconds(e.DomainSearchSeconds)
+}
+
+// CacheConfig contiene i parametri della cache LRU del Checker.
+type CacheConfig struct {
+	SizeMB     int `yaml:"size_mb"`
+	TTLMinutes int `yaml:"ttl_minutes"`
+}
+
+// TTL restituisce la durata di validità delle voci in cache (0 = nessuna scadenza).
+func (c CacheConfig) TTL() time.Duration {
+	return time.Duration(c.TTLMinutes) * time.Minute
+}
+
+// BatchConfig contiene i limiti della verifica di più email per richiesta (/check-emails).
+type BatchConfig struct {
+	// MaxEmails è il numero massimo di email per richiesta
+	MaxEmails int `yaml:"max_emails"`
+	// Concurrency è il numero di email di una richiesta cercate in parallelo
+	Concurrency int `yaml:"concurrency"`
+}
+
+// LoggingConfig contiene i parametri del logger.
+type LoggingConfig struct {
+	Level string `yaml:"level"`
+}
+
+// NormalizationConfig contiene le regole di normalizzazione delle email cercate.
+// Deve corrispondere a quella usata da pwnadmin durante gli import.
+type NormalizationConfig struct {
+	ProviderRules bool `yaml:"provider_rules"`
+}
+
+// AuthConfig contiene i parametri dell'autenticazione con chiavi API.
+type AuthConfig struct {
+	// Enabled richiede una chiave API con il permesso adeguato; se false tutte le richieste sono ammesse
+	Enabled bool `yaml:"enabled"`
+	// AnonymousScopes sono i permessi concessi alle richieste senza chiave (ad esempio "check" per l'interfaccia web)
+	AnonymousScopes []string `yaml:"anonymous_scopes"`
+	// CacheSeconds è la durata della cache delle chiavi lette dal database, e quindi il ritardo massimo di una revoca
+	CacheSeconds int `yaml:"cache_seconds"`
+}
+
+// CacheTTL restituisce la durata della cache delle chiavi.
+func (a AuthConfig) CacheTTL() time.Duration {
+	return time.Duration(a.CacheSeconds) * time.Second
+}
+
+// RateLimitConfig contiene i parametri del rate limiting delle richieste.
+type RateLimitConfig struct {
+	// Enabled attiva il rate limiting sugli endpoint REST
+	Enabled bool `yaml:"enabled"`
+	// Store indica dove sono conservati i bucket: "memory" (per istanza) o "database" (condivisi tra le istanze,
+	// solo con MongoDB o PostgreSQL)
+	Store string `yaml:"store"`
+	// TrustForwardedFor ricava l'IP del client dall'ultimo indirizzo di X-Forwarded-For, aggiunto dal proxy;
+	// va attivato solo dietro un reverse proxy, altrimenti il client può scegliere il proprio IP
+	TrustForwardedFor bool `yaml:"trust_forwarded_for"`
+	// Tiers sono i profili di limite per nome; "default" (chiavi API) e "anonymous" (richieste senza chiave,
+	// per IP) sono obbligatori, gli altri si assegnano alle chiavi con pwnadmin
+	Tiers map[string]RateLimitTier `yaml:"tiers"`
+}
+
+// RateLimitTier è un profilo di limite: il bucket si riempie di RequestsPerMinute gettoni al minuto
+// fino a Burst, e ogni richiesta ne consuma uno (una per email in /check-emails).
+type RateLimitTier struct {
+	RequestsPerMinute float64 `yaml:"requests_per_minute"`
+	Burst             int     `yaml:"burst"`
+}
+
+// DatabaseConfig contiene i parametri di connessione al database.
+type DatabaseConfig struct {
+	Type         string `yaml:"type"`
+	Host         string `yaml:"host"`
+	Port         int    `yaml:"port"`
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password"`
+	DatabaseName string `yaml:"database_name"`
+	Collection   string `yaml:"collection"`
+	FixturePath  string `yaml:"fixture_path"`
+	EmbeddedPath string `yaml:"embedded_path"`
+	SSLMode      string `yaml:"ssl_mode"`
+
+	// EmailHMACKeys fa cercare le email come HMAC (solo MongoDB): chiavi "id:segreto in base64" separate
+	// da virgole, dalla più vecchia alla più recente, uguali a EMAIL_HMAC_KEYS di pwnadmin
+	EmailHMACKeys string `yaml:"email_hmac_keys"`
+	// EmailHMACDualRead cerca le email anche con la catena di chiavi precedente, finché la rotazione
+	// di pwnadmin (rotate-email-keys) non è completata
+	EmailHMACDualRead bool `yaml:"email_hmac_dual_read"`
+
+	// AutoMigrate applica all'avvio le migrazioni mancanti dello schema (richiede permessi di scrittura);
+	// altrimenti PwnScannerFront si limita a verificare di supportare la versione dello schema
+	AutoMigrate bool `yaml:"auto_migrate"`
+
+	SnapshotPath          string `yaml:"snapshot_path"`
+	SnapshotReloadSeconds int    `yaml:"snapshot_reload_seconds"`
+}
+
+// SnapshotReloadInterval restituisce l'intervallo di controllo del file snapshot (0 = nessuna ricarica).
+func (d DatabaseConfig) SnapshotReloadInterval() time.Duration {
+	return time.Duration(d.SnapshotReloadSeconds) * time.Second
+}
+
+// defaultPorts contiene la porta predefinita per ogni tipo di database di rete.
+var defaultPorts = map[string]int{
+	"mongodb":  27017,
+	"postgres": 5432,
+}
+
+// Default restituisce la configurazione con i valori di default.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			ListenAddr:               ":8080",
+			ReadHeaderTimeoutSeconds: 5,
+			ReadTimeoutSeconds:       30,
+			WriteTimeoutSeconds:      30,
+			IdleTimeoutSeconds:       120,
+			EndpointTimeouts: EndpointTimeouts{
+				CheckEmailSeconds:   5,
+				CheckEmailsSeconds:  120,
+				BreachesSeconds:     10,
+				StatsSeconds:        10,
+				RangeSeconds:        5,
+				EmailRangeSeconds:   5,
+				DomainSearchSeconds: 30,
+			},
+			ShutdownDrainSeconds:   5,
+			ShutdownTimeoutSeconds: 30,
+		},
+		Cache: CacheConfig{
+			SizeMB:     100,
+			TTLMinutes: 0,
+		},
+		Batch: BatchConfig{
+			MaxEmails:   1000,
+			Concurrency: 8,
+		},
+		Logging: LoggingConfig{
+			Level: "info",
+		},
+		Auth: AuthConfig{
+			Enabled: true,
+			// Come in config.yaml: l'interfaccia web verifica le email senza chiave
+			AnonymousScopes: []string{"check"},
+			CacheSeconds:    60,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			Store:   "memory",
+			Tiers: map[string]RateLimitTier{
+				"default":   {RequestsPerMinute: 600, Burst: 100},
+				"anonymous": {RequestsPerMinute: 60, Burst: 20},
+			},
+		},
+		Database: DatabaseConfig{
+			Type:       "mongodb",
+			Collection: "breaches",
+			SSLMode:    "prefer",
+
+			EmailHMACDualRead: true,
+
+			SnapshotReloadSeconds: 30,
+		},
+	}
+}
+
+// Load carica la configurazione dal file YAML indicato, applica le variabili d'ambiente e la valida.
+// Se path è vuoto viene usato DefaultPath, che può anche non esistere: in quel caso
+// la configurazione è composta solo dai default e dalle variabili d'ambiente.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	explicit := path != ""
+	if !explicit {
+		path = DefaultPath
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := cfg.decode(data); err != nil {
+			return nil, fmt.Errorf("errore nella lettura di %s: %w", path, err)
+		}
+	case errors.Is(err, os.ErrNotExist) && !explicit:
+		// Nessun file di configurazione: si usano default e variabili d'ambiente
+	default:
+		return nil, fmt.Errorf("impossibile aprire il file di configurazione: %w", err)
+	}
+
+	envErr := cfg.applyEnv()
+
+	// La porta di default dipende dal tipo di database, noto solo dopo file e variabili d'ambiente
+	if cfg.Database.Port == 0 {
+		cfg.Database.Port = defaultPorts[cfg.Database.Type]
+	}
+
+	// Gli errori delle variabili d'ambiente e della validazione vengono riportati insieme
+	if err := errors.Join(envErr, cfg.Validate()); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// decode interpreta il contenuto YAML sopra i valori già presenti, rifiutando chiavi sconosciute.
+func (c *Config) decode(data []byte) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	// Un file vuoto non è un errore: restano i valori di default
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// applyEnv sovrascrive le singole chiavi con le variabili d'ambiente corrispondenti.
+// Ogni variabile può essere fornita anche come <NOME>_FILE, indicando un file che ne contiene il valore.
+func (c *Config) applyEnv() error {
+	var errs []error
+
+	str := func(dst *string, name string) {
+		if v, ok, err := lookupEnv(name); err != nil {
+			errs = append(errs, err)
+		} else if ok {
+			*dst = v
+		}
+	}
+	num := func(dst *int, name string) {
+		v, ok, err := lookupEnv(name)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		if !ok {
+			return
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: valore numerico non valido %q", name, v))
+			return
+		}
+		*dst = n
+	}
+	boolean := func(dst *bool, name string) {
+		v, ok, err := lookupEnv(name)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		if !ok {
+			return
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: valore booleano non valido %q", name, v))
+			return
+		}
+		*dst = b
+	}
+	// list interpreta un elenco separato da virgole; una variabile con solo spazi svuota l'elenco
+	list := func(dst *[]string, name string) {
+		v, ok, err := lookupEnv(name)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		if !ok {
+			return
+		}
+		items := []string{}
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*dst = items
+	}
+
+	str(&c.Server.ListenAddr, "LISTEN_ADDR")
+	num(&c.Server.ReadHeaderTimeoutSeconds, "SERVER_READ_HEADER_TIMEOUT_SECONDS")
+	num(&c.Server.ReadTimeoutSeconds, "SERVER_READ_TIMEOUT_SECONDS")
+	num(&c.Server.WriteTimeoutSeconds, "SERVER_WRITE_TIMEOUT_SECONDS")
+	num(&c.Server.IdleTimeoutSeconds, "SERVER_IDLE_TIMEOUT_SECONDS")
+	num(&c.Server.ShutdownDrainSeconds, "SERVER_SHUTDOWN_DRAIN_SECONDS")
+	num(&c.Server.ShutdownTimeoutSeconds, "SERVER_SHUTDOWN_TIMEOUT_SECONDS")
+	num(&c.Server.EndpointTimeouts.CheckEmailSeconds, "TIMEOUT_CHECK_EMAIL_SECONDS")
+	num(&c.Server.EndpointTimeouts.CheckEmailsSeconds, "TIMEOUT_CHECK_EMAILS_SECONDS")
+	num(&c.Server.EndpointTimeouts.BreachesSeconds, "TIMEOUT_BREACHES_SECONDS")
+	num(&c.Server.EndpointTimeouts.StatsSeconds, "TIMEOUT_STATS_SECONDS")
+	num(&c.Server.EndpointTimeouts.RangeSeconds, "TIMEOUT_RANGE_SECONDS")
+	num(&c.Server.EndpointTimeouts.EmailRangeSeconds, "TIMEOUT_EMAIL_RANGE_SECONDS")
+	num(&c.Server.EndpointTimeouts.DomainSearchSeconds, "TIMEOUT_DOMAIN_SEARCH_SECONDS")
+
+	num(&c.Cache.SizeMB, "CACHE_SIZE_MB")
+	num(&c.Cache.TTLMinutes, "CACHE_TTL_MINUTES")
+
+	num(&c.Batch.MaxEmails, "BATCH_MAX_EMAILS")
+	num(&c.Batch.Concurrency, "BATCH_CONCURRENCY")
+
+	str(&c.Logging.Level, "LOG_LEVEL")
+
+	str(&c.Database.Type, "DB_TYPE")
+	str(&c.Database.Host, "DB_HOST")
+	num(&c.Database.Port, "DB_PORT")
+	str(&c.Database.Username, "DB_USERNAME")
+	str(&c.Database.Password, "DB_PASSWORD")
+	str(&c.Database.DatabaseName, "DB_NAME")
+	str(&c.Database.Collection, "DB_COLLECTION")
+	str(&c.Database.FixturePath, "DB_FIXTURE")
+	str(&c.Database.EmbeddedPath, "DB_EMBEDDED_PATH")
+	str(&c.Database.SSLMode, "DB_SSLMODE")
+	str(&c.Database.EmailHMACKeys, "DB_EMAIL_HMAC_KEYS")
+	boolean(&c.Database.EmailHMACDualRead, "DB_EMAIL_HMAC_DUAL_READ")
+	boolean(&c.Database.AutoMigrate, "DB_AUTO_MIGRATE")
+	str(&c.Database.SnapshotPath, "DB_SNAPSHOT_PATH")
+	num(&c.Database.SnapshotReloadSeconds, "DB_SNAPSHOT_RELOAD_SECONDS")
+
+	boolean(&c.Normalization.ProviderRules, "NORMALIZE_PROVIDER_RULES")
+
+	boolean(&c.Auth.Enabled, "AUTH_ENABLED")
+	list(&c.Auth.AnonymousScopes, "AUTH_ANONYMOUS_SCOPES")
+	num(&c.Auth.CacheSeconds, "AUTH_CACHE_SECONDS")
+
+	boolean(&c.RateLimit.Enabled, "RATELIMIT_ENABLED")
+	str(&c.RateLimit.Store, "RATELIMIT_STORE")
+	boolean(&c.RateLimit.TrustForwardedFor, "RATELIMIT_TRUST_FORWARDED_FOR")
+
+	return errors.Join(errs...)
+}
+
+// lookupEnv legge una variabile d'ambiente o, in alternativa, il file indicato da <NOME>_FILE.
+// Definire entrambe le forme è considerato un errore.
+func lookupEnv(name string) (string, bool, error) {
+	value, ok := os.LookupEnv(name)
+	filePath, fileOK := os.LookupEnv(name + "_FILE")
+
+	if ok && fileOK {
+		return "", false, fmt.Errorf("%s e %s_FILE non possono essere definite insieme", name, name)
+	}
+	if fileOK {
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), true, nil
+	}
+	if ok && value == "" {
+		// Una variabile definita ma vuota non sovrascrive il file di configurazione
+		return "", false, nil
+	}
+	return value, ok, nil
+}
+
+// Validate controlla la coerenza della configurazione e restituisce tutti gli errori trovati insieme.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if _, _, err := net.SplitHostPort(c.Server.ListenAddr); err != nil {
+		errs = append(errs, fmt.Errorf("server.listen_addr: indirizzo non valido %q", c.Server.ListenAddr))
+	}
+	for _, f := range []struct {
+		key   string
+		value int
+	}{
+		{"server.read_header_timeout_seconds", c.Server.ReadHeaderTimeoutSeconds},
+		{"server.read_timeout_seconds", c.Server.ReadTimeoutSeconds},
+		{"server.write_timeout_seconds", c.Server.WriteTimeoutSeconds},
+		{"server.idle_timeout_seconds", c.Server.IdleTimeoutSeconds},
+		{"server.shutdown_drain_seconds", c.Server.ShutdownDrainSeconds},
+		{"server.shutdown_timeout_seconds", c.Server.ShutdownTimeoutSeconds},
+		{"server.endpoint_timeouts.check_email_seconds", c.Server.EndpointTimeouts.CheckEmailSeconds},
+		{"server.endpoint_timeouts.check_emails_seconds", c.Server.EndpointTimeouts.CheckEmailsSeconds},
+		{"server.endpoint_timeouts.breaches_seconds", c.Server.EndpointTimeouts.BreachesSeconds},
+		{"server.endpoint_timeouts.stats_seconds", c.Server.EndpointTimeouts.StatsSeconds},
+		{"server.endpoint_timeouts.range_seconds", c.Server.EndpointTimeouts.RangeSeconds},
+		{"server.endpoint_timeouts.email_range_seconds", c.Server.EndpointTimeouts.EmailRangeSeconds},
+		{"server.endpoint_timeouts.domain_search_seconds", c.Server.EndpointTimeouts.DomainSearchSeconds},
+	} {
+		if f.value < 0 {
+			errs = append(errs, fmt.Errorf("%s: non può essere negativo (trovato %d)", f.key, f.value))
+		}
+	}
+
+	if c.Cache.SizeMB <= 0 {
+		errs = append(errs, fmt.Errorf("cache.size_mb: deve essere maggiore di zero (trovato %d)", c.Cache.SizeMB))
+	}
+	if c.Cache.TTLMinutes < 0 {
+		errs = append(errs, fmt.Errorf("cache.ttl_minutes: non può essere negativo (trovato %d)", c.Cache.TTLMinutes))
+	}
+
+	if c.Batch.MaxEmails <= 0 {
+		errs = append(errs, fmt.Errorf("batch.max_emails: deve essere maggiore di zero (trovato %d)", c.Batch.MaxEmails))
+	}
+	if c.Batch.Concurrency <= 0 {
+		errs = append(errs, fmt.Errorf("batch.concurrency: deve essere maggiore di zero (trovato %d)", c.Batch.Concurrency))
+	}
+
+	if _, err := zerolog.ParseLevel(c.Logging.Level); err != nil || c.Logging.Level == "" {
+		errs = append(errs, fmt.Errorf("logging.level: livello sconosciuto %q", c.Logging.Level))
+	}
+
+	if _, err := auth.ParseScopes(strings.Join(c.Auth.AnonymousScopes, ",")); err != nil {
+		errs = append(errs, fmt.Errorf("auth.anonymous_scopes: %w", err))
+	} else if slices.Contains(c.Auth.AnonymousScopes, string(auth.ScopeAdmin)) {
+		errs = append(errs, fmt.Errorf("auth.anonymous_scopes: il permesso %q non può essere concesso senza chiave", auth.ScopeAdmin))
+	}
+	if c.Auth.CacheSeconds < 0 {
+		errs = append(errs, fmt.Errorf("auth.cache_seconds: non può essere negativo (trovato %d)", c.Auth.CacheSeconds))
+	}
+
+	errs = append(errs, c.RateLimit.validate(c.Database.Type)...)
+
+	errs = append(errs, c.Database.validate()...)
+
+	return errors.Join(errs...)
+}
+
+// validate controlla i profili e lo store del rate limiting; dbType è il tipo di database configurato.
+func (r RateLimitConfig) validate(dbType string) []error {
+	var errs []error
+
+	switch r.Store {
+	case "memory":
+	case "database":
+		if dbType != "mongodb" && dbType != "postgres" {
+			errs = append(errs, fmt.Errorf("rate_limit.store: \"database\" richiede MongoDB o PostgreSQL (database %s)", dbType))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("rate_limit.store: valore non valido %q (ammessi: memory, database)", r.Store))
+	}
+
+	for _, name := range []string{"default", "anonymous"} {
+		if _, ok := r.Tiers[name]; !ok {
+			errs = append(errs, fmt.Errorf("rate_limit.tiers: manca il profilo obbligatorio %q", name))
+		}
+	}
+	names := make([]string, 0, len(r.Tiers))
+	for name := range r.Tiers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		tier := r.Tiers[name]
+		if tier.RequestsPerMinute <= 0 {
+			errs = append(errs, fmt.Errorf("rate_limit.tiers.%s.requests_per_minute: deve essere maggiore di zero (trovato %v)", name, tier.RequestsPerMinute))
+		}
+		if tier.Burst < 1 {
+			errs = append(errs, fmt.Errorf("rate_limit.tiers.%s.burst: deve essere almeno 1 (trovato %d)", name, tier.Burst))
+		}
+	}
+
+	return errs
+}
+
+// validate controlla i parametri del database in base al tipo scelto.
+func (d DatabaseConfig) validate() []error {
+	var errs []error
+
+	switch d.Type {
+	case "mongodb":
+		errs = append(errs, required(d.Type, []field{
+			{"database.host", d.Host},
+			{"database.username", d.Username},
+			{"database.password", d.Password},
+			{"database.database_name", d.DatabaseName},
+			{"database.collection", d.Collection},
+		})...)
+		if d.Port <= 0 || d.Port > 65535 {
+			errs = append(errs, fmt.Errorf("database.port: porta non valida %d", d.Port))
+		}
+	case "postgres":
+		errs = append(errs, required(d.Type, []field{
+			{"database.host", d.Host},
+			{"database.username", d.Username},
+			{"database.database_name", d.DatabaseName},
+		})...)
+		if d.Port <= 0 || d.Port > 65535 {
+			errs = append(errs, fmt.Errorf("database.port: porta non valida %d", d.Port))
+		}
+		switch d.SSLMode {
+		case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+		default:
+			errs = append(errs, fmt.Errorf("database.ssl_mode: valore non valido %q", d.SSLMode))
+		}
+	case "memory":
+		// La fixture è facoltativa: senza, il database parte vuoto
+		if d.FixturePath != "" {
+			if _, err := os.Stat(d.FixturePath); err != nil {
+				errs = append(errs, fmt.Errorf("database.fixture_path: %w", err))
+			}
+		}
+	case "embedded":
+		// Il file viene aperto in sola lettura: deve essere già stato creato da pwnadmin
+		errs = append(errs, required(d.Type, []field{{"database.embedded_path", d.EmbeddedPath}})...)
+		if d.EmbeddedPath != "" {
+			if _, err := os.Stat(d.EmbeddedPath); err != nil {
+				errs = append(errs, fmt.Errorf("database.embedded_path: %w", err))
+			}
+		}
+	case "snapshot":
+		errs = append(errs, required(d.Type, []field{{"database.snapshot_path", d.SnapshotPath}})...)
+		if d.SnapshotPath != "" {
+			if _, err := os.Stat(d.SnapshotPath); err != nil {
+				errs = append(errs, fmt.Errorf("database.snapshot_path: %w", err))
+			}
+		}
+		if d.SnapshotReloadSeconds < 0 {
+			errs = append(errs, fmt.Errorf("database.snapshot_reload_seconds: non può essere negativo (trovato %d)", d.SnapshotReloadSeconds))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("database.type: tipo di database non supportato %q", d.Type))
+	}
+
+	if d.EmailHMACKeys != "" {
+		if d.Type != "mongodb" {
+			errs = append(errs, fmt.Errorf("database.email_hmac_keys: le email come HMAC richiedono MongoDB (database %s)", d.Type))
+		} else if _, err := database.ParseEmailKeys(d.EmailHMACKeys); err != nil {
+			errs = append(errs, fmt.Errorf("database.email_hmac_keys: %w", err))
+		}
+	}
+
+	return errs
+}
+
+// field associa una chiave di configurazione al suo valore, per i messaggi di errore.
+type field struct {
+	key   string
+	value string
+}
+
+// required segnala le chiavi obbligatorie lasciate vuote per il tipo di database indicato.
+func required(dbType string, fields []field) []error {
+	var errs []error
+	for _, f := range fields {
+		if f.value == "" {
+			errs = append(errs, fmt.Errorf("%s: obbligatorio per il database %s", f.key, dbType))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrAPIKeyNotFound indica una chiave API inesistente.
+var ErrAPIKeyNotFound = errors.New("chiave API inesistente")
+
+// ErrAPIKeyExists indica una chiave API con un identificativo già usato.
+var ErrAPIKeyExists = errors.New("chiave API già esistente")
+
+// APIKey è una chiave API dei client di PwnScannerFront. Il segreto non viene mai memorizzato:
+// resta solo il suo hash, confrontato da pkg/auth con quello della chiave presentata.
+type APIKey struct {
+	// ID è la parte pubblica della chiave, usata per cercarla e nei log
+	ID string `json:"id" bson:"_id"`
+	// Hash è lo SHA-256 esadecimale del segreto
+	Hash string `json:"hash" bson:"hash"`
+	// Owner identifica il proprietario (persona, team o servizio)
+	Owner string `json:"owner" bson:"owner"`
+	// Scopes sono i permessi della chiave (vedi pkg/auth)
+	Scopes []string `json:"scopes" bson:"scopes"`
+	// MaxBatch è il numero massimo di email per richiesta a /check-emails; 0 = limite della configurazione
+	MaxBatch int `json:"max_batch" bson:"max_batch"`
+	// Tier è il profilo di rate limiting della chiave; vuoto = profilo "default" della configurazione
+	Tier string `json:"tier,omitempty" bson:"tier,omitempty"`
+	// Domains sono i domini di cui il proprietario ha dimostrato il possesso, in forma canonica
+	// (normalize.Domain): con il permesso domain_search può cercarne le email
+	Domains []string `json:"domains,omitempty" bson:"domains,omitempty"`
+	// CreatedAt è il momento della creazione
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	// ExpiresAt è la scadenza; zero = nessuna scadenza
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+	// RevokedAt è il momento della revoca; zero = chiave non revocata
+	RevokedAt time.Time `json:"revoked_at" bson:"revoked_at"`
+}
+
+// Validate controlla i campi obbligatori della chiave prima del salvataggio.
+func (k APIKey) Validate() error {
+	var errs []error
+	if strings.TrimSpace(k.ID) == "" {
+		errs = append(errs, errors.New("l'identificativo della chiave è obbligatorio"))
+	}
+	if k.Hash == "" {
+		errs = append(errs, errors.New("l'hash della chiave è obbligatorio"))
+	}
+	if strings.TrimSpace(k.Owner) == "" {
+		errs = append(errs, errors.New("il proprietario della chiave è obbligatorio"))
+	}
+	if k.MaxBatch < 0 {
+		errs = append(errs, errors.New("il limite di email per richiesta non può essere negativo"))
+	}
+	return errors.Join(errs...)
+}
+
+// APIKeyStore è implementato dai database che conservano le chiavi API.
+type APIKeyStore interface {
+	// GetAPIKey restituisce la chiave, o nil (senza errore) se non esiste
+	GetAPIKey(ctx context.Context, id string) (*APIKey, error)
+
+	// ListAPIKeys restituisce tutte le chiavi, anche revocate, in ordine di creazione
+	ListAPIKeys(ctx context.Context) ([]APIKey, error)
+}
+
+// APIKeyWriter è implementato dai database in cui pwnadmin può gestire le chiavi API.
+type APIKeyWriter interface {
+	APIKeyStore
+
+	// CreateAPIKey salva una nuova chiave; fallisce con ErrAPIKeyExists se l'identificativo è già usato
+	CreateAPIKey(ctx context.Context, key APIKey) error
+
+	// RevokeAPIKey revoca la chiave all'istante indicato; fallisce con ErrAPIKeyNotFound se non esiste.
+	// Revocare una chiave già revocata non cambia la data di revoca
+	RevokeAPIKey(ctx context.Context, id string, at time.Time) error
+	// SetAPIKeyDomains sostituisce i domini della chiave, già in forma canonica; fallisce con
+	// ErrAPIKeyNotFound se non esiste
+	SetAPIKeyDomains(ctx context.Context, id string, domains []string) error
+}
+
+// compareAPIKeys è il criterio di ordinamento di ListAPIKeys: creazione, poi identificativo.
+func compareAPIKeys(a, b APIKey) int {
+	if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+		return c
+	}
+	return strings.Compare(a.ID, b.ID)
+}
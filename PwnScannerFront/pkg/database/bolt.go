@@ -0,0 +1,1154 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"pwnscanner/pkg/normalize"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bucket del file embedded
+var (
+	boltEmailsBucket   = []byte("emails")   // email -> breach (array JSON)
+	boltBreachesBucket = []byte("breaches") // breach -> numero di email (uint64 big-endian)
+	boltCatalogBucket  = []byte("catalog")  // breach -> metadati (Breach in JSON)
+	boltDomainsBucket  = []byte("domains")  // dominio -> numero di email (uint64 big-endian)
+	boltStatsBucket    = []byte("stats")    // contatori globali (uint64 big-endian)
+	boltAPIKeysBucket  = []byte("api_keys") // identificativo -> chiave API (APIKey in JSON)
+	// email, byte 0 e breach -> classi di dati esposte (array JSON)
+	boltDataClassesBucket = []byte("data_classes")
+	// hash SHA-1 della password (40 cifre esadecimali maiuscole) -> occorrenze (uint64 big-endian)
+	boltPasswordsBucket = []byte("passwords")
+	// origine degli hash delle password -> bucket con i sotto-bucket counts (hash -> occorrenze contate
+	// per l'origine, uint64 big-endian) e blocks (numero del blocco già sommato, uint64 big-endian -> 1)
+	boltPasswordSourcesBucket = []byte("password_sources")
+	// hash SHA-256 dell'email (normalize.Hash) -> email
+	boltEmailHashesBucket = []byte("email_hashes")
+	// dominio, byte 0 ed email -> niente (vedi boltDomainEmailKey)
+	boltDomainEmailsBucket = []byte("domain_emails")
+)
+
+// Chiavi del bucket stats
+var (
+	boltEmailsKey       = []byte("emails")
+	boltAssociationsKey = []byte("associations")
+	boltReconciledKey   = []byte("reconciled_at") // istante in secondi Unix
+)
+
+// Bolt è l'implementazione del database su un singolo file locale (bbolt),
+// pensata per le installazioni che non vogliono gestire MongoDB.
+//
+// Il file può essere aperto in scrittura da un solo processo alla volta:
+// pwnadmin lo aggiorna mentre PwnScannerFront è fermo, poi PwnScannerFront lo apre in sola lettura.
+type Bolt struct {
+	db *bolt.DB
+}
+
+// NewBolt apre (o crea, se readOnly è false) il file embedded indicato.
+func NewBolt(path string, readOnly bool) (*Bolt, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{
+		ReadOnly: readOnly,
+		Timeout:  5 * time.Second, // Evita di restare bloccati se un altro processo tiene il file
+	})
+	if err != nil {
+		return nil, fmt.Errorf("errore durante l'apertura del database embedded %s: %w", path, err)
+	}
+
+	if !readOnly {
+		err = db.Update(func(tx *bolt.Tx) error {
+			hashesIndexed := tx.Bucket(boltEmailHashesBucket) != nil
+			domainsIndexed := tx.Bucket(boltDomainEmailsBucket) != nil
+			for _, name := range [][]byte{boltEmailsBucket, boltBreachesBucket, boltCatalogBucket, boltDomainsBucket, boltStatsBucket, boltAPIKeysBucket, boltDataClassesBucket, boltPasswordsBucket, boltPasswordSourcesBucket, boltEmailHashesBucket, boltDomainEmailsBucket} {
+				if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+					return err
+				}
+			}
+			if hashesIndexed && domainsIndexed {
+				return nil
+			}
+			// I file creati prima dell'introduzione degli indici degli hash e dei domini
+			// li ricevono alla prima apertura in scrittura
+			hashes := tx.Bucket(boltEmailHashesBucket)
+			domains := tx.Bucket(boltDomainEmailsBucket)
+			return tx.Bucket(boltEmailsBucket).ForEach(func(email, _ []byte) error {
+				if !hashesIndexed {
+					if err := hashes.Put([]byte(normalize.Hash(string(email))), email); err != nil {
+						return err
+					}
+				}
+				if !domainsIndexed {
+					return domains.Put(boltDomainEmailKey(string(email)), nil)
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("errore durante l'inizializzazione del database embedded: %w", err)
+		}
+	}
+
+	return &Bolt{db: db}, nil
+}
+
+// FindEmail cerca un'email nei breach, restituendoli in ordine alfabetico.
+func (b *Bolt) FindEmail(ctx context.Context, email string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var breaches []string
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltEmailsBucket)
+		if bucket == nil {
+			return nil
+		}
+		value := bucket.Get([]byte(email))
+		if value == nil {
+			return nil
+		}
+		// Il valore è valido solo durante la transazione: la decodifica ne crea una copia
+		return json.Unmarshal(value, &breaches)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(breaches)
+	return breaches, nil
+}
+
+// GetAllBreaches restituisce un elenco di tutti i breach senza duplicati, in ordine alfabetico.
+// I breach sono le chiavi di un bucket dedicato, già ordinate: non serve scorrere le email.
+func (b *Bolt) GetAllBreaches(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	breaches := []string{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBreachesBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(name, _ []byte) error {
+			breaches = append(breaches, string(name))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return breaches, nil
+}
+
+// AddBreachEmails associa le email al breach in un'unica transazione.
+func (b *Bolt) AddBreachEmails(ctx context.Context, breach string, emails []string) (WriteResult, error) {
+	if err := ctx.Err(); err != nil {
+		return WriteResult{}, err
+	}
+
+	var result WriteResult
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		emailsBucket := tx.Bucket(boltEmailsBucket)
+		breachesBucket := tx.Bucket(boltBreachesBucket)
+		if emailsBucket == nil || breachesBucket == nil {
+			return errors.New("database embedded aperto in sola lettura")
+		}
+
+		domainsBucket := tx.Bucket(boltDomainsBucket)
+		statsBucket := tx.Bucket(boltStatsBucket)
+
+		var added, upserted int64
+		for _, email := range emails {
+			key := []byte(email)
+			var breaches []string
+			if value := emailsBucket.Get(key); value != nil {
+				result.MatchedCount++
+				if err := json.Unmarshal(value, &breaches); err != nil {
+					return fmt.Errorf("record corrotto per %s: %w", email, err)
+				}
+				if slices.Contains(breaches, breach) {
+					continue
+				}
+				result.ModifiedCount++
+			} else {
+				result.UpsertedCount++
+				upserted++
+				if err := addCounter(domainsBucket, []byte(EmailDomain(email)), 1); err != nil {
+					return err
+				}
+				if err := tx.Bucket(boltEmailHashesBucket).Put([]byte(normalize.Hash(email)), key); err != nil {
+					return err
+				}
+				if err := tx.Bucket(boltDomainEmailsBucket).Put(boltDomainEmailKey(email), nil); err != nil {
+					return err
+				}
+			}
+
+			breaches = append(breaches, breach)
+			value, err := json.Marshal(breaches)
+			if err != nil {
+				return err
+			}
+			if err := emailsBucket.Put(key, value); err != nil {
+				return err
+			}
+			added++
+		}
+
+		if added == 0 {
+			return nil
+		}
+		if err := addCounter(statsBucket, boltEmailsKey, upserted); err != nil {
+			return err
+		}
+		if err := addCounter(statsBucket, boltAssociationsKey, added); err != nil {
+			return err
+		}
+		return addCounter(breachesBucket, []byte(breach), added)
+	})
+	if err != nil {
+		return WriteResult{}, err
+	}
+	return result, nil
+}
+
+// getCounter legge un contatore uint64 big-endian; un bucket o una chiave assenti valgono zero.
+func getCounter(bucket *bolt.Bucket, key []byte) int64 {
+	if bucket == nil {
+		return 0
+	}
+	value := bucket.Get(key)
+	if len(value) != 8 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(value))
+}
+
+// addCounter somma delta a un contatore, eliminando la chiave quando arriva a zero.
+func addCounter(bucket *bolt.Bucket, key []byte, delta int64) error {
+	if bucket == nil {
+		return errors.New("database embedded aperto in sola lettura")
+	}
+	count := getCounter(bucket, key) + delta
+	if count <= 0 {
+		return bucket.Delete(key)
+	}
+	return bucket.Put(key, binary.BigEndian.AppendUint64(nil, uint64(count)))
+}
+
+// ForEachEmail scorre tutte le email del file in un'unica transazione di lettura.
+func (b *Bolt) ForEachEmail(ctx context.Context, fn func(Record) error) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltEmailsBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(email, value []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			record := Record{Email: string(email)}
+			if err := json.Unmarshal(value, &record.Breaches); err != nil {
+				return fmt.Errorf("record corrotto per %s: %w", email, err)
+			}
+			return fn(record)
+		})
+	})
+}
+
+// CountEmails restituisce il numero di email presenti nel file.
+func (b *Bolt) CountEmails(ctx context.Context) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	var count int64
+	err := b.db.View(func(tx *bolt.Tx) error {
+		if bucket := tx.Bucket(boltEmailsBucket); bucket != nil {
+			count = int64(bucket.Stats().KeyN)
+		}
+		return nil
+	})
+	return count, err
+}
+
+// GetBreach restituisce i metadati del breach, o nil se non è nel catalogo.
+func (b *Bolt) GetBreach(ctx context.Context, name string) (*Breach, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var breach *Breach
+	err := b.db.View(func(tx *bolt.Tx) error {
+		// I file creati prima del catalogo non hanno il bucket
+		bucket := tx.Bucket(boltCatalogBucket)
+		if bucket == nil {
+			return nil
+		}
+		value := bucket.Get([]byte(name))
+		if value == nil {
+			return nil
+		}
+		breach = &Breach{}
+		return json.Unmarshal(value, breach)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return breach, nil
+}
+
+// ListBreaches restituisce tutto il catalogo; le chiavi del bucket sono già in ordine alfabetico.
+func (b *Bolt) ListBreaches(ctx context.Context) ([]Breach, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	breaches := []Breach{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltCatalogBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(name, value []byte) error {
+			var breach Breach
+			if err := json.Unmarshal(value, &breach); err != nil {
+				return fmt.Errorf("metadati corrotti per %s: %w", name, err)
+			}
+			breaches = append(breaches, breach)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return breaches, nil
+}
+
+// UpsertBreach crea o sostituisce i metadati del breach nel catalogo.
+func (b *Bolt) UpsertBreach(ctx context.Context, breach Breach) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := breach.Validate(); err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(breach)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltCatalogBucket)
+		if bucket == nil {
+			return errors.New("database embedded aperto in sola lettura")
+		}
+		return bucket.Put([]byte(breach.Name), value)
+	})
+}
+
+// DeleteBreach elimina i metadati del breach dal catalogo.
+func (b *Bolt) DeleteBreach(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltCatalogBucket)
+		if bucket == nil {
+			return errors.New("database embedded aperto in sola lettura")
+		}
+		return bucket.Delete([]byte(name))
+	})
+}
+
+// GetAPIKey restituisce la chiave, o nil se non esiste.
+func (b *Bolt) GetAPIKey(ctx context.Context, id string) (*APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var key *APIKey
+	err := b.db.View(func(tx *bolt.Tx) error {
+		// I file creati prima delle chiavi API non hanno il bucket
+		bucket := tx.Bucket(boltAPIKeysBucket)
+		if bucket == nil {
+			return nil
+		}
+		value := bucket.Get([]byte(id))
+		if value == nil {
+			return nil
+		}
+		key = &APIKey{}
+		return json.Unmarshal(value, key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ListAPIKeys restituisce tutte le chiavi in ordine di creazione.
+func (b *Bolt) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	keys := []APIKey{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltAPIKeysBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(id, value []byte) error {
+			var key APIKey
+			if err := json.Unmarshal(value, &key); err != nil {
+				return fmt.Errorf("chiave API corrotta %s: %w", id, err)
+			}
+			keys = append(keys, key)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(keys, compareAPIKeys)
+	return keys, nil
+}
+
+// CreateAPIKey salva una nuova chiave.
+func (b *Bolt) CreateAPIKey(ctx context.Context, key APIKey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := key.Validate(); err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltAPIKeysBucket)
+		if bucket == nil {
+			return errors.New("database embedded aperto in sola lettura")
+		}
+		if bucket.Get([]byte(key.ID)) != nil {
+			return ErrAPIKeyExists
+		}
+		return bucket.Put([]byte(key.ID), value)
+	})
+}
+
+// RevokeAPIKey revoca la chiave, conservando la data di una revoca precedente.
+func (b *Bolt) RevokeAPIKey(ctx context.Context, id string, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltAPIKeysBucket)
+		if bucket == nil {
+			return errors.New("database embedded aperto in sola lettura")
+		}
+		value := bucket.Get([]byte(id))
+		if value == nil {
+			return ErrAPIKeyNotFound
+		}
+		var key APIKey
+		if err := json.Unmarshal(value, &key); err != nil {
+			return fmt.Errorf("chiave API corrotta %s: %w", id, err)
+		}
+		if !key.RevokedAt.IsZero() {
+			return nil
+		}
+		key.RevokedAt = at
+		value, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(id), value)
+	})
+}
+
+// SetAPIKeyDomains sostituisce i domini della chiave.
+func (b *Bolt) SetAPIKeyDomains(ctx context.Context, id string, domains []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltAPIKeysBucket)
+		if bucket == nil {
+			return errors.New("database embedded aperto in sola lettura")
+		}
+		value := bucket.Get([]byte(id))
+		if value == nil {
+			return ErrAPIKeyNotFound
+		}
+		var key APIKey
+		if err := json.Unmarshal(value, &key); err != nil {
+			return fmt.Errorf("chiave API corrotta %s: %w", id, err)
+		}
+		key.Domains = domains
+		value, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(id), value)
+	})
+}
+
+// RemoveBreach rimuove il breach da tutte le email, eliminando quelle rimaste senza breach,
+// in un'unica transazione. Il file non ha un indice per breach: vengono lette tutte le email.
+func (b *Bolt) RemoveBreach(ctx context.Context, breach string) (RemoveResult, error) {
+	var result RemoveResult
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		emailsBucket := tx.Bucket(boltEmailsBucket)
+		domainsBucket := tx.Bucket(boltDomainsBucket)
+		statsBucket := tx.Bucket(boltStatsBucket)
+		if emailsBucket == nil || domainsBucket == nil || statsBucket == nil {
+			return errors.New("database embedded aperto in sola lettura")
+		}
+
+		// Le modifiche vengono applicate dopo la scansione: bbolt non consente di modificare
+		// un bucket mentre lo si percorre. Un valore nil indica un'email da eliminare.
+		updates := make(map[string][]byte)
+		err := emailsBucket.ForEach(func(email, value []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			var breaches []string
+			if err := json.Unmarshal(value, &breaches); err != nil {
+				return fmt.Errorf("record corrotto per %s: %w", email, err)
+			}
+			i := slices.Index(breaches, breach)
+			if i < 0 {
+				return nil
+			}
+			if len(breaches) == 1 {
+				updates[string(email)] = nil
+				return nil
+			}
+			updated, err := json.Marshal(slices.Delete(breaches, i, i+1))
+			if err != nil {
+				return err
+			}
+			updates[string(email)] = updated
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		dataClassesBucket := tx.Bucket(boltDataClassesBucket)
+		for email, value := range updates {
+			result.UnlinkedCount++
+			if dataClassesBucket != nil {
+				if err := dataClassesBucket.Delete(boltDataClassesKey(email, breach)); err != nil {
+					return err
+				}
+			}
+			if value != nil {
+				if err := emailsBucket.Put([]byte(email), value); err != nil {
+					return err
+				}
+				continue
+			}
+			result.DeletedCount++
+			if err := emailsBucket.Delete([]byte(email)); err != nil {
+				return err
+			}
+			if err := deleteBoltEmailIndexes(tx, email); err != nil {
+				return err
+			}
+			if err := addCounter(domainsBucket, []byte(EmailDomain(email)), -1); err != nil {
+				return err
+			}
+		}
+
+		if err := addCounter(statsBucket, boltEmailsKey, -result.DeletedCount); err != nil {
+			return err
+		}
+		if err := addCounter(statsBucket, boltAssociationsKey, -result.UnlinkedCount); err != nil {
+			return err
+		}
+		return tx.Bucket(boltBreachesBucket).Delete([]byte(breach))
+	})
+	if err != nil {
+		return RemoveResult{}, err
+	}
+	return result, nil
+}
+
+// DeleteEmails elimina le email indicate e aggiorna i contatori in un'unica transazione.
+func (b *Bolt) DeleteEmails(ctx context.Context, emails []string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	var deleted int64
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		emailsBucket := tx.Bucket(boltEmailsBucket)
+		breachesBucket := tx.Bucket(boltBreachesBucket)
+		domainsBucket := tx.Bucket(boltDomainsBucket)
+		statsBucket := tx.Bucket(boltStatsBucket)
+		if emailsBucket == nil || breachesBucket == nil || domainsBucket == nil || statsBucket == nil {
+			return errors.New("database embedded aperto in sola lettura")
+		}
+
+		var associations int64
+		for _, email := range emails {
+			key := []byte(email)
+			value := emailsBucket.Get(key)
+			if value == nil {
+				continue
+			}
+			var breaches []string
+			if err := json.Unmarshal(value, &breaches); err != nil {
+				return fmt.Errorf("record corrotto per %s: %w", email, err)
+			}
+			for _, breach := range breaches {
+				if err := addCounter(breachesBucket, []byte(breach), -1); err != nil {
+					return err
+				}
+			}
+			if err := addCounter(domainsBucket, []byte(EmailDomain(email)), -1); err != nil {
+				return err
+			}
+			if err := emailsBucket.Delete(key); err != nil {
+				return err
+			}
+			if err := deleteBoltDataClasses(tx.Bucket(boltDataClassesBucket), email); err != nil {
+				return err
+			}
+			if err := deleteBoltEmailIndexes(tx, email); err != nil {
+				return err
+			}
+			associations += int64(len(breaches))
+			deleted++
+		}
+
+		if err := addCounter(statsBucket, boltEmailsKey, -deleted); err != nil {
+			return err
+		}
+		return addCounter(statsBucket, boltAssociationsKey, -associations)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// deleteBoltEmailIndexes elimina l'email dagli indici degli hash e dei domini.
+func deleteBoltEmailIndexes(tx *bolt.Tx, email string) error {
+	if bucket := tx.Bucket(boltEmailHashesBucket); bucket != nil {
+		if err := bucket.Delete([]byte(normalize.Hash(email))); err != nil {
+			return err
+		}
+	}
+	if bucket := tx.Bucket(boltDomainEmailsBucket); bucket != nil {
+		return bucket.Delete(boltDomainEmailKey(email))
+	}
+	return nil
+}
+
+// boltDomainEmailKey restituisce la chiave dell'email nell'indice dei domini: il dominio, il byte 0
+// e l'email, così le email di un dominio sono contigue e in ordine.
+func boltDomainEmailKey(email string) []byte {
+	return []byte(EmailDomain(email) + "\x00" + email)
+}
+
+// FindDomainEmails scorre l'indice dei domini dalla prima email successiva ad after e ne cerca i breach.
+// Come per FindEmailRange, un file creato prima dell'introduzione dell'indice non lo ha finché
+// pwnadmin non lo apre in scrittura.
+func (b *Bolt) FindDomainEmails(ctx context.Context, domain, after string, limit int) ([]Record, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	records := []Record{}
+	err := b.forEachDomainEmail(domain, after, func(email string, breaches []string) bool {
+		if len(records) >= limit {
+			return false
+		}
+		records = append(records, Record{Email: email, Breaches: breaches})
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// DomainBreachStats scorre le email del dominio e ne conta i breach.
+func (b *Bolt) DomainBreachStats(ctx context.Context, domain string) ([]BreachStat, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64)
+	err := b.forEachDomainEmail(domain, "", func(_ string, breaches []string) bool {
+		for _, breach := range breaches {
+			counts[breach]++
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]BreachStat, 0, len(counts))
+	for breach, accounts := range counts {
+		stats = append(stats, BreachStat{Name: breach, Accounts: accounts})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats, nil
+}
+
+// forEachDomainEmail chiama fn, in ordine, per le email del dominio successive ad after con i loro
+// breach in ordine alfabetico, finché fn restituisce true.
+func (b *Bolt) forEachDomainEmail(domain, after string, fn func(email string, breaches []string) bool) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		index := tx.Bucket(boltDomainEmailsBucket)
+		emails := tx.Bucket(boltEmailsBucket)
+		if index == nil || emails == nil {
+			return errors.New("il database embedded non ha l'indice dei domini: aprirlo in scrittura con pwnadmin per crearlo")
+		}
+		prefix := []byte(domain + "\x00")
+		cursor := index.Cursor()
+		start := append(slices.Clone(prefix), after...)
+		key, _ := cursor.Seek(start)
+		if after != "" && bytes.Equal(key, start) {
+			key, _ = cursor.Next() // La pagina precedente terminava con after
+		}
+		for ; key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Next() {
+			email := string(key[len(prefix):])
+			value := emails.Get([]byte(email))
+			if value == nil {
+				continue
+			}
+			var breaches []string
+			if err := json.Unmarshal(value, &breaches); err != nil {
+				return fmt.Errorf("record corrotto per %s: %w", email, err)
+			}
+			sort.Strings(breaches)
+			if !fn(email, breaches) {
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
+// FindEmailRange legge dall'indice degli hash, le cui chiavi sono in ordine, le email con l'hash che
+// inizia con prefix e ne cerca i breach. Un file creato prima dell'introduzione dell'indice non lo ha
+// finché pwnadmin non lo apre in scrittura: la ricerca fallisce invece di non trovare nulla.
+func (b *Bolt) FindEmailRange(ctx context.Context, prefix string) ([]EmailHashMatch, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	matches := []EmailHashMatch{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		hashes := tx.Bucket(boltEmailHashesBucket)
+		emails := tx.Bucket(boltEmailsBucket)
+		if hashes == nil || emails == nil {
+			return errors.New("il database embedded non ha l'indice degli hash delle email: aprirlo in scrittura con pwnadmin per crearlo")
+		}
+		start := []byte(strings.ToUpper(prefix))
+		cursor := hashes.Cursor()
+		for key, email := cursor.Seek(start); key != nil && bytes.HasPrefix(key, start); key, email = cursor.Next() {
+			value := emails.Get(email)
+			if value == nil {
+				continue
+			}
+			var breaches []string
+			if err := json.Unmarshal(value, &breaches); err != nil {
+				return fmt.Errorf("record corrotto per %s: %w", email, err)
+			}
+			sort.Strings(breaches)
+			matches = append(matches, EmailHashMatch{Suffix: string(key[len(start):]), Breaches: breaches})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// boltDataClassesKey restituisce la chiave delle classi di dati dell'email nel breach. Il byte 0,
+// che non compare nelle email, separa le due parti: le chiavi di un'email sono contigue.
+func boltDataClassesKey(email, breach string) []byte {
+	return []byte(email + "\x00" + breach)
+}
+
+// deleteBoltDataClasses elimina le classi di dati dell'email in tutti i breach.
+func deleteBoltDataClasses(bucket *bolt.Bucket, email string) error {
+	if bucket == nil {
+		return nil
+	}
+	prefix := boltDataClassesKey(email, "")
+	cursor := bucket.Cursor()
+	for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Seek(prefix) {
+		if err := cursor.Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddDataClasses aggiunge le classi di dati esposte dalle email nel breach in un'unica transazione.
+// Le email non associate al breach vengono ignorate.
+func (b *Bolt) AddDataClasses(ctx context.Context, breach string, classes map[string][]string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		emailsBucket := tx.Bucket(boltEmailsBucket)
+		bucket := tx.Bucket(boltDataClassesBucket)
+		if emailsBucket == nil || bucket == nil {
+			return errors.New("database embedded aperto in sola lettura")
+		}
+
+		for email, emailClasses := range classes {
+			if len(emailClasses) == 0 {
+				continue
+			}
+			value := emailsBucket.Get([]byte(email))
+			if value == nil {
+				continue
+			}
+			var breaches []string
+			if err := json.Unmarshal(value, &breaches); err != nil {
+				return fmt.Errorf("record corrotto per %s: %w", email, err)
+			}
+			if !slices.Contains(breaches, breach) {
+				continue
+			}
+
+			key := boltDataClassesKey(email, breach)
+			var current []string
+			if value := bucket.Get(key); value != nil {
+				if err := json.Unmarshal(value, &current); err != nil {
+					return fmt.Errorf("classi di dati corrotte per %s: %w", email, err)
+				}
+			}
+			merged := mergeDataClasses(current, emailClasses)
+			if len(merged) == len(current) {
+				continue
+			}
+			value, err := json.Marshal(merged)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(key, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// FindDataClasses legge le classi di dati esposte dall'email, le cui chiavi sono contigue nel bucket.
+// I file creati prima dell'introduzione delle classi di dati non hanno il bucket: nessuna classe.
+func (b *Bolt) FindDataClasses(ctx context.Context, email string) (map[string][]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var result map[string][]string
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltDataClassesBucket)
+		if bucket == nil {
+			return nil
+		}
+		prefix := boltDataClassesKey(email, "")
+		cursor := bucket.Cursor()
+		for key, value := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, value = cursor.Next() {
+			var classes []string
+			if err := json.Unmarshal(value, &classes); err != nil {
+				return fmt.Errorf("classi di dati corrotte per %s: %w", email, err)
+			}
+			if result == nil {
+				result = make(map[string][]string)
+			}
+			result[string(key[len(prefix):])] = classes
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Sotto-bucket di un'origine in password_sources
+var (
+	boltPasswordCountsBucket = []byte("counts")
+	boltPasswordBlocksBucket = []byte("blocks")
+)
+
+// ResetPasswordHashes toglie dai conteggi le occorrenze registrate per l'origine in un'unica transazione.
+func (b *Bolt) ResetPasswordHashes(ctx context.Context, source string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		sources := tx.Bucket(boltPasswordSourcesBucket)
+		if sources == nil {
+			return errors.New("database embedded aperto in sola lettura")
+		}
+		bucket := sources.Bucket([]byte(source))
+		if bucket == nil {
+			return nil
+		}
+		passwords := tx.Bucket(boltPasswordsBucket)
+		err := bucket.Bucket(boltPasswordCountsBucket).ForEach(func(hash, value []byte) error {
+			return addCounter(passwords, hash, -int64(binary.BigEndian.Uint64(value)))
+		})
+		if err != nil {
+			return err
+		}
+		return sources.DeleteBucket([]byte(source))
+	})
+}
+
+// AddPasswordHashes somma le occorrenze degli hash delle password e registra il blocco dell'origine
+// in un'unica transazione; un blocco già registrato viene ignorato.
+func (b *Bolt) AddPasswordHashes(ctx context.Context, source string, block int, counts map[string]int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if source == "" {
+		return errors.New("origine degli hash delle password vuota")
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		sources := tx.Bucket(boltPasswordSourcesBucket)
+		if sources == nil {
+			return errors.New("database embedded aperto in sola lettura")
+		}
+		bucket, err := sources.CreateBucketIfNotExists([]byte(source))
+		if err != nil {
+			return err
+		}
+		blocks, err := bucket.CreateBucketIfNotExists(boltPasswordBlocksBucket)
+		if err != nil {
+			return err
+		}
+		sourceCounts, err := bucket.CreateBucketIfNotExists(boltPasswordCountsBucket)
+		if err != nil {
+			return err
+		}
+
+		key := binary.BigEndian.AppendUint64(nil, uint64(block))
+		if blocks.Get(key) != nil {
+			return nil
+		}
+		if err := blocks.Put(key, []byte{1}); err != nil {
+			return err
+		}
+		passwords := tx.Bucket(boltPasswordsBucket)
+		for hash, count := range normalizePasswordCounts(counts) {
+			if err := addCounter(sourceCounts, []byte(hash), count); err != nil {
+				return err
+			}
+			if err := addCounter(passwords, []byte(hash), count); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PasswordRange legge gli hash con il prefisso indicato, le cui chiavi sono contigue nel bucket.
+// I file creati prima dell'introduzione degli hash delle password non hanno il bucket: nessun hash.
+func (b *Bolt) PasswordRange(ctx context.Context, prefix string) ([]PasswordHash, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	hashes := []PasswordHash{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltPasswordsBucket)
+		if bucket == nil {
+			return nil
+		}
+		start := []byte(strings.ToUpper(prefix))
+		cursor := bucket.Cursor()
+		for key, value := cursor.Seek(start); key != nil && bytes.HasPrefix(key, start); key, value = cursor.Next() {
+			if len(value) != 8 {
+				return fmt.Errorf("contatore corrotto per l'hash %s", key)
+			}
+			hashes = append(hashes, PasswordHash{Suffix: string(key[len(start):]), Count: int64(binary.BigEndian.Uint64(value))})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+// BreachStats legge il numero di email di ogni breach; le chiavi del bucket sono già in ordine alfabetico.
+func (b *Bolt) BreachStats(ctx context.Context) ([]BreachStat, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	stats := []BreachStat{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBreachesBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(name, _ []byte) error {
+			stats = append(stats, BreachStat{Name: string(name), Accounts: getCounter(bucket, name)})
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// TopDomains legge tutti i contatori dei domini e restituisce i più numerosi.
+func (b *Bolt) TopDomains(ctx context.Context, limit int) ([]DomainStat, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltDomainsBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(domain, _ []byte) error {
+			counts[string(domain)] = getCounter(bucket, domain)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return topDomains(counts, limit), nil
+}
+
+// GlobalStats legge i contatori globali.
+func (b *Bolt) GlobalStats(ctx context.Context) (Stats, error) {
+	if err := ctx.Err(); err != nil {
+		return Stats{}, err
+	}
+
+	var stats Stats
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltStatsBucket)
+		stats.Emails = getCounter(bucket, boltEmailsKey)
+		stats.Associations = getCounter(bucket, boltAssociationsKey)
+		if reconciled := getCounter(bucket, boltReconciledKey); reconciled > 0 {
+			stats.ReconciledAt = time.Unix(reconciled, 0).UTC()
+		}
+		if breaches := tx.Bucket(boltBreachesBucket); breaches != nil {
+			stats.Breaches = int64(breaches.Stats().KeyN)
+		}
+		return nil
+	})
+	return stats, err
+}
+
+// ReconcileStats ricostruisce i contatori leggendo tutte le email in un'unica transazione.
+func (b *Bolt) ReconcileStats(ctx context.Context) (Stats, error) {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		emailsBucket := tx.Bucket(boltEmailsBucket)
+		if emailsBucket == nil {
+			return errors.New("database embedded aperto in sola lettura")
+		}
+
+		breaches := make(map[string]int64)
+		domains := make(map[string]int64)
+		var emails, associations int64
+		err := emailsBucket.ForEach(func(email, value []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			var list []string
+			if err := json.Unmarshal(value, &list); err != nil {
+				return fmt.Errorf("record corrotto per %s: %w", email, err)
+			}
+			for _, breach := range list {
+				breaches[breach]++
+			}
+			domains[EmailDomain(string(email))]++
+			emails++
+			associations += int64(len(list))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// I bucket dei contatori vengono ricreati da zero
+		for name, counts := range map[string]map[string]int64{
+			string(boltBreachesBucket): breaches,
+			string(boltDomainsBucket):  domains,
+			string(boltStatsBucket): {
+				string(boltEmailsKey):       emails,
+				string(boltAssociationsKey): associations,
+				string(boltReconciledKey):   time.Now().Unix(),
+			},
+		} {
+			if err := tx.DeleteBucket([]byte(name)); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+				return err
+			}
+			bucket, err := tx.CreateBucket([]byte(name))
+			if err != nil {
+				return err
+			}
+			for key, count := range counts {
+				if err := addCounter(bucket, []byte(key), count); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Stats{}, err
+	}
+	return b.GlobalStats(ctx)
+}
+
+// Ping verifica che il file sia aperto e leggibile.
+func (b *Bolt) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(boltEmailsBucket) == nil {
+			return fmt.Errorf("il file %s non contiene il bucket delle email", b.db.Path())
+		}
+		return nil
+	})
+}
+
+// Close chiude il file embedded.
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,26 @@
+package database_test
+
+import (
+	"context"
+	"path/filepath"
+	"pwnscanner/pkg/database"
+	"pwnscanner/pkg/database/dbtest"
+	"testing"
+)
+
+func TestBoltContract(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, seed []database.Record) database.Database {
+		db, err := database.NewBolt(filepath.Join(t.TempDir(), "pwnscanner.db"), false)
+		if err != nil {
+			t.Fatalf("NewBolt: %v", err)
+		}
+		for _, r := range seed {
+			for _, breach := range r.Breaches {
+				if _, err := db.AddBreachEmails(context.Background(), breach, []string{r.Email}); err != nil {
+					t.Fatalf("AddBreachEmails: %v", err)
+				}
+			}
+		}
+		return db
+	})
+}
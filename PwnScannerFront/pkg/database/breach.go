@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BreachDateLayout è il formato della data del breach (solo giorno).
+const BreachDateLayout = "2006-01-02"
+
+// Breach descrive un breach con i metadati mostrati ai client.
+// @Description Metadati di un breach
+type Breach struct {
+	Name        string    `json:"name" bson:"_id"`
+	Title       string    `json:"title" bson:"title"`
+	Domain      string    `json:"domain" bson:"domain"`
+	BreachDate  string    `json:"breach_date" bson:"breach_date"` // AAAA-MM-GG
+	AddedDate   time.Time `json:"added_date" bson:"added_date"`
+	Description string    `json:"description" bson:"description"`
+	DataClasses []string  `json:"data_classes" bson:"data_classes"`
+	PwnCount    int64     `json:"pwn_count" bson:"pwn_count"`
+	IsVerified  bool      `json:"is_verified" bson:"is_verified"`
+	IsSensitive bool      `json:"is_sensitive" bson:"is_sensitive"`
+	LogoPath    string    `json:"logo_path" bson:"logo_path"`
+}
+
+// Validate controlla i campi del breach prima del salvataggio.
+func (b Breach) Validate() error {
+	var errs []error
+	if strings.TrimSpace(b.Name) == "" {
+		errs = append(errs, errors.New("il nome del breach è obbligatorio"))
+	}
+	if b.BreachDate != "" {
+		if _, err := time.Parse(BreachDateLayout, b.BreachDate); err != nil {
+			errs = append(errs, fmt.Errorf("data del breach non valida %q (formato AAAA-MM-GG)", b.BreachDate))
+		}
+	}
+	if b.PwnCount < 0 {
+		errs = append(errs, errors.New("il numero di account non può essere negativo"))
+	}
+	return errors.Join(errs...)
+}
+
+// BreachCatalog è implementato dai database che conservano i metadati dei breach.
+type BreachCatalog interface {
+	// GetBreach restituisce i metadati del breach, o nil (senza errore) se non è nel catalogo
+	GetBreach(ctx context.Context, name string) (*Breach, error)
+
+	// ListBreaches restituisce tutti i breach del catalogo in ordine alfabetico di nome
+	ListBreaches(ctx context.Context) ([]Breach, error)
+}
+
+// BreachCatalogWriter è implementato dai database in cui pwnadmin può modificare il catalogo.
+type BreachCatalogWriter interface {
+	BreachCatalog
+
+	// UpsertBreach crea o sostituisce i metadati del breach
+	UpsertBreach(ctx context.Context, breach Breach) error
+
+	// DeleteBreach elimina i metadati del breach (non le email associate)
+	DeleteBreach(ctx context.Context, name string) error
+}
+
+// EnsureBreach crea nel catalogo una voce minima per il breach, se non esiste già.
+// Viene usata dall'import, così ogni breach caricato compare nel catalogo con la data di aggiunta.
+func EnsureBreach(ctx context.Context, catalog BreachCatalogWriter, name string) error {
+	existing, err := catalog.GetBreach(ctx, name)
+	if err != nil || existing != nil {
+		return err
+	}
+	return catalog.UpsertBreach(ctx, Breach{
+		Name:        name,
+		Title:       name,
+		AddedDate:   time.Now().UTC(),
+		DataClasses: []string{"Email addresses"},
+	})
+}
@@ -1,9 +1,35 @@
 package database
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrUnavailable indica che il database non è raggiungibile (connessione rifiutata, server non selezionabile
+// o in arresto): a differenza degli altri errori, l'operazione può riuscire se ripetuta più tardi.
+var ErrUnavailable = errors.New("database non disponibile")
+
+// ErrConflict indica che una scrittura è stata annullata dal database per un conflitto con una scrittura
+// concorrente (write conflict, deadlock, errore di serializzazione): ripetuta, può riuscire.
+var ErrConflict = errors.New("conflitto con una scrittura concorrente")
+
+// IsTransient indica se l'operazione fallita con err può riuscire se ripetuta (ErrUnavailable o ErrConflict).
+func IsTransient(err error) bool {
+	return errors.Is(err, ErrUnavailable) || errors.Is(err, ErrConflict)
+}
 
 // Database è l'interfaccia per astrarre le operazioni sul database
 // @Description Interfaccia che definisce le operazioni principali del database
+//
+// Tutte le implementazioni devono rispettare la stessa semantica, verificata dalla suite in pkg/database/dbtest:
+//   - FindEmail confronta l'email in modo esatto e restituisce nil (senza errore) se non la trova;
+//     altrimenti restituisce i breach senza duplicati, in ordine alfabetico.
+//   - GetAllBreaches restituisce i breach senza duplicati in ordine alfabetico,
+//     e una slice vuota (non nil) se il database non contiene breach.
+//   - Con un contesto annullato o scaduto le operazioni falliscono con un errore riconoscibile con errors.Is
+//     (context.Canceled o context.DeadlineExceeded); i database di rete segnalano con ErrUnavailable
+//     l'impossibilità di raggiungere il server.
 type Database interface {
 	// FindEmail cerca un'email nei breach
 	FindEmail(ctx context.Context, email string) ([]string, error)
@@ -14,3 +40,73 @@ type Database interface {
 	// Close chiude la connessione al database
 	Close() error
 }
+
+// Writer è l'interfaccia per le operazioni di scrittura usate dall'import di pwnadmin.
+type Writer interface {
+	// AddBreachEmails associa le email al breach con semantica add-to-set,
+	// creando le email non ancora presenti nel database. Può essere chiamato in modo concorrente,
+	// anche con email in comune; gli errori che IsTransient riconosce possono essere ripetuti
+	// senza effetti sui dati, perché la scrittura è idempotente.
+	AddBreachEmails(ctx context.Context, breach string, emails []string) (WriteResult, error)
+
+	// CountEmails restituisce il numero di email presenti nel database
+	CountEmails(ctx context.Context) (int64, error)
+
+	// Close chiude la connessione al database
+	Close() error
+}
+
+// WriteResult riassume l'esito di una scrittura, con la stessa semantica del BulkWrite di MongoDB.
+type WriteResult struct {
+	// MatchedCount è il numero di email già presenti nel database
+	MatchedCount int64
+	// ModifiedCount è il numero di email già presenti a cui è stato aggiunto il breach
+	ModifiedCount int64
+	// UpsertedCount è il numero di email create
+	UpsertedCount int64
+}
+
+// Add somma i conteggi di un'altra scrittura.
+func (r *WriteResult) Add(other WriteResult) {
+	r.MatchedCount += other.MatchedCount
+	r.ModifiedCount += other.ModifiedCount
+	r.UpsertedCount += other.UpsertedCount
+}
+
+// Exporter è implementato dai database che permettono di scorrere tutte le email,
+// ad esempio per esportare uno snapshot.
+type Exporter interface {
+	// ForEachEmail chiama fn per ogni email presente; si interrompe al primo errore restituito da fn
+	ForEachEmail(ctx context.Context, fn func(Record) error) error
+}
+
+// Record rappresenta un'email con i breach in cui compare.
+// È il formato usato per popolare i database (fixture, suite di test) e per esportarli.
+type Record struct {
+	Email    string   `json:"email" bson:"email"`
+	Breaches []string `json:"breaches" bson:"breaches"`
+}
+
+// EmailDeleter è implementato dai database da cui pwnadmin può eliminare singole email,
+// ad esempio quando la migrazione della normalizzazione unisce i duplicati.
+type EmailDeleter interface {
+	// DeleteEmails elimina le email indicate con tutte le loro associazioni, aggiornando i contatori,
+	// e restituisce quante ne ha eliminate. Le email assenti vengono ignorate.
+	DeleteEmails(ctx context.Context, emails []string) (int64, error)
+}
+
+// Pinger è implementato dai database che possono verificare di essere raggiungibili,
+// usato dagli endpoint di readiness. I database in memoria non lo implementano: sono sempre pronti.
+type Pinger interface {
+	// Ping verifica la connessione al database; fallisce con ErrUnavailable se il server non è raggiungibile
+	Ping(ctx context.Context) error
+}
+
+// contextError avvolge err nell'errore del contesto, se il contesto è stato annullato o è scaduto,
+// così che il chiamante lo riconosca con errors.Is anche quando il driver non lo conserva.
+func contextError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil && err != nil && !errors.Is(err, ctxErr) {
+		return fmt.Errorf("%w: %w", ctxErr, err)
+	}
+	return err
+}
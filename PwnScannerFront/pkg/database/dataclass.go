@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"sort"
+)
+
+// Classi di dati esposte da un'email in un breach, registrate dall'import di pwnadmin.
+// Vengono conservate solo le classi, mai i valori (password, hash, numeri di telefono, indirizzi IP).
+const (
+	// DataClassPassword indica una password in chiaro
+	DataClassPassword = "password"
+	// DataClassPasswordHash è il prefisso delle classi degli hash delle password, seguito dall'algoritmo
+	// (ad esempio "password_hash:bcrypt"); vedi PasswordHashClass
+	DataClassPasswordHash = "password_hash"
+	// DataClassUsername indica uno username
+	DataClassUsername = "username"
+	// DataClassPhone indica un numero di telefono
+	DataClassPhone = "phone"
+	// DataClassIP indica un indirizzo IP
+	DataClassIP = "ip_address"
+	// DataClassName indica il nome della persona
+	DataClassName = "name"
+)
+
+// PasswordHashClass restituisce la classe dell'hash di una password calcolato con l'algoritmo indicato.
+func PasswordHashClass(algorithm string) string {
+	return DataClassPasswordHash + ":" + algorithm
+}
+
+// DataClassWriter è implementato dai database in cui pwnadmin può registrare le classi di dati
+// esposte da ogni email in un breach.
+type DataClassWriter interface {
+	// AddDataClasses aggiunge, con semantica add-to-set, le classi di dati esposte da ogni email
+	// (chiave della mappa) nel breach. Le email devono essere già associate al breach con AddBreachEmails.
+	// Come AddBreachEmails può essere chiamato in modo concorrente e ripetuto dopo un errore transitorio.
+	AddDataClasses(ctx context.Context, breach string, classes map[string][]string) error
+}
+
+// DataClassReader è implementato dai database che conservano le classi di dati esposte.
+type DataClassReader interface {
+	// FindDataClasses restituisce le classi di dati esposte dall'email in ogni breach, in ordine
+	// alfabetico e senza duplicati; i breach senza classi registrate non compaiono. Restituisce nil
+	// (senza errore) se per l'email non è registrata nessuna classe.
+	FindDataClasses(ctx context.Context, email string) (map[string][]string, error)
+}
+
+// mergeDataClasses aggiunge a current le classi mancanti e restituisce il risultato ordinato.
+func mergeDataClasses(current, classes []string) []string {
+	merged := slices.Clone(current)
+	for _, class := range classes {
+		if class != "" && !slices.Contains(merged, class) {
+			merged = append(merged, class)
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
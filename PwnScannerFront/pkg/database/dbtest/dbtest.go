@@ -0,0 +1,1051 @@
+// Package dbtest contiene la suite di contratto che ogni implementazione di database.Database deve superare.
+//
+// Un backend la esegue dal proprio file di test fornendo una Factory:
+//
+//	func TestContract(t *testing.T) {
+//		dbtest.Run(t, func(t *testing.T, seed []database.Record) database.Database {
+//			db := database.NewMemory()
+//			for _, r := range seed {
+//				db.Add(r.Email, r.Breaches...)
+//			}
+//			return db
+//		})
+//	}
+package dbtest
+
+import (
+	"context"
+	"errors"
+	"pwnscanner/pkg/database"
+	"pwnscanner/pkg/normalize"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Factory crea un'istanza vuota del database e la popola con i record indicati, nell'ordine dato.
+// Record con la stessa email vanno uniti con semantica add-to-set, come fa l'import di pwnadmin.
+// La suite chiama Close sull'istanza restituita al termine di ogni sotto-test.
+type Factory func(t *testing.T, seed []database.Record) database.Database
+
+// Run esegue la suite di contratto sul database creato da newDB.
+func Run(t *testing.T, newDB Factory) {
+	t.Helper()
+
+	for _, tc := range []struct {
+		name string
+		run  func(t *testing.T, newDB Factory)
+	}{
+		{"FindEmailNotFound", testFindEmailNotFound},
+		{"FindEmailFound", testFindEmailFound},
+		{"FindEmailExactMatch", testFindEmailExactMatch},
+		{"FindEmailSorted", testFindEmailSorted},
+		{"FindEmailNoDuplicates", testFindEmailNoDuplicates},
+		{"FindEmailReturnsCopy", testFindEmailReturnsCopy},
+		{"GetAllBreachesEmpty", testGetAllBreachesEmpty},
+		{"GetAllBreachesUniqueSorted", testGetAllBreachesUniqueSorted},
+		{"CancelledContext", testCancelledContext},
+		{"CatalogNotFound", testCatalogNotFound},
+		{"CatalogUpsertReplaces", testCatalogUpsertReplaces},
+		{"CatalogListSorted", testCatalogListSorted},
+		{"CatalogDelete", testCatalogDelete},
+		{"CatalogValidation", testCatalogValidation},
+		{"APIKeyRoundTrip", testAPIKeyRoundTrip},
+		{"APIKeyDuplicate", testAPIKeyDuplicate},
+		{"APIKeyRevoke", testAPIKeyRevoke},
+		{"APIKeyDomains", testAPIKeyDomains},
+		{"APIKeyListSorted", testAPIKeyListSorted},
+		{"RateLimitTakeTokens", testRateLimitTakeTokens},
+		{"RateLimitPrune", testRateLimitPrune},
+		{"StatsMatchData", testStatsMatchData},
+		{"StatsReconcile", testStatsReconcile},
+		{"RemoveBreach", testRemoveBreach},
+		{"DeleteEmails", testDeleteEmails},
+		{"DataClasses", testDataClasses},
+		{"DataClassesRemoved", testDataClassesRemoved},
+		{"PasswordRange", testPasswordRange},
+		{"PasswordSources", testPasswordSources},
+		{"EmailRange", testEmailRange},
+		{"DomainSearch", testDomainSearch},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, newDB)
+		})
+	}
+}
+
+// open crea il database e ne registra la chiusura.
+func open(t *testing.T, newDB Factory, seed ...database.Record) database.Database {
+	t.Helper()
+	db := newDB(t, seed)
+	t.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("Close: errore inatteso: %v", err)
+		}
+	})
+	return db
+}
+
+// findEmail chiama FindEmail e fallisce il test in caso di errore.
+func findEmail(t *testing.T, db database.Database, email string) []string {
+	t.Helper()
+	breaches, err := db.FindEmail(context.Background(), email)
+	if err != nil {
+		t.Fatalf("FindEmail(%q): errore inatteso: %v", email, err)
+	}
+	return breaches
+}
+
+func testFindEmailNotFound(t *testing.T, newDB Factory) {
+	db := open(t, newDB, database.Record{Email: "alice@example.com", Breaches: []string{"Adobe"}})
+
+	if got := findEmail(t, db, "bob@example.com"); got != nil {
+		t.Errorf("FindEmail su email assente: atteso nil, ottenuto %#v", got)
+	}
+}
+
+func testFindEmailFound(t *testing.T, newDB Factory) {
+	db := open(t, newDB,
+		database.Record{Email: "alice@example.com", Breaches: []string{"Adobe", "LinkedIn"}},
+		database.Record{Email: "bob@example.com", Breaches: []string{"Dropbox"}},
+	)
+
+	if got, want := findEmail(t, db, "alice@example.com"), []string{"Adobe", "LinkedIn"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindEmail: atteso %v, ottenuto %v", want, got)
+	}
+	if got, want := findEmail(t, db, "bob@example.com"), []string{"Dropbox"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindEmail: atteso %v, ottenuto %v", want, got)
+	}
+}
+
+func testFindEmailExactMatch(t *testing.T, newDB Factory) {
+	db := open(t, newDB, database.Record{Email: "alice@example.com", Breaches: []string{"Adobe"}})
+
+	for _, email := range []string{"Alice@example.com", " alice@example.com", "alice@example.co", "alice"} {
+		if got := findEmail(t, db, email); got != nil {
+			t.Errorf("FindEmail(%q): il confronto deve essere esatto, ottenuto %v", email, got)
+		}
+	}
+}
+
+func testFindEmailSorted(t *testing.T, newDB Factory) {
+	db := open(t, newDB,
+		database.Record{Email: "alice@example.com", Breaches: []string{"Zynga"}},
+		database.Record{Email: "alice@example.com", Breaches: []string{"Adobe"}},
+		database.Record{Email: "alice@example.com", Breaches: []string{"MySpace"}},
+	)
+
+	if got, want := findEmail(t, db, "alice@example.com"), []string{"Adobe", "MySpace", "Zynga"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindEmail deve restituire i breach in ordine alfabetico: atteso %v, ottenuto %v", want, got)
+	}
+}
+
+func testFindEmailNoDuplicates(t *testing.T, newDB Factory) {
+	db := open(t, newDB,
+		database.Record{Email: "alice@example.com", Breaches: []string{"Adobe", "Adobe"}},
+		database.Record{Email: "alice@example.com", Breaches: []string{"LinkedIn", "Adobe"}},
+	)
+
+	if got, want := findEmail(t, db, "alice@example.com"), []string{"Adobe", "LinkedIn"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindEmail non deve restituire duplicati: atteso %v, ottenuto %v", want, got)
+	}
+}
+
+func testFindEmailReturnsCopy(t *testing.T, newDB Factory) {
+	db := open(t, newDB, database.Record{Email: "alice@example.com", Breaches: []string{"Adobe"}})
+
+	first := findEmail(t, db, "alice@example.com")
+	first[0] = "Modificato"
+
+	if got, want := findEmail(t, db, "alice@example.com"), []string{"Adobe"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("modificare il risultato non deve alterare il database: atteso %v, ottenuto %v", want, got)
+	}
+}
+
+func testGetAllBreachesEmpty(t *testing.T, newDB Factory) {
+	db := open(t, newDB)
+
+	got, err := db.GetAllBreaches(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllBreaches: errore inatteso: %v", err)
+	}
+	if got == nil || len(got) != 0 {
+		t.Errorf("GetAllBreaches su database vuoto: attesa slice vuota non nil, ottenuto %#v", got)
+	}
+}
+
+func testGetAllBreachesUniqueSorted(t *testing.T, newDB Factory) {
+	db := open(t, newDB,
+		database.Record{Email: "alice@example.com", Breaches: []string{"LinkedIn", "Adobe"}},
+		database.Record{Email: "bob@example.com", Breaches: []string{"Adobe", "Zynga"}},
+		database.Record{Email: "carol@example.com", Breaches: []string{"Dropbox"}},
+	)
+
+	got, err := db.GetAllBreaches(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllBreaches: errore inatteso: %v", err)
+	}
+	want := []string{"Adobe", "Dropbox", "LinkedIn", "Zynga"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetAllBreaches: atteso %v, ottenuto %v", want, got)
+	}
+	if !sort.StringsAreSorted(got) {
+		t.Errorf("GetAllBreaches deve restituire i breach in ordine alfabetico: %v", got)
+	}
+}
+
+func testCancelledContext(t *testing.T, newDB Factory) {
+	db := open(t, newDB, database.Record{Email: "alice@example.com", Breaches: []string{"Adobe"}})
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+
+	for _, tc := range []struct {
+		ctx  context.Context
+		want error
+	}{
+		{cancelled, context.Canceled},
+		{expired, context.DeadlineExceeded},
+	} {
+		if _, err := db.FindEmail(tc.ctx, "alice@example.com"); !errors.Is(err, tc.want) {
+			t.Errorf("FindEmail con contesto terminato: atteso %v, ottenuto %v", tc.want, err)
+		}
+		if _, err := db.GetAllBreaches(tc.ctx); !errors.Is(err, tc.want) {
+			t.Errorf("GetAllBreaches con contesto terminato: atteso %v, ottenuto %v", tc.want, err)
+		}
+	}
+}
+
+// openCatalog crea il database e salta il test se non implementa il catalogo dei breach.
+func openCatalog(t *testing.T, newDB Factory) database.BreachCatalogWriter {
+	t.Helper()
+	catalog, ok := open(t, newDB).(database.BreachCatalogWriter)
+	if !ok {
+		t.Skip("il database non implementa database.BreachCatalogWriter")
+	}
+	return catalog
+}
+
+// upsertBreach chiama UpsertBreach e fallisce il test in caso di errore.
+func upsertBreach(t *testing.T, catalog database.BreachCatalogWriter, breach database.Breach) {
+	t.Helper()
+	if err := catalog.UpsertBreach(context.Background(), breach); err != nil {
+		t.Fatalf("UpsertBreach(%q): errore inatteso: %v", breach.Name, err)
+	}
+}
+
+func testCatalogNotFound(t *testing.T, newDB Factory) {
+	catalog := openCatalog(t, newDB)
+
+	got, err := catalog.GetBreach(context.Background(), "Adobe")
+	if err != nil {
+		t.Fatalf("GetBreach: errore inatteso: %v", err)
+	}
+	if got != nil {
+		t.Errorf("GetBreach su breach assente: atteso nil, ottenuto %#v", got)
+	}
+}
+
+func testCatalogUpsertReplaces(t *testing.T, newDB Factory) {
+	catalog := openCatalog(t, newDB)
+
+	added := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	upsertBreach(t, catalog, database.Breach{Name: "Adobe", Title: "Vecchio", AddedDate: added})
+	want := database.Breach{
+		Name:        "Adobe",
+		Title:       "Adobe",
+		Domain:      "adobe.com",
+		BreachDate:  "2013-10-04",
+		AddedDate:   added,
+		Description: "Descrizione",
+		DataClasses: []string{"Email addresses", "Passwords"},
+		PwnCount:    152445165,
+		IsVerified:  true,
+		IsSensitive: false,
+		LogoPath:    "/media/img/adobe.png",
+	}
+	upsertBreach(t, catalog, want)
+
+	got, err := catalog.GetBreach(context.Background(), "Adobe")
+	if err != nil {
+		t.Fatalf("GetBreach: errore inatteso: %v", err)
+	}
+	if got == nil {
+		t.Fatal("GetBreach: atteso il breach salvato, ottenuto nil")
+	}
+	if !got.AddedDate.Equal(want.AddedDate) {
+		t.Errorf("GetBreach: AddedDate atteso %v, ottenuto %v", want.AddedDate, got.AddedDate)
+	}
+	got.AddedDate = want.AddedDate
+	if !reflect.DeepEqual(*got, want) {
+		t.Errorf("GetBreach: atteso %#v, ottenuto %#v", want, *got)
+	}
+}
+
+func testCatalogListSorted(t *testing.T, newDB Factory) {
+	catalog := openCatalog(t, newDB)
+
+	list, err := catalog.ListBreaches(context.Background())
+	if err != nil {
+		t.Fatalf("ListBreaches: errore inatteso: %v", err)
+	}
+	if list == nil || len(list) != 0 {
+		t.Errorf("ListBreaches su catalogo vuoto: attesa slice vuota non nil, ottenuto %#v", list)
+	}
+
+	for _, name := range []string{"Zynga", "Adobe", "LinkedIn", "Adobe"} {
+		upsertBreach(t, catalog, database.Breach{Name: name, Title: name})
+	}
+	list, err = catalog.ListBreaches(context.Background())
+	if err != nil {
+		t.Fatalf("ListBreaches: errore inatteso: %v", err)
+	}
+	var names []string
+	for _, breach := range list {
+		names = append(names, breach.Name)
+	}
+	if want := []string{"Adobe", "LinkedIn", "Zynga"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ListBreaches: attesi %v, ottenuti %v", want, names)
+	}
+}
+
+func testCatalogDelete(t *testing.T, newDB Factory) {
+	catalog := openCatalog(t, newDB)
+
+	upsertBreach(t, catalog, database.Breach{Name: "Adobe"})
+	if err := catalog.DeleteBreach(context.Background(), "Adobe"); err != nil {
+		t.Fatalf("DeleteBreach: errore inatteso: %v", err)
+	}
+	if err := catalog.DeleteBreach(context.Background(), "Assente"); err != nil {
+		t.Errorf("DeleteBreach su breach assente: errore inatteso: %v", err)
+	}
+	if got, _ := catalog.GetBreach(context.Background(), "Adobe"); got != nil {
+		t.Errorf("GetBreach dopo DeleteBreach: atteso nil, ottenuto %#v", got)
+	}
+}
+
+func testCatalogValidation(t *testing.T, newDB Factory) {
+	catalog := openCatalog(t, newDB)
+
+	for _, breach := range []database.Breach{
+		{Name: ""},
+		{Name: "Adobe", BreachDate: "04/10/2013"},
+		{Name: "Adobe", PwnCount: -1},
+	} {
+		if err := catalog.UpsertBreach(context.Background(), breach); err == nil {
+			t.Errorf("UpsertBreach(%#v): atteso un errore di validazione", breach)
+		}
+	}
+}
+
+// openAPIKeys crea il database e salta il test se non implementa la gestione delle chiavi API.
+func openAPIKeys(t *testing.T, newDB Factory) database.APIKeyWriter {
+	t.Helper()
+	keys, ok := open(t, newDB).(database.APIKeyWriter)
+	if !ok {
+		t.Skip("il database non implementa database.APIKeyWriter")
+	}
+	return keys
+}
+
+// createAPIKey chiama CreateAPIKey e fallisce il test in caso di errore.
+func createAPIKey(t *testing.T, keys database.APIKeyWriter, key database.APIKey) {
+	t.Helper()
+	if err := keys.CreateAPIKey(context.Background(), key); err != nil {
+		t.Fatalf("CreateAPIKey(%q): errore inatteso: %v", key.ID, err)
+	}
+}
+
+// getAPIKey chiama GetAPIKey e fallisce il test in caso di errore.
+func getAPIKey(t *testing.T, keys database.APIKeyWriter, id string) *database.APIKey {
+	t.Helper()
+	key, err := keys.GetAPIKey(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetAPIKey(%q): errore inatteso: %v", id, err)
+	}
+	return key
+}
+
+func testAPIKeyRoundTrip(t *testing.T, newDB Factory) {
+	keys := openAPIKeys(t, newDB)
+
+	if got := getAPIKey(t, keys, "assente"); got != nil {
+		t.Errorf("GetAPIKey su chiave assente: atteso nil, ottenuto %#v", got)
+	}
+
+	want := database.APIKey{
+		ID:        "a1b2c3d4e5f6",
+		Hash:      "hash",
+		Owner:     "security-team",
+		Scopes:    []string{"check", "batch"},
+		MaxBatch:  5000,
+		Tier:      "partner",
+		Domains:   []string{"example.com", "example.org"},
+		CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		ExpiresAt: time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC),
+	}
+	createAPIKey(t, keys, want)
+
+	got := getAPIKey(t, keys, want.ID)
+	if got == nil {
+		t.Fatal("GetAPIKey: attesa la chiave salvata, ottenuto nil")
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) || !got.ExpiresAt.Equal(want.ExpiresAt) || !got.RevokedAt.IsZero() {
+		t.Errorf("GetAPIKey: date attese %v/%v/zero, ottenute %v/%v/%v",
+			want.CreatedAt, want.ExpiresAt, got.CreatedAt, got.ExpiresAt, got.RevokedAt)
+	}
+	got.CreatedAt, got.ExpiresAt, got.RevokedAt = want.CreatedAt, want.ExpiresAt, want.RevokedAt
+	if !reflect.DeepEqual(*got, want) {
+		t.Errorf("GetAPIKey: atteso %#v, ottenuto %#v", want, *got)
+	}
+}
+
+func testAPIKeyDuplicate(t *testing.T, newDB Factory) {
+	keys := openAPIKeys(t, newDB)
+
+	createAPIKey(t, keys, database.APIKey{ID: "k1", Hash: "h1", Owner: "a"})
+	err := keys.CreateAPIKey(context.Background(), database.APIKey{ID: "k1", Hash: "h2", Owner: "b"})
+	if !errors.Is(err, database.ErrAPIKeyExists) {
+		t.Errorf("CreateAPIKey con identificativo duplicato: atteso ErrAPIKeyExists, ottenuto %v", err)
+	}
+	if got := getAPIKey(t, keys, "k1"); got == nil || got.Hash != "h1" {
+		t.Errorf("CreateAPIKey duplicata non deve sostituire la chiave, ottenuto %#v", got)
+	}
+	if err := keys.CreateAPIKey(context.Background(), database.APIKey{ID: "k2"}); err == nil {
+		t.Error("CreateAPIKey senza hash e proprietario: atteso un errore di validazione")
+	}
+}
+
+func testAPIKeyRevoke(t *testing.T, newDB Factory) {
+	keys := openAPIKeys(t, newDB)
+
+	createAPIKey(t, keys, database.APIKey{ID: "k1", Hash: "h1", Owner: "a"})
+	first := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	if err := keys.RevokeAPIKey(context.Background(), "k1", first); err != nil {
+		t.Fatalf("RevokeAPIKey: errore inatteso: %v", err)
+	}
+	if err := keys.RevokeAPIKey(context.Background(), "k1", first.Add(time.Hour)); err != nil {
+		t.Fatalf("RevokeAPIKey ripetuta: errore inatteso: %v", err)
+	}
+	if got := getAPIKey(t, keys, "k1"); got == nil || !got.RevokedAt.Equal(first) {
+		t.Errorf("RevokeAPIKey: attesa la prima data di revoca %v, ottenuto %#v", first, got)
+	}
+
+	err := keys.RevokeAPIKey(context.Background(), "assente", first)
+	if !errors.Is(err, database.ErrAPIKeyNotFound) {
+		t.Errorf("RevokeAPIKey su chiave assente: atteso ErrAPIKeyNotFound, ottenuto %v", err)
+	}
+}
+
+func testAPIKeyDomains(t *testing.T, newDB Factory) {
+	keys := openAPIKeys(t, newDB)
+
+	createAPIKey(t, keys, database.APIKey{ID: "k1", Hash: "h1", Owner: "a", Domains: []string{"example.com"}})
+	if err := keys.SetAPIKeyDomains(context.Background(), "k1", []string{"example.com", "example.org"}); err != nil {
+		t.Fatalf("SetAPIKeyDomains: errore inatteso: %v", err)
+	}
+	if got := getAPIKey(t, keys, "k1"); got == nil || !reflect.DeepEqual(got.Domains, []string{"example.com", "example.org"}) {
+		t.Errorf("SetAPIKeyDomains: attesi i domini example.com, example.org, ottenuto %#v", got)
+	}
+	if err := keys.SetAPIKeyDomains(context.Background(), "k1", nil); err != nil {
+		t.Fatalf("SetAPIKeyDomains senza domini: errore inatteso: %v", err)
+	}
+	if got := getAPIKey(t, keys, "k1"); got == nil || len(got.Domains) != 0 || got.Owner != "a" {
+		t.Errorf("SetAPIKeyDomains senza domini: attesa la chiave senza domini, ottenuto %#v", got)
+	}
+
+	err := keys.SetAPIKeyDomains(context.Background(), "assente", []string{"example.com"})
+	if !errors.Is(err, database.ErrAPIKeyNotFound) {
+		t.Errorf("SetAPIKeyDomains su chiave assente: atteso ErrAPIKeyNotFound, ottenuto %v", err)
+	}
+}
+
+func testAPIKeyListSorted(t *testing.T, newDB Factory) {
+	keys := openAPIKeys(t, newDB)
+
+	list, err := keys.ListAPIKeys(context.Background())
+	if err != nil {
+		t.Fatalf("ListAPIKeys: errore inatteso: %v", err)
+	}
+	if list == nil || len(list) != 0 {
+		t.Errorf("ListAPIKeys senza chiavi: attesa slice vuota non nil, ottenuto %#v", list)
+	}
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	createAPIKey(t, keys, database.APIKey{ID: "c", Hash: "h", Owner: "o", CreatedAt: base.Add(time.Hour)})
+	createAPIKey(t, keys, database.APIKey{ID: "b", Hash: "h", Owner: "o", CreatedAt: base})
+	createAPIKey(t, keys, database.APIKey{ID: "a", Hash: "h", Owner: "o", CreatedAt: base.Add(time.Hour)})
+
+	list, err = keys.ListAPIKeys(context.Background())
+	if err != nil {
+		t.Fatalf("ListAPIKeys: errore inatteso: %v", err)
+	}
+	var ids []string
+	for _, key := range list {
+		ids = append(ids, key.ID)
+	}
+	if want := []string{"b", "a", "c"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("ListAPIKeys: attesi %v, ottenuti %v", want, ids)
+	}
+}
+
+// openRateLimits crea il database e salta il test se non conserva i bucket del rate limiting.
+func openRateLimits(t *testing.T, newDB Factory) database.RateLimitStore {
+	t.Helper()
+	store, ok := open(t, newDB).(database.RateLimitStore)
+	if !ok {
+		t.Skip("il database non implementa database.RateLimitStore")
+	}
+	return store
+}
+
+// takeTokens chiama TakeTokens e fallisce il test in caso di errore.
+func takeTokens(t *testing.T, store database.RateLimitStore, key string, bucket database.TokenBucket, cost float64, force bool, now time.Time) (float64, bool) {
+	t.Helper()
+	tokens, allowed, err := store.TakeTokens(context.Background(), key, bucket, cost, force, now)
+	if err != nil {
+		t.Fatalf("TakeTokens(%q): errore inatteso: %v", key, err)
+	}
+	return tokens, allowed
+}
+
+func testRateLimitTakeTokens(t *testing.T, newDB Factory) {
+	store := openRateLimits(t, newDB)
+	bucket := database.TokenBucket{Rate: 1, Burst: 3}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Un bucket nuovo parte pieno: tre prelievi ammessi, il quarto rifiutato
+	for i, want := range []float64{2, 1, 0} {
+		if tokens, allowed := takeTokens(t, store, "k", bucket, 1, false, now); !allowed || tokens != want {
+			t.Fatalf("prelievo %d: attesi %v gettoni e ammesso, ottenuti %v (ammesso=%v)", i+1, want, tokens, allowed)
+		}
+	}
+	if tokens, allowed := takeTokens(t, store, "k", bucket, 1, false, now); allowed || tokens != 0 {
+		t.Errorf("bucket vuoto: atteso rifiuto con 0 gettoni, ottenuti %v (ammesso=%v)", tokens, allowed)
+	}
+
+	// I bucket sono indipendenti
+	if _, allowed := takeTokens(t, store, "altro", bucket, 1, false, now); !allowed {
+		t.Error("bucket diverso: atteso prelievo ammesso")
+	}
+
+	// Dopo due secondi sono tornati due gettoni; un prelievo forzato può andare in negativo
+	later := now.Add(2 * time.Second)
+	if tokens, allowed := takeTokens(t, store, "k", bucket, 5, true, later); !allowed || tokens != -3 {
+		t.Errorf("prelievo forzato: attesi -3 gettoni e ammesso, ottenuti %v (ammesso=%v)", tokens, allowed)
+	}
+	if _, allowed := takeTokens(t, store, "k", bucket, 1, false, later.Add(3*time.Second)); allowed {
+		t.Error("bucket in debito: atteso rifiuto finché il debito non è recuperato")
+	}
+
+	// Il riempimento non supera Burst
+	if tokens, allowed := takeTokens(t, store, "k", bucket, 1, false, later.Add(time.Hour)); !allowed || tokens != 2 {
+		t.Errorf("dopo un'ora: attesi 2 gettoni e ammesso, ottenuti %v (ammesso=%v)", tokens, allowed)
+	}
+}
+
+func testRateLimitPrune(t *testing.T, newDB Factory) {
+	store := openRateLimits(t, newDB)
+	bucket := database.TokenBucket{Rate: 1, Burst: 10}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	takeTokens(t, store, "breve", bucket, 1, false, now)
+	takeTokens(t, store, "lungo", bucket, 5, false, now)
+
+	// "breve" torna pieno dopo un secondo, "lungo" dopo cinque
+	pruned, err := store.PruneRateLimits(context.Background(), now.Add(3*time.Second))
+	if err != nil {
+		t.Fatalf("PruneRateLimits: errore inatteso: %v", err)
+	}
+	if pruned != 1 {
+		t.Errorf("PruneRateLimits: atteso 1 bucket eliminato, ottenuti %d", pruned)
+	}
+	if tokens, _ := takeTokens(t, store, "lungo", bucket, 1, false, now.Add(3*time.Second)); tokens != 7 {
+		t.Errorf("bucket non eliminato: attesi 7 gettoni, ottenuti %v", tokens)
+	}
+}
+
+// statsSeed contiene email in più breach e domini, con maiuscole nel dominio.
+var statsSeed = []database.Record{
+	{Email: "alice@example.com", Breaches: []string{"Adobe", "LinkedIn"}},
+	{Email: "bob@Example.com", Breaches: []string{"Adobe"}},
+	{Email: "carol@test.org", Breaches: []string{"LinkedIn"}},
+	{Email: "dave@test.org", Breaches: []string{"Adobe", "LinkedIn", "Zynga"}},
+	{Email: "erin@other.net", Breaches: []string{"Zynga"}},
+}
+
+// openStats crea il database popolato con statsSeed e salta il test se non espone le statistiche.
+func openStats(t *testing.T, newDB Factory) (database.Database, database.StatsReader) {
+	t.Helper()
+	db := open(t, newDB, statsSeed...)
+	stats, ok := db.(database.StatsReader)
+	if !ok {
+		t.Skip("il database non implementa database.StatsReader")
+	}
+	return db, stats
+}
+
+// checkStats confronta le statistiche con i valori attesi.
+func checkStats(t *testing.T, stats database.StatsReader, breaches []database.BreachStat, domains []database.DomainStat, emails, associations int64) {
+	t.Helper()
+	ctx := context.Background()
+
+	gotBreaches, err := stats.BreachStats(ctx)
+	if err != nil {
+		t.Fatalf("BreachStats: errore inatteso: %v", err)
+	}
+	if !reflect.DeepEqual(gotBreaches, breaches) {
+		t.Errorf("BreachStats: attesi %v, ottenuti %v", breaches, gotBreaches)
+	}
+
+	global, err := stats.GlobalStats(ctx)
+	if err != nil {
+		t.Fatalf("GlobalStats: errore inatteso: %v", err)
+	}
+	if global.Emails != emails || global.Associations != associations || global.Breaches != int64(len(breaches)) {
+		t.Errorf("GlobalStats: attesi %d email, %d associazioni, %d breach; ottenuto %+v",
+			emails, associations, len(breaches), global)
+	}
+
+	gotDomains, err := stats.TopDomains(ctx, 2)
+	if err != nil {
+		t.Fatalf("TopDomains: errore inatteso: %v", err)
+	}
+	// Alcune implementazioni (snapshot) non conoscono i domini
+	if len(gotDomains) > 0 && !reflect.DeepEqual(gotDomains, domains) {
+		t.Errorf("TopDomains(2): attesi %v, ottenuti %v", domains, gotDomains)
+	}
+	if none, err := stats.TopDomains(ctx, 0); err != nil || len(none) != 0 {
+		t.Errorf("TopDomains(0): atteso un elenco vuoto, ottenuto %v (errore %v)", none, err)
+	}
+}
+
+func testStatsMatchData(t *testing.T, newDB Factory) {
+	_, stats := openStats(t, newDB)
+
+	checkStats(t, stats,
+		[]database.BreachStat{{Name: "Adobe", Accounts: 3}, {Name: "LinkedIn", Accounts: 3}, {Name: "Zynga", Accounts: 2}},
+		[]database.DomainStat{{Domain: "example.com", Accounts: 2}, {Domain: "test.org", Accounts: 2}},
+		5, 8)
+}
+
+func testStatsReconcile(t *testing.T, newDB Factory) {
+	db, stats := openStats(t, newDB)
+	reconciler, ok := db.(database.StatsReconciler)
+	if !ok {
+		t.Skip("il database non implementa database.StatsReconciler")
+	}
+
+	global, err := reconciler.ReconcileStats(context.Background())
+	if err != nil {
+		t.Fatalf("ReconcileStats: errore inatteso: %v", err)
+	}
+	if global.ReconciledAt.IsZero() {
+		t.Error("ReconcileStats: attesa una data di ricostruzione")
+	}
+	checkStats(t, stats,
+		[]database.BreachStat{{Name: "Adobe", Accounts: 3}, {Name: "LinkedIn", Accounts: 3}, {Name: "Zynga", Accounts: 2}},
+		[]database.DomainStat{{Domain: "example.com", Accounts: 2}, {Domain: "test.org", Accounts: 2}},
+		5, 8)
+}
+
+func testRemoveBreach(t *testing.T, newDB Factory) {
+	db, stats := openStats(t, newDB)
+	remover, ok := db.(database.BreachRemover)
+	if !ok {
+		t.Skip("il database non implementa database.BreachRemover")
+	}
+
+	result, err := remover.RemoveBreach(context.Background(), "Adobe")
+	if err != nil {
+		t.Fatalf("RemoveBreach: errore inatteso: %v", err)
+	}
+	if want := (database.RemoveResult{UnlinkedCount: 3, DeletedCount: 1}); result != want {
+		t.Errorf("RemoveBreach: atteso %+v, ottenuto %+v", want, result)
+	}
+
+	if got := findEmail(t, db, "bob@Example.com"); got != nil {
+		t.Errorf("FindEmail su email rimasta senza breach: atteso nil, ottenuto %v", got)
+	}
+	if got, want := findEmail(t, db, "dave@test.org"), []string{"LinkedIn", "Zynga"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindEmail dopo RemoveBreach: attesi %v, ottenuti %v", want, got)
+	}
+	breaches, err := db.GetAllBreaches(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllBreaches: errore inatteso: %v", err)
+	}
+	if want := []string{"LinkedIn", "Zynga"}; !reflect.DeepEqual(breaches, want) {
+		t.Errorf("GetAllBreaches dopo RemoveBreach: attesi %v, ottenuti %v", want, breaches)
+	}
+
+	checkStats(t, stats,
+		[]database.BreachStat{{Name: "LinkedIn", Accounts: 3}, {Name: "Zynga", Accounts: 2}},
+		[]database.DomainStat{{Domain: "test.org", Accounts: 2}, {Domain: "example.com", Accounts: 1}},
+		4, 5)
+}
+
+func testDeleteEmails(t *testing.T, newDB Factory) {
+	db, stats := openStats(t, newDB)
+	deleter, ok := db.(database.EmailDeleter)
+	if !ok {
+		t.Skip("il database non implementa database.EmailDeleter")
+	}
+
+	deleted, err := deleter.DeleteEmails(context.Background(), []string{"alice@example.com", "erin@other.net", "nobody@example.com"})
+	if err != nil {
+		t.Fatalf("DeleteEmails: errore inatteso: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("DeleteEmails: attese 2 email eliminate, ottenute %d", deleted)
+	}
+	if got := findEmail(t, db, "alice@example.com"); got != nil {
+		t.Errorf("FindEmail su email eliminata: atteso nil, ottenuto %v", got)
+	}
+
+	checkStats(t, stats,
+		[]database.BreachStat{{Name: "Adobe", Accounts: 2}, {Name: "LinkedIn", Accounts: 2}, {Name: "Zynga", Accounts: 1}},
+		[]database.DomainStat{{Domain: "test.org", Accounts: 2}, {Domain: "example.com", Accounts: 1}},
+		3, 5)
+}
+
+// openDataClasses crea il database popolato con statsSeed e salta il test se non conserva le classi di dati.
+func openDataClasses(t *testing.T, newDB Factory) (database.Database, database.DataClassWriter, database.DataClassReader) {
+	t.Helper()
+	db := open(t, newDB, statsSeed...)
+	writer, ok := db.(database.DataClassWriter)
+	if !ok {
+		t.Skip("il database non implementa database.DataClassWriter")
+	}
+	reader, ok := db.(database.DataClassReader)
+	if !ok {
+		t.Skip("il database non implementa database.DataClassReader")
+	}
+	return db, writer, reader
+}
+
+// addDataClasses chiama AddDataClasses e fallisce il test in caso di errore.
+func addDataClasses(t *testing.T, writer database.DataClassWriter, breach string, classes map[string][]string) {
+	t.Helper()
+	if err := writer.AddDataClasses(context.Background(), breach, classes); err != nil {
+		t.Fatalf("AddDataClasses(%q): errore inatteso: %v", breach, err)
+	}
+}
+
+// findDataClasses chiama FindDataClasses e fallisce il test in caso di errore.
+func findDataClasses(t *testing.T, reader database.DataClassReader, email string) map[string][]string {
+	t.Helper()
+	classes, err := reader.FindDataClasses(context.Background(), email)
+	if err != nil {
+		t.Fatalf("FindDataClasses(%q): errore inatteso: %v", email, err)
+	}
+	return classes
+}
+
+func testDataClasses(t *testing.T, newDB Factory) {
+	_, writer, reader := openDataClasses(t, newDB)
+
+	if got := findDataClasses(t, reader, "alice@example.com"); got != nil {
+		t.Errorf("FindDataClasses senza classi registrate: atteso nil, ottenuto %v", got)
+	}
+
+	addDataClasses(t, writer, "Adobe", map[string][]string{
+		"alice@example.com": {database.PasswordHashClass("md5"), database.DataClassPassword},
+		"bob@Example.com":   {database.DataClassPhone},
+	})
+	// Le classi si aggiungono a quelle presenti, senza duplicati
+	addDataClasses(t, writer, "Adobe", map[string][]string{"alice@example.com": {database.DataClassPassword, database.DataClassIP}})
+	addDataClasses(t, writer, "LinkedIn", map[string][]string{"alice@example.com": {database.DataClassUsername}})
+
+	want := map[string][]string{
+		"Adobe":    {database.DataClassIP, database.DataClassPassword, database.PasswordHashClass("md5")},
+		"LinkedIn": {database.DataClassUsername},
+	}
+	if got := findDataClasses(t, reader, "alice@example.com"); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindDataClasses: attese %v, ottenute %v", want, got)
+	}
+	if got, want := findDataClasses(t, reader, "bob@Example.com"), map[string][]string{"Adobe": {database.DataClassPhone}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindDataClasses: attese %v, ottenute %v", want, got)
+	}
+	if got := findDataClasses(t, reader, "carol@test.org"); got != nil {
+		t.Errorf("FindDataClasses su email senza classi: atteso nil, ottenuto %v", got)
+	}
+}
+
+func testDataClassesRemoved(t *testing.T, newDB Factory) {
+	db, writer, reader := openDataClasses(t, newDB)
+	remover, ok := db.(database.BreachRemover)
+	if !ok {
+		t.Skip("il database non implementa database.BreachRemover")
+	}
+	deleter, ok := db.(database.EmailDeleter)
+	if !ok {
+		t.Skip("il database non implementa database.EmailDeleter")
+	}
+
+	addDataClasses(t, writer, "Adobe", map[string][]string{"alice@example.com": {database.DataClassPassword}, "dave@test.org": {database.DataClassPhone}})
+	addDataClasses(t, writer, "LinkedIn", map[string][]string{"alice@example.com": {database.DataClassName}, "dave@test.org": {database.DataClassIP}})
+
+	if _, err := remover.RemoveBreach(context.Background(), "Adobe"); err != nil {
+		t.Fatalf("RemoveBreach: errore inatteso: %v", err)
+	}
+	if got, want := findDataClasses(t, reader, "alice@example.com"), map[string][]string{"LinkedIn": {database.DataClassName}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindDataClasses dopo RemoveBreach: attese %v, ottenute %v", want, got)
+	}
+
+	if _, err := deleter.DeleteEmails(context.Background(), []string{"dave@test.org"}); err != nil {
+		t.Fatalf("DeleteEmails: errore inatteso: %v", err)
+	}
+	if got := findDataClasses(t, reader, "dave@test.org"); got != nil {
+		t.Errorf("FindDataClasses dopo DeleteEmails: atteso nil, ottenuto %v", got)
+	}
+}
+
+func testPasswordRange(t *testing.T, newDB Factory) {
+	db := open(t, newDB)
+	writer, ok := db.(database.PasswordWriter)
+	if !ok {
+		t.Skip("il database non implementa database.PasswordWriter")
+	}
+	reader, ok := db.(database.PasswordRangeReader)
+	if !ok {
+		t.Skip("il database non implementa database.PasswordRangeReader")
+	}
+
+	passwordRange := func(prefix string) []database.PasswordHash {
+		t.Helper()
+		hashes, err := reader.PasswordRange(context.Background(), prefix)
+		if err != nil {
+			t.Fatalf("PasswordRange(%q): errore inatteso: %v", prefix, err)
+		}
+		return hashes
+	}
+	if got := passwordRange("5BAA6"); len(got) != 0 {
+		t.Errorf("PasswordRange senza hash: atteso vuoto, ottenuto %v", got)
+	}
+
+	// SHA-1 di "password" e di "password1"; il terzo hash condivide il prefisso del primo
+	for block, counts := range []map[string]int64{
+		{"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8": 2, "E38AD214943DAAD1D64C102FAEC29DE4AFE9DA3D": 1},
+		// Gli hash in minuscolo vengono accettati e le occorrenze si sommano
+		{"5baa61e4c9b93f3f0682250b6cf8331b7ee68fd8": 3, "5BAA60000000000000000000000000000000000F": 1},
+	} {
+		if err := writer.AddPasswordHashes(context.Background(), "Adobe/dump.txt", block, counts); err != nil {
+			t.Fatalf("AddPasswordHashes: errore inatteso: %v", err)
+		}
+	}
+
+	want := []database.PasswordHash{
+		{Suffix: "0000000000000000000000000000000000F", Count: 1},
+		{Suffix: "1E4C9B93F3F0682250B6CF8331B7EE68FD8", Count: 5},
+	}
+	for _, prefix := range []string{"5BAA6", "5baa6"} {
+		if got := passwordRange(prefix); !reflect.DeepEqual(got, want) {
+			t.Errorf("PasswordRange(%q): attesi %v, ottenuti %v", prefix, want, got)
+		}
+	}
+	if got := passwordRange("5BAA5"); len(got) != 0 {
+		t.Errorf("PasswordRange(5BAA5): atteso vuoto, ottenuto %v", got)
+	}
+}
+
+func testPasswordSources(t *testing.T, newDB Factory) {
+	db := open(t, newDB)
+	writer, ok := db.(database.PasswordWriter)
+	if !ok {
+		t.Skip("il database non implementa database.PasswordWriter")
+	}
+	reader, ok := db.(database.PasswordRangeReader)
+	if !ok {
+		t.Skip("il database non implementa database.PasswordRangeReader")
+	}
+
+	const hash = "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8"
+	add := func(source string, block int, count int64) {
+		t.Helper()
+		if err := writer.AddPasswordHashes(context.Background(), source, block, map[string]int64{hash: count}); err != nil {
+			t.Fatalf("AddPasswordHashes(%s, %d): errore inatteso: %v", source, block, err)
+		}
+	}
+	reset := func(source string) {
+		t.Helper()
+		if err := writer.ResetPasswordHashes(context.Background(), source); err != nil {
+			t.Fatalf("ResetPasswordHashes(%s): errore inatteso: %v", source, err)
+		}
+	}
+	check := func(when string, want int64) {
+		t.Helper()
+		hashes, err := reader.PasswordRange(context.Background(), hash[:database.PasswordPrefixLength])
+		if err != nil {
+			t.Fatalf("PasswordRange: errore inatteso: %v", err)
+		}
+		var got int64
+		for _, h := range hashes {
+			if h.Suffix == hash[database.PasswordPrefixLength:] {
+				got = h.Count
+			}
+		}
+		if got != want {
+			t.Errorf("%s: attese %d occorrenze, ottenute %d", when, want, got)
+		}
+	}
+
+	add("Adobe/a.txt", 0, 2)
+	add("Adobe/a.txt", 1, 3)
+	// Un blocco ripetuto, come dopo un errore transitorio, non viene contato di nuovo
+	add("Adobe/a.txt", 1, 3)
+	check("blocco ripetuto", 5)
+
+	add("LinkedIn/b.txt", 0, 4)
+	check("due origini", 9)
+
+	// Un import ripreso da capo riparte da zero per la sua origine, senza toccare le altre
+	reset("Adobe/a.txt")
+	check("dopo ResetPasswordHashes", 4)
+	add("Adobe/a.txt", 0, 2)
+	add("Adobe/a.txt", 1, 3)
+	check("origine importata di nuovo", 9)
+
+	reset("LinkedIn/b.txt")
+	reset("Adobe/a.txt")
+	check("tutte le origini azzerate", 0)
+	// Un'origine senza occorrenze può essere azzerata
+	reset("Yahoo/c.txt")
+
+	if err := writer.AddPasswordHashes(context.Background(), "", 0, map[string]int64{hash: 1}); err == nil {
+		t.Error("AddPasswordHashes con origine vuota: atteso un errore")
+	}
+}
+
+func testEmailRange(t *testing.T, newDB Factory) {
+	db := open(t, newDB, statsSeed...)
+	reader, ok := db.(database.EmailRangeReader)
+	if !ok {
+		t.Skip("il database non implementa database.EmailRangeReader")
+	}
+
+	findEmailRange := func(prefix string) []database.EmailHashMatch {
+		t.Helper()
+		matches, err := reader.FindEmailRange(context.Background(), prefix)
+		if err != nil {
+			t.Fatalf("FindEmailRange(%q): errore inatteso: %v", prefix, err)
+		}
+		return matches
+	}
+
+	hash := normalize.Hash("dave@test.org")
+	for _, length := range []int{database.MinEmailPrefixLength, database.MaxEmailPrefixLength} {
+		prefix := hash[:length]
+		want := database.EmailHashMatch{Suffix: hash[length:], Breaches: []string{"Adobe", "LinkedIn", "Zynga"}}
+		found := false
+		for _, match := range findEmailRange(prefix) {
+			if match.Suffix == want.Suffix {
+				found = true
+				if !reflect.DeepEqual(match, want) {
+					t.Errorf("FindEmailRange(%q): atteso %v, ottenuto %v", prefix, want, match)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("FindEmailRange(%q): hash di dave@test.org non trovato", prefix)
+		}
+	}
+
+	// Un prefisso in minuscolo trova le stesse email
+	if got, want := findEmailRange(strings.ToLower(hash[:6])), findEmailRange(hash[:6]); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindEmailRange con prefisso minuscolo: attesi %v, ottenuti %v", want, got)
+	}
+
+	deleter, ok := db.(database.EmailDeleter)
+	if !ok {
+		return
+	}
+	if _, err := deleter.DeleteEmails(context.Background(), []string{"dave@test.org"}); err != nil {
+		t.Fatalf("DeleteEmails: errore inatteso: %v", err)
+	}
+	for _, match := range findEmailRange(hash[:database.MaxEmailPrefixLength]) {
+		if match.Suffix == hash[database.MaxEmailPrefixLength:] {
+			t.Errorf("FindEmailRange dopo DeleteEmails: dave@test.org ancora presente")
+		}
+	}
+}
+
+func testDomainSearch(t *testing.T, newDB Factory) {
+	db := open(t, newDB, statsSeed...)
+	searcher, ok := db.(database.DomainSearcher)
+	if !ok {
+		t.Skip("il database non implementa database.DomainSearcher")
+	}
+
+	findDomainEmails := func(domain, after string, limit int) []database.Record {
+		t.Helper()
+		records, err := searcher.FindDomainEmails(context.Background(), domain, after, limit)
+		if err != nil {
+			t.Fatalf("FindDomainEmails(%q, %q, %d): errore inatteso: %v", domain, after, limit, err)
+		}
+		return records
+	}
+
+	// Le pagine, di una email ciascuna, seguono l'ordine delle email
+	carol := database.Record{Email: "carol@test.org", Breaches: []string{"LinkedIn"}}
+	dave := database.Record{Email: "dave@test.org", Breaches: []string{"Adobe", "LinkedIn", "Zynga"}}
+	if got := findDomainEmails("test.org", "", 1); !reflect.DeepEqual(got, []database.Record{carol}) {
+		t.Errorf("FindDomainEmails prima pagina: atteso %v, ottenuto %v", []database.Record{carol}, got)
+	}
+	if got := findDomainEmails("test.org", carol.Email, 1); !reflect.DeepEqual(got, []database.Record{dave}) {
+		t.Errorf("FindDomainEmails seconda pagina: atteso %v, ottenuto %v", []database.Record{dave}, got)
+	}
+	if got := findDomainEmails("test.org", dave.Email, 1); got == nil || len(got) != 0 {
+		t.Errorf("FindDomainEmails dopo l'ultima email: attesa slice vuota non nil, ottenuto %#v", got)
+	}
+	if got := findDomainEmails("test.org", "", 10); !reflect.DeepEqual(got, []database.Record{carol, dave}) {
+		t.Errorf("FindDomainEmails: attesi %v, ottenuti %v", []database.Record{carol, dave}, got)
+	}
+	if got := findDomainEmails("example.org", "", 10); got == nil || len(got) != 0 {
+		t.Errorf("FindDomainEmails su dominio assente: attesa slice vuota non nil, ottenuto %#v", got)
+	}
+
+	domainBreachStats := func(domain string) []database.BreachStat {
+		t.Helper()
+		stats, err := searcher.DomainBreachStats(context.Background(), domain)
+		if err != nil {
+			t.Fatalf("DomainBreachStats(%q): errore inatteso: %v", domain, err)
+		}
+		return stats
+	}
+
+	// Il dominio è indicizzato in minuscolo, come in EmailDomain
+	want := []database.BreachStat{{Name: "Adobe", Accounts: 2}, {Name: "LinkedIn", Accounts: 1}}
+	if got := domainBreachStats("example.com"); !reflect.DeepEqual(got, want) {
+		t.Errorf("DomainBreachStats(example.com): attesi %v, ottenuti %v", want, got)
+	}
+
+	if writer, ok := db.(database.Writer); ok {
+		if _, err := writer.AddBreachEmails(context.Background(), "Zynga", []string{"bob@test.org", "carol@test.org"}); err != nil {
+			t.Fatalf("AddBreachEmails: errore inatteso: %v", err)
+		}
+		want := []database.BreachStat{{Name: "Adobe", Accounts: 1}, {Name: "LinkedIn", Accounts: 2}, {Name: "Zynga", Accounts: 3}}
+		if got := domainBreachStats("test.org"); !reflect.DeepEqual(got, want) {
+			t.Errorf("DomainBreachStats dopo AddBreachEmails: attesi %v, ottenuti %v", want, got)
+		}
+		if got := findDomainEmails("test.org", "", 1); len(got) != 1 || got[0].Email != "bob@test.org" {
+			t.Errorf("FindDomainEmails dopo AddBreachEmails: attesa bob@test.org, ottenuto %v", got)
+		}
+	}
+
+	deleter, ok := db.(database.EmailDeleter)
+	if !ok {
+		return
+	}
+	if _, err := deleter.DeleteEmails(context.Background(), []string{"dave@test.org"}); err != nil {
+		t.Fatalf("DeleteEmails: errore inatteso: %v", err)
+	}
+	for _, record := range findDomainEmails("test.org", "", 10) {
+		if record.Email == "dave@test.org" {
+			t.Errorf("FindDomainEmails dopo DeleteEmails: dave@test.org ancora presente")
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package database
+
+import "context"
+
+// DomainSearcher è implementato dai database che indicizzano le email per dominio (EmailDomain),
+// per la ricerca delle email di un dominio da parte dei suoi proprietari.
+type DomainSearcher interface {
+	// FindDomainEmails restituisce, in ordine di email, al massimo limit email del dominio (in minuscolo)
+	// successive ad after, con i breach in ordine alfabetico. Con after vuoto parte dalla prima email;
+	// l'ultima email restituita è il cursore della pagina successiva.
+	FindDomainEmails(ctx context.Context, domain, after string, limit int) ([]Record, error)
+
+	// DomainBreachStats restituisce, in ordine alfabetico, i breach con almeno un'email del dominio
+	// e il numero di email del dominio in ciascuno.
+	DomainBreachStats(ctx context.Context, domain string) ([]BreachStat, error)
+}
@@ -0,0 +1,152 @@
+package database
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrHashedEmails indica un'operazione che richiede le email in chiaro su un database che le conserva
+// come HMAC (vedi EmailKeys), come l'esportazione o le ricerche per intervallo sull'hash SHA-256.
+var ErrHashedEmails = errors.New("le email sono conservate come HMAC e non sono disponibili in chiaro")
+
+// hmacValuePrefix precede i valori HMAC conservati al posto delle email: "hmac:<id della chiave>:<hex>".
+const hmacValuePrefix = "hmac:"
+
+// MinEmailKeyBytes è la lunghezza minima dei segreti HMAC.
+const MinEmailKeyBytes = 32
+
+// emailKeyIDRegex descrive gli identificativi delle chiavi, che compaiono nei valori conservati.
+var emailKeyIDRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// EmailKey è un segreto HMAC-SHA256 con il suo identificativo.
+type EmailKey struct {
+	ID     string
+	Secret []byte
+}
+
+// EmailKeys è la catena di chiavi con cui vengono conservate le email, dalla più vecchia alla più recente.
+// Il valore conservato è l'HMAC dell'email normalizzata con la prima chiave, a cui ogni chiave successiva
+// applica di nuovo l'HMAC: HMAC(k2, HMAC(k1, email)). Così la rotazione (vedi EmailKeyRotator) aggiunge
+// una chiave in coda e ricalcola i valori da quelli conservati, senza conoscere le email; le chiavi
+// precedenti restano necessarie per le ricerche ma da sole non permettono di verificare un'email.
+type EmailKeys struct {
+	keys []EmailKey
+	// DualRead fa cercare le email anche con la catena senza l'ultima chiave (o in chiaro, se la chiave
+	// è una sola), per trovare i documenti non ancora ruotati. Va disattivato solo a rotazione completata.
+	DualRead bool
+}
+
+// ParseEmailKeys interpreta un elenco di chiavi "id:segreto" separate da virgole, dalla più vecchia
+// alla più recente, con il segreto in base64 di almeno MinEmailKeyBytes byte.
+func ParseEmailKeys(spec string) (*EmailKeys, error) {
+	var keys []EmailKey
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(item, ":")
+		if !ok || !emailKeyIDRegex.MatchString(id) {
+			return nil, fmt.Errorf("chiave non valida: il formato è id:segreto, con id di lettere, cifre, '-' o '_'")
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("chiave %s ripetuta", id)
+		}
+		seen[id] = true
+		secret, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("chiave %s: segreto non in base64: %w", id, err)
+		}
+		if len(secret) < MinEmailKeyBytes {
+			return nil, fmt.Errorf("chiave %s: il segreto deve essere di almeno %d byte (trovati %d)", id, MinEmailKeyBytes, len(secret))
+		}
+		keys = append(keys, EmailKey{ID: id, Secret: secret})
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("nessuna chiave indicata")
+	}
+	return &EmailKeys{keys: keys, DualRead: true}, nil
+}
+
+// Current restituisce l'identificativo della chiave più recente.
+func (k *EmailKeys) Current() string {
+	return k.keys[len(k.keys)-1].ID
+}
+
+// Value restituisce il valore conservato al posto dell'email normalizzata.
+func (k *EmailKeys) Value(email string) string {
+	return k.chain([]byte(email), k.keys)
+}
+
+// Lookup restituisce i valori con cui cercare l'email: quello attuale e, con DualRead,
+// quello della catena precedente.
+func (k *EmailKeys) Lookup(email string) []string {
+	values := []string{k.Value(email)}
+	if k.DualRead {
+		if len(k.keys) == 1 {
+			values = append(values, email)
+		} else {
+			values = append(values, k.chain([]byte(email), k.keys[:len(k.keys)-1]))
+		}
+	}
+	return values
+}
+
+// Rekey ricalcola con la catena completa un valore conservato: un'email in chiaro o un valore
+// HMAC di una catena precedente. Restituisce false se il valore è già aggiornato.
+func (k *EmailKeys) Rekey(value string) (string, bool, error) {
+	rest, hashed := strings.CutPrefix(value, hmacValuePrefix)
+	if !hashed {
+		return k.Value(value), true, nil
+	}
+	id, encoded, _ := strings.Cut(rest, ":")
+	mac, err := hex.DecodeString(encoded)
+	if err != nil || len(mac) != sha256.Size {
+		return "", false, fmt.Errorf("valore HMAC non valido: %q", value)
+	}
+	for i, key := range k.keys {
+		if key.ID == id {
+			if i == len(k.keys)-1 {
+				return value, false, nil
+			}
+			return k.chain(mac, k.keys[i+1:]), true, nil
+		}
+	}
+	return "", false, fmt.Errorf("valore HMAC con una chiave sconosciuta: %s", id)
+}
+
+// chain applica in ordine le chiavi a data e restituisce il valore con l'identificativo dell'ultima.
+func (k *EmailKeys) chain(data []byte, keys []EmailKey) string {
+	for _, key := range keys {
+		mac := hmac.New(sha256.New, key.Secret)
+		mac.Write(data)
+		data = mac.Sum(nil)
+	}
+	return hmacValuePrefix + keys[len(keys)-1].ID + ":" + hex.EncodeToString(data)
+}
+
+// EmailKeyRotation è l'esito di una rotazione delle chiavi.
+type EmailKeyRotation struct {
+	// Emails è il numero di email ricalcolate con la chiave più recente
+	Emails int64
+	// DataClasses è il numero di documenti delle classi di dati ricalcolati
+	DataClasses int64
+	// Merged è il numero di documenti uniti a quello già presente con il nuovo valore,
+	// ad esempio creato da un import eseguito senza DualRead durante la rotazione
+	Merged int64
+}
+
+// EmailKeyRotator è implementato dai database che possono conservare le email come HMAC.
+type EmailKeyRotator interface {
+	// RotateEmailKeys ricalcola con la chiave più recente i documenti conservati con una catena
+	// precedente o in chiaro, un blocco alla volta e senza fermare letture e scritture.
+	RotateEmailKeys(ctx context.Context) (EmailKeyRotation, error)
+}
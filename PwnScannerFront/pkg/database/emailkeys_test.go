@@ -0,0 +1,105 @@
+package database_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"pwnscanner/pkg/database"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Segreti di prova di 32 byte, in base64
+var (
+	secret1 = strings.Repeat("1", database.MinEmailKeyBytes)
+	secret2 = strings.Repeat("2", database.MinEmailKeyBytes)
+	key1    = "k1:" + base64.StdEncoding.EncodeToString([]byte(secret1))
+	key2    = "k2:" + base64.StdEncoding.EncodeToString([]byte(secret2))
+)
+
+// hmacSum calcola HMAC-SHA256(secret, data).
+func hmacSum(secret string, data []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func TestParseEmailKeysErrors(t *testing.T) {
+	short := "k1:" + base64.StdEncoding.EncodeToString([]byte(strings.Repeat("x", database.MinEmailKeyBytes-1)))
+	for _, tc := range []struct {
+		name string
+		spec string
+		want string
+	}{
+		{"vuoto", "", "nessuna chiave"},
+		{"solo separatori", " , ,", "nessuna chiave"},
+		{"senza segreto", "k1", "formato è id:segreto"},
+		{"id vuoto", ":" + strings.TrimPrefix(key1, "k1:"), "formato è id:segreto"},
+		{"id con caratteri non ammessi", "k.1:" + strings.TrimPrefix(key1, "k1:"), "formato è id:segreto"},
+		{"id troppo lungo", strings.Repeat("k", 33) + ":" + strings.TrimPrefix(key1, "k1:"), "formato è id:segreto"},
+		{"id ripetuto", key1 + "," + key1, "chiave k1 ripetuta"},
+		{"segreto non in base64", "k1:non-base64!", "non in base64"},
+		{"segreto corto", short, "almeno 32 byte"},
+		{"errore dopo una chiave valida", key1 + ",k2", "formato è id:segreto"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			keys, err := database.ParseEmailKeys(tc.spec)
+			if err == nil {
+				t.Fatalf("ParseEmailKeys(%q) = %v, atteso un errore", tc.spec, keys)
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("ParseEmailKeys(%q): errore %q, atteso che contenga %q", tc.spec, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseEmailKeys(t *testing.T) {
+	keys, err := database.ParseEmailKeys(" " + key1 + " , " + key2 + ",")
+	if err != nil {
+		t.Fatalf("ParseEmailKeys: errore inatteso: %v", err)
+	}
+	if keys.Current() != "k2" {
+		t.Errorf("Current = %s, attesa k2", keys.Current())
+	}
+	if !keys.DualRead {
+		t.Error("DualRead deve essere attivo per impostazione predefinita")
+	}
+}
+
+func TestEmailKeysLookup(t *testing.T) {
+	const email = "alice@example.com"
+	first := hmacSum(secret1, []byte(email))
+	oneKey := "hmac:k1:" + hex.EncodeToString(first)
+	twoKeys := "hmac:k2:" + hex.EncodeToString(hmacSum(secret2, first))
+
+	for _, tc := range []struct {
+		name     string
+		spec     string
+		dualRead bool
+		want     []string
+	}{
+		{"una chiave", key1, false, []string{oneKey}},
+		// Con una sola chiave la lettura doppia trova le email ancora in chiaro
+		{"una chiave con DualRead", key1, true, []string{oneKey, email}},
+		{"due chiavi", key1 + "," + key2, false, []string{twoKeys}},
+		// Con due chiavi la lettura doppia trova i valori non ancora ruotati sull'ultima
+		{"due chiavi con DualRead", key1 + "," + key2, true, []string{twoKeys, oneKey}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			keys, err := database.ParseEmailKeys(tc.spec)
+			if err != nil {
+				t.Fatalf("ParseEmailKeys: errore inatteso: %v", err)
+			}
+			keys.DualRead = tc.dualRead
+			if got := keys.Lookup(email); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Lookup = %v, atteso %v", got, tc.want)
+			}
+			if got := keys.Value(email); got != tc.want[0] {
+				t.Errorf("Value = %s, atteso %s", got, tc.want[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	"pwnscanner/pkg/normalize"
+	"strings"
+)
+
+// Lunghezze, in cifre esadecimali, degli hash SHA-256 delle email (vedi normalize.Hash) e dei prefissi
+// accettati dalle ricerche per intervallo. I prefissi corti restituiscono più email ma rivelano meno
+// dell'email cercata; oltre MaxEmailPrefixLength il prefisso identificherebbe quasi sempre una sola email.
+const (
+	EmailHashLength      = 64
+	MinEmailPrefixLength = 5
+	MaxEmailPrefixLength = 8
+)
+
+// EmailHashMatch è un'email trovata da una ricerca per intervallo: il suffisso del suo hash
+// (le cifre esadecimali che seguono il prefisso cercato) e i breach in cui compare, in ordine alfabetico.
+type EmailHashMatch struct {
+	Suffix   string   `json:"suffix"`
+	Breaches []string `json:"breaches"`
+}
+
+// EmailRangeReader è implementato dai database che conservano accanto a ogni email il suo hash
+// SHA-256 (normalize.Hash) indicizzato, per le ricerche con k-anonymity.
+type EmailRangeReader interface {
+	// FindEmailRange restituisce, in ordine di hash, le email il cui hash inizia con prefix
+	// (da MinEmailPrefixLength a MaxEmailPrefixLength cifre esadecimali maiuscole).
+	FindEmailRange(ctx context.Context, prefix string) ([]EmailHashMatch, error)
+}
+
+// IsEmailPrefix indica se s è un prefisso valido per FindEmailRange (cifre esadecimali, anche minuscole).
+func IsEmailPrefix(s string) bool {
+	return len(s) >= MinEmailPrefixLength && len(s) <= MaxEmailPrefixLength && isHexString(s)
+}
+
+// emailHashBucket restituisce i primi MinEmailPrefixLength caratteri dell'hash dell'email, con cui
+// l'implementazione in memoria raggruppa le email.
+func emailHashBucket(email string) string {
+	return normalize.Hash(email)[:MinEmailPrefixLength]
+}
+
+// emailRangeMatch restituisce il risultato per l'email se il suo hash inizia con prefix.
+func emailRangeMatch(email, prefix string, breaches []string) (EmailHashMatch, bool) {
+	hash := normalize.Hash(email)
+	if !strings.HasPrefix(hash, prefix) {
+		return EmailHashMatch{}, false
+	}
+	return EmailHashMatch{Suffix: hash[len(prefix):], Breaches: breaches}, true
+}
@@ -0,0 +1,27 @@
+package database_test
+
+import (
+	"pwnscanner/pkg/database"
+	"testing"
+)
+
+func TestIsEmailPrefix(t *testing.T) {
+	for _, tc := range []struct {
+		prefix string
+		want   bool
+	}{
+		{"FF8D9", true},
+		{"ff8d9", true},
+		{"FF8D98", true},
+		{"FF8D9819", true},
+		{"FF8D", false},
+		{"FF8D9819F", false},
+		{"FF8G9", false},
+		{"FF8D9-", false},
+		{"", false},
+	} {
+		if got := database.IsEmailPrefix(tc.prefix); got != tc.want {
+			t.Errorf("IsEmailPrefix(%q) = %t, atteso %t", tc.prefix, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,779 @@
+package database
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory è un'implementazione del database interamente in memoria.
+// È pensata per lo sviluppo e i test, dove non è disponibile un'istanza di MongoDB.
+// I contatori sono aggiornati a ogni modifica, quindi sono sempre esatti.
+type Memory struct {
+	mu           sync.RWMutex
+	emails       map[string][]string
+	breaches     map[string]int64 // breach -> numero di email
+	domains      map[string]int64 // dominio -> numero di email
+	associations int64
+	created      time.Time
+	catalog      map[string]Breach
+	dataClasses  map[string]map[string][]string // email -> breach -> classi di dati esposte
+	passwords    map[string]map[string]int64    // prefisso -> suffisso dell'hash SHA-1 -> occorrenze
+	emailHashes  map[string]map[string]struct{} // primi caratteri dell'hash SHA-256 -> email
+	domainEmails map[string]map[string]struct{} // dominio -> email
+	apiKeys      map[string]APIKey
+
+	passwordSources map[string]map[string]int64 // origine -> hash SHA-1 -> occorrenze contate per l'origine
+	passwordBlocks  map[string]map[int]struct{} // origine -> blocchi già sommati
+}
+
+// NewMemory crea un database in memoria vuoto.
+func NewMemory() *Memory {
+	return &Memory{
+		emails:       make(map[string][]string),
+		breaches:     make(map[string]int64),
+		domains:      make(map[string]int64),
+		created:      time.Now().UTC(),
+		catalog:      make(map[string]Breach),
+		dataClasses:  make(map[string]map[string][]string),
+		passwords:    make(map[string]map[string]int64),
+		emailHashes:  make(map[string]map[string]struct{}),
+		domainEmails: make(map[string]map[string]struct{}),
+		apiKeys:      make(map[string]APIKey),
+
+		passwordSources: make(map[string]map[string]int64),
+		passwordBlocks:  make(map[string]map[int]struct{}),
+	}
+}
+
+// NewMemoryFromFile crea un database in memoria popolato da un file fixture.
+// Il formato viene scelto in base all'estensione: .jsonl (un Record JSON per riga)
+// oppure .csv (email seguita da uno o più breach per riga, intestazione "email" opzionale).
+func NewMemoryFromFile(path string) (*Memory, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("errore nell'apertura della fixture: %w", err)
+	}
+	defer file.Close()
+
+	var records []Record
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl", ".ndjson":
+		records, err = readJSONLRecords(file)
+	case ".csv":
+		records, err = readCSVRecords(file)
+	default:
+		return nil, fmt.Errorf("formato della fixture non supportato: %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore nella lettura della fixture %s: %w", path, err)
+	}
+
+	m := NewMemory()
+	for _, record := range records {
+		m.Add(record.Email, record.Breaches...)
+	}
+	return m, nil
+}
+
+// readJSONLRecords legge un Record JSON per riga, ignorando le righe vuote.
+func readJSONLRecords(r io.Reader) ([]Record, error) {
+	var records []Record
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal([]byte(text), &record); err != nil {
+			return nil, fmt.Errorf("riga %d: %w", line, err)
+		}
+		if record.Email == "" {
+			return nil, fmt.Errorf("riga %d: email mancante", line)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// readCSVRecords legge righe nel formato email,breach[,breach...].
+func readCSVRecords(r io.Reader) ([]Record, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var records []Record
+	for line := 1; ; line++ {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && strings.EqualFold(row[0], "email") {
+			continue // Intestazione
+		}
+		if row[0] == "" {
+			return nil, fmt.Errorf("riga %d: email mancante", line)
+		}
+		records = append(records, Record{Email: row[0], Breaches: row[1:]})
+	}
+	return records, nil
+}
+
+// Add associa un'email ai breach indicati, ignorando le associazioni già presenti.
+func (m *Memory) Add(email string, breaches ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.add(email, breaches...)
+}
+
+// add associa l'email ai breach e aggiorna i contatori; restituisce se l'email era presente
+// e quanti breach sono stati aggiunti. Va chiamata con il lock in scrittura.
+func (m *Memory) add(email string, breaches ...string) (existed bool, added int64) {
+	current, existed := m.emails[email]
+	for _, breach := range breaches {
+		if breach == "" || slices.Contains(current, breach) {
+			continue
+		}
+		current = append(current, breach)
+		m.breaches[breach]++
+		added++
+	}
+	// Un'email senza breach non viene memorizzata, come avviene su MongoDB
+	if len(current) > 0 {
+		m.emails[email] = current
+	}
+	if !existed && len(current) > 0 {
+		m.domains[EmailDomain(email)]++
+		m.indexEmail(email)
+	}
+	m.associations += added
+	return existed, added
+}
+
+// indexEmail aggiunge l'email agli indici degli hash e dei domini. Va chiamata con il lock in scrittura.
+func (m *Memory) indexEmail(email string) {
+	addToIndex(m.emailHashes, emailHashBucket(email), email)
+	addToIndex(m.domainEmails, EmailDomain(email), email)
+}
+
+// unindexEmail rimuove l'email dagli indici degli hash e dei domini. Va chiamata con il lock in scrittura.
+func (m *Memory) unindexEmail(email string) {
+	removeFromIndex(m.emailHashes, emailHashBucket(email), email)
+	removeFromIndex(m.domainEmails, EmailDomain(email), email)
+}
+
+// addToIndex aggiunge l'email all'insieme della chiave key.
+func addToIndex(index map[string]map[string]struct{}, key, email string) {
+	emails := index[key]
+	if emails == nil {
+		emails = make(map[string]struct{})
+		index[key] = emails
+	}
+	emails[email] = struct{}{}
+}
+
+// removeFromIndex rimuove l'email dall'insieme della chiave key, eliminando gli insiemi vuoti.
+func removeFromIndex(index map[string]map[string]struct{}, key, email string) {
+	if delete(index[key], email); len(index[key]) == 0 {
+		delete(index, key)
+	}
+}
+
+// FindDomainEmails ordina le email del dominio e restituisce quelle successive ad after,
+// con copie ordinate dei breach.
+func (m *Memory) FindDomainEmails(ctx context.Context, domain, after string, limit int) ([]Record, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	emails := make([]string, 0, len(m.domainEmails[domain]))
+	for email := range m.domainEmails[domain] {
+		if email > after {
+			emails = append(emails, email)
+		}
+	}
+	sort.Strings(emails)
+
+	records := []Record{}
+	for _, email := range emails[:min(max(limit, 0), len(emails))] {
+		breaches := slices.Clone(m.emails[email])
+		sort.Strings(breaches)
+		records = append(records, Record{Email: email, Breaches: breaches})
+	}
+	return records, nil
+}
+
+// DomainBreachStats conta le email del dominio in ogni breach.
+func (m *Memory) DomainBreachStats(ctx context.Context, domain string) ([]BreachStat, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	counts := make(map[string]int64)
+	for email := range m.domainEmails[domain] {
+		for _, breach := range m.emails[email] {
+			counts[breach]++
+		}
+	}
+
+	stats := make([]BreachStat, 0, len(counts))
+	for breach, accounts := range counts {
+		stats = append(stats, BreachStat{Name: breach, Accounts: accounts})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats, nil
+}
+
+// FindEmailRange cerca le email con l'hash che inizia con prefix tra quelle con gli stessi primi
+// MinEmailPrefixLength caratteri, restituendo copie ordinate dei breach.
+func (m *Memory) FindEmailRange(ctx context.Context, prefix string) ([]EmailHashMatch, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	prefix = strings.ToUpper(prefix)
+	matches := []EmailHashMatch{}
+	for email := range m.emailHashes[prefix[:MinEmailPrefixLength]] {
+		breaches := slices.Clone(m.emails[email])
+		sort.Strings(breaches)
+		if match, ok := emailRangeMatch(email, prefix, breaches); ok {
+			matches = append(matches, match)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Suffix < matches[j].Suffix })
+	return matches, nil
+}
+
+// FindEmail cerca un'email nei breach.
+// Restituisce una copia ordinata dei breach associati, così il chiamante non può alterare il database.
+func (m *Memory) FindEmail(ctx context.Context, email string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	breaches, found := m.emails[email]
+	if !found {
+		return nil, nil
+	}
+	result := append([]string{}, breaches...)
+	sort.Strings(result)
+	return result, nil
+}
+
+// GetAllBreaches restituisce un elenco di tutti i breach senza duplicati, in ordine alfabetico.
+func (m *Memory) GetAllBreaches(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	breaches := make([]string, 0, len(m.breaches))
+	for breach, accounts := range m.breaches {
+		if accounts > 0 {
+			breaches = append(breaches, breach)
+		}
+	}
+	sort.Strings(breaches)
+	return breaches, nil
+}
+
+// Close non ha risorse da liberare per il database in memoria.
+func (m *Memory) Close() error {
+	return nil
+}
+
+// ForEachEmail scorre una copia delle email presenti, così fn può usare il database senza blocchi.
+func (m *Memory) ForEachEmail(ctx context.Context, fn func(Record) error) error {
+	m.mu.RLock()
+	records := make([]Record, 0, len(m.emails))
+	for email, breaches := range m.emails {
+		records = append(records, Record{Email: email, Breaches: append([]string{}, breaches...)})
+	}
+	m.mu.RUnlock()
+
+	for _, record := range records {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetBreach restituisce una copia dei metadati del breach, o nil se non è nel catalogo.
+func (m *Memory) GetBreach(ctx context.Context, name string) (*Breach, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	breach, found := m.catalog[name]
+	if !found {
+		return nil, nil
+	}
+	breach.DataClasses = slices.Clone(breach.DataClasses)
+	return &breach, nil
+}
+
+// ListBreaches restituisce una copia del catalogo in ordine alfabetico di nome.
+func (m *Memory) ListBreaches(ctx context.Context) ([]Breach, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	breaches := make([]Breach, 0, len(m.catalog))
+	for _, breach := range m.catalog {
+		breach.DataClasses = slices.Clone(breach.DataClasses)
+		breaches = append(breaches, breach)
+	}
+	sort.Slice(breaches, func(i, j int) bool { return breaches[i].Name < breaches[j].Name })
+	return breaches, nil
+}
+
+// UpsertBreach crea o sostituisce i metadati del breach nel catalogo.
+func (m *Memory) UpsertBreach(ctx context.Context, breach Breach) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := breach.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	breach.DataClasses = slices.Clone(breach.DataClasses)
+	m.catalog[breach.Name] = breach
+	return nil
+}
+
+// DeleteBreach elimina i metadati del breach dal catalogo.
+func (m *Memory) DeleteBreach(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.catalog, name)
+	return nil
+}
+
+// GetAPIKey restituisce una copia della chiave, o nil se non esiste.
+func (m *Memory) GetAPIKey(ctx context.Context, id string) (*APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	key, found := m.apiKeys[id]
+	if !found {
+		return nil, nil
+	}
+	key.Scopes = slices.Clone(key.Scopes)
+	key.Domains = slices.Clone(key.Domains)
+	return &key, nil
+}
+
+// ListAPIKeys restituisce una copia di tutte le chiavi in ordine di creazione.
+func (m *Memory) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := make([]APIKey, 0, len(m.apiKeys))
+	for _, key := range m.apiKeys {
+		key.Scopes = slices.Clone(key.Scopes)
+		key.Domains = slices.Clone(key.Domains)
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, compareAPIKeys)
+	return keys, nil
+}
+
+// CreateAPIKey salva una nuova chiave.
+func (m *Memory) CreateAPIKey(ctx context.Context, key APIKey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := key.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, found := m.apiKeys[key.ID]; found {
+		return ErrAPIKeyExists
+	}
+	key.Scopes = slices.Clone(key.Scopes)
+	key.Domains = slices.Clone(key.Domains)
+	m.apiKeys[key.ID] = key
+	return nil
+}
+
+// RevokeAPIKey revoca la chiave, conservando la data di una revoca precedente.
+func (m *Memory) RevokeAPIKey(ctx context.Context, id string, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, found := m.apiKeys[id]
+	if !found {
+		return ErrAPIKeyNotFound
+	}
+	if key.RevokedAt.IsZero() {
+		key.RevokedAt = at
+		m.apiKeys[id] = key
+	}
+	return nil
+}
+
+// SetAPIKeyDomains sostituisce i domini della chiave.
+func (m *Memory) SetAPIKeyDomains(ctx context.Context, id string, domains []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, found := m.apiKeys[id]
+	if !found {
+		return ErrAPIKeyNotFound
+	}
+	key.Domains = slices.Clone(domains)
+	m.apiKeys[id] = key
+	return nil
+}
+
+// AddBreachEmails associa le email al breach, con gli stessi conteggi del BulkWrite di MongoDB.
+func (m *Memory) AddBreachEmails(ctx context.Context, breach string, emails []string) (WriteResult, error) {
+	if err := ctx.Err(); err != nil {
+		return WriteResult{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var result WriteResult
+	for _, email := range emails {
+		existed, added := m.add(email, breach)
+		switch {
+		case !existed:
+			result.UpsertedCount++
+		case added > 0:
+			result.MatchedCount++
+			result.ModifiedCount++
+		default:
+			result.MatchedCount++
+		}
+	}
+	return result, nil
+}
+
+// AddDataClasses aggiunge le classi di dati esposte dalle email nel breach. Le email non associate
+// al breach vengono ignorate.
+func (m *Memory) AddDataClasses(ctx context.Context, breach string, classes map[string][]string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for email, emailClasses := range classes {
+		if len(emailClasses) == 0 || !slices.Contains(m.emails[email], breach) {
+			continue
+		}
+		current := m.dataClasses[email]
+		if current == nil {
+			current = make(map[string][]string)
+			m.dataClasses[email] = current
+		}
+		current[breach] = mergeDataClasses(current[breach], emailClasses)
+	}
+	return nil
+}
+
+// FindDataClasses restituisce una copia delle classi di dati esposte dall'email in ogni breach.
+func (m *Memory) FindDataClasses(ctx context.Context, email string) (map[string][]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	current := m.dataClasses[email]
+	if len(current) == 0 {
+		return nil, nil
+	}
+	result := make(map[string][]string, len(current))
+	for breach, classes := range current {
+		result[breach] = slices.Clone(classes)
+	}
+	return result, nil
+}
+
+// ResetPasswordHashes toglie dai conteggi le occorrenze registrate per l'origine.
+func (m *Memory) ResetPasswordHashes(ctx context.Context, source string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for hash, count := range m.passwordSources[source] {
+		m.addPasswordCount(hash, -count)
+	}
+	delete(m.passwordSources, source)
+	delete(m.passwordBlocks, source)
+	return nil
+}
+
+// AddPasswordHashes somma le occorrenze degli hash delle password, se il blocco dell'origine non è già stato sommato.
+func (m *Memory) AddPasswordHashes(ctx context.Context, source string, block int, counts map[string]int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if source == "" {
+		return errors.New("origine degli hash delle password vuota")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	blocks := m.passwordBlocks[source]
+	if _, found := blocks[block]; found {
+		return nil
+	}
+	if blocks == nil {
+		blocks = make(map[int]struct{})
+		m.passwordBlocks[source] = blocks
+	}
+	blocks[block] = struct{}{}
+
+	sourceCounts := m.passwordSources[source]
+	if sourceCounts == nil {
+		sourceCounts = make(map[string]int64)
+		m.passwordSources[source] = sourceCounts
+	}
+	for hash, count := range normalizePasswordCounts(counts) {
+		sourceCounts[hash] += count
+		m.addPasswordCount(hash, count)
+	}
+	return nil
+}
+
+// addPasswordCount somma count alle occorrenze dell'hash, eliminandolo quando si azzerano. Va chiamata con il lock.
+func (m *Memory) addPasswordCount(hash string, count int64) {
+	prefix, suffix := hash[:PasswordPrefixLength], hash[PasswordPrefixLength:]
+	suffixes := m.passwords[prefix]
+	if suffixes == nil {
+		suffixes = make(map[string]int64)
+		m.passwords[prefix] = suffixes
+	}
+	if suffixes[suffix] += count; suffixes[suffix] <= 0 {
+		delete(suffixes, suffix)
+		if len(suffixes) == 0 {
+			delete(m.passwords, prefix)
+		}
+	}
+}
+
+// PasswordRange restituisce i suffissi degli hash con il prefisso indicato, in ordine alfabetico.
+func (m *Memory) PasswordRange(ctx context.Context, prefix string) ([]PasswordHash, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	suffixes := m.passwords[strings.ToUpper(prefix)]
+	hashes := make([]PasswordHash, 0, len(suffixes))
+	for suffix, count := range suffixes {
+		hashes = append(hashes, PasswordHash{Suffix: suffix, Count: count})
+	}
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i].Suffix < hashes[j].Suffix })
+	return hashes, nil
+}
+
+// CountEmails restituisce il numero di email presenti.
+func (m *Memory) CountEmails(ctx context.Context) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return int64(len(m.emails)), nil
+}
+
+// RemoveBreach rimuove il breach da tutte le email, eliminando quelle rimaste senza breach.
+func (m *Memory) RemoveBreach(ctx context.Context, breach string) (RemoveResult, error) {
+	if err := ctx.Err(); err != nil {
+		return RemoveResult{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var result RemoveResult
+	for email, breaches := range m.emails {
+		i := slices.Index(breaches, breach)
+		if i < 0 {
+			continue
+		}
+		result.UnlinkedCount++
+		if classes := m.dataClasses[email]; classes != nil {
+			if delete(classes, breach); len(classes) == 0 {
+				delete(m.dataClasses, email)
+			}
+		}
+		if len(breaches) == 1 {
+			delete(m.emails, email)
+			m.unindexEmail(email)
+			m.domains[EmailDomain(email)]--
+			result.DeletedCount++
+			continue
+		}
+		m.emails[email] = slices.Delete(slices.Clone(breaches), i, i+1)
+	}
+	delete(m.breaches, breach)
+	m.associations -= result.UnlinkedCount
+	return result, nil
+}
+
+// DeleteEmails elimina le email indicate e aggiorna i contatori.
+func (m *Memory) DeleteEmails(ctx context.Context, emails []string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for _, email := range emails {
+		breaches, found := m.emails[email]
+		if !found {
+			continue
+		}
+		for _, breach := range breaches {
+			if m.breaches[breach]--; m.breaches[breach] <= 0 {
+				delete(m.breaches, breach)
+			}
+		}
+		m.domains[EmailDomain(email)]--
+		m.associations -= int64(len(breaches))
+		delete(m.emails, email)
+		delete(m.dataClasses, email)
+		m.unindexEmail(email)
+		deleted++
+	}
+	return deleted, nil
+}
+
+// BreachStats restituisce il numero di email di ogni breach, in ordine alfabetico.
+func (m *Memory) BreachStats(ctx context.Context) ([]BreachStat, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stats := make([]BreachStat, 0, len(m.breaches))
+	for breach, accounts := range m.breaches {
+		if accounts > 0 {
+			stats = append(stats, BreachStat{Name: breach, Accounts: accounts})
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats, nil
+}
+
+// TopDomains restituisce i domini con più email.
+func (m *Memory) TopDomains(ctx context.Context, limit int) ([]DomainStat, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return topDomains(m.domains, limit), nil
+}
+
+// GlobalStats restituisce i contatori globali. I contatori in memoria sono sempre esatti,
+// quindi la data di ricostruzione è quella di creazione del database.
+func (m *Memory) GlobalStats(ctx context.Context) (Stats, error) {
+	if err := ctx.Err(); err != nil {
+		return Stats{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stats := Stats{
+		Emails:       int64(len(m.emails)),
+		Associations: m.associations,
+		ReconciledAt: m.created,
+	}
+	for _, accounts := range m.breaches {
+		if accounts > 0 {
+			stats.Breaches++
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,17 @@
+package database_test
+
+import (
+	"pwnscanner/pkg/database"
+	"pwnscanner/pkg/database/dbtest"
+	"testing"
+)
+
+func TestMemoryContract(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, seed []database.Record) database.Database {
+		db := database.NewMemory()
+		for _, r := range seed {
+			db.Add(r.Email, r.Breaches...)
+		}
+		return db
+	})
+}
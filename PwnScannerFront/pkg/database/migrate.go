@@ -0,0 +1,52 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrSchemaTooNew indica un database migrato da una versione più recente del programma:
+// lo schema contiene modifiche che questa versione non conosce e non deve usarlo.
+var ErrSchemaTooNew = errors.New("lo schema del database è più recente di quello supportato")
+
+// Migration descrive una migrazione dello schema.
+type Migration struct {
+	// Version è il numero progressivo della migrazione, a partire da 1
+	Version int `bson:"_id"`
+	// Description riassume le modifiche applicate
+	Description string `bson:"description"`
+	// AppliedAt è il momento in cui la migrazione è stata applicata; zero se non ancora applicata
+	AppliedAt time.Time `bson:"applied_at"`
+}
+
+// SchemaStatus è lo stato delle migrazioni di un database.
+type SchemaStatus struct {
+	// Current è la versione dello schema registrata nel database (0 = nessuna migrazione applicata)
+	Current int
+	// Latest è la versione più recente conosciuta da questo programma
+	Latest int
+	// Pending sono le migrazioni ancora da applicare, in ordine
+	Pending []Migration
+}
+
+// Check restituisce un errore che avvolge ErrSchemaTooNew se il database è stato migrato
+// da una versione più recente del programma.
+func (s SchemaStatus) Check() error {
+	if s.Current > s.Latest {
+		return fmt.Errorf("%w: versione %d, supportata fino alla %d", ErrSchemaTooNew, s.Current, s.Latest)
+	}
+	return nil
+}
+
+// Migrator è implementato dai database con uno schema versionato (indici, validatori).
+// Le migrazioni sono idempotenti: applicarle più volte, anche da processi concorrenti, ha lo stesso effetto.
+type Migrator interface {
+	// SchemaStatus legge la versione dello schema registrata nel database
+	SchemaStatus(ctx context.Context) (SchemaStatus, error)
+
+	// Migrate applica in ordine le migrazioni mancanti e restituisce quelle applicate.
+	// Fallisce con ErrSchemaTooNew, senza modificare nulla, se lo schema è più recente del programma.
+	Migrate(ctx context.Context) ([]Migration, error)
+}
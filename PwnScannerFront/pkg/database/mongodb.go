@@ -2,16 +2,126 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+	"pwnscanner/pkg/normalize"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // MongoDB rappresenta l'implementazione del database per MongoDB.
 type MongoDB struct {
-	client     *mongo.Client
-	collection *mongo.Collection
+	client         *mongo.Client
+	collection     *mongo.Collection
+	catalog        *mongo.Collection
+	breachStats    *mongo.Collection
+	domainStats    *mongo.Collection
+	stats          *mongo.Collection
+	migrations     *mongo.Collection
+	apiKeys        *mongo.Collection
+	rateLimits     *mongo.Collection
+	dataClasses    *mongo.Collection
+	passwords      *mongo.Collection
+	passwordBlocks *mongo.Collection
+
+	// emailKeys, se impostate, fanno conservare le email come HMAC (vedi SetEmailKeys)
+	emailKeys *EmailKeys
+}
+
+// Collezioni ausiliarie, nello stesso database della collezione delle email.
+const (
+	// CatalogCollection contiene i metadati dei breach
+	CatalogCollection = "breach_catalog"
+	// BreachStatsCollection contiene il numero di email di ogni breach (_id = nome del breach)
+	BreachStatsCollection = "breach_stats"
+	// DomainStatsCollection contiene il numero di email distinte di ogni dominio (_id = dominio)
+	DomainStatsCollection = "domain_stats"
+	// StatsCollection contiene il documento dei contatori globali (_id = "global")
+	StatsCollection = "stats"
+	// APIKeysCollection contiene le chiavi API dei client (_id = identificativo della chiave)
+	APIKeysCollection = "api_keys"
+	// RateLimitsCollection contiene i bucket del rate limiting condivisi tra le istanze (_id = bucket)
+	RateLimitsCollection = "rate_limits"
+	// DataClassesCollection contiene le classi di dati esposte da un'email in un breach (un documento per coppia)
+	DataClassesCollection = "breach_data_classes"
+	// PasswordHashesCollection contiene le occorrenze degli hash SHA-1 delle password contate per ogni origine
+	// (_id = hash in maiuscolo, ":" e origine; i conteggi precedenti alle origini hanno come _id il solo hash)
+	PasswordHashesCollection = "password_hashes"
+	// PasswordBlocksCollection contiene i blocchi di ogni origine già sommati in password_hashes
+	// (_id = origine, ":" e numero del blocco)
+	PasswordBlocksCollection = "password_blocks"
+)
+
+// globalStatsID è l'_id del documento dei contatori globali.
+const globalStatsID = "global"
+
+// domainStatsIndex è l'indice di domain_stats usato da TopDomains.
+var domainStatsIndex = mongo.IndexModel{
+	Keys: bson.D{{Key: "accounts", Value: -1}, {Key: "_id", Value: 1}},
+}
+
+// domainExpression calcola in un'aggregazione il dominio dell'email: il campo domain delle email conservate
+// come HMAC o, per quelle in chiaro, il dominio di $email con la stessa regola di EmailDomain.
+var domainExpression = bson.M{"$ifNull": bson.A{
+	"$domain",
+	bson.M{"$toLower": bson.M{"$arrayElemAt": bson.A{bson.M{"$split": bson.A{"$email", "@"}}, -1}}},
+}}
+
+// mongoUnavailableCodes sono i codici di errore del server che indicano un primario non disponibile
+// o in arresto, ad esempio durante un'elezione nel replica set.
+var mongoUnavailableCodes = []int{
+	6,     // HostUnreachable
+	7,     // HostNotFound
+	89,    // NetworkTimeout
+	91,    // ShutdownInProgress
+	189,   // PrimarySteppedDown
+	9001,  // SocketException
+	10107, // NotWritablePrimary
+	11600, // InterruptedAtShutdown
+	11602, // InterruptedDueToReplStateChange
+	13435, // NotPrimaryNoSecondaryOk
+	13436, // NotPrimaryOrSecondary
+}
+
+// mongoWriteConflict è il codice di errore di una scrittura in conflitto con una scrittura concorrente.
+const mongoWriteConflict = 112
+
+// mongoError classifica gli errori del driver: contesto scaduto o annullato, server irraggiungibile
+// o primario non disponibile (ErrUnavailable), conflitto tra scritture (ErrConflict) o timeout
+// del driver (context.DeadlineExceeded). Gli altri errori restano invariati.
+func mongoError(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() != nil {
+		return contextError(ctx, err)
+	}
+	var selection topology.ServerSelectionError
+	switch {
+	case errors.As(err, &selection), mongo.IsNetworkError(err), errors.Is(err, mongo.ErrClientDisconnected):
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	case mongo.IsTimeout(err):
+		return fmt.Errorf("%w: %w", context.DeadlineExceeded, err)
+	}
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) {
+		switch {
+		case serverErr.HasErrorCode(mongoWriteConflict), serverErr.HasErrorLabel("TransientTransactionError"):
+			return fmt.Errorf("%w: %w", ErrConflict, err)
+		case serverErr.HasErrorLabel("RetryableWriteError"):
+			return fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+		for _, code := range mongoUnavailableCodes {
+			if serverErr.HasErrorCode(code) {
+				return fmt.Errorf("%w: %w", ErrUnavailable, err)
+			}
+		}
+	}
+	return err
 }
 
 // NewMongoDB crea una nuova connessione a MongoDB.
@@ -23,68 +133,970 @@ func NewMongoDB(ctx context.Context, host string, port int, username, password,
 		return nil, fmt.Errorf("errore durante la connessione a MongoDB: %w", err)
 	}
 
-	collection := client.Database(dbName).Collection(collectionName)
+	return newMongoDB(client, dbName, collectionName), nil
+}
+
+// NewMongoDBFromURI crea una nuova connessione a MongoDB a partire da una connection string completa.
+// Restituisce il tipo concreto, che implementa sia Database sia Writer.
+func NewMongoDBFromURI(ctx context.Context, uri, dbName, collectionName string) (*MongoDB, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, fmt.Errorf("errore durante la connessione a MongoDB: %w", err)
+	}
+
+	return newMongoDB(client, dbName, collectionName), nil
+}
+
+// newMongoDB prepara le collezioni usate dall'implementazione.
+func newMongoDB(client *mongo.Client, dbName, collectionName string) *MongoDB {
+	database := client.Database(dbName)
 	return &MongoDB{
-		client:     client,
-		collection: collection,
-	}, nil
+		client:         client,
+		collection:     database.Collection(collectionName),
+		catalog:        database.Collection(CatalogCollection),
+		breachStats:    database.Collection(BreachStatsCollection),
+		domainStats:    database.Collection(DomainStatsCollection),
+		stats:          database.Collection(StatsCollection),
+		migrations:     database.Collection(MigrationsCollection),
+		apiKeys:        database.Collection(APIKeysCollection),
+		rateLimits:     database.Collection(RateLimitsCollection),
+		dataClasses:    database.Collection(DataClassesCollection),
+		passwords:      database.Collection(PasswordHashesCollection),
+		passwordBlocks: database.Collection(PasswordBlocksCollection),
+	}
+}
+
+// SetEmailKeys fa conservare e cercare le email come HMAC con le chiavi indicate, al posto dell'indirizzo
+// in chiaro; il documento conserva in chiaro solo il dominio, per i contatori. Va chiamato prima di usare
+// il database, con le stesse chiavi in PwnScannerFront e in pwnadmin. Le email già presenti in chiaro
+// o con una catena precedente si convertono con RotateEmailKeys.
+func (db *MongoDB) SetEmailKeys(keys *EmailKeys) {
+	db.emailKeys = keys
+}
+
+// emailFilter restituisce la condizione sul campo email che trova l'email normalizzata: l'email stessa
+// o, con le chiavi HMAC, i valori calcolati da EmailKeys.Lookup.
+func (db *MongoDB) emailFilter(email string) any {
+	if db.emailKeys == nil {
+		return email
+	}
+	values := db.emailKeys.Lookup(email)
+	if len(values) == 1 {
+		return values[0]
+	}
+	return bson.M{"$in": values}
+}
+
+// emailInsert restituisce i campi impostati da un upsert che crea il documento dell'email: il dominio,
+// per la ricerca per dominio, e l'hash SHA-256 per le ricerche per intervallo o, con le chiavi HMAC,
+// il valore conservato. Un filtro $in non imposta il campo email nel documento creato.
+func (db *MongoDB) emailInsert(email string) bson.M {
+	if db.emailKeys == nil {
+		return bson.M{"email_hash": normalize.Hash(email), "domain": EmailDomain(email)}
+	}
+	return bson.M{"email": db.emailKeys.Value(email), "domain": EmailDomain(email)}
 }
 
 // FindEmail cerca un'email nei breach.
-// Restituisce un elenco di breach associati all'email specificata.
+// Restituisce un elenco di breach associati all'email specificata, in ordine alfabetico.
 func (db *MongoDB) FindEmail(ctx context.Context, email string) ([]string, error) {
 	var result struct {
 		Breaches []string `bson:"breaches"`
 	}
 
-	filter := bson.M{"email": email}
+	filter := bson.M{"email": db.emailFilter(email)}
 	err := db.collection.FindOne(ctx, filter).Decode(&result)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return nil, nil
 		}
-		return nil, err
+		return nil, mongoError(ctx, err)
 	}
 
+	sort.Strings(result.Breaches)
 	return result.Breaches, nil
 }
 
+// FindEmailRange cerca le email con l'hash che inizia con prefix con una ricerca per intervallo
+// sull'indice di email_hash: le cifre esadecimali maiuscole precedono "G" nell'ordinamento delle stringhe.
+// Le email conservate come HMAC non hanno l'hash SHA-256, che permetterebbe di verificarle senza la chiave.
+func (db *MongoDB) FindEmailRange(ctx context.Context, prefix string) ([]EmailHashMatch, error) {
+	if db.emailKeys != nil {
+		return nil, ErrHashedEmails
+	}
+	prefix = strings.ToUpper(prefix)
+	filter := bson.M{"email_hash": bson.M{"$gte": prefix, "$lt": prefix + "G"}}
+	opts := options.Find().
+		SetProjection(bson.M{"_id": 0, "email_hash": 1, "breaches": 1}).
+		SetSort(bson.M{"email_hash": 1})
+	cursor, err := db.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, mongoError(ctx, err)
+	}
+	var documents []struct {
+		Hash     string   `bson:"email_hash"`
+		Breaches []string `bson:"breaches"`
+	}
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, mongoError(ctx, err)
+	}
+
+	matches := make([]EmailHashMatch, 0, len(documents))
+	for _, document := range documents {
+		sort.Strings(document.Breaches)
+		matches = append(matches, EmailHashMatch{Suffix: document.Hash[len(prefix):], Breaches: document.Breaches})
+	}
+	return matches, nil
+}
+
+// FindDomainEmails legge dall'indice su domain ed email le email del dominio successive ad after.
+// Le email conservate come HMAC non possono essere restituite in chiaro.
+func (db *MongoDB) FindDomainEmails(ctx context.Context, domain, after string, limit int) ([]Record, error) {
+	if db.emailKeys != nil {
+		return nil, ErrHashedEmails
+	}
+	if limit <= 0 {
+		return []Record{}, nil // Per MongoDB un limite pari a zero significa "nessun limite"
+	}
+	filter := bson.M{"domain": domain, "email": bson.M{"$gt": after}}
+	opts := options.Find().
+		SetProjection(bson.M{"_id": 0, "email": 1, "breaches": 1}).
+		SetSort(bson.D{{Key: "domain", Value: 1}, {Key: "email", Value: 1}}).
+		SetLimit(int64(limit))
+	cursor, err := db.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, mongoError(ctx, err)
+	}
+	records := []Record{}
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, mongoError(ctx, err)
+	}
+	for _, record := range records {
+		sort.Strings(record.Breaches)
+	}
+	return records, nil
+}
+
+// DomainBreachStats conta con un'aggregazione sull'indice di domain le email del dominio in ogni breach.
+func (db *MongoDB) DomainBreachStats(ctx context.Context, domain string) ([]BreachStat, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"domain": domain}}},
+		{{Key: "$unwind", Value: "$breaches"}},
+		{{Key: "$group", Value: bson.M{"_id": "$breaches", "accounts": bson.M{"$sum": 1}}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	}
+	cursor, err := db.collection.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, mongoError(ctx, err)
+	}
+	stats := []BreachStat{}
+	if err := cursor.All(ctx, &stats); err != nil {
+		return nil, mongoError(ctx, err)
+	}
+	return stats, nil
+}
+
+// Ping verifica che il server primario di MongoDB risponda.
+func (db *MongoDB) Ping(ctx context.Context) error {
+	return mongoError(ctx, db.client.Ping(ctx, nil))
+}
+
 // Close chiude la connessione a MongoDB.
 // Deve essere chiamata per liberare le risorse.
 func (db *MongoDB) Close() error {
 	return db.client.Disconnect(context.Background())
 }
 
-// GetAllBreaches restituisce un elenco di tutti i breach senza duplicati.
-// Esegue una query sulla collezione per raccogliere tutti i breach.
+// GetAllBreaches restituisce un elenco di tutti i breach senza duplicati, in ordine alfabetico.
+// Legge i contatori materializzati in breach_stats, senza scorrere le email.
 func (db *MongoDB) GetAllBreaches(ctx context.Context) ([]string, error) {
-	var breaches []string
-	cursor, err := db.collection.Find(ctx, bson.M{})
+	stats, err := db.BreachStats(ctx)
 	if err != nil {
 		return nil, err
 	}
+
+	breaches := make([]string, 0, len(stats))
+	for _, stat := range stats {
+		breaches = append(breaches, stat.Name)
+	}
+	return breaches, nil
+}
+
+// AddBreachEmails associa le email al breach con un BulkWrite di upsert e $addToSet.
+func (db *MongoDB) AddBreachEmails(ctx context.Context, breach string, emails []string) (WriteResult, error) {
+	if len(emails) == 0 {
+		return WriteResult{}, nil
+	}
+
+	// Il BulkWrite non è ordinato: il server può eseguire gli upsert in parallelo e continua dopo un errore.
+	// Due upsert concorrenti della stessa email nuova possono fallire per chiave duplicata: ripetuti,
+	// trovano il documento creato dall'altro e aggiungono il breach.
+	var total WriteResult
+	var newEmails []string
+	pending := emails
+	var writeErr error
+	for attempt := 0; len(pending) > 0; attempt++ {
+		models := make([]mongo.WriteModel, 0, len(pending))
+		for _, email := range pending {
+			// Crea un modello di aggiornamento con upsert
+			model := mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"email": db.emailFilter(email)}).
+				SetUpdate(bson.M{
+					"$addToSet":    bson.M{"breaches": breach},
+					"$setOnInsert": db.emailInsert(email),
+				}).
+				SetUpsert(true)
+			models = append(models, model)
+		}
+
+		result, err := db.collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		if result != nil {
+			total.MatchedCount += result.MatchedCount
+			total.ModifiedCount += result.ModifiedCount
+			total.UpsertedCount += result.UpsertedCount
+			for index := range result.UpsertedIDs {
+				newEmails = append(newEmails, pending[index])
+			}
+		}
+		if err == nil {
+			break
+		}
+		retry, ok := duplicateKeyRetries(err, pending)
+		if !ok || attempt == maxDuplicateKeyRetries {
+			writeErr = mongoError(ctx, err)
+			break
+		}
+		pending = retry
+	}
+
+	// Aggiorna i contatori, anche per le email scritte prima di un errore. Non è atomico rispetto
+	// al BulkWrite: un errore qui lascia i contatori indietro finché non vengono ricostruiti con ReconcileStats.
+	added := total.ModifiedCount + total.UpsertedCount
+	delta := statsDelta{
+		breaches:     map[string]int64{breach: added},
+		emails:       total.UpsertedCount,
+		associations: added,
+	}
+	delta.addEmailDomains(newEmails, 1)
+	if err := db.applyStats(context.WithoutCancel(ctx), delta); err != nil {
+		return WriteResult{}, fmt.Errorf("errore durante l'aggiornamento delle statistiche: %w", mongoError(ctx, err))
+	}
+	if writeErr != nil {
+		return WriteResult{}, writeErr
+	}
+	return total, nil
+}
+
+// AddDataClasses aggiunge le classi di dati esposte dalle email nel breach con un BulkWrite di upsert
+// e $addToSet su breach_data_classes. Come in AddBreachEmails, gli upsert concorrenti falliti
+// per chiave duplicata vengono ripetuti.
+func (db *MongoDB) AddDataClasses(ctx context.Context, breach string, classes map[string][]string) error {
+	pending := make([]string, 0, len(classes))
+	for email, emailClasses := range classes {
+		if len(emailClasses) > 0 {
+			pending = append(pending, email)
+		}
+	}
+	sort.Strings(pending)
+
+	for attempt := 0; len(pending) > 0; attempt++ {
+		models := make([]mongo.WriteModel, 0, len(pending))
+		for _, email := range pending {
+			update := bson.M{"$addToSet": bson.M{"classes": bson.M{"$each": classes[email]}}}
+			if db.emailKeys != nil {
+				update["$setOnInsert"] = bson.M{"email": db.emailKeys.Value(email)}
+			}
+			model := mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"email": db.emailFilter(email), "breach": breach}).
+				SetUpdate(update).
+				SetUpsert(true)
+			models = append(models, model)
+		}
+
+		_, err := db.dataClasses.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		if err == nil {
+			return nil
+		}
+		retry, ok := duplicateKeyRetries(err, pending)
+		if !ok || attempt == maxDuplicateKeyRetries {
+			return mongoError(ctx, err)
+		}
+		pending = retry
+	}
+	return nil
+}
+
+// FindDataClasses legge da breach_data_classes le classi di dati esposte dall'email. Durante la rotazione
+// delle chiavi HMAC lo stesso breach può comparire con entrambi i valori dell'email: le classi vengono unite.
+func (db *MongoDB) FindDataClasses(ctx context.Context, email string) (map[string][]string, error) {
+	cursor, err := db.dataClasses.Find(ctx, bson.M{"email": db.emailFilter(email)}, options.Find().SetProjection(bson.M{"_id": 0, "breach": 1, "classes": 1}))
+	if err != nil {
+		return nil, mongoError(ctx, err)
+	}
+	var documents []struct {
+		Breach  string   `bson:"breach"`
+		Classes []string `bson:"classes"`
+	}
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, mongoError(ctx, err)
+	}
+
+	var result map[string][]string
+	for _, document := range documents {
+		if len(document.Classes) == 0 {
+			continue
+		}
+		if result == nil {
+			result = make(map[string][]string, len(documents))
+		}
+		classes := append(result[document.Breach], document.Classes...)
+		sort.Strings(classes)
+		result[document.Breach] = slices.Compact(classes)
+	}
+	return result, nil
+}
+
+// passwordCountID restituisce l'_id del documento di password_hashes con le occorrenze dell'hash contate per
+// l'origine: l'hash precede l'origine, così i documenti dello stesso hash sono contigui nell'indice dell'_id.
+func passwordCountID(hash, source string) string {
+	return hash + ":" + source
+}
+
+// passwordBlockID restituisce l'_id del documento di password_blocks che registra il blocco dell'origine.
+func passwordBlockID(source string, block int) string {
+	return source + ":" + strconv.Itoa(block)
+}
+
+// ResetPasswordHashes elimina da password_hashes i documenti dell'origine e da password_blocks i blocchi
+// registrati. I documenti importati prima dei conteggi per origine hanno come _id il solo hash e non
+// appartengono a nessuna origine.
+func (db *MongoDB) ResetPasswordHashes(ctx context.Context, source string) error {
+	if _, err := db.passwordBlocks.DeleteMany(ctx, bson.M{"source": source}); err != nil {
+		return mongoError(ctx, err)
+	}
+	_, err := db.passwords.DeleteMany(ctx, bson.M{"source": source})
+	return mongoError(ctx, err)
+}
+
+// AddPasswordHashes somma le occorrenze degli hash delle password nei documenti dell'origine, se il blocco
+// non è già registrato in password_blocks. Senza transazioni, ogni $inc registra il blocco nel campo pending
+// del proprio documento, nello stesso aggiornamento: il filtro esclude i documenti in cui il blocco è già
+// in pending, così un blocco ripetuto dopo un errore somma solo gli hash mancanti. Sommati tutti gli hash,
+// il blocco viene registrato in password_blocks e tolto dai pending, che contengono così solo i blocchi
+// in corso o interrotti e non crescono con la dimensione dell'import.
+// Un upsert fallito per chiave duplicata ha trovato il documento creato da un import concorrente, e va
+// ripetuto, oppure un documento in cui il blocco è già sommato, e va ignorato.
+func (db *MongoDB) AddPasswordHashes(ctx context.Context, source string, block int, counts map[string]int64) error {
+	if source == "" {
+		return errors.New("origine degli hash delle password vuota")
+	}
+	normalized := normalizePasswordCounts(counts)
+	hashes := make([]string, 0, len(normalized))
+	for hash := range normalized {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+
+	blockID := passwordBlockID(source, block)
+	err := db.passwordBlocks.FindOne(ctx, bson.M{"_id": blockID}, options.FindOne().SetProjection(bson.M{"_id": 1})).Err()
+	switch {
+	case err == nil:
+		// blocco già sommato: restano da togliere i pending di un tentativo interrotto
+		return db.clearPasswordBlock(ctx, source, block, hashes)
+	case !errors.Is(err, mongo.ErrNoDocuments):
+		return mongoError(ctx, err)
+	}
+
+	pending := hashes
+	for attempt := 0; len(pending) > 0; attempt++ {
+		models := make([]mongo.WriteModel, 0, len(pending))
+		for _, hash := range pending {
+			model := mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": passwordCountID(hash, source), "pending": bson.M{"$ne": block}}).
+				SetUpdate(bson.M{
+					"$inc":         bson.M{"count": normalized[hash]},
+					"$push":        bson.M{"pending": block},
+					"$setOnInsert": bson.M{"source": source},
+				}).
+				SetUpsert(true)
+			models = append(models, model)
+		}
+
+		_, err := db.passwords.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		if err == nil {
+			break
+		}
+		retry, ok := duplicateKeyRetries(err, pending)
+		if !ok || attempt == maxDuplicateKeyRetries {
+			return mongoError(ctx, err)
+		}
+		if pending, err = db.passwordBlockPending(ctx, source, block, retry); err != nil {
+			return err
+		}
+	}
+
+	_, err = db.passwordBlocks.InsertOne(ctx, bson.M{"_id": blockID, "source": source, "block": block})
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return mongoError(ctx, err)
+	}
+	return db.clearPasswordBlock(ctx, source, block, hashes)
+}
+
+// clearPasswordBlock toglie il blocco dai pending dei documenti degli hash, dopo averlo registrato in password_blocks.
+func (db *MongoDB) clearPasswordBlock(ctx context.Context, source string, block int, hashes []string) error {
+	if len(hashes) == 0 {
+		return nil
+	}
+	ids := make([]string, len(hashes))
+	for i, hash := range hashes {
+		ids[i] = passwordCountID(hash, source)
+	}
+	_, err := db.passwords.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}, "pending": block},
+		bson.M{"$pull": bson.M{"pending": block}})
+	return mongoError(ctx, err)
+}
+
+// passwordBlockPending restituisce gli hash in cui il blocco dell'origine non è ancora sommato.
+func (db *MongoDB) passwordBlockPending(ctx context.Context, source string, block int, hashes []string) ([]string, error) {
+	ids := make([]string, len(hashes))
+	for i, hash := range hashes {
+		ids[i] = passwordCountID(hash, source)
+	}
+	cursor, err := db.passwords.Find(ctx, bson.M{"_id": bson.M{"$in": ids}, "pending": block},
+		options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, mongoError(ctx, err)
+	}
+	var documents []struct {
+		ID string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, mongoError(ctx, err)
+	}
+
+	applied := make(map[string]bool, len(documents))
+	for _, document := range documents {
+		applied[document.ID] = true
+	}
+	pending := make([]string, 0, len(hashes))
+	for i, hash := range hashes {
+		if !applied[ids[i]] {
+			pending = append(pending, hash)
+		}
+	}
+	return pending, nil
+}
+
+// PasswordRange legge da password_hashes gli hash con il prefisso indicato con una ricerca per
+// intervallo sull'_id: le cifre esadecimali maiuscole precedono "G" nell'ordinamento delle stringhe.
+// Le occorrenze dello stesso hash, in documenti contigui (uno per origine), vengono sommate.
+func (db *MongoDB) PasswordRange(ctx context.Context, prefix string) ([]PasswordHash, error) {
+	prefix = strings.ToUpper(prefix)
+	filter := bson.M{"_id": bson.M{"$gte": prefix, "$lt": prefix + "G"}}
+	cursor, err := db.passwords.Find(ctx, filter, options.Find().SetSort(bson.M{"_id": 1}).SetProjection(bson.M{"count": 1}))
+	if err != nil {
+		return nil, mongoError(ctx, err)
+	}
+	var documents []struct {
+		ID    string `bson:"_id"`
+		Count int64  `bson:"count"`
+	}
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, mongoError(ctx, err)
+	}
+
+	hashes := make([]PasswordHash, 0, len(documents))
+	for _, document := range documents {
+		if len(document.ID) < PasswordHashLength || document.Count <= 0 {
+			continue
+		}
+		suffix := document.ID[len(prefix):PasswordHashLength]
+		if last := len(hashes) - 1; last >= 0 && hashes[last].Suffix == suffix {
+			hashes[last].Count += document.Count
+			continue
+		}
+		hashes = append(hashes, PasswordHash{Suffix: suffix, Count: document.Count})
+	}
+	return hashes, nil
+}
+
+// maxDuplicateKeyRetries è il numero massimo di volte in cui AddBreachEmails ripete gli upsert
+// falliti per chiave duplicata.
+const maxDuplicateKeyRetries = 3
+
+// duplicateKeyRetries restituisce le email degli upsert falliti se tutti gli errori di err sono
+// di chiave duplicata, gli unici che AddBreachEmails e AddDataClasses ripetono subito.
+func duplicateKeyRetries(err error, emails []string) ([]string, bool) {
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil || len(bulkErr.WriteErrors) == 0 {
+		return nil, false
+	}
+	retry := make([]string, 0, len(bulkErr.WriteErrors))
+	for _, writeErr := range bulkErr.WriteErrors {
+		if !mongo.IsDuplicateKeyError(writeErr) {
+			return nil, false
+		}
+		retry = append(retry, emails[writeErr.Index])
+	}
+	return retry, true
+}
+
+// statsDelta contiene le variazioni (positive o negative) da applicare ai contatori.
+type statsDelta struct {
+	breaches     map[string]int64 // breach -> associazioni
+	domains      map[string]int64 // dominio -> email
+	emails       int64
+	associations int64
+}
+
+// addEmailDomains conta le email indicate nei domini, con il segno dato.
+func (d *statsDelta) addEmailDomains(emails []string, sign int64) {
+	if d.domains == nil {
+		d.domains = make(map[string]int64)
+	}
+	for _, email := range emails {
+		d.domains[EmailDomain(email)] += sign
+	}
+}
+
+// applyStats applica le variazioni alle collezioni dei contatori.
+func (db *MongoDB) applyStats(ctx context.Context, delta statsDelta) error {
+	for collection, counts := range map[*mongo.Collection]map[string]int64{
+		db.breachStats: delta.breaches,
+		db.domainStats: delta.domains,
+	} {
+		models := make([]mongo.WriteModel, 0, len(counts))
+		for id, count := range counts {
+			if count == 0 {
+				continue
+			}
+			models = append(models, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": id}).
+				SetUpdate(bson.M{"$inc": bson.M{"accounts": count}}).
+				SetUpsert(true))
+		}
+		if len(models) == 0 {
+			continue
+		}
+		if _, err := collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+			return err
+		}
+	}
+
+	if delta.emails == 0 && delta.associations == 0 {
+		return nil
+	}
+	_, err := db.stats.UpdateOne(ctx, bson.M{"_id": globalStatsID}, bson.M{"$inc": bson.M{
+		"emails":       delta.emails,
+		"associations": delta.associations,
+	}}, options.Update().SetUpsert(true))
+	return err
+}
+
+// CountEmails restituisce il numero di documenti nella collezione.
+func (db *MongoDB) CountEmails(ctx context.Context) (int64, error) {
+	return db.collection.CountDocuments(ctx, bson.M{})
+}
+
+// ForEachEmail scorre tutta la collezione leggendo solo email e breach.
+// Con le chiavi HMAC le email non sono disponibili in chiaro e restituisce ErrHashedEmails.
+func (db *MongoDB) ForEachEmail(ctx context.Context, fn func(Record) error) error {
+	if db.emailKeys != nil {
+		return ErrHashedEmails
+	}
+	opts := options.Find().
+		SetProjection(bson.M{"_id": 0, "email": 1, "breaches": 1}).
+		SetBatchSize(1000)
+	cursor, err := db.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return err
+	}
 	defer cursor.Close(ctx)
 
 	for cursor.Next(ctx) {
-		var doc struct {
-			Breaches []string `bson:"breaches"`
+		var record Record
+		if err := cursor.Decode(&record); err != nil {
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// GetBreach restituisce i metadati del breach dal catalogo, o nil se non è presente.
+func (db *MongoDB) GetBreach(ctx context.Context, name string) (*Breach, error) {
+	var breach Breach
+	err := db.catalog.FindOne(ctx, bson.M{"_id": name}).Decode(&breach)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, mongoError(ctx, err)
+	}
+	return &breach, nil
+}
+
+// ListBreaches restituisce tutto il catalogo in ordine alfabetico di nome.
+func (db *MongoDB) ListBreaches(ctx context.Context) ([]Breach, error) {
+	cursor, err := db.catalog.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, mongoError(ctx, err)
+	}
+	defer cursor.Close(ctx)
+
+	breaches := []Breach{}
+	if err := cursor.All(ctx, &breaches); err != nil {
+		return nil, mongoError(ctx, err)
+	}
+	return breaches, nil
+}
+
+// UpsertBreach crea o sostituisce i metadati del breach nel catalogo.
+func (db *MongoDB) UpsertBreach(ctx context.Context, breach Breach) error {
+	if err := breach.Validate(); err != nil {
+		return err
+	}
+	_, err := db.catalog.ReplaceOne(ctx, bson.M{"_id": breach.Name}, breach, options.Replace().SetUpsert(true))
+	return err
+}
+
+// DeleteBreach elimina i metadati del breach dal catalogo.
+func (db *MongoDB) DeleteBreach(ctx context.Context, name string) error {
+	_, err := db.catalog.DeleteOne(ctx, bson.M{"_id": name})
+	return err
+}
+
+// GetAPIKey restituisce la chiave, o nil se non esiste.
+func (db *MongoDB) GetAPIKey(ctx context.Context, id string) (*APIKey, error) {
+	var key APIKey
+	err := db.apiKeys.FindOne(ctx, bson.M{"_id": id}).Decode(&key)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, mongoError(ctx, err)
+	}
+	return &key, nil
+}
+
+// ListAPIKeys restituisce tutte le chiavi in ordine di creazione.
+func (db *MongoDB) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	cursor, err := db.apiKeys.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	keys := []APIKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// CreateAPIKey salva una nuova chiave.
+func (db *MongoDB) CreateAPIKey(ctx context.Context, key APIKey) error {
+	if err := key.Validate(); err != nil {
+		return err
+	}
+	_, err := db.apiKeys.InsertOne(ctx, key)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrAPIKeyExists
+	}
+	return err
+}
+
+// RevokeAPIKey revoca la chiave, conservando la data di una revoca precedente.
+func (db *MongoDB) RevokeAPIKey(ctx context.Context, id string, at time.Time) error {
+	key, err := db.GetAPIKey(ctx, id)
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		return ErrAPIKeyNotFound
+	}
+	if !key.RevokedAt.IsZero() {
+		return nil
+	}
+	_, err = db.apiKeys.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"revoked_at": at}})
+	return err
+}
+
+// SetAPIKeyDomains sostituisce i domini della chiave; senza domini il campo viene rimosso,
+// come per le chiavi create senza domini.
+func (db *MongoDB) SetAPIKeyDomains(ctx context.Context, id string, domains []string) error {
+	update := bson.M{"$set": bson.M{"domains": domains}}
+	if len(domains) == 0 {
+		update = bson.M{"$unset": bson.M{"domains": ""}}
+	}
+	result, err := db.apiKeys.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// TakeTokens applica TokenBucket.Take al bucket con un unico aggiornamento atomico (upsert con pipeline).
+// expires_at è l'istante in cui il bucket torna pieno, usato dall'indice TTL e da PruneRateLimits.
+func (db *MongoDB) TakeTokens(ctx context.Context, key string, bucket TokenBucket, cost float64, force bool, now time.Time) (float64, bool, error) {
+	elapsed := bson.M{"$divide": bson.A{bson.M{"$subtract": bson.A{now, bson.M{"$ifNull": bson.A{"$updated_at", now}}}}, 1000}}
+	available := bson.M{"$min": bson.A{
+		bucket.Burst,
+		bson.M{"$add": bson.A{
+			bson.M{"$ifNull": bson.A{"$tokens", bucket.Burst}},
+			bson.M{"$multiply": bson.A{bson.M{"$max": bson.A{0, elapsed}}, bucket.Rate}},
+		}},
+	}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"available": available}}},
+		{{Key: "$set", Value: bson.M{"allowed": bson.M{"$or": bson.A{force, bson.M{"$gte": bson.A{"$available", 1}}}}}}},
+		{{Key: "$set", Value: bson.M{
+			"tokens":     bson.M{"$cond": bson.A{"$allowed", bson.M{"$subtract": bson.A{"$available", cost}}, "$available"}},
+			"updated_at": bson.M{"$max": bson.A{"$updated_at", now}},
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"expires_at": bson.M{"$add": bson.A{now, bson.M{"$multiply": bson.A{
+				bson.M{"$divide": bson.A{bson.M{"$max": bson.A{0, bson.M{"$subtract": bson.A{bucket.Burst, "$tokens"}}}}, bucket.Rate}},
+				1000,
+			}}}},
+		}}},
+		{{Key: "$unset", Value: "available"}},
+	}
+
+	var result struct {
+		Tokens  float64 `bson:"tokens"`
+		Allowed bool    `bson:"allowed"`
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := db.rateLimits.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline, opts).Decode(&result)
+	if err != nil {
+		return 0, false, mongoError(ctx, err)
+	}
+	return result.Tokens, result.Allowed, nil
+}
+
+// PruneRateLimits elimina i bucket tornati pieni. Con la migrazione 4 lo fa anche l'indice TTL su expires_at.
+func (db *MongoDB) PruneRateLimits(ctx context.Context, now time.Time) (int64, error) {
+	result, err := db.rateLimits.DeleteMany(ctx, bson.M{"expires_at": bson.M{"$lt": now}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// RemoveBreach rimuove il breach da tutte le email ed elimina quelle rimaste senza breach.
+// Senza un indice su breaches la ricerca delle email del breach scorre l'intera collezione.
+func (db *MongoDB) RemoveBreach(ctx context.Context, breach string) (RemoveResult, error) {
+	updated, err := db.collection.UpdateMany(ctx, bson.M{"breaches": breach}, bson.M{"$pull": bson.M{"breaches": breach}})
+	if err != nil {
+		return RemoveResult{}, err
+	}
+
+	// Conta per dominio le email rimaste senza breach prima di eliminarle
+	orphans := bson.M{"breaches": bson.M{"$size": 0}}
+	cursor, err := db.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: orphans}},
+		{{Key: "$group", Value: bson.M{"_id": domainExpression, "accounts": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return RemoveResult{}, err
+	}
+	var orphanDomains []DomainStat
+	if err := cursor.All(ctx, &orphanDomains); err != nil {
+		return RemoveResult{}, err
+	}
+
+	deleted, err := db.collection.DeleteMany(ctx, orphans)
+	if err != nil {
+		return RemoveResult{}, err
+	}
+
+	delta := statsDelta{
+		domains:      make(map[string]int64, len(orphanDomains)),
+		emails:       -deleted.DeletedCount,
+		associations: -updated.ModifiedCount,
+	}
+	for _, domain := range orphanDomains {
+		delta.domains[domain.Domain] = -domain.Accounts
+	}
+	// Il contatore del breach viene eliminato subito dopo
+	if err := db.applyStats(ctx, delta); err != nil {
+		return RemoveResult{}, fmt.Errorf("errore durante l'aggiornamento delle statistiche: %w", err)
+	}
+	if _, err := db.breachStats.DeleteOne(ctx, bson.M{"_id": breach}); err != nil {
+		return RemoveResult{}, err
+	}
+	if _, err := db.dataClasses.DeleteMany(ctx, bson.M{"breach": breach}); err != nil {
+		return RemoveResult{}, err
+	}
+
+	return RemoveResult{UnlinkedCount: updated.ModifiedCount, DeletedCount: deleted.DeletedCount}, nil
+}
+
+// DeleteEmails elimina le email indicate e aggiorna i contatori con i breach che avevano.
+func (db *MongoDB) DeleteEmails(ctx context.Context, emails []string) (int64, error) {
+	if len(emails) == 0 {
+		return 0, nil
+	}
+
+	values := emails
+	if db.emailKeys != nil {
+		values = make([]string, 0, 2*len(emails))
+		for _, email := range emails {
+			values = append(values, db.emailKeys.Lookup(email)...)
 		}
-		if err := cursor.Decode(&doc); err != nil {
-			return nil, err
+	}
+	filter := bson.M{"email": bson.M{"$in": values}}
+	cursor, err := db.collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 0, "email": 1, "domain": 1, "breaches": 1}))
+	if err != nil {
+		return 0, err
+	}
+	var records []struct {
+		Email    string   `bson:"email"`
+		Domain   string   `bson:"domain"`
+		Breaches []string `bson:"breaches"`
+	}
+	if err := cursor.All(ctx, &records); err != nil {
+		return 0, err
+	}
+
+	deleted, err := db.collection.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := db.dataClasses.DeleteMany(ctx, filter); err != nil {
+		return 0, err
+	}
+
+	delta := statsDelta{breaches: make(map[string]int64), domains: make(map[string]int64)}
+	for _, record := range records {
+		for _, breach := range record.Breaches {
+			delta.breaches[breach]--
+			delta.associations--
+		}
+		domain := record.Domain
+		if domain == "" {
+			domain = EmailDomain(record.Email)
+		}
+		delta.domains[domain]--
+	}
+	delta.emails = -int64(len(records))
+	if err := db.applyStats(ctx, delta); err != nil {
+		return 0, fmt.Errorf("errore durante l'aggiornamento delle statistiche: %w", err)
+	}
+	return deleted.DeletedCount, nil
+}
+
+// BreachStats legge il numero di email di ogni breach da breach_stats, in ordine alfabetico.
+func (db *MongoDB) BreachStats(ctx context.Context) ([]BreachStat, error) {
+	cursor, err := db.breachStats.Find(ctx, bson.M{"accounts": bson.M{"$gt": 0}}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, mongoError(ctx, err)
+	}
+	defer cursor.Close(ctx)
+
+	stats := []BreachStat{}
+	if err := cursor.All(ctx, &stats); err != nil {
+		return nil, mongoError(ctx, err)
+	}
+	return stats, nil
+}
+
+// TopDomains legge i domini con più email da domain_stats.
+func (db *MongoDB) TopDomains(ctx context.Context, limit int) ([]DomainStat, error) {
+	if limit <= 0 {
+		return []DomainStat{}, nil // Per MongoDB un limite pari a zero significa "nessun limite"
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "accounts", Value: -1}, {Key: "_id", Value: 1}}).
+		SetLimit(int64(limit))
+	cursor, err := db.domainStats.Find(ctx, bson.M{"accounts": bson.M{"$gt": 0}}, opts)
+	if err != nil {
+		return nil, mongoError(ctx, err)
+	}
+	defer cursor.Close(ctx)
+
+	stats := []DomainStat{}
+	if err := cursor.All(ctx, &stats); err != nil {
+		return nil, mongoError(ctx, err)
+	}
+	return stats, nil
+}
+
+// GlobalStats legge il documento dei contatori globali e conta i breach in breach_stats.
+func (db *MongoDB) GlobalStats(ctx context.Context) (Stats, error) {
+	var stats Stats
+	err := db.stats.FindOne(ctx, bson.M{"_id": globalStatsID}).Decode(&stats)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return Stats{}, mongoError(ctx, err)
+	}
+
+	stats.Breaches, err = db.breachStats.CountDocuments(ctx, bson.M{"accounts": bson.M{"$gt": 0}})
+	if err != nil {
+		return Stats{}, mongoError(ctx, err)
+	}
+	return stats, nil
+}
+
+// ReconcileStats ricostruisce i contatori con tre aggregazioni sulla collezione delle email.
+// Le collezioni dei contatori vengono sostituite da $out solo a aggregazione completata.
+func (db *MongoDB) ReconcileStats(ctx context.Context) (Stats, error) {
+	opts := options.Aggregate().SetAllowDiskUse(true)
+
+	pipelines := []mongo.Pipeline{
+		{
+			{{Key: "$unwind", Value: "$breaches"}},
+			{{Key: "$group", Value: bson.M{"_id": "$breaches", "accounts": bson.M{"$sum": 1}}}},
+			{{Key: "$out", Value: BreachStatsCollection}},
+		},
+		{
+			{{Key: "$group", Value: bson.M{"_id": domainExpression, "accounts": bson.M{"$sum": 1}}}},
+			{{Key: "$out", Value: DomainStatsCollection}},
+		},
+	}
+	for _, pipeline := range pipelines {
+		cursor, err := db.collection.Aggregate(ctx, pipeline, opts)
+		if err != nil {
+			return Stats{}, err
 		}
-		breaches = append(breaches, doc.Breaches...)
+		cursor.Close(ctx)
 	}
 
-	// Rimuovi duplicati
-	uniqueBreachSet := make(map[string]struct{})
-	for _, breach := range breaches {
-		uniqueBreachSet[breach] = struct{}{}
+	// $out conserva gli indici della collezione di destinazione: l'indice serve a TopDomains
+	_, err := db.domainStats.Indexes().CreateOne(ctx, domainStatsIndex)
+	if err != nil {
+		return Stats{}, err
 	}
 
-	var uniqueBreaches []string
-	for breach := range uniqueBreachSet {
-		uniqueBreaches = append(uniqueBreaches, breach)
+	cursor, err := db.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id":          nil,
+			"emails":       bson.M{"$sum": 1},
+			"associations": bson.M{"$sum": bson.M{"$size": bson.M{"$ifNull": bson.A{"$breaches", bson.A{}}}}},
+		}}},
+	}, opts)
+	if err != nil {
+		return Stats{}, err
+	}
+	var totals []Stats
+	if err := cursor.All(ctx, &totals); err != nil {
+		return Stats{}, err
+	}
+
+	stats := Stats{ReconciledAt: time.Now().UTC()}
+	if len(totals) > 0 {
+		stats.Emails = totals[0].Emails
+		stats.Associations = totals[0].Associations
+	}
+	_, err = db.stats.ReplaceOne(ctx, bson.M{"_id": globalStatsID}, stats, options.Replace().SetUpsert(true))
+	if err != nil {
+		return Stats{}, err
 	}
 
-	return uniqueBreaches, nil
+	return db.GlobalStats(ctx)
 }
@@ -0,0 +1,186 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// emailKeyRotationBatch è il numero di documenti ricalcolati con un singolo BulkWrite da RotateEmailKeys.
+const emailKeyRotationBatch = 1000
+
+// RotateEmailKeys ricalcola con la chiave più recente le email conservate in chiaro o con una catena
+// precedente, prima nella collezione delle email e poi in breach_data_classes. Ogni documento viene
+// aggiornato solo se ha ancora il valore letto, così gli import concorrenti non vengono persi: con
+// DualRead scrivono sul documento esistente, che sia già stato ruotato o no. Se il nuovo valore è già
+// presente i due documenti vengono uniti e, alla fine, i contatori ricostruiti. Può essere interrotta
+// e ripetuta: riprende dai documenti non ancora ruotati.
+func (db *MongoDB) RotateEmailKeys(ctx context.Context) (EmailKeyRotation, error) {
+	var rotation EmailKeyRotation
+	if db.emailKeys == nil {
+		return rotation, fmt.Errorf("nessuna chiave HMAC configurata")
+	}
+
+	emails, merged, err := db.rekeyCollection(ctx, db.collection, db.mergeRekeyedEmail)
+	rotation.Emails, rotation.Merged = emails, merged
+	if err != nil {
+		return rotation, fmt.Errorf("errore durante la rotazione delle email: %w", err)
+	}
+	classes, merged, err := db.rekeyCollection(ctx, db.dataClasses, db.mergeRekeyedDataClasses)
+	rotation.DataClasses, rotation.Merged = classes, rotation.Merged+merged
+	if err != nil {
+		return rotation, fmt.Errorf("errore durante la rotazione delle classi di dati: %w", err)
+	}
+
+	// Le email unite erano contate due volte nei contatori
+	if rotation.Merged > 0 {
+		if _, err := db.ReconcileStats(ctx); err != nil {
+			return rotation, fmt.Errorf("errore durante la ricostruzione delle statistiche: %w", err)
+		}
+	}
+	return rotation, nil
+}
+
+// rekeyedDocument è un documento di cui RotateEmailKeys sta sostituendo il valore del campo email.
+type rekeyedDocument struct {
+	ID    any
+	Email string
+	Value string
+}
+
+// rekeyCollection ricalcola il campo email dei documenti di collection che non hanno il valore della chiave
+// più recente. I documenti il cui nuovo valore è già presente vengono passati a merge.
+// Restituisce il numero di documenti ricalcolati e di quelli uniti.
+func (db *MongoDB) rekeyCollection(ctx context.Context, collection *mongo.Collection, merge func(context.Context, rekeyedDocument) error) (int64, int64, error) {
+	current := hmacValuePrefix + db.emailKeys.Current() + ":"
+	filter := bson.M{"email": bson.M{
+		"$type": "string",
+		"$not":  primitive.Regex{Pattern: "^" + regexp.QuoteMeta(current)},
+	}}
+	cursor, err := collection.Find(ctx, filter, options.Find().
+		SetProjection(bson.M{"email": 1}).
+		SetBatchSize(emailKeyRotationBatch))
+	if err != nil {
+		return 0, 0, mongoError(ctx, err)
+	}
+	defer cursor.Close(ctx)
+
+	var rekeyed, merged int64
+	documents := make([]rekeyedDocument, 0, emailKeyRotationBatch)
+	flush := func() error {
+		if len(documents) == 0 {
+			return nil
+		}
+		models := make([]mongo.WriteModel, 0, len(documents))
+		for _, document := range documents {
+			set := bson.M{"email": document.Value}
+			if !strings.HasPrefix(document.Email, hmacValuePrefix) && collection == db.collection {
+				set["domain"] = EmailDomain(document.Email)
+			}
+			models = append(models, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": document.ID, "email": document.Email}).
+				SetUpdate(bson.M{"$set": set, "$unset": bson.M{"email_hash": ""}}))
+		}
+
+		result, err := collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		if result != nil {
+			rekeyed += result.ModifiedCount
+		}
+		if err != nil {
+			// Un errore di chiave duplicata indica che il nuovo valore esiste già: i documenti vanno uniti
+			var bulkErr mongo.BulkWriteException
+			if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+				return mongoError(ctx, err)
+			}
+			for _, writeErr := range bulkErr.WriteErrors {
+				if !mongo.IsDuplicateKeyError(writeErr) {
+					return mongoError(ctx, err)
+				}
+				if err := merge(ctx, documents[writeErr.Index]); err != nil {
+					return mongoError(ctx, err)
+				}
+				merged++
+			}
+		}
+		documents = documents[:0]
+		return nil
+	}
+
+	for cursor.Next(ctx) {
+		var document struct {
+			ID    any    `bson:"_id"`
+			Email string `bson:"email"`
+		}
+		if err := cursor.Decode(&document); err != nil {
+			return rekeyed, merged, err
+		}
+		value, changed, err := db.emailKeys.Rekey(document.Email)
+		if err != nil {
+			return rekeyed, merged, err
+		}
+		if !changed {
+			continue
+		}
+		documents = append(documents, rekeyedDocument{ID: document.ID, Email: document.Email, Value: value})
+		if len(documents) == emailKeyRotationBatch {
+			if err := flush(); err != nil {
+				return rekeyed, merged, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return rekeyed, merged, mongoError(ctx, err)
+	}
+	return rekeyed, merged, flush()
+}
+
+// mergeRekeyedEmail aggiunge i breach del documento a quello che ha già il nuovo valore e lo elimina.
+func (db *MongoDB) mergeRekeyedEmail(ctx context.Context, document rekeyedDocument) error {
+	var source struct {
+		Breaches []string `bson:"breaches"`
+	}
+	err := db.collection.FindOne(ctx, bson.M{"_id": document.ID, "email": document.Email}).Decode(&source)
+	if err == mongo.ErrNoDocuments {
+		return nil // Già unito o eliminato da un'altra operazione
+	}
+	if err != nil {
+		return err
+	}
+	_, err = db.collection.UpdateOne(ctx, bson.M{"email": document.Value},
+		bson.M{"$addToSet": bson.M{"breaches": bson.M{"$each": source.Breaches}}})
+	if err != nil {
+		return err
+	}
+	_, err = db.collection.DeleteOne(ctx, bson.M{"_id": document.ID, "email": document.Email})
+	return err
+}
+
+// mergeRekeyedDataClasses aggiunge le classi di dati del documento a quello che ha già il nuovo valore
+// per lo stesso breach e lo elimina.
+func (db *MongoDB) mergeRekeyedDataClasses(ctx context.Context, document rekeyedDocument) error {
+	var source struct {
+		Breach  string   `bson:"breach"`
+		Classes []string `bson:"classes"`
+	}
+	err := db.dataClasses.FindOne(ctx, bson.M{"_id": document.ID, "email": document.Email}).Decode(&source)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = db.dataClasses.UpdateOne(ctx, bson.M{"email": document.Value, "breach": source.Breach},
+		bson.M{"$addToSet": bson.M{"classes": bson.M{"$each": source.Classes}}})
+	if err != nil {
+		return err
+	}
+	_, err = db.dataClasses.DeleteOne(ctx, bson.M{"_id": document.ID, "email": document.Email})
+	return err
+}
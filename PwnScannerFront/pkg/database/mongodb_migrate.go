@@ -0,0 +1,394 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pwnscanner/pkg/normalize"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MigrationsCollection registra le migrazioni applicate (_id = versione).
+const MigrationsCollection = "schema_migrations"
+
+// namespaceExistsCode è il codice di errore di MongoDB per una collezione già esistente.
+const namespaceExistsCode = 48
+
+// mongoMigration è una migrazione dello schema MongoDB. up deve essere idempotente:
+// viene ripetuta se il processo si interrompe prima di registrarla.
+type mongoMigration struct {
+	Migration
+	up func(ctx context.Context, db *MongoDB) error
+}
+
+// mongoMigrations elenca le migrazioni in ordine di versione. Le migrazioni già pubblicate
+// non vanno modificate: ogni cambiamento dello schema richiede una nuova versione in coda.
+var mongoMigrations = []mongoMigration{
+	{
+		Migration: Migration{Version: 1, Description: "unione delle email duplicate e indice univoco su email"},
+		up:        migrateUniqueEmail,
+	},
+	{
+		Migration: Migration{Version: 2, Description: "validatori $jsonSchema per email e catalogo dei breach"},
+		up:        migrateValidators,
+	},
+	{
+		Migration: Migration{Version: 3, Description: "indici su breaches e sui contatori per dominio"},
+		up:        migrateSecondaryIndexes,
+	},
+	{
+		Migration: Migration{Version: 4, Description: "indice TTL sui bucket del rate limiting"},
+		up:        migrateRateLimitTTL,
+	},
+	{
+		Migration: Migration{Version: 5, Description: "indici delle classi di dati esposte per email e breach"},
+		up:        migrateDataClassIndexes,
+	},
+	{
+		Migration: Migration{Version: 6, Description: "hash SHA-256 delle email e indice per le ricerche per intervallo"},
+		up:        migrateEmailHashes,
+	},
+	{
+		Migration: Migration{Version: 7, Description: "validatore delle email con i valori HMAC e il dominio"},
+		up:        migrateHashedEmailValidator,
+	},
+	{
+		Migration: Migration{Version: 8, Description: "dominio delle email in chiaro e indice per la ricerca per dominio"},
+		up:        migrateEmailDomains,
+	},
+	{
+		Migration: Migration{Version: 9, Description: "indice delle origini degli hash delle password"},
+		up:        migratePasswordSources,
+	},
+}
+
+// SchemaStatus legge da schema_migrations la versione dello schema.
+func (db *MongoDB) SchemaStatus(ctx context.Context) (SchemaStatus, error) {
+	status := SchemaStatus{Latest: len(mongoMigrations)}
+
+	cursor, err := db.migrations.Find(ctx, bson.M{})
+	if err != nil {
+		return SchemaStatus{}, err
+	}
+	var applied []Migration
+	if err := cursor.All(ctx, &applied); err != nil {
+		return SchemaStatus{}, err
+	}
+
+	done := make(map[int]bool, len(applied))
+	for _, m := range applied {
+		done[m.Version] = true
+		status.Current = max(status.Current, m.Version)
+	}
+	for _, m := range mongoMigrations {
+		if !done[m.Version] {
+			status.Pending = append(status.Pending, m.Migration)
+		}
+	}
+	return status, nil
+}
+
+// Migrate applica le migrazioni mancanti, registrando ciascuna subito dopo averla completata.
+func (db *MongoDB) Migrate(ctx context.Context) ([]Migration, error) {
+	status, err := db.SchemaStatus(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("errore durante la lettura della versione dello schema: %w", err)
+	}
+	if err := status.Check(); err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, m := range mongoMigrations {
+		if !slices.ContainsFunc(status.Pending, func(p Migration) bool { return p.Version == m.Version }) {
+			continue
+		}
+		if err := m.up(ctx, db); err != nil {
+			return applied, fmt.Errorf("errore nella migrazione %d (%s): %w", m.Version, m.Description, err)
+		}
+
+		record := m.Migration
+		record.AppliedAt = time.Now().UTC()
+		// Un altro processo può aver registrato la stessa migrazione nel frattempo: è idempotente
+		_, err := db.migrations.InsertOne(ctx, record)
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return applied, fmt.Errorf("errore durante la registrazione della migrazione %d: %w", m.Version, err)
+		}
+		applied = append(applied, record)
+	}
+	return applied, nil
+}
+
+// migrateUniqueEmail unisce i documenti con la stessa email, creati da import concorrenti,
+// e crea l'indice univoco che li impedisce e che serve a FindEmail e agli upsert.
+func migrateUniqueEmail(ctx context.Context, db *MongoDB) error {
+	cursor, err := db.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"email": bson.M{"$type": "string"}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      "$email",
+			"ids":      bson.M{"$push": "$_id"},
+			"breaches": bson.M{"$push": bson.M{"$ifNull": bson.A{"$breaches", bson.A{}}}},
+			"count":    bson.M{"$sum": 1},
+		}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var merged int
+	for cursor.Next(ctx) {
+		var duplicate struct {
+			IDs      []any      `bson:"ids"`
+			Breaches [][]string `bson:"breaches"`
+		}
+		if err := cursor.Decode(&duplicate); err != nil {
+			return err
+		}
+
+		var breaches []string
+		for _, list := range duplicate.Breaches {
+			breaches = append(breaches, list...)
+		}
+		slices.Sort(breaches)
+		breaches = slices.Compact(breaches)
+
+		// Il primo documento riceve tutti i breach, gli altri vengono eliminati
+		_, err := db.collection.UpdateByID(ctx, duplicate.IDs[0], bson.M{"$set": bson.M{"breaches": breaches}})
+		if err != nil {
+			return err
+		}
+		_, err = db.collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": duplicate.IDs[1:]}})
+		if err != nil {
+			return err
+		}
+		merged++
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	// I duplicati erano contati più volte nei contatori
+	if merged > 0 {
+		if _, err := db.ReconcileStats(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emailValidator è lo $jsonSchema dei documenti delle email.
+var emailValidator = bson.M{
+	"bsonType": "object",
+	"required": bson.A{"email", "breaches"},
+	"properties": bson.M{
+		"email":    bson.M{"bsonType": "string", "pattern": "^[^@]+@[^@]+$"},
+		"breaches": bson.M{"bsonType": "array", "items": bson.M{"bsonType": "string"}},
+	},
+}
+
+// catalogValidator è lo $jsonSchema delle voci del catalogo dei breach.
+var catalogValidator = bson.M{
+	"bsonType": "object",
+	"required": bson.A{"_id"},
+	"properties": bson.M{
+		"_id":          bson.M{"bsonType": "string", "minLength": 1},
+		"title":        bson.M{"bsonType": "string"},
+		"domain":       bson.M{"bsonType": "string"},
+		"breach_date":  bson.M{"bsonType": "string", "pattern": `^(\d{4}-\d{2}-\d{2})?$`},
+		"added_date":   bson.M{"bsonType": "date"},
+		"description":  bson.M{"bsonType": "string"},
+		"data_classes": bson.M{"bsonType": bson.A{"array", "null"}, "items": bson.M{"bsonType": "string"}},
+		"pwn_count":    bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 0},
+		"is_verified":  bson.M{"bsonType": "bool"},
+		"is_sensitive": bson.M{"bsonType": "bool"},
+		"logo_path":    bson.M{"bsonType": "string"},
+	},
+}
+
+// migrateValidators applica i validatori alla collezione delle email e al catalogo.
+// Il livello "moderate" non blocca gli aggiornamenti dei documenti già non validi.
+func migrateValidators(ctx context.Context, db *MongoDB) error {
+	if err := setValidator(ctx, db.collection, emailValidator); err != nil {
+		return err
+	}
+	return setValidator(ctx, db.catalog, catalogValidator)
+}
+
+// setValidator crea la collezione con il validatore, oppure lo sostituisce se la collezione esiste già.
+func setValidator(ctx context.Context, collection *mongo.Collection, schema bson.M) error {
+	validator := bson.M{"$jsonSchema": schema}
+	database := collection.Database()
+
+	names, err := database.ListCollectionNames(ctx, bson.M{"name": collection.Name()})
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		err := database.CreateCollection(ctx, collection.Name(), options.CreateCollection().
+			SetValidator(validator).
+			SetValidationLevel("moderate"))
+		// La collezione può essere stata creata nel frattempo da un altro processo (NamespaceExists)
+		var cmdErr mongo.CommandError
+		if !errors.As(err, &cmdErr) || cmdErr.Code != namespaceExistsCode {
+			return err
+		}
+	}
+
+	return database.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: collection.Name()},
+		{Key: "validator", Value: validator},
+		{Key: "validationLevel", Value: "moderate"},
+	}).Err()
+}
+
+// migrateSecondaryIndexes crea l'indice multikey usato dalla rimozione dei breach
+// e quello su domain_stats usato da TopDomains.
+func migrateSecondaryIndexes(ctx context.Context, db *MongoDB) error {
+	_, err := db.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "breaches", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = db.domainStats.Indexes().CreateOne(ctx, domainStatsIndex)
+	return err
+}
+
+// migrateRateLimitTTL fa eliminare a MongoDB i bucket del rate limiting tornati pieni.
+func migrateRateLimitTTL(ctx context.Context, db *MongoDB) error {
+	_, err := db.rateLimits.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// migrateDataClassIndexes crea l'indice univoco (email, breach) di breach_data_classes, usato dagli upsert
+// e da FindDataClasses, e quello su breach usato dalla rimozione dei breach.
+func migrateDataClassIndexes(ctx context.Context, db *MongoDB) error {
+	_, err := db.dataClasses.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "email", Value: 1}, {Key: "breach", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "breach", Value: 1}}},
+	})
+	return err
+}
+
+// emailHashBatch è il numero di documenti aggiornati con un singolo BulkWrite da migrateEmailHashes.
+const emailHashBatch = 1000
+
+// migrateEmailHashes aggiunge email_hash (normalize.Hash) ai documenti che non lo hanno, creati prima
+// dell'introduzione delle ricerche per intervallo, e crea l'indice usato da FindEmailRange. L'hash
+// viene calcolato qui perché le aggregazioni di MongoDB non hanno SHA-256.
+func migrateEmailHashes(ctx context.Context, db *MongoDB) error {
+	cursor, err := db.collection.Find(ctx,
+		bson.M{"email_hash": bson.M{"$exists": false}, "email": bson.M{"$type": "string"}},
+		options.Find().SetProjection(bson.M{"email": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	models := make([]mongo.WriteModel, 0, emailHashBatch)
+	flush := func() error {
+		if len(models) == 0 {
+			return nil
+		}
+		_, err := db.collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		models = models[:0]
+		return err
+	}
+	for cursor.Next(ctx) {
+		var document struct {
+			ID    any    `bson:"_id"`
+			Email string `bson:"email"`
+		}
+		if err := cursor.Decode(&document); err != nil {
+			return err
+		}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": document.ID}).
+			SetUpdate(bson.M{"$set": bson.M{"email_hash": normalize.Hash(document.Email)}}))
+		if len(models) == emailHashBatch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	_, err = db.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "email_hash", Value: 1}},
+	})
+	return err
+}
+
+// hashedEmailValidator è lo $jsonSchema dei documenti delle email che ammette, oltre agli indirizzi,
+// i valori HMAC conservati al posto delle email (vedi EmailKeys) con il dominio in chiaro.
+var hashedEmailValidator = bson.M{
+	"bsonType": "object",
+	"required": bson.A{"email", "breaches"},
+	"properties": bson.M{
+		"email":    bson.M{"bsonType": "string", "pattern": "^([^@]+@[^@]+|hmac:[A-Za-z0-9_-]+:[0-9a-f]{64})$"},
+		"domain":   bson.M{"bsonType": "string"},
+		"breaches": bson.M{"bsonType": "array", "items": bson.M{"bsonType": "string"}},
+	},
+}
+
+// migrateHashedEmailValidator sostituisce il validatore della collezione delle email con hashedEmailValidator.
+func migrateHashedEmailValidator(ctx context.Context, db *MongoDB) error {
+	return setValidator(ctx, db.collection, hashedEmailValidator)
+}
+
+// migrateEmailDomains imposta il campo domain delle email in chiaro importate prima che venisse
+// salvato a ogni import, con un unico aggiornamento lato server, e crea l'indice usato da FindDomainEmails.
+func migrateEmailDomains(ctx context.Context, db *MongoDB) error {
+	filter := bson.M{"domain": bson.M{"$exists": false}, "email": bson.M{"$type": "string"}}
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{"domain": domainExpression}}}}
+	if _, err := db.collection.UpdateMany(ctx, filter, update); err != nil {
+		return err
+	}
+
+	_, err := db.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "domain", Value: 1}, {Key: "email", Value: 1}},
+	})
+	return err
+}
+
+// migratePasswordSources crea gli indici usati da ResetPasswordHashes per eliminare le occorrenze
+// e i blocchi di un'origine.
+// I documenti importati prima dei conteggi per origine non hanno il campo source e non vengono toccati.
+func migratePasswordSources(ctx context.Context, db *MongoDB) error {
+	_, err := db.passwords.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "source", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = db.passwordBlocks.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "source", Value: 1}},
+	})
+	return err
+}
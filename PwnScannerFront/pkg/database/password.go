@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"strings"
+)
+
+// Lunghezze, in cifre esadecimali, degli hash SHA-1 delle password e dei prefissi usati nelle ricerche per intervallo.
+const (
+	PasswordHashLength   = 40
+	PasswordPrefixLength = 5
+)
+
+// PasswordHash è un hash SHA-1 di password restituito da una ricerca per intervallo: il suffisso
+// (le 35 cifre esadecimali che seguono il prefisso cercato) e il numero di volte in cui è comparso nei breach.
+type PasswordHash struct {
+	Suffix string
+	Count  int64
+}
+
+// PasswordWriter è implementato dai database in cui pwnadmin può accumulare gli hash SHA-1
+// delle password trovate nei breach con il numero di occorrenze.
+//
+// Le occorrenze sono registrate per origine (source, ad esempio il breach e il nome del file importato)
+// e per blocco, così un import ripetuto non le conta due volte: l'import di un'origine inizia con
+// ResetPasswordHashes, che toglie le occorrenze contate in precedenza, e un blocco già sommato viene ignorato.
+type PasswordWriter interface {
+	// ResetPasswordHashes toglie dai conteggi tutte le occorrenze registrate per source e dimentica
+	// i suoi blocchi. Va chiamato prima di importare di nuovo, da capo, la stessa origine.
+	ResetPasswordHashes(ctx context.Context, source string) error
+
+	// AddPasswordHashes somma a ogni hash (chiave della mappa: SHA-1 in 40 cifre esadecimali maiuscole)
+	// il numero di occorrenze indicato, registrandole come blocco block di source. Se il blocco è già
+	// stato sommato non fa nulla, quindi può essere ripetuto dopo un errore transitorio; può essere
+	// chiamato in modo concorrente per blocchi diversi.
+	AddPasswordHashes(ctx context.Context, source string, block int, counts map[string]int64) error
+}
+
+// PasswordRangeReader è implementato dai database che conservano gli hash delle password.
+type PasswordRangeReader interface {
+	// PasswordRange restituisce, in ordine alfabetico, i suffissi degli hash che iniziano con prefix
+	// (PasswordPrefixLength cifre esadecimali maiuscole) e il loro numero di occorrenze.
+	PasswordRange(ctx context.Context, prefix string) ([]PasswordHash, error)
+}
+
+// IsPasswordPrefix indica se s è un prefisso valido per PasswordRange (cifre esadecimali, anche minuscole).
+func IsPasswordPrefix(s string) bool {
+	return len(s) == PasswordPrefixLength && isHexString(s)
+}
+
+// IsPasswordHash indica se s è un hash SHA-1 in esadecimale (anche minuscolo).
+func IsPasswordHash(s string) bool {
+	return len(s) == PasswordHashLength && isHexString(s)
+}
+
+// normalizePasswordCounts restituisce le occorrenze degli hash validi e positivi, con gli hash in maiuscolo.
+func normalizePasswordCounts(counts map[string]int64) map[string]int64 {
+	normalized := make(map[string]int64, len(counts))
+	for hash, count := range counts {
+		if IsPasswordHash(hash) && count > 0 {
+			normalized[strings.ToUpper(hash)] += count
+		}
+	}
+	return normalized
+}
+
+// isHexString indica se s contiene solo cifre esadecimali.
+func isHexString(s string) bool {
+	return strings.Trim(s, "0123456789abcdefABCDEF") == ""
+}
@@ -0,0 +1,48 @@
+package database_test
+
+import (
+	"pwnscanner/pkg/database"
+	"testing"
+)
+
+func TestIsPasswordPrefix(t *testing.T) {
+	for _, tc := range []struct {
+		prefix string
+		want   bool
+	}{
+		{"5BAA6", true},
+		{"5baa6", true},
+		{"00000", true},
+		{"FFFFF", true},
+		{"5BAA", false},
+		{"5BAA61", false},
+		{"5BAG6", false},
+		{"5BA 6", false},
+		{"", false},
+	} {
+		if got := database.IsPasswordPrefix(tc.prefix); got != tc.want {
+			t.Errorf("IsPasswordPrefix(%q) = %t, atteso %t", tc.prefix, got, tc.want)
+		}
+	}
+}
+
+func TestIsPasswordHash(t *testing.T) {
+	for _, tc := range []struct {
+		hash string
+		want bool
+	}{
+		{"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8", true},
+		{"5baa61e4c9b93f3f0682250b6cf8331b7ee68fd8", true},
+		{"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD", false},
+		{"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD80", false},
+		{"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FDZ", false},
+		// MD5 e SHA-256 non sono hash SHA-1
+		{"5F4DCC3B5AA765D61D8327DEB882CF99", false},
+		{"5E884898DA28047151D0E56F8DC6292773603D0D6AABBDD62A11EF721D1542D8", false},
+		{"", false},
+	} {
+		if got := database.IsPasswordHash(tc.hash); got != tc.want {
+			t.Errorf("IsPasswordHash(%q) = %t, atteso %t", tc.hash, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,967 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// postgresSchema crea le tabelle e gli indici usati dall'implementazione PostgreSQL.
+// Ogni istruzione è idempotente e viene eseguita a ogni avvio.
+//
+//   - breach_emails contiene un'associazione email-breach per riga; la chiave primaria (email, breach)
+//     garantisce la semantica add-to-set ed è l'indice usato da FindEmail. La colonna data_classes
+//     contiene le classi di dati esposte dall'email nel breach, la colonna email_hash lo SHA-256 dell'email
+//     (normalize.Hash), ripetuto in ogni riga dell'email e indicizzato per FindEmailRange, e la colonna
+//     domain il dominio dell'email (EmailDomain), indicizzato con l'email per FindDomainEmails.
+//   - breaches contiene una riga per breach con il numero di email associate,
+//     così GetAllBreaches non deve scorrere tutte le associazioni.
+//   - breach_catalog contiene i metadati dei breach mostrati ai client.
+//   - domains e stats contengono i contatori per dominio e globali, aggiornati come breaches.
+//   - api_keys contiene le chiavi API dei client, con il solo hash del segreto.
+//   - rate_limits contiene i bucket del rate limiting condivisi tra le istanze di PwnScannerFront.
+//   - password_hashes contiene le occorrenze degli hash SHA-1 delle password; la collazione "C" della chiave
+//     primaria permette a PasswordRange di usarla per le ricerche per prefisso.
+//   - password_sources e password_blocks registrano le occorrenze contate per ogni origine e i blocchi
+//     già sommati, perché un import ripetuto non le conti due volte (vedi PasswordWriter).
+var postgresSchema = []string{
+	`CREATE TABLE IF NOT EXISTS breach_emails (
+		email    TEXT        NOT NULL,
+		breach   TEXT        NOT NULL,
+		added_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (email, breach)
+	)`,
+	`CREATE INDEX IF NOT EXISTS breach_emails_breach_idx ON breach_emails (breach)`,
+	// Le tabelle breach_emails create prima dell'introduzione delle classi di dati non hanno la colonna
+	`ALTER TABLE breach_emails ADD COLUMN IF NOT EXISTS data_classes TEXT[] NOT NULL DEFAULT '{}'`,
+	// Le righe create prima dell'introduzione delle ricerche per intervallo ricevono l'hash al primo avvio;
+	// l'indice parziale sulle righe senza hash evita di scorrere la tabella agli avvii successivi
+	`ALTER TABLE breach_emails ADD COLUMN IF NOT EXISTS email_hash TEXT COLLATE "C"`,
+	`CREATE INDEX IF NOT EXISTS breach_emails_email_hash_idx ON breach_emails (email_hash)`,
+	`CREATE INDEX IF NOT EXISTS breach_emails_missing_hash_idx ON breach_emails (email) WHERE email_hash IS NULL`,
+	`UPDATE breach_emails SET email_hash = ` + postgresEmailHash + ` WHERE email_hash IS NULL`,
+	// Come per email_hash, le righe create prima dell'introduzione della ricerca per dominio
+	// ricevono il dominio al primo avvio
+	`ALTER TABLE breach_emails ADD COLUMN IF NOT EXISTS domain TEXT`,
+	`CREATE INDEX IF NOT EXISTS breach_emails_domain_idx ON breach_emails (domain, email COLLATE "C")`,
+	`CREATE INDEX IF NOT EXISTS breach_emails_missing_domain_idx ON breach_emails (email) WHERE domain IS NULL`,
+	`UPDATE breach_emails SET domain = ` + postgresDomain + ` WHERE domain IS NULL`,
+	`CREATE TABLE IF NOT EXISTS breaches (
+		name     TEXT   PRIMARY KEY,
+		accounts BIGINT NOT NULL DEFAULT 0
+	)`,
+	`CREATE TABLE IF NOT EXISTS breach_catalog (
+		name         TEXT        PRIMARY KEY,
+		title        TEXT        NOT NULL DEFAULT '',
+		domain       TEXT        NOT NULL DEFAULT '',
+		breach_date  DATE,
+		added_date   TIMESTAMPTZ NOT NULL DEFAULT now(),
+		description  TEXT        NOT NULL DEFAULT '',
+		data_classes TEXT[]      NOT NULL DEFAULT '{}',
+		pwn_count    BIGINT      NOT NULL DEFAULT 0,
+		is_verified  BOOLEAN     NOT NULL DEFAULT false,
+		is_sensitive BOOLEAN     NOT NULL DEFAULT false,
+		logo_path    TEXT        NOT NULL DEFAULT ''
+	)`,
+	`CREATE TABLE IF NOT EXISTS domains (
+		name     TEXT   PRIMARY KEY,
+		accounts BIGINT NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX IF NOT EXISTS domains_accounts_idx ON domains (accounts DESC, name COLLATE "C")`,
+	`CREATE TABLE IF NOT EXISTS stats (
+		id            BOOLEAN     PRIMARY KEY DEFAULT true CHECK (id),
+		emails        BIGINT      NOT NULL DEFAULT 0,
+		associations  BIGINT      NOT NULL DEFAULT 0,
+		reconciled_at TIMESTAMPTZ
+	)`,
+	`INSERT INTO stats (id) VALUES (true) ON CONFLICT DO NOTHING`,
+	`CREATE TABLE IF NOT EXISTS api_keys (
+		id         TEXT        PRIMARY KEY,
+		hash       TEXT        NOT NULL,
+		owner      TEXT        NOT NULL,
+		scopes     TEXT[]      NOT NULL DEFAULT '{}',
+		max_batch  INTEGER     NOT NULL DEFAULT 0,
+		tier       TEXT        NOT NULL DEFAULT '',
+		domains    TEXT[]      NOT NULL DEFAULT '{}',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		expires_at TIMESTAMPTZ,
+		revoked_at TIMESTAMPTZ
+	)`,
+	// Le tabelle api_keys create prima dell'introduzione dei profili di rate limiting non hanno la colonna tier
+	`ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS tier TEXT NOT NULL DEFAULT ''`,
+	// e quelle create prima dell'introduzione della ricerca per dominio non hanno la colonna domains
+	`ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS domains TEXT[] NOT NULL DEFAULT '{}'`,
+	`CREATE TABLE IF NOT EXISTS rate_limits (
+		key        TEXT             PRIMARY KEY,
+		tokens     DOUBLE PRECISION NOT NULL,
+		allowed    BOOLEAN          NOT NULL,
+		updated_at TIMESTAMPTZ      NOT NULL,
+		expires_at TIMESTAMPTZ      NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS rate_limits_expires_at_idx ON rate_limits (expires_at)`,
+	`CREATE TABLE IF NOT EXISTS password_hashes (
+		hash  TEXT COLLATE "C" PRIMARY KEY,
+		count BIGINT           NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS password_sources (
+		source TEXT   NOT NULL,
+		hash   TEXT   NOT NULL,
+		count  BIGINT NOT NULL,
+		PRIMARY KEY (source, hash)
+	)`,
+	`CREATE TABLE IF NOT EXISTS password_blocks (
+		source TEXT    NOT NULL,
+		block  INTEGER NOT NULL,
+		PRIMARY KEY (source, block)
+	)`,
+}
+
+// postgresEmailHash calcola in SQL lo SHA-256 della colonna email con la stessa regola di normalize.Hash.
+const postgresEmailHash = `upper(encode(sha256(convert_to(email, 'UTF8')), 'hex'))`
+
+// postgresDomain calcola in SQL il dominio della colonna email con la stessa regola di EmailDomain.
+const postgresDomain = `lower(regexp_replace(email, '^.*@', ''))`
+
+// catalogColumns sono le colonne lette da breach_catalog, nell'ordine di scanBreach.
+const catalogColumns = `name, title, domain, COALESCE(to_char(breach_date, 'YYYY-MM-DD'), ''), added_date,
+	description, data_classes, pwn_count, is_verified, is_sensitive, logo_path`
+
+// apiKeyColumns sono le colonne lette da api_keys, nell'ordine di scanAPIKey.
+const apiKeyColumns = `id, hash, owner, scopes, max_batch, tier, domains, created_at, expires_at, revoked_at`
+
+// addBreachEmailsQuery associa un blocco di email a un breach e restituisce i conteggi
+// con la stessa semantica del BulkWrite di MongoDB. Tutte le CTE vedono lo stesso snapshot,
+// quindi "existing" contiene le email presenti prima dell'inserimento.
+const addBreachEmailsQuery = `
+WITH input AS (
+	SELECT DISTINCT email FROM unnest($1::text[]) AS t(email)
+), existing AS (
+	SELECT DISTINCT e.email FROM breach_emails e JOIN input i ON e.email = i.email
+), inserted AS (
+	INSERT INTO breach_emails (email, breach, email_hash, domain)
+	SELECT email, $2, ` + postgresEmailHash + `, ` + postgresDomain + ` FROM input
+	ON CONFLICT (email, breach) DO NOTHING
+	RETURNING email
+), new_emails AS (
+	SELECT email FROM inserted WHERE email NOT IN (SELECT email FROM existing)
+), domain_counts AS (
+	INSERT INTO domains (name, accounts)
+	SELECT ` + postgresDomain + `, count(*) FROM new_emails GROUP BY 1
+	ON CONFLICT (name) DO UPDATE SET accounts = domains.accounts + EXCLUDED.accounts
+)
+SELECT
+	(SELECT count(*) FROM existing),
+	(SELECT count(*) FROM inserted WHERE email IN (SELECT email FROM existing)),
+	(SELECT count(*) FROM new_emails)`
+
+// removeBreachQuery rimuove un breach e aggiorna i contatori dei domini delle email rimaste senza breach.
+// Come in addBreachEmailsQuery, "orphans" vede lo stato precedente all'eliminazione,
+// per questo esclude le righe del breach rimosso.
+const removeBreachQuery = `
+WITH removed AS (
+	DELETE FROM breach_emails WHERE breach = $1 RETURNING email
+), orphans AS (
+	SELECT r.email FROM removed r
+	WHERE NOT EXISTS (SELECT 1 FROM breach_emails e WHERE e.email = r.email AND e.breach <> $1)
+), domain_counts AS (
+	UPDATE domains d SET accounts = d.accounts - o.accounts
+	FROM (SELECT ` + postgresDomain + ` AS name, count(*) AS accounts FROM orphans GROUP BY 1) o
+	WHERE d.name = o.name
+)
+SELECT (SELECT count(*) FROM removed), (SELECT count(*) FROM orphans)`
+
+// deleteEmailsQuery elimina le email indicate e aggiorna i contatori dei breach e dei domini.
+const deleteEmailsQuery = `
+WITH deleted AS (
+	DELETE FROM breach_emails WHERE email = ANY($1::text[]) RETURNING email, breach
+), breach_counts AS (
+	UPDATE breaches b SET accounts = b.accounts - d.accounts
+	FROM (SELECT breach, count(*) AS accounts FROM deleted GROUP BY breach) d
+	WHERE b.name = d.breach
+), domain_counts AS (
+	UPDATE domains d SET accounts = d.accounts - o.accounts
+	FROM (SELECT ` + postgresDomain + ` AS name, count(DISTINCT email) AS accounts FROM deleted GROUP BY 1) o
+	WHERE d.name = o.name
+)
+SELECT (SELECT count(DISTINCT email) FROM deleted), (SELECT count(*) FROM deleted)`
+
+// addDataClassesQuery aggiunge le classi di dati alle associazioni con il breach $3 delle email $1:
+// $2 contiene, nella stessa posizione, le classi di ogni email separate da virgole. Le righe che hanno
+// già tutte le classi non vengono riscritte; quelle mancanti vengono ignorate.
+const addDataClassesQuery = `
+UPDATE breach_emails e SET data_classes = ARRAY(
+	SELECT c FROM (SELECT DISTINCT unnest(e.data_classes || string_to_array(i.classes, ',')) AS c) d
+	ORDER BY c COLLATE "C"
+)
+FROM unnest($1::text[], $2::text[]) AS i(email, classes)
+WHERE e.email = i.email AND e.breach = $3 AND NOT string_to_array(i.classes, ',') <@ e.data_classes`
+
+// addPasswordHashesQuery somma alle occorrenze degli hash $1 i conteggi $2, nella stessa posizione.
+const addPasswordHashesQuery = `
+INSERT INTO password_hashes AS p (hash, count)
+SELECT * FROM unnest($1::text[], $2::bigint[])
+ON CONFLICT (hash) DO UPDATE SET count = p.count + excluded.count`
+
+// addPasswordSourceQuery somma alle occorrenze contate per l'origine $3 i conteggi $2 degli hash $1.
+const addPasswordSourceQuery = `
+INSERT INTO password_sources AS s (source, hash, count)
+SELECT $3, hash, count FROM unnest($1::text[], $2::bigint[]) AS i(hash, count)
+ON CONFLICT (source, hash) DO UPDATE SET count = s.count + excluded.count`
+
+// resetPasswordSourceQuery elimina le occorrenze contate per l'origine $1, le toglie da password_hashes
+// e restituisce gli hash rimasti senza occorrenze.
+const resetPasswordSourceQuery = `
+WITH removed AS (
+	DELETE FROM password_sources WHERE source = $1 RETURNING hash, count
+), updated AS (
+	UPDATE password_hashes AS p SET count = p.count - r.count
+	FROM removed r WHERE p.hash = r.hash
+	RETURNING p.hash, p.count
+)
+SELECT COALESCE(array_agg(hash), '{}') FROM updated WHERE count <= 0`
+
+// takeTokensQuery applica TokenBucket.Take al bucket $1 in un'unica istruzione, con $2 = Rate, $3 = Burst,
+// $4 = gettoni da prelevare, $5 = force e $6 = istante corrente. Un bucket nuovo parte pieno,
+// quindi il primo prelievo è sempre ammesso. Nel ramo DO UPDATE "r" è la riga precedente.
+const takeTokensQuery = `
+INSERT INTO rate_limits AS r (key, tokens, allowed, updated_at, expires_at)
+VALUES ($1, $3::float8 - $4::float8, true, $6, $6::timestamptz + make_interval(secs => $4::float8 / $2::float8))
+ON CONFLICT (key) DO UPDATE SET (tokens, allowed, updated_at, expires_at) = (
+	SELECT t.tokens, t.allowed, greatest(r.updated_at, $6),
+		$6::timestamptz + make_interval(secs => greatest(0, $3::float8 - t.tokens) / $2::float8)
+	FROM (SELECT least($3::float8, r.tokens + greatest(0, extract(epoch FROM $6::timestamptz - r.updated_at)::float8) * $2::float8) AS available) a
+	CROSS JOIN LATERAL (SELECT $5::boolean OR a.available >= 1 AS allowed) o
+	CROSS JOIN LATERAL (SELECT CASE WHEN o.allowed THEN a.available - $4::float8 ELSE a.available END AS tokens, o.allowed) t
+)
+RETURNING tokens, allowed`
+
+// reconcileStatsQueries ricostruiscono i contatori dalle associazioni, in un'unica transazione.
+var reconcileStatsQueries = []string{
+	`DELETE FROM breaches`,
+	`INSERT INTO breaches (name, accounts) SELECT breach, count(*) FROM breach_emails GROUP BY breach`,
+	`DELETE FROM domains`,
+	`INSERT INTO domains (name, accounts)
+	SELECT ` + postgresDomain + `, count(*) FROM (SELECT DISTINCT email FROM breach_emails) e GROUP BY 1`,
+	`UPDATE stats SET
+		emails = (SELECT count(DISTINCT email) FROM breach_emails),
+		associations = (SELECT count(*) FROM breach_emails),
+		reconciled_at = now()`,
+}
+
+// Postgres è l'implementazione del database per PostgreSQL.
+type Postgres struct {
+	pool *pgxpool.Pool
+}
+
+// postgresError classifica gli errori di PostgreSQL: contesto scaduto o annullato, connessione non riuscita
+// o server in arresto (ErrUnavailable), query annullata da statement_timeout (context.DeadlineExceeded),
+// transazione annullata per deadlock o errore di serializzazione (ErrConflict). Gli altri errori restano invariati.
+func postgresError(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() != nil {
+		return contextError(ctx, err)
+	}
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		// Classe 08: errori di connessione; 57P01-57P03: server in arresto o non ancora pronto
+		case strings.HasPrefix(pgErr.Code, "08"), pgErr.Code == "57P01", pgErr.Code == "57P02", pgErr.Code == "57P03":
+			return fmt.Errorf("%w: %w", ErrUnavailable, err)
+		case pgErr.Code == "57014": // query_canceled
+			return fmt.Errorf("%w: %w", context.DeadlineExceeded, err)
+		case pgErr.Code == "40001", pgErr.Code == "40P01": // serialization_failure, deadlock_detected
+			return fmt.Errorf("%w: %w", ErrConflict, err)
+		}
+	}
+	if pgconn.Timeout(err) {
+		return fmt.Errorf("%w: %w", context.DeadlineExceeded, err)
+	}
+	return err
+}
+
+// PostgresURL compone la connection string a partire dai singoli parametri.
+func PostgresURL(host string, port int, username, password, dbName, sslMode string) string {
+	u := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(username, password),
+		Host:   net.JoinHostPort(host, strconv.Itoa(port)),
+		Path:   "/" + dbName,
+	}
+	if sslMode != "" {
+		u.RawQuery = url.Values{"sslmode": {sslMode}}.Encode()
+	}
+	return u.String()
+}
+
+// NewPostgres crea una nuova connessione a PostgreSQL e prepara lo schema se non esiste.
+// Restituisce il tipo concreto, che implementa sia Database sia Writer.
+func NewPostgres(ctx context.Context, connString string) (*Postgres, error) {
+	pool, err := pgxpool.New(ctx, connString)
+	if err != nil {
+		return nil, fmt.Errorf("errore durante la connessione a PostgreSQL: %w", err)
+	}
+
+	for _, statement := range postgresSchema {
+		if _, err := pool.Exec(ctx, statement); err != nil {
+			pool.Close()
+			return nil, fmt.Errorf("errore durante la creazione dello schema PostgreSQL: %w", err)
+		}
+	}
+
+	return &Postgres{pool: pool}, nil
+}
+
+// FindEmail cerca un'email nei breach, restituendoli in ordine alfabetico.
+func (db *Postgres) FindEmail(ctx context.Context, email string) ([]string, error) {
+	rows, err := db.pool.Query(ctx, `SELECT breach FROM breach_emails WHERE email = $1 ORDER BY breach COLLATE "C"`, email)
+	if err != nil {
+		return nil, postgresError(ctx, err)
+	}
+
+	breaches, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, postgresError(ctx, err)
+	}
+	if len(breaches) == 0 {
+		return nil, nil
+	}
+	return breaches, nil
+}
+
+// GetAllBreaches restituisce un elenco di tutti i breach senza duplicati, in ordine alfabetico.
+// La collazione "C" ordina per byte, come sort.Strings nelle altre implementazioni.
+func (db *Postgres) GetAllBreaches(ctx context.Context) ([]string, error) {
+	rows, err := db.pool.Query(ctx, `SELECT name FROM breaches WHERE accounts > 0 ORDER BY name COLLATE "C"`)
+	if err != nil {
+		return nil, postgresError(ctx, err)
+	}
+
+	breaches, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, postgresError(ctx, err)
+	}
+	if breaches == nil {
+		breaches = []string{}
+	}
+	return breaches, nil
+}
+
+// AddBreachEmails associa le email al breach (upsert con semantica add-to-set)
+// e aggiorna il numero di email del breach nella stessa transazione.
+func (db *Postgres) AddBreachEmails(ctx context.Context, breach string, emails []string) (WriteResult, error) {
+	if len(emails) == 0 {
+		return WriteResult{}, nil
+	}
+
+	var result WriteResult
+	err := pgx.BeginFunc(ctx, db.pool, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, addBreachEmailsQuery, emails, breach).
+			Scan(&result.MatchedCount, &result.ModifiedCount, &result.UpsertedCount)
+		if err != nil {
+			return err
+		}
+
+		added := result.ModifiedCount + result.UpsertedCount
+		if added == 0 {
+			return nil
+		}
+		_, err = tx.Exec(ctx, `
+			INSERT INTO breaches (name, accounts) VALUES ($1, $2)
+			ON CONFLICT (name) DO UPDATE SET accounts = breaches.accounts + EXCLUDED.accounts`,
+			breach, added)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `UPDATE stats SET emails = emails + $1, associations = associations + $2`,
+			result.UpsertedCount, added)
+		return err
+	})
+	if err != nil {
+		return WriteResult{}, postgresError(ctx, err)
+	}
+	return result, nil
+}
+
+// AddDataClasses aggiunge le classi di dati esposte dalle email alle loro associazioni con il breach.
+func (db *Postgres) AddDataClasses(ctx context.Context, breach string, classes map[string][]string) error {
+	emails := make([]string, 0, len(classes))
+	joined := make([]string, 0, len(classes))
+	for email, emailClasses := range classes {
+		if len(emailClasses) > 0 {
+			emails = append(emails, email)
+			joined = append(joined, strings.Join(emailClasses, ","))
+		}
+	}
+	if len(emails) == 0 {
+		return nil
+	}
+	_, err := db.pool.Exec(ctx, addDataClassesQuery, emails, joined, breach)
+	return postgresError(ctx, err)
+}
+
+// FindDataClasses legge le classi di dati esposte dall'email dalle sue associazioni.
+func (db *Postgres) FindDataClasses(ctx context.Context, email string) (map[string][]string, error) {
+	rows, err := db.pool.Query(ctx, `SELECT breach, data_classes FROM breach_emails WHERE email = $1 AND cardinality(data_classes) > 0`, email)
+	if err != nil {
+		return nil, postgresError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	var result map[string][]string
+	for rows.Next() {
+		var breach string
+		var classes []string
+		if err := rows.Scan(&breach, &classes); err != nil {
+			return nil, err
+		}
+		if result == nil {
+			result = make(map[string][]string)
+		}
+		result[breach] = classes
+	}
+	if err := rows.Err(); err != nil {
+		return nil, postgresError(ctx, err)
+	}
+	return result, nil
+}
+
+// ResetPasswordHashes toglie da password_hashes le occorrenze registrate per l'origine, in una transazione.
+func (db *Postgres) ResetPasswordHashes(ctx context.Context, source string) error {
+	err := pgx.BeginFunc(ctx, db.pool, func(tx pgx.Tx) error {
+		var empty []string
+		if err := tx.QueryRow(ctx, resetPasswordSourceQuery, source).Scan(&empty); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM password_hashes WHERE hash = ANY($1)`, empty); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `DELETE FROM password_blocks WHERE source = $1`, source)
+		return err
+	})
+	return postgresError(ctx, err)
+}
+
+// AddPasswordHashes registra il blocco dell'origine e somma le occorrenze degli hash delle password
+// in una transazione: se il blocco è già registrato non somma nulla. Gli hash vengono ordinati
+// perché le importazioni concorrenti blocchino le righe nello stesso ordine.
+func (db *Postgres) AddPasswordHashes(ctx context.Context, source string, block int, counts map[string]int64) error {
+	if source == "" {
+		return errors.New("origine degli hash delle password vuota")
+	}
+	normalized := normalizePasswordCounts(counts)
+	hashes := make([]string, 0, len(normalized))
+	for hash := range normalized {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	values := make([]int64, len(hashes))
+	for i, hash := range hashes {
+		values[i] = normalized[hash]
+	}
+
+	err := pgx.BeginFunc(ctx, db.pool, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `INSERT INTO password_blocks (source, block) VALUES ($1, $2) ON CONFLICT DO NOTHING`, source, block)
+		if err != nil || tag.RowsAffected() == 0 || len(hashes) == 0 {
+			return err
+		}
+		if _, err := tx.Exec(ctx, addPasswordSourceQuery, hashes, values, source); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, addPasswordHashesQuery, hashes, values)
+		return err
+	})
+	return postgresError(ctx, err)
+}
+
+// PasswordRange legge gli hash con il prefisso indicato con una ricerca per intervallo sulla chiave
+// primaria: le cifre esadecimali maiuscole precedono "G" nella collazione "C".
+func (db *Postgres) PasswordRange(ctx context.Context, prefix string) ([]PasswordHash, error) {
+	prefix = strings.ToUpper(prefix)
+	rows, err := db.pool.Query(ctx, `SELECT substr(hash, $3), count FROM password_hashes WHERE hash >= $1 AND hash < $2 ORDER BY hash`,
+		prefix, prefix+"G", len(prefix)+1)
+	if err != nil {
+		return nil, postgresError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	hashes := []PasswordHash{}
+	for rows.Next() {
+		var hash PasswordHash
+		if err := rows.Scan(&hash.Suffix, &hash.Count); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, postgresError(ctx, err)
+	}
+	return hashes, nil
+}
+
+// FindEmailRange cerca le email con l'hash che inizia con prefix con una ricerca per intervallo
+// sull'indice di email_hash: le cifre esadecimali maiuscole precedono "G" nella collazione "C".
+func (db *Postgres) FindEmailRange(ctx context.Context, prefix string) ([]EmailHashMatch, error) {
+	prefix = strings.ToUpper(prefix)
+	rows, err := db.pool.Query(ctx, `
+		SELECT substr(email_hash, $3), array_agg(breach ORDER BY breach COLLATE "C")
+		FROM breach_emails WHERE email_hash >= $1 AND email_hash < $2
+		GROUP BY email_hash ORDER BY email_hash`,
+		prefix, prefix+"G", len(prefix)+1)
+	if err != nil {
+		return nil, postgresError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	matches := []EmailHashMatch{}
+	for rows.Next() {
+		var match EmailHashMatch
+		if err := rows.Scan(&match.Suffix, &match.Breaches); err != nil {
+			return nil, err
+		}
+		matches = append(matches, match)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, postgresError(ctx, err)
+	}
+	return matches, nil
+}
+
+// FindDomainEmails raggruppa per email, usando l'indice su domain ed email, le associazioni
+// delle email del dominio successive ad after nella collazione "C".
+func (db *Postgres) FindDomainEmails(ctx context.Context, domain, after string, limit int) ([]Record, error) {
+	rows, err := db.pool.Query(ctx, `
+		SELECT email, array_agg(breach ORDER BY breach COLLATE "C")
+		FROM breach_emails WHERE domain = $1 AND email COLLATE "C" > $2
+		GROUP BY email ORDER BY email COLLATE "C" LIMIT $3`,
+		domain, after, max(limit, 0))
+	if err != nil {
+		return nil, postgresError(ctx, err)
+	}
+
+	records, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Record, error) {
+		var record Record
+		err := row.Scan(&record.Email, &record.Breaches)
+		return record, err
+	})
+	if err != nil {
+		return nil, postgresError(ctx, err)
+	}
+	if records == nil {
+		records = []Record{}
+	}
+	return records, nil
+}
+
+// DomainBreachStats conta le associazioni delle email del dominio in ogni breach:
+// la chiave primaria garantisce una riga per email e breach.
+func (db *Postgres) DomainBreachStats(ctx context.Context, domain string) ([]BreachStat, error) {
+	rows, err := db.pool.Query(ctx, `
+		SELECT breach, count(*) FROM breach_emails WHERE domain = $1
+		GROUP BY breach ORDER BY breach COLLATE "C"`, domain)
+	if err != nil {
+		return nil, postgresError(ctx, err)
+	}
+
+	stats, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (BreachStat, error) {
+		var stat BreachStat
+		err := row.Scan(&stat.Name, &stat.Accounts)
+		return stat, err
+	})
+	if err != nil {
+		return nil, postgresError(ctx, err)
+	}
+	if stats == nil {
+		stats = []BreachStat{}
+	}
+	return stats, nil
+}
+
+// ForEachEmail scorre le associazioni in ordine di email (usando la chiave primaria)
+// e le raggruppa in un Record per email.
+func (db *Postgres) ForEachEmail(ctx context.Context, fn func(Record) error) error {
+	rows, err := db.pool.Query(ctx, `SELECT email, breach FROM breach_emails ORDER BY email, breach`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var current Record
+	for rows.Next() {
+		var email, breach string
+		if err := rows.Scan(&email, &breach); err != nil {
+			return err
+		}
+		if email != current.Email && current.Email != "" {
+			if err := fn(current); err != nil {
+				return err
+			}
+			current = Record{}
+		}
+		current.Email = email
+		current.Breaches = append(current.Breaches, breach)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if current.Email != "" {
+		return fn(current)
+	}
+	return nil
+}
+
+// CountEmails restituisce il numero di email distinte presenti nel database.
+func (db *Postgres) CountEmails(ctx context.Context) (int64, error) {
+	var count int64
+	err := db.pool.QueryRow(ctx, `SELECT count(DISTINCT email) FROM breach_emails`).Scan(&count)
+	return count, err
+}
+
+// scanBreach legge una riga di breach_catalog selezionata con catalogColumns.
+func scanBreach(row pgx.CollectableRow) (Breach, error) {
+	var b Breach
+	err := row.Scan(&b.Name, &b.Title, &b.Domain, &b.BreachDate, &b.AddedDate,
+		&b.Description, &b.DataClasses, &b.PwnCount, &b.IsVerified, &b.IsSensitive, &b.LogoPath)
+	return b, err
+}
+
+// GetBreach restituisce i metadati del breach, o nil se non è nel catalogo.
+func (db *Postgres) GetBreach(ctx context.Context, name string) (*Breach, error) {
+	rows, err := db.pool.Query(ctx, `SELECT `+catalogColumns+` FROM breach_catalog WHERE name = $1`, name)
+	if err != nil {
+		return nil, postgresError(ctx, err)
+	}
+
+	breach, err := pgx.CollectOneRow(rows, scanBreach)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, postgresError(ctx, err)
+	}
+	return &breach, nil
+}
+
+// ListBreaches restituisce tutto il catalogo in ordine alfabetico di nome.
+func (db *Postgres) ListBreaches(ctx context.Context) ([]Breach, error) {
+	rows, err := db.pool.Query(ctx, `SELECT `+catalogColumns+` FROM breach_catalog ORDER BY name COLLATE "C"`)
+	if err != nil {
+		return nil, postgresError(ctx, err)
+	}
+
+	breaches, err := pgx.CollectRows(rows, scanBreach)
+	if err != nil {
+		return nil, postgresError(ctx, err)
+	}
+	if breaches == nil {
+		breaches = []Breach{}
+	}
+	return breaches, nil
+}
+
+// UpsertBreach crea o sostituisce i metadati del breach nel catalogo.
+func (db *Postgres) UpsertBreach(ctx context.Context, breach Breach) error {
+	if err := breach.Validate(); err != nil {
+		return err
+	}
+	if breach.DataClasses == nil {
+		breach.DataClasses = []string{}
+	}
+
+	_, err := db.pool.Exec(ctx, `
+		INSERT INTO breach_catalog (name, title, domain, breach_date, added_date,
+			description, data_classes, pwn_count, is_verified, is_sensitive, logo_path)
+		VALUES ($1, $2, $3, NULLIF($4, '')::date, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (name) DO UPDATE SET
+			title = EXCLUDED.title, domain = EXCLUDED.domain, breach_date = EXCLUDED.breach_date,
+			added_date = EXCLUDED.added_date, description = EXCLUDED.description,
+			data_classes = EXCLUDED.data_classes, pwn_count = EXCLUDED.pwn_count,
+			is_verified = EXCLUDED.is_verified, is_sensitive = EXCLUDED.is_sensitive,
+			logo_path = EXCLUDED.logo_path`,
+		breach.Name, breach.Title, breach.Domain, breach.BreachDate, breach.AddedDate,
+		breach.Description, breach.DataClasses, breach.PwnCount, breach.IsVerified, breach.IsSensitive, breach.LogoPath)
+	return err
+}
+
+// DeleteBreach elimina i metadati del breach dal catalogo.
+func (db *Postgres) DeleteBreach(ctx context.Context, name string) error {
+	_, err := db.pool.Exec(ctx, `DELETE FROM breach_catalog WHERE name = $1`, name)
+	return err
+}
+
+// scanAPIKey legge una riga di api_keys selezionata con apiKeyColumns.
+// Le date assenti (NULL) diventano il valore zero di time.Time.
+func scanAPIKey(row pgx.CollectableRow) (APIKey, error) {
+	var k APIKey
+	var expiresAt, revokedAt *time.Time
+	err := row.Scan(&k.ID, &k.Hash, &k.Owner, &k.Scopes, &k.MaxBatch, &k.Tier, &k.Domains, &k.CreatedAt, &expiresAt, &revokedAt)
+	if len(k.Domains) == 0 {
+		k.Domains = nil // Come negli altri database, una chiave senza domini non ha l'elenco
+	}
+	if expiresAt != nil {
+		k.ExpiresAt = *expiresAt
+	}
+	if revokedAt != nil {
+		k.RevokedAt = *revokedAt
+	}
+	return k, err
+}
+
+// nullTime converte il valore zero di time.Time in NULL.
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// GetAPIKey restituisce la chiave, o nil se non esiste.
+func (db *Postgres) GetAPIKey(ctx context.Context, id string) (*APIKey, error) {
+	rows, err := db.pool.Query(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1`, id)
+	if err != nil {
+		return nil, postgresError(ctx, err)
+	}
+
+	key, err := pgx.CollectOneRow(rows, scanAPIKey)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, postgresError(ctx, err)
+	}
+	return &key, nil
+}
+
+// ListAPIKeys restituisce tutte le chiavi in ordine di creazione.
+func (db *Postgres) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	rows, err := db.pool.Query(ctx, `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY created_at, id COLLATE "C"`)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := pgx.CollectRows(rows, scanAPIKey)
+	if err != nil {
+		return nil, err
+	}
+	if keys == nil {
+		keys = []APIKey{}
+	}
+	return keys, nil
+}
+
+// CreateAPIKey salva una nuova chiave.
+func (db *Postgres) CreateAPIKey(ctx context.Context, key APIKey) error {
+	if err := key.Validate(); err != nil {
+		return err
+	}
+	if key.Scopes == nil {
+		key.Scopes = []string{}
+	}
+	if key.Domains == nil {
+		key.Domains = []string{}
+	}
+
+	tag, err := db.pool.Exec(ctx, `
+		INSERT INTO api_keys (`+apiKeyColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (id) DO NOTHING`,
+		key.ID, key.Hash, key.Owner, key.Scopes, key.MaxBatch, key.Tier, key.Domains, key.CreatedAt, nullTime(key.ExpiresAt), nullTime(key.RevokedAt))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAPIKeyExists
+	}
+	return nil
+}
+
+// RevokeAPIKey revoca la chiave, conservando la data di una revoca precedente.
+func (db *Postgres) RevokeAPIKey(ctx context.Context, id string, at time.Time) error {
+	tag, err := db.pool.Exec(ctx, `UPDATE api_keys SET revoked_at = COALESCE(revoked_at, $2) WHERE id = $1`, id, at)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// SetAPIKeyDomains sostituisce i domini della chiave.
+func (db *Postgres) SetAPIKeyDomains(ctx context.Context, id string, domains []string) error {
+	if domains == nil {
+		domains = []string{}
+	}
+	tag, err := db.pool.Exec(ctx, `UPDATE api_keys SET domains = $2 WHERE id = $1`, id, domains)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// TakeTokens applica TokenBucket.Take al bucket in modo atomico.
+func (db *Postgres) TakeTokens(ctx context.Context, key string, bucket TokenBucket, cost float64, force bool, now time.Time) (float64, bool, error) {
+	var tokens float64
+	var allowed bool
+	err := db.pool.QueryRow(ctx, takeTokensQuery, key, bucket.Rate, bucket.Burst, cost, force, now).Scan(&tokens, &allowed)
+	return tokens, allowed, postgresError(ctx, err)
+}
+
+// PruneRateLimits elimina i bucket tornati pieni.
+func (db *Postgres) PruneRateLimits(ctx context.Context, now time.Time) (int64, error) {
+	tag, err := db.pool.Exec(ctx, `DELETE FROM rate_limits WHERE expires_at < $1`, now)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// RemoveBreach rimuove il breach da tutte le email e aggiorna i contatori nella stessa transazione.
+func (db *Postgres) RemoveBreach(ctx context.Context, breach string) (RemoveResult, error) {
+	var result RemoveResult
+	err := pgx.BeginFunc(ctx, db.pool, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, removeBreachQuery, breach).Scan(&result.UnlinkedCount, &result.DeletedCount)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM breaches WHERE name = $1`, breach); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `UPDATE stats SET emails = emails - $1, associations = associations - $2`,
+			result.DeletedCount, result.UnlinkedCount)
+		return err
+	})
+	if err != nil {
+		return RemoveResult{}, err
+	}
+	return result, nil
+}
+
+// DeleteEmails elimina le email indicate e aggiorna i contatori nella stessa transazione.
+func (db *Postgres) DeleteEmails(ctx context.Context, emails []string) (int64, error) {
+	if len(emails) == 0 {
+		return 0, nil
+	}
+
+	var deleted, associations int64
+	err := pgx.BeginFunc(ctx, db.pool, func(tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx, deleteEmailsQuery, emails).Scan(&deleted, &associations); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `UPDATE stats SET emails = emails - $1, associations = associations - $2`,
+			deleted, associations)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// BreachStats restituisce il numero di email di ogni breach, in ordine alfabetico.
+func (db *Postgres) BreachStats(ctx context.Context) ([]BreachStat, error) {
+	rows, err := db.pool.Query(ctx, `SELECT name, accounts FROM breaches WHERE accounts > 0 ORDER BY name COLLATE "C"`)
+	if err != nil {
+		return nil, postgresError(ctx, err)
+	}
+
+	stats, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (BreachStat, error) {
+		var stat BreachStat
+		err := row.Scan(&stat.Name, &stat.Accounts)
+		return stat, err
+	})
+	if err != nil {
+		return nil, postgresError(ctx, err)
+	}
+	if stats == nil {
+		stats = []BreachStat{}
+	}
+	return stats, nil
+}
+
+// TopDomains restituisce i domini con più email, usando l'indice su accounts.
+func (db *Postgres) TopDomains(ctx context.Context, limit int) ([]DomainStat, error) {
+	if limit <= 0 {
+		return []DomainStat{}, nil
+	}
+	rows, err := db.pool.Query(ctx, `
+		SELECT name, accounts FROM domains WHERE accounts > 0
+		ORDER BY accounts DESC, name COLLATE "C" LIMIT $1`, limit)
+	if err != nil {
+		return nil, postgresError(ctx, err)
+	}
+
+	stats, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (DomainStat, error) {
+		var stat DomainStat
+		err := row.Scan(&stat.Domain, &stat.Accounts)
+		return stat, err
+	})
+	if err != nil {
+		return nil, postgresError(ctx, err)
+	}
+	if stats == nil {
+		stats = []DomainStat{}
+	}
+	return stats, nil
+}
+
+// GlobalStats restituisce i contatori globali.
+func (db *Postgres) GlobalStats(ctx context.Context) (Stats, error) {
+	var stats Stats
+	var reconciledAt *time.Time
+	err := db.pool.QueryRow(ctx, `
+		SELECT emails, associations, reconciled_at, (SELECT count(*) FROM breaches WHERE accounts > 0)
+		FROM stats`).Scan(&stats.Emails, &stats.Associations, &reconciledAt, &stats.Breaches)
+	if err != nil {
+		return Stats{}, postgresError(ctx, err)
+	}
+	if reconciledAt != nil {
+		stats.ReconciledAt = reconciledAt.UTC()
+	}
+	return stats, nil
+}
+
+// ReconcileStats ricostruisce i contatori a partire dalle associazioni.
+func (db *Postgres) ReconcileStats(ctx context.Context) (Stats, error) {
+	err := pgx.BeginFunc(ctx, db.pool, func(tx pgx.Tx) error {
+		for _, query := range reconcileStatsQueries {
+			if _, err := tx.Exec(ctx, query); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Stats{}, err
+	}
+	return db.GlobalStats(ctx)
+}
+
+// Ping verifica che PostgreSQL accetti connessioni.
+func (db *Postgres) Ping(ctx context.Context) error {
+	return postgresError(ctx, db.pool.Ping(ctx))
+}
+
+// Close chiude il pool di connessioni a PostgreSQL.
+func (db *Postgres) Close() error {
+	db.pool.Close()
+	return nil
+}
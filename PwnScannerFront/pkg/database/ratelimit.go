@@ -0,0 +1,52 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// TokenBucket descrive un bucket del rate limiting: si riempie di Rate gettoni al secondo
+// fino a un massimo di Burst, e ogni richiesta ne consuma almeno uno.
+type TokenBucket struct {
+	// Rate è il numero di gettoni aggiunti al secondo
+	Rate float64
+	// Burst è la capacità del bucket, e quindi il numero di richieste ammesse di seguito
+	Burst float64
+}
+
+// Take applica un prelievo di cost gettoni al bucket che conteneva tokens gettoni all'istante updatedAt.
+// Il prelievo è ammesso se dopo il riempimento resta almeno un gettone, oppure se force è true;
+// un prelievo ammesso può lasciare il bucket in negativo (ad esempio per le richieste che valgono
+// più gettoni), e le richieste successive attendono che il debito sia stato recuperato.
+// È la semantica che ogni RateLimitStore deve rispettare; un bucket nuovo parte pieno.
+func (b TokenBucket) Take(tokens float64, updatedAt, now time.Time, cost float64, force bool) (float64, bool) {
+	if elapsed := now.Sub(updatedAt).Seconds(); elapsed > 0 {
+		tokens += elapsed * b.Rate
+	}
+	tokens = min(tokens, b.Burst)
+
+	if tokens < 1 && !force {
+		return tokens, false
+	}
+	return tokens - cost, true
+}
+
+// FullAt restituisce l'istante in cui il bucket, con tokens gettoni all'istante now, torna pieno:
+// da quel momento il suo stato equivale a quello di un bucket nuovo e può essere eliminato.
+func (b TokenBucket) FullAt(tokens float64, now time.Time) time.Time {
+	if tokens >= b.Burst {
+		return now
+	}
+	return now.Add(time.Duration((b.Burst - tokens) / b.Rate * float64(time.Second)))
+}
+
+// RateLimitStore è implementato dai database che possono conservare i bucket del rate limiting,
+// così che più istanze di PwnScannerFront applichino gli stessi limiti.
+type RateLimitStore interface {
+	// TakeTokens applica in modo atomico TokenBucket.Take al bucket key e restituisce
+	// i gettoni rimasti e se il prelievo è stato ammesso
+	TakeTokens(ctx context.Context, key string, bucket TokenBucket, cost float64, force bool, now time.Time) (float64, bool, error)
+
+	// PruneRateLimits elimina i bucket tornati pieni prima di now e restituisce quanti ne ha eliminati
+	PruneRateLimits(ctx context.Context, now time.Time) (int64, error)
+}
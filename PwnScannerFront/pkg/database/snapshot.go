@@ -0,0 +1,197 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"pwnscanner/pkg/snapshot"
+	"sync"
+	"time"
+)
+
+// Snapshot è l'implementazione di sola lettura basata su un file snapshot esportato da pwnadmin.
+// Non ha dipendenze esterne: il file viene mappato in memoria e interrogato con una ricerca binaria.
+//
+// Il file viene controllato periodicamente; quando viene sostituito (pwnadmin lo scrive accanto
+// e poi lo rinomina) il nuovo snapshot viene validato e scambiato a caldo, senza riavvii.
+type Snapshot struct {
+	path     string
+	onReload func(snapshot.Info, error)
+
+	mu      sync.RWMutex
+	current *snapshot.Snapshot
+	stat    os.FileInfo
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewSnapshot apre lo snapshot in path. Se reloadInterval è positivo, il file viene controllato
+// con quella frequenza e ricaricato quando cambia; onReload (facoltativa) riceve l'esito di ogni ricarica.
+func NewSnapshot(path string, reloadInterval time.Duration, onReload func(snapshot.Info, error)) (*Snapshot, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("errore durante l'apertura dello snapshot: %w", err)
+	}
+	current, err := snapshot.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("errore durante l'apertura dello snapshot %s: %w", path, err)
+	}
+
+	s := &Snapshot{
+		path:     path,
+		onReload: onReload,
+		current:  current,
+		stat:     stat,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	if reloadInterval > 0 {
+		go s.watch(reloadInterval)
+	} else {
+		close(s.done)
+	}
+	return s, nil
+}
+
+// Info restituisce la descrizione dello snapshot attualmente in uso.
+func (s *Snapshot) Info() snapshot.Info {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current.Info()
+}
+
+// watch controlla periodicamente il file e lo ricarica quando viene sostituito.
+func (s *Snapshot) watch(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			stat, err := os.Stat(s.path)
+			if err != nil {
+				// Il file può mancare per un istante durante la sostituzione: si riprova al prossimo controllo
+				continue
+			}
+			if os.SameFile(stat, s.stat) && stat.ModTime().Equal(s.stat.ModTime()) && stat.Size() == s.stat.Size() {
+				continue
+			}
+			info, err := s.reload(stat)
+			if s.onReload != nil {
+				s.onReload(info, err)
+			}
+		}
+	}
+}
+
+// reload apre il nuovo file e, se valido, lo sostituisce a quello corrente.
+// In caso di errore lo snapshot corrente resta in uso.
+func (s *Snapshot) reload(stat os.FileInfo) (snapshot.Info, error) {
+	next, err := snapshot.Open(s.path)
+	if err != nil {
+		// Il file non viene riprovato finché non cambia di nuovo
+		s.stat = stat
+		return snapshot.Info{}, err
+	}
+
+	s.mu.Lock()
+	previous := s.current
+	s.current = next
+	s.stat = stat
+	s.mu.Unlock()
+
+	// Nessuna lettura può essere in corso sul vecchio snapshot: il lock esclusivo le ha attese tutte
+	return next.Info(), previous.Close()
+}
+
+// FindEmail cerca un'email nello snapshot.
+func (s *Snapshot) FindEmail(ctx context.Context, email string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current.Lookup(email), nil
+}
+
+// GetAllBreaches restituisce i breach presenti nello snapshot, in ordine alfabetico.
+func (s *Snapshot) GetAllBreaches(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current.Breaches(), nil
+}
+
+// BreachStats restituisce il numero di email di ogni breach, letto dalla tabella dello snapshot.
+func (s *Snapshot) BreachStats(ctx context.Context) ([]BreachStat, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := s.current.BreachCounts()
+	stats := make([]BreachStat, 0, len(counts))
+	for _, name := range s.current.Breaches() {
+		if counts[name] > 0 {
+			stats = append(stats, BreachStat{Name: name, Accounts: int64(counts[name])})
+		}
+	}
+	return stats, nil
+}
+
+// TopDomains restituisce sempre un elenco vuoto: lo snapshot contiene solo gli hash delle email.
+func (s *Snapshot) TopDomains(ctx context.Context, limit int) ([]DomainStat, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return []DomainStat{}, nil
+}
+
+// GlobalStats restituisce i contatori dello snapshot, esatti alla data della sua creazione.
+func (s *Snapshot) GlobalStats(ctx context.Context) (Stats, error) {
+	if err := ctx.Err(); err != nil {
+		return Stats{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	info := s.current.Info()
+	stats := Stats{
+		Emails:       int64(info.Records),
+		ReconciledAt: info.Created.UTC(),
+	}
+	for _, count := range s.current.BreachCounts() {
+		if count > 0 {
+			stats.Breaches++
+			stats.Associations += int64(count)
+		}
+	}
+	return stats, nil
+}
+
+// Close ferma il controllo del file e rilascia lo snapshot.
+func (s *Snapshot) Close() error {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current.Close()
+}
@@ -0,0 +1,110 @@
+package database_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"pwnscanner/pkg/database"
+	"pwnscanner/pkg/database/dbtest"
+	"pwnscanner/pkg/snapshot"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeSnapshot esporta i record in uno snapshot in path, come fa pwnadmin export-snapshot.
+func writeSnapshot(t *testing.T, path string, version uint64, records []database.Record) {
+	t.Helper()
+	w, err := snapshot.NewWriter(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	defer w.Close()
+	for _, r := range records {
+		if err := w.Add(r.Email, r.Breaches); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	if _, err := w.Commit(path, version); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+}
+
+func TestSnapshotContract(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, seed []database.Record) database.Database {
+		path := filepath.Join(t.TempDir(), "pwnscanner.snapshot")
+		writeSnapshot(t, path, 1, seed)
+		db, err := database.NewSnapshot(path, 0, nil)
+		if err != nil {
+			t.Fatalf("NewSnapshot: %v", err)
+		}
+		return db
+	})
+}
+
+// Un file sostituito con una rinomina viene ricaricato a caldo; uno non valido viene scartato
+// e resta in uso lo snapshot precedente.
+func TestSnapshotReload(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "pwnscanner.snapshot")
+	writeSnapshot(t, path, 1, []database.Record{{Email: "alice@example.com", Breaches: []string{"Adobe"}}})
+
+	type reload struct {
+		info snapshot.Info
+		err  error
+	}
+	reloads := make(chan reload, 4)
+	db, err := database.NewSnapshot(path, 10*time.Millisecond, func(info snapshot.Info, err error) {
+		reloads <- reload{info, err}
+	})
+	if err != nil {
+		t.Fatalf("NewSnapshot: %v", err)
+	}
+	defer db.Close()
+	wait := func() reload {
+		t.Helper()
+		select {
+		case r := <-reloads:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("lo snapshot sostituito non è stato ricaricato")
+			return reload{}
+		}
+	}
+	find := func(email string) []string {
+		t.Helper()
+		breaches, err := db.FindEmail(ctx, email)
+		if err != nil {
+			t.Fatalf("FindEmail: errore inatteso: %v", err)
+		}
+		return breaches
+	}
+
+	writeSnapshot(t, path, 2, []database.Record{{Email: "bob@example.com", Breaches: []string{"Dropbox", "LinkedIn"}}})
+	if r := wait(); r.err != nil || r.info.Version != 2 {
+		t.Fatalf("ricarica: info %+v, errore %v; attesa la versione 2", r.info, r.err)
+	}
+	if got := db.Info().Version; got != 2 {
+		t.Errorf("Info().Version = %d, attesa 2", got)
+	}
+	if got := find("alice@example.com"); got != nil {
+		t.Errorf("FindEmail(alice) dopo la ricarica = %v, atteso nil", got)
+	}
+	if got, want := find("bob@example.com"), []string{"Dropbox", "LinkedIn"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindEmail(bob) dopo la ricarica = %v, attesi %v", got, want)
+	}
+
+	invalid := path + ".tmp"
+	if err := os.WriteFile(invalid, []byte("non è uno snapshot"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(invalid, path); err != nil {
+		t.Fatal(err)
+	}
+	if r := wait(); r.err == nil {
+		t.Fatal("ricarica di un file non valido: atteso un errore")
+	}
+	if got, want := find("bob@example.com"), []string{"Dropbox", "LinkedIn"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindEmail(bob) dopo un file non valido = %v, attesi %v", got, want)
+	}
+}
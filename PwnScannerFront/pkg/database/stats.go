@@ -0,0 +1,97 @@
+package database
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"time"
+)
+
+// BreachStat è il numero di email associate a un breach.
+type BreachStat struct {
+	Name     string `json:"name" bson:"_id"`
+	Accounts int64  `json:"accounts" bson:"accounts"`
+}
+
+// DomainStat è il numero di email distinte di un dominio.
+type DomainStat struct {
+	Domain   string `json:"domain" bson:"_id"`
+	Accounts int64  `json:"accounts" bson:"accounts"`
+}
+
+// Stats sono i contatori globali del database.
+// @Description Contatori globali del database
+type Stats struct {
+	// Emails è il numero di email distinte presenti
+	Emails int64 `json:"emails" bson:"emails"`
+	// Associations è il numero di coppie email-breach (un'email in tre breach conta tre volte)
+	Associations int64 `json:"associations" bson:"associations"`
+	// Breaches è il numero di breach con almeno un'email
+	Breaches int64 `json:"breaches" bson:"-"`
+	// ReconciledAt è l'ultima ricostruzione completa dei contatori; zero se non è mai stata eseguita,
+	// nel qual caso i contatori non includono i dati caricati prima della loro introduzione
+	ReconciledAt time.Time `json:"reconciled_at" bson:"reconciled_at"`
+}
+
+// StatsReader è implementato dai database che mantengono contatori materializzati,
+// così le statistiche si leggono in tempo proporzionale al numero di breach o di domini, non di email.
+type StatsReader interface {
+	// BreachStats restituisce i breach con almeno un'email, in ordine alfabetico di nome
+	BreachStats(ctx context.Context) ([]BreachStat, error)
+
+	// TopDomains restituisce al massimo limit domini, dal più numeroso (a parità, in ordine alfabetico);
+	// con limit <= 0 restituisce un elenco vuoto
+	TopDomains(ctx context.Context, limit int) ([]DomainStat, error)
+
+	// GlobalStats restituisce i contatori globali
+	GlobalStats(ctx context.Context) (Stats, error)
+}
+
+// StatsReconciler è implementato dai database i cui contatori possono essere ricostruiti dai dati.
+// La ricostruzione corregge eventuali scostamenti (import interrotti, dati precedenti ai contatori)
+// e va eseguita senza import o rimozioni in corso.
+type StatsReconciler interface {
+	ReconcileStats(ctx context.Context) (Stats, error)
+}
+
+// RemoveResult riassume l'effetto della rimozione di un breach.
+type RemoveResult struct {
+	// UnlinkedCount è il numero di email da cui è stato rimosso il breach
+	UnlinkedCount int64
+	// DeletedCount è il numero di email eliminate perché rimaste senza breach
+	DeletedCount int64
+}
+
+// BreachRemover è implementato dai database da cui pwnadmin può eliminare i dati di un breach.
+// La rimozione aggiorna i contatori come fa AddBreachEmails.
+type BreachRemover interface {
+	RemoveBreach(ctx context.Context, breach string) (RemoveResult, error)
+}
+
+// EmailDomain restituisce il dominio (in minuscolo) con cui un'email viene contata nelle statistiche:
+// la parte dopo l'ultima @, oppure l'intera stringa se manca la @.
+// Le implementazioni che calcolano il dominio lato database usano la stessa regola.
+func EmailDomain(email string) string {
+	return strings.ToLower(email[strings.LastIndex(email, "@")+1:])
+}
+
+// topDomains ordina i contatori per numero di email decrescente e nome, restituendone al massimo limit.
+func topDomains(counts map[string]int64, limit int) []DomainStat {
+	domains := make([]DomainStat, 0, len(counts))
+	for domain, accounts := range counts {
+		if accounts > 0 {
+			domains = append(domains, DomainStat{Domain: domain, Accounts: accounts})
+		}
+	}
+	slices.SortFunc(domains, func(a, b DomainStat) int {
+		if a.Accounts != b.Accounts {
+			return cmp.Compare(b.Accounts, a.Accounts)
+		}
+		return strings.Compare(a.Domain, b.Domain)
+	})
+	if len(domains) > limit {
+		domains = domains[:max(limit, 0)]
+	}
+	return domains
+}
@@ -0,0 +1,132 @@
+// Package normalize definisce la forma canonica delle email, condivisa da pwnadmin (import)
+// e da PwnScannerFront (ricerca): un'email viene memorizzata e cercata sempre nella stessa forma,
+// così "John@Gmail.com" e "john@gmail.com" sono lo stesso account.
+//
+// La normalizzazione di base:
+//   - rimuove gli spazi e i caratteri di contorno (<, >, virgolette, punteggiatura finale);
+//   - converte in minuscolo la parte locale;
+//   - converte il dominio in minuscolo e in forma ASCII (IDN → punycode), senza punto finale.
+//
+// Le regole dei provider sono facoltative perché cambiano l'identità dell'email
+// (ad esempio Gmail ignora i punti e il suffisso +tag). Vanno abilitate allo stesso modo
+// in entrambi i programmi, altrimenti le ricerche non trovano le email importate.
+package normalize
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// ErrInvalid indica una stringa che non è un'email normalizzabile.
+var ErrInvalid = errors.New("email non valida")
+
+// Options configura le regole facoltative.
+type Options struct {
+	// ProviderRules abilita le regole specifiche dei provider (vedi providers)
+	ProviderRules bool
+}
+
+// provider descrive come un provider di posta interpreta la parte locale.
+type provider struct {
+	ignoreDots bool   // i punti nella parte locale sono ignorati
+	plusTags   bool   // tutto ciò che segue il primo + è ignorato
+	domain     string // dominio canonico, se il provider ne ha più di uno
+}
+
+// providers elenca i provider noti per cui vengono applicate le regole facoltative.
+var providers = map[string]provider{
+	"gmail.com":      {ignoreDots: true, plusTags: true},
+	"googlemail.com": {ignoreDots: true, plusTags: true, domain: "gmail.com"},
+	"outlook.com":    {plusTags: true},
+	"hotmail.com":    {plusTags: true},
+	"live.com":       {plusTags: true},
+	"icloud.com":     {plusTags: true},
+	"me.com":         {plusTags: true},
+	"mac.com":        {plusTags: true},
+	"protonmail.com": {plusTags: true},
+	"proton.me":      {plusTags: true},
+	"fastmail.com":   {plusTags: true},
+}
+
+// profile è il profilo IDNA usato per i domini: applica la mappatura UTS #46
+// (che include la conversione in minuscolo) e verifica la sintassi dei nomi host.
+var profile = idna.New(
+	idna.MapForLookup(),
+	idna.Transitional(false),
+	idna.StrictDomainName(true),
+)
+
+// Normalizer normalizza le email secondo le opzioni scelte. È sicuro per l'uso concorrente.
+type Normalizer struct {
+	opts Options
+}
+
+// New crea un Normalizer con le opzioni indicate.
+func New(opts Options) *Normalizer {
+	return &Normalizer{opts: opts}
+}
+
+// Email restituisce la forma canonica di raw, oppure un errore che avvolge ErrInvalid.
+func (n *Normalizer) Email(raw string) (string, error) {
+	email := strings.TrimLeft(raw, " \t\r\n<(\"'")
+	email = strings.TrimRight(email, " \t\r\n>)\"'.,:;")
+
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return "", fmt.Errorf("%w: %q", ErrInvalid, raw)
+	}
+	local := email[:at]
+	if strings.ContainsAny(local, " \t\r\n") {
+		return "", fmt.Errorf("%w: %q", ErrInvalid, raw)
+	}
+
+	domain, err := Domain(email[at+1:])
+	if err != nil {
+		return "", fmt.Errorf("%w: dominio non valido in %q", ErrInvalid, raw)
+	}
+	local = strings.ToLower(local)
+
+	if n.opts.ProviderRules {
+		if p, found := providers[domain]; found {
+			if p.plusTags {
+				if plus := strings.IndexByte(local, '+'); plus >= 0 {
+					local = local[:plus]
+				}
+			}
+			if p.ignoreDots {
+				local = strings.ReplaceAll(local, ".", "")
+			}
+			if p.domain != "" {
+				domain = p.domain
+			}
+			if local == "" {
+				return "", fmt.Errorf("%w: %q", ErrInvalid, raw)
+			}
+		}
+	}
+
+	return local + "@" + domain, nil
+}
+
+// Domain restituisce la forma canonica di un dominio, la stessa della parte dopo la @ delle email:
+// in minuscolo e in forma ASCII, senza punto finale. Le regole dei provider non vengono applicate.
+func Domain(raw string) (string, error) {
+	domain, err := profile.ToASCII(strings.TrimSuffix(raw, "."))
+	if err != nil || domain == "" || !strings.Contains(domain, ".") {
+		return "", fmt.Errorf("dominio non valido: %q", raw)
+	}
+	return domain, nil
+}
+
+// Hash restituisce lo SHA-256 dell'email, già in forma canonica, in 64 cifre esadecimali maiuscole.
+// È la chiave delle ricerche per intervallo sugli hash delle email: il client invia solo un prefisso
+// dell'hash, che deve calcolare dall'email normalizzata con le stesse opzioni del server.
+func Hash(email string) string {
+	sum := sha256.Sum256([]byte(email))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
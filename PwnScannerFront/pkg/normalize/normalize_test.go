@@ -0,0 +1,29 @@
+package normalize
+
+import "testing"
+
+func TestHash(t *testing.T) {
+	for _, tc := range []struct {
+		email string
+		want  string
+	}{
+		{"", "E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855"},
+		{"alice@example.com", "FF8D9819FC0E12BF0D24892E45987E249A28DCE836A85CAD60E28EAAA8C6D976"},
+	} {
+		if got := Hash(tc.email); got != tc.want {
+			t.Errorf("Hash(%q) = %s, atteso %s", tc.email, got, tc.want)
+		}
+	}
+
+	// Hash non normalizza: va chiamato sull'email già in forma canonica
+	if Hash("Alice@Example.com") == Hash("alice@example.com") {
+		t.Error("Hash deve distinguere le email non normalizzate")
+	}
+	email, err := New(Options{}).Email("Alice@Example.com")
+	if err != nil {
+		t.Fatalf("Email: errore inatteso: %v", err)
+	}
+	if got, want := Hash(email), Hash("alice@example.com"); got != want {
+		t.Errorf("Hash dell'email normalizzata = %s, atteso %s", got, want)
+	}
+}
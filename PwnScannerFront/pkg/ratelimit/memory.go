@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"context"
+	"pwnscanner/pkg/database"
+	"sync"
+	"time"
+)
+
+// bucketState è lo stato di un bucket di MemoryStore.
+type bucketState struct {
+	tokens    float64
+	updatedAt time.Time
+	fullAt    time.Time
+}
+
+// MemoryStore conserva i bucket nella memoria del processo: ogni istanza applica i limiti per conto proprio.
+// Implementa database.RateLimitStore.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucketState
+}
+
+// NewMemoryStore crea un MemoryStore vuoto.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucketState)}
+}
+
+// TakeTokens applica database.TokenBucket.Take al bucket key.
+func (m *MemoryStore) TakeTokens(_ context.Context, key string, bucket database.TokenBucket, cost float64, force bool, now time.Time) (float64, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, ok := m.buckets[key]
+	if !ok {
+		state = &bucketState{tokens: bucket.Burst, updatedAt: now}
+		m.buckets[key] = state
+	}
+
+	tokens, allowed := bucket.Take(state.tokens, state.updatedAt, now, cost, force)
+	state.tokens = tokens
+	if now.After(state.updatedAt) {
+		state.updatedAt = now
+	}
+	state.fullAt = bucket.FullAt(tokens, now)
+	return tokens, allowed, nil
+}
+
+// PruneRateLimits elimina i bucket tornati pieni prima di now.
+func (m *MemoryStore) PruneRateLimits(_ context.Context, now time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var pruned int64
+	for key, state := range m.buckets {
+		if state.fullAt.Before(now) {
+			delete(m.buckets, key)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
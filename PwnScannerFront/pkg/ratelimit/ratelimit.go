@@ -0,0 +1,204 @@
+// Package ratelimit limita la frequenza delle richieste dei client di PwnScannerFront con dei token bucket:
+// uno per chiave API, oppure uno per indirizzo IP per le richieste anonime.
+//
+// Ogni bucket appartiene a un profilo (tier) che ne stabilisce velocità di riempimento e capacità.
+// I bucket sono conservati da un database.RateLimitStore: MemoryStore per una singola istanza,
+// oppure il database (MongoDB o PostgreSQL) quando più istanze devono applicare gli stessi limiti.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"pwnscanner/pkg/database"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Profili sempre presenti nella configurazione.
+const (
+	// DefaultTier è il profilo delle chiavi API senza un profilo esplicito, o con un profilo sconosciuto
+	DefaultTier = "default"
+	// AnonymousTier è il profilo delle richieste senza chiave, limitate per indirizzo IP
+	AnonymousTier = "anonymous"
+)
+
+// Definizione delle metriche Prometheus
+var (
+	limiterRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ratelimit_requests_total",
+			Help: "Numero di richieste valutate dal rate limiter, per profilo ed esito (allowed o limited).",
+		},
+		[]string{"tier", "result"},
+	)
+	limiterCharged = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ratelimit_charged_tokens_total",
+			Help: "Gettoni aggiuntivi addebitati alle richieste che valgono più di una (ad esempio /check-emails), per profilo.",
+		},
+		[]string{"tier"},
+	)
+	limiterStoreErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ratelimit_store_errors_total",
+			Help: "Numero di errori nell'accesso ai bucket; le richieste coinvolte vengono ammesse.",
+		},
+	)
+	limiterStoreTimes = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "ratelimit_store_duration_seconds",
+			Help:    "Distribuzione dei tempi di accesso ai bucket.",
+			Buckets: prometheus.DefBuckets,
+		},
+	)
+	limiterPruned = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ratelimit_pruned_buckets_total",
+			Help: "Numero di bucket eliminati perché tornati pieni.",
+		},
+	)
+)
+
+// init registra le metriche Prometheus al momento dell'avvio.
+func init() {
+	prometheus.MustRegister(limiterRequests, limiterCharged, limiterStoreErrors, limiterStoreTimes, limiterPruned)
+}
+
+// Result è l'esito di una richiesta valutata dal Limiter, con i valori degli header X-RateLimit-*.
+type Result struct {
+	// Allowed indica se la richiesta è ammessa
+	Allowed bool
+	// Limit è la capacità del bucket
+	Limit int
+	// Remaining è il numero di richieste ancora ammesse senza attendere
+	Remaining int
+	// RetryAfter è l'attesa prima che una richiesta rifiutata possa essere ripetuta
+	RetryAfter time.Duration
+	// ResetAfter è l'attesa prima che il bucket torni pieno
+	ResetAfter time.Duration
+}
+
+// Limiter applica i profili ai bucket conservati nello store.
+type Limiter struct {
+	store database.RateLimitStore
+	tiers map[string]database.TokenBucket
+	now   func() time.Time
+}
+
+// New crea un Limiter con i profili indicati, che devono includere DefaultTier e AnonymousTier.
+func New(store database.RateLimitStore, tiers map[string]database.TokenBucket) *Limiter {
+	return &Limiter{store: store, tiers: tiers, now: time.Now}
+}
+
+// bucket restituisce i parametri del profilo, o quelli di DefaultTier se il profilo non esiste.
+func (l *Limiter) bucket(tier string) (string, database.TokenBucket) {
+	if bucket, ok := l.tiers[tier]; ok {
+		return tier, bucket
+	}
+	return DefaultTier, l.tiers[DefaultTier]
+}
+
+// Take preleva un gettone dal bucket key con i parametri del profilo tier.
+// In caso di errore dello store la richiesta va considerata ammessa: Result ha Allowed = true.
+func (l *Limiter) Take(ctx context.Context, key, tier string) (Result, error) {
+	tier, bucket := l.bucket(tier)
+	now := l.now()
+
+	start := time.Now()
+	tokens, allowed, err := l.store.TakeTokens(ctx, key, bucket, 1, false, now)
+	limiterStoreTimes.Observe(time.Since(start).Seconds())
+	if err != nil {
+		limiterStoreErrors.Inc()
+		limiterRequests.WithLabelValues(tier, "allowed").Inc()
+		return Result{Allowed: true, Limit: int(bucket.Burst)}, err
+	}
+
+	result := Result{
+		Allowed:    allowed,
+		Limit:      int(bucket.Burst),
+		Remaining:  int(math.Max(0, math.Floor(tokens))),
+		ResetAfter: bucket.FullAt(tokens, now).Sub(now),
+	}
+	if allowed {
+		limiterRequests.WithLabelValues(tier, "allowed").Inc()
+	} else {
+		limiterRequests.WithLabelValues(tier, "limited").Inc()
+		result.RetryAfter = time.Duration((1 - tokens) / bucket.Rate * float64(time.Second))
+	}
+	return result, nil
+}
+
+// Charge addebita cost gettoni al bucket key anche se è vuoto, per le richieste già ammesse che valgono
+// più di una: il debito rallenta le richieste successive.
+func (l *Limiter) Charge(ctx context.Context, key, tier string, cost float64) error {
+	if cost <= 0 {
+		return nil
+	}
+	tier, bucket := l.bucket(tier)
+
+	start := time.Now()
+	_, _, err := l.store.TakeTokens(ctx, key, bucket, cost, true, l.now())
+	limiterStoreTimes.Observe(time.Since(start).Seconds())
+	if err != nil {
+		limiterStoreErrors.Inc()
+		return err
+	}
+	limiterCharged.WithLabelValues(tier).Add(cost)
+	return nil
+}
+
+// Prune elimina i bucket tornati pieni, il cui stato equivale a quello di un bucket nuovo.
+func (l *Limiter) Prune(ctx context.Context) (int64, error) {
+	pruned, err := l.store.PruneRateLimits(ctx, l.now())
+	if err != nil {
+		limiterStoreErrors.Inc()
+		return 0, err
+	}
+	limiterPruned.Add(float64(pruned))
+	return pruned, nil
+}
+
+// StartPruning esegue Prune ogni interval finché ctx non viene annullato.
+// onPrune, se non nil, riceve l'esito di ogni esecuzione.
+func (l *Limiter) StartPruning(ctx context.Context, interval time.Duration, onPrune func(int64, error)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				pruned, err := l.Prune(ctx)
+				if onPrune != nil {
+					onPrune(pruned, err)
+				}
+			}
+		}
+	}()
+}
+
+// charge identifica il bucket a cui addebitare il costo aggiuntivo di una richiesta.
+type charge struct {
+	limiter *Limiter
+	key     string
+	tier    string
+}
+
+// chargeKey è la chiave del bucket della richiesta nel contesto.
+type chargeKey struct{}
+
+// NewContext restituisce un contesto che ricorda il bucket della richiesta, usato da Charge.
+func NewContext(ctx context.Context, l *Limiter, key, tier string) context.Context {
+	return context.WithValue(ctx, chargeKey{}, charge{limiter: l, key: key, tier: tier})
+}
+
+// Charge addebita cost gettoni al bucket della richiesta; non fa nulla se il rate limiting non è attivo.
+func Charge(ctx context.Context, cost float64) error {
+	c, ok := ctx.Value(chargeKey{}).(charge)
+	if !ok {
+		return nil
+	}
+	return c.limiter.Charge(ctx, c.key, c.tier, cost)
+}
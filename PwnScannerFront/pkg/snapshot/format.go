@@ -0,0 +1,137 @@
+// Package snapshot definisce il formato binario immutabile usato dai nodi di sola lettura.
+//
+// Uno snapshot contiene l'hash di ogni email e l'insieme dei breach in cui compare,
+// codificato come bitset di ID. Il file è composto da:
+//
+//	header         64 byte (vedi header)
+//	tabella breach per ogni breach: lunghezza nome (uint16), nome, numero di email (uint64)
+//	padding        fino a un multiplo di 8 byte
+//	record         recordCount record ordinati per hash: hash (HashSize byte) + bitset (bitsetBytes byte)
+//
+// Gli ID dei breach sono la posizione nella tabella, ordinata alfabeticamente,
+// quindi decodificare un bitset restituisce già i breach in ordine alfabetico.
+// Tutti gli interi sono little-endian.
+package snapshot
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"time"
+)
+
+const (
+	// FormatVersion è la versione del formato scritta e letta da questo pacchetto.
+	FormatVersion uint32 = 1
+
+	// HashSize è il numero di byte dell'hash SHA-256 conservati per ogni email.
+	HashSize = 16
+
+	headerSize = 64
+)
+
+// magic identifica un file snapshot di PwnScanner.
+var magic = [8]byte{'P', 'W', 'N', 'S', 'N', 'A', 'P', 0}
+
+// crcTable è la tabella CRC-32 (Castagnoli) usata per il checksum del contenuto.
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	// ErrInvalidFormat indica un file che non è uno snapshot valido.
+	ErrInvalidFormat = errors.New("snapshot: formato non valido")
+
+	// ErrUnsupportedVersion indica uno snapshot scritto con una versione del formato più recente.
+	ErrUnsupportedVersion = errors.New("snapshot: versione del formato non supportata")
+)
+
+// Info descrive uno snapshot.
+type Info struct {
+	// FormatVersion è la versione del formato binario
+	FormatVersion uint32
+	// Version identifica i dati contenuti; è scelta da chi esporta lo snapshot
+	Version uint64
+	// Created è l'istante di creazione dello snapshot
+	Created time.Time
+	// Breaches è il numero di breach presenti
+	Breaches int
+	// Records è il numero di email presenti
+	Records uint64
+}
+
+// String restituisce una descrizione leggibile dello snapshot, utile nei log.
+func (i Info) String() string {
+	return fmt.Sprintf("versione %d (formato %d, creato il %s): %d email, %d breach",
+		i.Version, i.FormatVersion, i.Created.UTC().Format(time.RFC3339), i.Records, i.Breaches)
+}
+
+// HashEmail calcola la chiave con cui un'email viene cercata nello snapshot.
+// L'email deve essere già nella forma in cui è memorizzata nel database.
+func HashEmail(email string) [HashSize]byte {
+	sum := sha256.Sum256([]byte(email))
+	var h [HashSize]byte
+	copy(h[:], sum[:HashSize])
+	return h
+}
+
+// header è l'intestazione a dimensione fissa all'inizio del file.
+type header struct {
+	formatVersion uint32
+	hashSize      uint32
+	version       uint64
+	created       int64
+	breachCount   uint32
+	bitsetBytes   uint32
+	recordCount   uint64
+	recordsOffset uint64
+	checksum      uint32
+}
+
+// marshal codifica l'intestazione nei suoi 64 byte.
+func (h header) marshal() []byte {
+	buf := make([]byte, headerSize)
+	copy(buf[0:8], magic[:])
+	binary.LittleEndian.PutUint32(buf[8:], h.formatVersion)
+	binary.LittleEndian.PutUint32(buf[12:], h.hashSize)
+	binary.LittleEndian.PutUint64(buf[16:], h.version)
+	binary.LittleEndian.PutUint64(buf[24:], uint64(h.created))
+	binary.LittleEndian.PutUint32(buf[32:], h.breachCount)
+	binary.LittleEndian.PutUint32(buf[36:], h.bitsetBytes)
+	binary.LittleEndian.PutUint64(buf[40:], h.recordCount)
+	binary.LittleEndian.PutUint64(buf[48:], h.recordsOffset)
+	binary.LittleEndian.PutUint32(buf[56:], h.checksum)
+	return buf
+}
+
+// unmarshalHeader decodifica e valida l'intestazione.
+func unmarshalHeader(buf []byte) (header, error) {
+	if len(buf) < headerSize || [8]byte(buf[0:8]) != magic {
+		return header{}, ErrInvalidFormat
+	}
+
+	h := header{
+		formatVersion: binary.LittleEndian.Uint32(buf[8:]),
+		hashSize:      binary.LittleEndian.Uint32(buf[12:]),
+		version:       binary.LittleEndian.Uint64(buf[16:]),
+		created:       int64(binary.LittleEndian.Uint64(buf[24:])),
+		breachCount:   binary.LittleEndian.Uint32(buf[32:]),
+		bitsetBytes:   binary.LittleEndian.Uint32(buf[36:]),
+		recordCount:   binary.LittleEndian.Uint64(buf[40:]),
+		recordsOffset: binary.LittleEndian.Uint64(buf[48:]),
+		checksum:      binary.LittleEndian.Uint32(buf[56:]),
+	}
+
+	if h.formatVersion > FormatVersion {
+		return header{}, fmt.Errorf("%w: %d (massima supportata %d)", ErrUnsupportedVersion, h.formatVersion, FormatVersion)
+	}
+	if h.hashSize != HashSize || h.bitsetBytes != bitsetBytes(int(h.breachCount)) {
+		return header{}, ErrInvalidFormat
+	}
+	return h, nil
+}
+
+// bitsetBytes restituisce i byte necessari per un bitset di n breach.
+func bitsetBytes(n int) uint32 {
+	return uint32((n + 7) / 8)
+}
@@ -0,0 +1,19 @@
+//go:build unix
+
+package snapshot
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile mappa il file in memoria in sola lettura.
+// Il file non deve essere modificato sul posto finché la mappatura è attiva:
+// gli snapshot si sostituiscono solo rinominando un nuovo file al loro posto.
+func mapFile(file *os.File, size int) ([]byte, func() error, error) {
+	data, err := syscall.Mmap(int(file.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
@@ -0,0 +1,174 @@
+package snapshot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Snapshot è uno snapshot aperto in sola lettura e mappato in memoria.
+// È sicuro per l'uso concorrente finché non viene chiuso.
+type Snapshot struct {
+	info     Info
+	data     []byte
+	unmap    func() error
+	breaches []string
+	counts   []uint64
+
+	records    []byte
+	recordSize int
+	bitsetSize int
+}
+
+// Open apre lo snapshot in path, ne verifica intestazione e checksum e lo mappa in memoria.
+func Open(path string) (*Snapshot, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	// La mappatura resta valida anche dopo la chiusura del file
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if stat.Size() < headerSize {
+		return nil, fmt.Errorf("%w: file troppo corto", ErrInvalidFormat)
+	}
+	if stat.Size() > math.MaxInt {
+		return nil, fmt.Errorf("snapshot: file troppo grande per questa piattaforma")
+	}
+
+	data, unmap, err := mapFile(file, int(stat.Size()))
+	if err != nil {
+		return nil, fmt.Errorf("snapshot: impossibile mappare %s: %w", path, err)
+	}
+
+	s, err := parse(data)
+	if err != nil {
+		unmap()
+		return nil, err
+	}
+	s.unmap = unmap
+	return s, nil
+}
+
+// parse valida il contenuto del file e ne estrae tabella dei breach e record.
+func parse(data []byte) (*Snapshot, error) {
+	h, err := unmarshalHeader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if crc32.Checksum(data[headerSize:], crcTable) != h.checksum {
+		return nil, fmt.Errorf("%w: checksum non corrispondente (file danneggiato o incompleto)", ErrInvalidFormat)
+	}
+
+	s := &Snapshot{
+		info: Info{
+			FormatVersion: h.formatVersion,
+			Version:       h.version,
+			Created:       time.Unix(h.created, 0),
+			Breaches:      int(h.breachCount),
+			Records:       h.recordCount,
+		},
+		data:       data,
+		breaches:   make([]string, 0, h.breachCount),
+		counts:     make([]uint64, 0, h.breachCount),
+		bitsetSize: int(h.bitsetBytes),
+		recordSize: HashSize + int(h.bitsetBytes),
+	}
+
+	// Tabella dei breach
+	offset := uint64(headerSize)
+	for range h.breachCount {
+		if offset+2 > uint64(len(data)) {
+			return nil, fmt.Errorf("%w: tabella dei breach troncata", ErrInvalidFormat)
+		}
+		n := uint64(binary.LittleEndian.Uint16(data[offset:]))
+		offset += 2
+		if offset+n+8 > uint64(len(data)) {
+			return nil, fmt.Errorf("%w: tabella dei breach troncata", ErrInvalidFormat)
+		}
+		// string() copia il nome: resta valido anche dopo la chiusura dello snapshot
+		s.breaches = append(s.breaches, string(data[offset:offset+n]))
+		s.counts = append(s.counts, binary.LittleEndian.Uint64(data[offset+n:]))
+		offset += n + 8
+	}
+
+	// Record
+	size := h.recordCount * uint64(s.recordSize)
+	if h.recordsOffset < offset || h.recordsOffset+size != uint64(len(data)) {
+		return nil, fmt.Errorf("%w: dimensione dei record non corrispondente", ErrInvalidFormat)
+	}
+	s.records = data[h.recordsOffset:]
+
+	return s, nil
+}
+
+// Info restituisce la descrizione dello snapshot.
+func (s *Snapshot) Info() Info {
+	return s.info
+}
+
+// Breaches restituisce i nomi dei breach in ordine alfabetico.
+func (s *Snapshot) Breaches() []string {
+	return slices.Clone(s.breaches)
+}
+
+// BreachCounts restituisce il numero di email di ogni breach, indicizzato per nome.
+func (s *Snapshot) BreachCounts() map[string]uint64 {
+	counts := make(map[string]uint64, len(s.breaches))
+	for i, name := range s.breaches {
+		counts[name] = s.counts[i]
+	}
+	return counts
+}
+
+// Lookup cerca un'email con una ricerca binaria sugli hash ordinati.
+// Restituisce nil se l'email non è presente, altrimenti i breach in ordine alfabetico.
+func (s *Snapshot) Lookup(email string) []string {
+	hash := HashEmail(email)
+	n := int(s.info.Records)
+
+	i := sort.Search(n, func(i int) bool {
+		return bytes.Compare(s.record(i)[:HashSize], hash[:]) >= 0
+	})
+	if i == n || !bytes.Equal(s.record(i)[:HashSize], hash[:]) {
+		return nil
+	}
+
+	var breaches []string
+	bitset := s.record(i)[HashSize:]
+	for id := range s.breaches {
+		if bitset[id/8]&(1<<(id%8)) != 0 {
+			breaches = append(breaches, s.breaches[id])
+		}
+	}
+	return breaches
+}
+
+// record restituisce l'i-esimo record (hash + bitset).
+func (s *Snapshot) record(i int) []byte {
+	start := i * s.recordSize
+	return s.records[start : start+s.recordSize]
+}
+
+// Close rilascia la mappatura in memoria. Lo snapshot non va più usato dopo la chiusura.
+func (s *Snapshot) Close() error {
+	if s.unmap == nil {
+		return nil
+	}
+	err := s.unmap()
+	s.unmap = nil
+	s.data = nil
+	s.records = nil
+	return err
+}
@@ -0,0 +1,156 @@
+package snapshot
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// write crea uno snapshot in dir con le email indicate, aggiunte nell'ordine dato.
+func write(t *testing.T, dir string, chunkRecords int, emails [][2]string) string {
+	t.Helper()
+	w, err := NewWriter(dir, chunkRecords)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	defer w.Close()
+	for _, e := range emails {
+		if err := w.Add(e[0], []string{e[1]}); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	path := filepath.Join(dir, "test.snapshot")
+	if _, err := w.Commit(path, 7); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	return path
+}
+
+func TestEmptySnapshot(t *testing.T) {
+	path := write(t, t.TempDir(), 0, nil)
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close()
+
+	info := s.Info()
+	if info.Records != 0 || info.Breaches != 0 || info.Version != 7 || info.FormatVersion != FormatVersion {
+		t.Errorf("Info = %+v, attesi 0 email, 0 breach, versione 7", info)
+	}
+	if got := s.Lookup("alice@example.com"); got != nil {
+		t.Errorf("Lookup su snapshot vuoto = %v, atteso nil", got)
+	}
+	if got := s.Breaches(); len(got) != 0 {
+		t.Errorf("Breaches = %v, atteso vuoto", got)
+	}
+}
+
+// Con blocchi di due email la stessa email finisce in blocchi diversi: il merge la unisce in un record.
+func TestMergeRuns(t *testing.T) {
+	var emails [][2]string
+	for i := range 10 {
+		emails = append(emails, [2]string{fmt.Sprintf("user%d@example.com", i), "Zeta"})
+	}
+	emails = append(emails,
+		[2]string{"user3@example.com", "Alpha"},
+		[2]string{"user7@example.com", "Beta"},
+		[2]string{"user3@example.com", "Beta"},
+		[2]string{"user3@example.com", "Alpha"},
+	)
+	path := write(t, t.TempDir(), 2, emails)
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close()
+
+	if info := s.Info(); info.Records != 10 || info.Breaches != 3 {
+		t.Errorf("Info = %+v, attese 10 email e 3 breach", info)
+	}
+	if got, want := s.Breaches(), []string{"Alpha", "Beta", "Zeta"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Breaches = %v, attesi %v", got, want)
+	}
+	if got, want := s.BreachCounts(), map[string]uint64{"Alpha": 1, "Beta": 2, "Zeta": 10}; !reflect.DeepEqual(got, want) {
+		t.Errorf("BreachCounts = %v, attesi %v", got, want)
+	}
+	for email, want := range map[string][]string{
+		"user3@example.com": {"Alpha", "Beta", "Zeta"},
+		"user7@example.com": {"Beta", "Zeta"},
+		"user0@example.com": {"Zeta"},
+		"user9@example.com": {"Zeta"},
+		"other@example.com": nil,
+	} {
+		if got := s.Lookup(email); !reflect.DeepEqual(got, want) {
+			t.Errorf("Lookup(%s) = %v, attesi %v", email, got, want)
+		}
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	dir := t.TempDir()
+	valid, err := os.ReadFile(write(t, dir, 0, [][2]string{{"alice@example.com", "Adobe"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		modify func(data []byte) []byte
+		want   error
+	}{
+		{
+			name: "checksum non corrispondente",
+			modify: func(data []byte) []byte {
+				data[len(data)-1] ^= 0xFF
+				return data
+			},
+			want: ErrInvalidFormat,
+		},
+		{
+			name: "versione del formato più recente",
+			modify: func(data []byte) []byte {
+				binary.LittleEndian.PutUint32(data[8:], FormatVersion+1)
+				return data
+			},
+			want: ErrUnsupportedVersion,
+		},
+		{
+			name: "magic errato",
+			modify: func(data []byte) []byte {
+				data[0] = 'X'
+				return data
+			},
+			want: ErrInvalidFormat,
+		},
+		{
+			name:   "file troncato",
+			modify: func(data []byte) []byte { return data[:len(data)-1] },
+			want:   ErrInvalidFormat,
+		},
+		{
+			name:   "file più corto dell'intestazione",
+			modify: func(data []byte) []byte { return data[:headerSize-1] },
+			want:   ErrInvalidFormat,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, "invalid.snapshot")
+			if err := os.WriteFile(path, tc.modify(append([]byte(nil), valid...)), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			s, err := Open(path)
+			if err == nil {
+				s.Close()
+			}
+			if !errors.Is(err, tc.want) {
+				t.Errorf("Open: errore %v, atteso %v", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,409 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+)
+
+// DefaultChunkRecords è il numero di email tenute in memoria prima di scrivere un blocco ordinato su disco.
+const DefaultChunkRecords = 1_000_000
+
+// Writer costruisce uno snapshot a partire da un insieme di email di dimensione arbitraria.
+//
+// Le email vengono accumulate in blocchi ordinati scritti in una directory temporanea
+// (ordinamento esterno), così la memoria usata dipende da chunkRecords e non dalla dimensione del corpus.
+// Commit unisce i blocchi e scrive il file finale in modo atomico.
+type Writer struct {
+	tempDir      string
+	chunkRecords int
+
+	breachIDs   map[string]uint32 // ID provvisori, in ordine di prima apparizione
+	breachNames []string
+
+	chunk []entry
+	runs  []string
+}
+
+// entry è un'email in attesa di essere scritta: hash e ID provvisori dei breach.
+type entry struct {
+	hash [HashSize]byte
+	ids  []uint32
+}
+
+// NewWriter crea un Writer che usa una sottodirectory temporanea di tempDir
+// (la directory di sistema se vuota). chunkRecords <= 0 usa DefaultChunkRecords.
+func NewWriter(tempDir string, chunkRecords int) (*Writer, error) {
+	dir, err := os.MkdirTemp(tempDir, "pwnsnapshot-*")
+	if err != nil {
+		return nil, fmt.Errorf("snapshot: impossibile creare la directory temporanea: %w", err)
+	}
+	if chunkRecords <= 0 {
+		chunkRecords = DefaultChunkRecords
+	}
+	return &Writer{
+		tempDir:      dir,
+		chunkRecords: chunkRecords,
+		breachIDs:    make(map[string]uint32),
+	}, nil
+}
+
+// Add aggiunge un'email con i breach in cui compare.
+// La stessa email può essere aggiunta più volte: i breach vengono uniti.
+func (w *Writer) Add(email string, breaches []string) error {
+	if len(breaches) == 0 {
+		return nil
+	}
+	if len(breaches) > math.MaxUint16 {
+		return fmt.Errorf("snapshot: troppi breach per una sola email (%d)", len(breaches))
+	}
+
+	e := entry{hash: HashEmail(email), ids: make([]uint32, 0, len(breaches))}
+	for _, breach := range breaches {
+		if len(breach) > math.MaxUint16 {
+			return fmt.Errorf("snapshot: nome del breach troppo lungo (%d byte)", len(breach))
+		}
+		id, found := w.breachIDs[breach]
+		if !found {
+			id = uint32(len(w.breachNames))
+			w.breachIDs[breach] = id
+			w.breachNames = append(w.breachNames, breach)
+		}
+		e.ids = append(e.ids, id)
+	}
+
+	w.chunk = append(w.chunk, e)
+	if len(w.chunk) >= w.chunkRecords {
+		return w.flush()
+	}
+	return nil
+}
+
+// flush ordina il blocco corrente per hash e lo scrive in un file temporaneo.
+func (w *Writer) flush() error {
+	if len(w.chunk) == 0 {
+		return nil
+	}
+
+	sort.Slice(w.chunk, func(i, j int) bool {
+		return bytes.Compare(w.chunk[i].hash[:], w.chunk[j].hash[:]) < 0
+	})
+
+	file, err := os.Create(filepath.Join(w.tempDir, fmt.Sprintf("run-%06d", len(w.runs))))
+	if err != nil {
+		return fmt.Errorf("snapshot: impossibile creare il blocco temporaneo: %w", err)
+	}
+	defer file.Close()
+
+	out := bufio.NewWriter(file)
+	for _, e := range w.chunk {
+		if err := writeRunEntry(out, e); err != nil {
+			return err
+		}
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	w.runs = append(w.runs, file.Name())
+	w.chunk = w.chunk[:0]
+	return nil
+}
+
+// Commit scrive lo snapshot in path con la versione indicata.
+// Il file viene prima scritto accanto a path e poi rinominato, così chi lo legge
+// (anche un nodo che lo ricarica a caldo) non vede mai un file incompleto.
+func (w *Writer) Commit(path string, version uint64) (Info, error) {
+	if err := w.flush(); err != nil {
+		return Info{}, err
+	}
+
+	// Gli ID definitivi sono la posizione del breach in ordine alfabetico
+	names := slices.Clone(w.breachNames)
+	sort.Strings(names)
+	finalIDs := make([]uint32, len(w.breachNames))
+	for final, name := range names {
+		finalIDs[w.breachIDs[name]] = uint32(final)
+	}
+	counts := make([]uint64, len(names))
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".snapshot-*.tmp")
+	if err != nil {
+		return Info{}, fmt.Errorf("snapshot: impossibile creare il file: %w", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	// Le email vengono scritte in un file separato mentre si contano i breach,
+	// perché la tabella dei breach (con i conteggi) precede i record.
+	records, err := os.CreateTemp(w.tempDir, "records-*")
+	if err != nil {
+		return Info{}, err
+	}
+	defer records.Close()
+
+	h := header{
+		formatVersion: FormatVersion,
+		hashSize:      HashSize,
+		version:       version,
+		created:       time.Now().Unix(),
+		breachCount:   uint32(len(names)),
+		bitsetBytes:   bitsetBytes(len(names)),
+	}
+
+	h.recordCount, err = w.merge(records, finalIDs, counts, int(h.bitsetBytes))
+	if err != nil {
+		return Info{}, err
+	}
+
+	// Placeholder per l'intestazione, riscritta alla fine con il checksum
+	if _, err := tmp.Write(make([]byte, headerSize)); err != nil {
+		return Info{}, err
+	}
+
+	crc := crc32.New(crcTable)
+	body := bufio.NewWriter(io.MultiWriter(tmp, crc))
+	offset, err := writeBreachTable(body, names, counts)
+	if err != nil {
+		return Info{}, err
+	}
+	h.recordsOffset = headerSize + offset
+
+	if _, err := records.Seek(0, io.SeekStart); err != nil {
+		return Info{}, err
+	}
+	if _, err := io.Copy(body, records); err != nil {
+		return Info{}, err
+	}
+	if err := body.Flush(); err != nil {
+		return Info{}, err
+	}
+
+	h.checksum = crc.Sum32()
+	if _, err := tmp.WriteAt(h.marshal(), 0); err != nil {
+		return Info{}, err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		return Info{}, err
+	}
+	if err := tmp.Sync(); err != nil {
+		return Info{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return Info{}, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return Info{}, fmt.Errorf("snapshot: impossibile sostituire %s: %w", path, err)
+	}
+	committed = true
+
+	return Info{
+		FormatVersion: h.formatVersion,
+		Version:       h.version,
+		Created:       time.Unix(h.created, 0),
+		Breaches:      len(names),
+		Records:       h.recordCount,
+	}, nil
+}
+
+// Close elimina i file temporanei. Va chiamata anche dopo Commit.
+func (w *Writer) Close() error {
+	return os.RemoveAll(w.tempDir)
+}
+
+// writeBreachTable scrive la tabella dei breach e il padding fino all'allineamento a 8 byte.
+// Restituisce il numero di byte scritti.
+func writeBreachTable(out io.Writer, names []string, counts []uint64) (uint64, error) {
+	var written uint64
+	buf := make([]byte, 0, 64)
+	for i, name := range names {
+		buf = binary.LittleEndian.AppendUint16(buf[:0], uint16(len(name)))
+		buf = append(buf, name...)
+		buf = binary.LittleEndian.AppendUint64(buf, counts[i])
+		if _, err := out.Write(buf); err != nil {
+			return 0, err
+		}
+		written += uint64(len(buf))
+	}
+
+	if pad := (8 - written%8) % 8; pad > 0 {
+		if _, err := out.Write(make([]byte, pad)); err != nil {
+			return 0, err
+		}
+		written += pad
+	}
+	return written, nil
+}
+
+// merge unisce i blocchi ordinati scrivendo un record per hash, con il bitset degli ID definitivi.
+// Gli hash ripetuti (la stessa email in più blocchi) vengono uniti in un solo record.
+func (w *Writer) merge(out io.Writer, finalIDs []uint32, counts []uint64, bitsetSize int) (uint64, error) {
+	readers := make([]*runReader, 0, len(w.runs))
+	for _, path := range w.runs {
+		r, err := openRun(path)
+		if err != nil {
+			return 0, err
+		}
+		defer r.close()
+		readers = append(readers, r)
+	}
+
+	queue := &runQueue{}
+	for _, r := range readers {
+		ok, err := r.next()
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			queue.items = append(queue.items, r)
+		}
+	}
+	heap.Init(queue)
+
+	buffered := bufio.NewWriter(out)
+	var (
+		records uint64
+		current [HashSize]byte
+		bitset  = make([]byte, bitsetSize)
+		pending bool
+	)
+
+	emit := func() error {
+		for id := range bitsetSize * 8 {
+			if bitset[id/8]&(1<<(id%8)) != 0 {
+				counts[id]++
+			}
+		}
+		if _, err := buffered.Write(current[:]); err != nil {
+			return err
+		}
+		if _, err := buffered.Write(bitset); err != nil {
+			return err
+		}
+		records++
+		clear(bitset)
+		return nil
+	}
+
+	for queue.Len() > 0 {
+		r := queue.items[0]
+		if pending && r.entry.hash != current {
+			if err := emit(); err != nil {
+				return 0, err
+			}
+		}
+		current = r.entry.hash
+		pending = true
+		for _, id := range r.entry.ids {
+			final := finalIDs[id]
+			bitset[final/8] |= 1 << (final % 8)
+		}
+
+		ok, err := r.next()
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			heap.Fix(queue, 0)
+		} else {
+			heap.Pop(queue)
+		}
+	}
+	if pending {
+		if err := emit(); err != nil {
+			return 0, err
+		}
+	}
+
+	return records, buffered.Flush()
+}
+
+// writeRunEntry scrive un'email in un blocco temporaneo: hash, numero di ID (uint16), ID (uint32).
+func writeRunEntry(out io.Writer, e entry) error {
+	buf := make([]byte, 0, HashSize+2+4*len(e.ids))
+	buf = append(buf, e.hash[:]...)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(e.ids)))
+	for _, id := range e.ids {
+		buf = binary.LittleEndian.AppendUint32(buf, id)
+	}
+	_, err := out.Write(buf)
+	return err
+}
+
+// runReader legge in sequenza un blocco temporaneo.
+type runReader struct {
+	file  *os.File
+	in    *bufio.Reader
+	entry entry
+}
+
+func openRun(path string) (*runReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &runReader{file: file, in: bufio.NewReader(file)}, nil
+}
+
+// next legge l'email successiva; restituisce false a fine blocco.
+func (r *runReader) next() (bool, error) {
+	var head [HashSize + 2]byte
+	if _, err := io.ReadFull(r.in, head[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		return false, err
+	}
+	copy(r.entry.hash[:], head[:HashSize])
+
+	n := int(binary.LittleEndian.Uint16(head[HashSize:]))
+	ids := make([]byte, 4*n)
+	if _, err := io.ReadFull(r.in, ids); err != nil {
+		return false, err
+	}
+	r.entry.ids = r.entry.ids[:0]
+	for i := range n {
+		r.entry.ids = append(r.entry.ids, binary.LittleEndian.Uint32(ids[4*i:]))
+	}
+	return true, nil
+}
+
+func (r *runReader) close() error {
+	return r.file.Close()
+}
+
+// runQueue è un min-heap dei blocchi ordinato per l'hash corrente.
+type runQueue struct {
+	items []*runReader
+}
+
+func (q *runQueue) Len() int { return len(q.items) }
+func (q *runQueue) Less(i, j int) bool {
+	return bytes.Compare(q.items[i].entry.hash[:], q.items[j].entry.hash[:]) < 0
+}
+func (q *runQueue) Swap(i, j int) { q.items[i], q.items[j] = q.items[j], q.items[i] }
+func (q *runQueue) Push(x any)    { q.items = append(q.items, x.(*runReader)) }
+func (q *runQueue) Pop() any {
+	last := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+	return last
+}
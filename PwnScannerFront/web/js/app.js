@@ -7,6 +7,31 @@ document.addEventListener('DOMContentLoaded', () => {
     const heroSection = document.querySelector('.hero-section');
     const resultsSection = document.querySelector('.results-section');
 
+    const genericImage = '/media/img/generic.png'; // Immagine generica per breach senza logo
+
+    // Metadati dei breach (titolo, logo, data) letti dal catalogo del server;
+    // l'elenco viene riletto solo se un risultato contiene un breach non ancora noto
+    let breachCatalog = null;
+    const loadBreachCatalog = async (names) => {
+        if (breachCatalog && names.every(name => name in breachCatalog)) {
+            return breachCatalog;
+        }
+        try {
+            // L'interfaccia web usa i permessi anonimi (auth.anonymous_scopes): nessuna chiave API nel browser
+            const response = await fetch('/breaches');
+            if (!response.ok) {
+                return {};
+            }
+            const breaches = await response.json();
+            breachCatalog = Object.fromEntries(breaches.map(breach => [breach.name, breach]));
+        } catch (error) {
+            // Senza catalogo i breach vengono mostrati con il solo nome
+            console.error("Errore durante il caricamento dei breach:", error);
+            return {};
+        }
+        return breachCatalog;
+    };
+
     emailForm.addEventListener('submit', async (event) => {
         event.preventDefault(); // Previene il ricaricamento della pagina
 
@@ -25,84 +50,35 @@ document.addEventListener('DOMContentLoaded', () => {
             <p class="text-center animate__animated animate__fadeIn">Stiamo cercando nei database...</p>
         `;
 
-        const breachImages = {
-            'Facebook': '/media/img/facebook.png',
-            'LinkedIn': '/media/img/linkedin.png',
-            'Twitter': '/media/img/twitter.png',
-            'Adobe': '/media/img/adobe.png',
-            'VK': '/media/img/vk.png',
-            'Tumblr': '/media/img/tumblr.png',
-            'Badoo': '/media/img/badoo.png',
-            'Last.fm': '/media/img/lastfm.png',
-            'Zynga': '/media/img/zynga.png',
-            'Canva': '/media/img/canva.png',
-            '500px': '/media/img/500px.png',
-            'Disqus': '/media/img/disqus.png',
-            'LiveJournal': '/media/img/livejournal.png',
-            'MySpace': '/media/img/myspace.png',
-            'Patreon': '/media/img/patreon.png',
-            'Wattpad': '/media/img/wattpad.png',
-            'Instagram': '/media/img/instagram.png',
-            'Dropbox': '/media/img/dropbox.png',
-            'Yahoo': '/media/img/yahoo.png',
-            'Apple': '/media/img/apple.png',
-            'Amazon': '/media/img/amazon.png',
-            'Netflix': '/media/img/netflix.png',
-            'Spotify': '/media/img/spotify.png',
-            'Google': '/media/img/google.png',
-            'PayPal': '/media/img/paypal.png',
-            'eBay': '/media/img/ebay.png',
-            'Uber': '/media/img/uber.png',
-            'Airbnb': '/media/img/airbnb.png',
-            'TikTok': '/media/img/tiktok.png',
-            'Pinterest': '/media/img/pinterest.png',
-            'Snapchat': '/media/img/snapchat.png',
-            'Reddit': '/media/img/reddit.png',
-            'Twitch': '/media/img/twitch.png',
-            'GitHub': '/media/img/github.png',
-            'Steam': '/media/img/steam.png',
-            'Epic Games': '/media/img/epicgames.png',
-            'HBO': '/media/img/hbo.png',
-            'Slack': '/media/img/slack.png',
-            'Microsoft': '/media/img/microsoft.png',
-            'Nintendo': '/media/img/nintendo.png',
-            'Tinder': '/media/img/tinder.png',
-            'Vodafone': '/media/img/vodafone.png',
-            'YouTube': '/media/img/youtube.png',
-            'Xbox': '/media/img/xbox.png',
-            'PlayStation': '/media/img/playstation.png',
-            'WhatsApp': '/media/img/whatsapp.png',
-            'Telegram': '/media/img/telegram.png',
-            'Discord': '/media/img/discord.png',
-            'Generic': '/media/img/generic.png' // Immagine generica per breach non specifici
-        };
-
-
         try {
             // Chiamata API
             const response = await fetch('/check-email', {
                 method: 'POST',
                 headers: {
-                    'Content-Type': 'application/json',
-                    'Authorization': 'Bearer YOUR_SECRET_TOKEN'
+                    'Content-Type': 'application/json'
                 },
                 body: JSON.stringify({ email: emailValue })
             });
 
             if (response.ok) {
                 const data = await response.json();
+                const catalog = await loadBreachCatalog(data.breaches || []);
 
                 if (data.breaches && data.breaches.length > 0) {
                     resultsDiv.innerHTML = `
                     <div class="custom-alert animate__animated animate__fadeIn">
                         <strong>Email trovata nei seguenti breach:</strong>
                         <ul class="list-group mt-3">
-                            ${data.breaches.map(breach => `
+                            ${data.breaches.map(name => {
+                                const breach = catalog[name] || { title: name };
+                                return `
                                 <li class="list-group-item d-flex align-items-center">
-                                    <img src="${breachImages[breach] || breachImages['Generic']}" alt="${breach}" class="me-3" style="width: 24px; height: 24px;">
-                                    <span>${breach}</span>
+                                    <img src="${breach.logo_path || genericImage}" alt="${name}" class="me-3" style="width: 24px; height: 24px;">
+                                    <span>${breach.title || name}</span>
+                                    ${breach.breach_date ? `<small class="ms-auto text-muted">${breach.breach_date}</small>` : ''}
                                 </li>
-                            `).join('')}
+                            `;
+                            }).join('')}
                         </ul>
                     </div>`;
                 } else {
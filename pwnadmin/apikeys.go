@@ -0,0 +1,403 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"pwnscanner/pkg/auth"
+	"pwnscanner/pkg/database"
+	"pwnscanner/pkg/normalize"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// apiKeysPageData sono i dati passati al template apikeys.html.
+type apiKeysPageData struct {
+	Keys   []apiKeyRow
+	Scopes []auth.Scope
+	// NewKey è la chiave appena creata, mostrata una sola volta
+	NewKey string
+	Error  string
+}
+
+// apiKeyRow è una riga dell'elenco delle chiavi.
+type apiKeyRow struct {
+	database.APIKey
+	Status string
+}
+
+// apiKeyStatus descrive lo stato della chiave all'istante now.
+func apiKeyStatus(key database.APIKey, now time.Time) string {
+	switch {
+	case !key.RevokedAt.IsZero():
+		return "revocata"
+	case !key.ExpiresAt.IsZero() && !now.Before(key.ExpiresAt):
+		return "scaduta"
+	default:
+		return "attiva"
+	}
+}
+
+// apiKeyWriter restituisce la gestione delle chiavi API del database, se supportata.
+func apiKeyWriter(db database.Writer) (database.APIKeyWriter, bool) {
+	keys, ok := db.(database.APIKeyWriter)
+	return keys, ok
+}
+
+// parseDomains interpreta un elenco di domini separati da virgole, convertendoli in forma canonica
+// e ignorando spazi e duplicati.
+func parseDomains(value string) ([]string, error) {
+	var domains []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		domain, err := normalize.Domain(item)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(domains, domain) {
+			domains = append(domains, domain)
+		}
+	}
+	return domains, nil
+}
+
+// createAPIKey genera e salva una chiave, restituendola in chiaro.
+// expires è una data AAAA-MM-GG (la chiave scade all'inizio del giorno, UTC) oppure vuoto;
+// tier è il profilo di rate limiting, che deve esistere nella configurazione di PwnScannerFront (vuoto = "default");
+// domains sono i domini, separati da virgole, di cui il proprietario ha dimostrato il possesso.
+func createAPIKey(ctx context.Context, keys database.APIKeyWriter, owner, scopes, expires, tier, domains string, maxBatch int) (string, error) {
+	parsedScopes, err := auth.ParseScopes(scopes)
+	if err != nil {
+		return "", err
+	}
+	parsedDomains, err := parseDomains(domains)
+	if err != nil {
+		return "", err
+	}
+	if len(parsedDomains) > 0 && !slices.Contains(parsedScopes, auth.ScopeDomainSearch) {
+		return "", fmt.Errorf("i domini sono consultabili solo con il permesso %s", auth.ScopeDomainSearch)
+	}
+	var expiresAt time.Time
+	if expires != "" {
+		expiresAt, err = time.Parse(database.BreachDateLayout, expires)
+		if err != nil {
+			return "", fmt.Errorf("data di scadenza non valida %q (formato AAAA-MM-GG)", expires)
+		}
+	}
+
+	plaintext, key, err := auth.NewKey(owner, parsedScopes, maxBatch, expiresAt)
+	if err != nil {
+		return "", err
+	}
+	key.Tier = strings.TrimSpace(tier)
+	key.Domains = parsedDomains
+	if err := keys.CreateAPIKey(ctx, key); err != nil {
+		return "", err
+	}
+	log.Printf("Chiave API %s creata per %s (permessi: %s)", key.ID, key.Owner, strings.Join(key.Scopes, ", "))
+	if len(key.Domains) > 0 {
+		log.Printf("Domini assegnati alla chiave API %s: %s", key.ID, strings.Join(key.Domains, ", "))
+	}
+	return plaintext, nil
+}
+
+// updateAPIKeyDomains aggiunge alla chiave i domini di grant e le toglie quelli di revoke, entrambi
+// separati da virgole, e restituisce i domini risultanti. Aggiungere domini richiede il permesso
+// domain_search; la modifica vale per PwnScannerFront alla scadenza della cache di autenticazione.
+func updateAPIKeyDomains(ctx context.Context, keys database.APIKeyWriter, id, grant, revoke string) ([]string, error) {
+	granted, err := parseDomains(grant)
+	if err != nil {
+		return nil, err
+	}
+	revoked, err := parseDomains(revoke)
+	if err != nil {
+		return nil, err
+	}
+	if len(granted) == 0 && len(revoked) == 0 {
+		return nil, fmt.Errorf("nessun dominio da aggiungere o togliere")
+	}
+	key, err := keys.GetAPIKey(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, database.ErrAPIKeyNotFound
+	}
+	if len(granted) > 0 && !slices.Contains(key.Scopes, string(auth.ScopeDomainSearch)) {
+		return nil, fmt.Errorf("i domini sono consultabili solo con il permesso %s", auth.ScopeDomainSearch)
+	}
+
+	domains := slices.Clone(key.Domains)
+	for _, domain := range granted {
+		if !slices.Contains(domains, domain) {
+			domains = append(domains, domain)
+		}
+	}
+	domains = slices.DeleteFunc(domains, func(domain string) bool {
+		return slices.Contains(revoked, domain)
+	})
+	if err := keys.SetAPIKeyDomains(ctx, id, domains); err != nil {
+		return nil, err
+	}
+	if len(domains) > 0 {
+		log.Printf("Domini assegnati alla chiave API %s: %s", id, strings.Join(domains, ", "))
+	} else {
+		log.Printf("Nessun dominio assegnato alla chiave API %s", id)
+	}
+	return domains, nil
+}
+
+// Handler per la pagina delle chiavi API: elenco e creazione
+func apiKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys, ok := apiKeyWriter(writer)
+	if !ok {
+		http.Error(w, "Il database configurato non supporta le chiavi API", http.StatusNotImplemented)
+		return
+	}
+	ctx := context.Background()
+
+	data := apiKeysPageData{Scopes: auth.Scopes}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		r.ParseForm()
+		maxBatch := 0
+		var err error
+		if value := strings.TrimSpace(r.FormValue("maxBatch")); value != "" {
+			maxBatch, err = strconv.Atoi(value)
+			if err != nil {
+				err = fmt.Errorf("limite di email per richiesta non valido %q", value)
+			}
+		}
+		if err == nil {
+			data.NewKey, err = createAPIKey(ctx, keys, r.FormValue("owner"), strings.Join(r.Form["scopes"], ","), r.FormValue("expires"), r.FormValue("tier"), r.FormValue("domains"), maxBatch)
+		}
+		if err != nil {
+			log.Printf("Errore nella creazione della chiave API: %v", err)
+			data.Error = err.Error()
+		}
+	default:
+		http.Error(w, "Metodo non consentito", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, err := keys.ListAPIKeys(ctx)
+	if err != nil {
+		http.Error(w, "Errore nel recupero delle chiavi API", http.StatusInternalServerError)
+		log.Printf("Errore nel recupero delle chiavi API: %v", err)
+		return
+	}
+	now := time.Now()
+	for _, key := range list {
+		data.Keys = append(data.Keys, apiKeyRow{APIKey: key, Status: apiKeyStatus(key, now)})
+	}
+	renderTemplate(w, r, "apikeys", data)
+}
+
+// Handler per la revoca di una chiave API
+func revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Metodo non consentito", http.StatusMethodNotAllowed)
+		return
+	}
+	keys, ok := apiKeyWriter(writer)
+	if !ok {
+		http.Error(w, "Il database configurato non supporta le chiavi API", http.StatusNotImplemented)
+		return
+	}
+
+	id := r.FormValue("id")
+	if err := keys.RevokeAPIKey(context.Background(), id, time.Now().UTC()); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, database.ErrAPIKeyNotFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, "Errore nella revoca della chiave API", status)
+		log.Printf("Errore nella revoca della chiave API %s: %v", id, err)
+		return
+	}
+	log.Printf("Chiave API %s revocata", id)
+	http.Redirect(w, r, "/apikeys", http.StatusSeeOther)
+}
+
+// Handler per l'aggiunta o la rimozione di domini da una chiave API
+func apiKeyDomainsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Metodo non consentito", http.StatusMethodNotAllowed)
+		return
+	}
+	keys, ok := apiKeyWriter(writer)
+	if !ok {
+		http.Error(w, "Il database configurato non supporta le chiavi API", http.StatusNotImplemented)
+		return
+	}
+
+	id := r.FormValue("id")
+	var grant, revoke string
+	switch r.FormValue("action") {
+	case "grant":
+		grant = r.FormValue("domains")
+	case "revoke":
+		revoke = r.FormValue("domains")
+	default:
+		http.Error(w, "Azione non valida", http.StatusBadRequest)
+		return
+	}
+	if _, err := updateAPIKeyDomains(context.Background(), keys, id, grant, revoke); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, database.ErrAPIKeyNotFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, "Errore nella modifica dei domini della chiave API", status)
+		log.Printf("Errore nella modifica dei domini della chiave API %s: %v", id, err)
+		return
+	}
+	http.Redirect(w, r, "/apikeys", http.StatusSeeOther)
+}
+
+// createAPIKeyCommand crea una chiave API da riga di comando e la stampa su standard output.
+func createAPIKeyCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("create-api-key", flag.ExitOnError)
+	owner := flags.String("owner", "", "proprietario della chiave (obbligatorio)")
+	scopes := flags.String("scopes", string(auth.ScopeCheck), "permessi separati da virgole: check, batch, domain_search, admin")
+	expires := flags.String("expires", "", "data di scadenza AAAA-MM-GG (vuoto = nessuna scadenza)")
+	maxBatch := flags.Int("max-batch", 0, "email massime per richiesta a /check-emails (0 = limite della configurazione)")
+	tier := flags.String("tier", "", "profilo di rate limiting definito in rate_limit.tiers di PwnScannerFront (vuoto = default)")
+	domains := flags.String("domains", "", "domini separati da virgole consultabili con domain_search, dopo averne verificato il possesso")
+	flags.Parse(args)
+
+	if *owner == "" {
+		flags.Usage()
+		return fmt.Errorf("il parametro -owner è obbligatorio")
+	}
+
+	db, err := openWriter(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	keys, ok := apiKeyWriter(db)
+	if !ok {
+		return fmt.Errorf("il database configurato non supporta le chiavi API")
+	}
+	plaintext, err := createAPIKey(ctx, keys, *owner, *scopes, *expires, *tier, *domains, *maxBatch)
+	if err != nil {
+		return err
+	}
+	// Solo la chiave va su stdout, così uno script la cattura con $(...); l'avviso resta su stderr
+	fmt.Fprintln(os.Stderr, "Chiave API creata, mostrata una sola volta: conservala ora.")
+	fmt.Fprintln(os.Stdout, plaintext)
+	return nil
+}
+
+// listAPIKeysCommand stampa l'elenco delle chiavi API.
+func listAPIKeysCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("list-api-keys", flag.ExitOnError)
+	flags.Parse(args)
+
+	db, err := openWriter(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	keys, ok := apiKeyWriter(db)
+	if !ok {
+		return fmt.Errorf("il database configurato non supporta le chiavi API")
+	}
+	list, err := keys.ListAPIKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(out, "ID\tPROPRIETARIO\tPERMESSI\tPROFILO\tDOMINI\tMAX BATCH\tCREATA\tSCADENZA\tSTATO")
+	now := time.Now()
+	for _, key := range list {
+		expires := "-"
+		if !key.ExpiresAt.IsZero() {
+			expires = key.ExpiresAt.Format(database.BreachDateLayout)
+		}
+		tier := key.Tier
+		if tier == "" {
+			tier = "default"
+		}
+		domains := "-"
+		if len(key.Domains) > 0 {
+			domains = strings.Join(key.Domains, ",")
+		}
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n", key.ID, key.Owner, strings.Join(key.Scopes, ","), tier,
+			domains, key.MaxBatch, key.CreatedAt.Format(database.BreachDateLayout), expires, apiKeyStatus(key, now))
+	}
+	return out.Flush()
+}
+
+// revokeAPIKeyCommand revoca una chiave API da riga di comando.
+func revokeAPIKeyCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("revoke-api-key", flag.ExitOnError)
+	id := flags.String("id", "", "identificativo della chiave da revocare (obbligatorio)")
+	flags.Parse(args)
+
+	if *id == "" {
+		flags.Usage()
+		return fmt.Errorf("il parametro -id è obbligatorio")
+	}
+
+	db, err := openWriter(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	keys, ok := apiKeyWriter(db)
+	if !ok {
+		return fmt.Errorf("il database configurato non supporta le chiavi API")
+	}
+	if err := keys.RevokeAPIKey(ctx, *id, time.Now().UTC()); err != nil {
+		return err
+	}
+	log.Printf("Chiave API %s revocata", *id)
+	return nil
+}
+
+// apiKeyDomainsCommand aggiunge o toglie domini da una chiave API da riga di comando.
+func apiKeyDomainsCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("api-key-domains", flag.ExitOnError)
+	id := flags.String("id", "", "identificativo della chiave (obbligatorio)")
+	grant := flags.String("grant", "", "domini da aggiungere, separati da virgole (solo dopo averne verificato il possesso)")
+	revoke := flags.String("revoke", "", "domini da togliere, separati da virgole")
+	flags.Parse(args)
+
+	if *id == "" {
+		flags.Usage()
+		return fmt.Errorf("il parametro -id è obbligatorio")
+	}
+	if *grant == "" && *revoke == "" {
+		flags.Usage()
+		return fmt.Errorf("indicare almeno uno tra -grant e -revoke")
+	}
+
+	db, err := openWriter(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	keys, ok := apiKeyWriter(db)
+	if !ok {
+		return fmt.Errorf("il database configurato non supporta le chiavi API")
+	}
+	_, err = updateAPIKeyDomains(ctx, keys, *id, *grant, *revoke)
+	return err
+}
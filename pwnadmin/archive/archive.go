@@ -0,0 +1,333 @@
+// Package archive apre gli archivi e i file compressi caricati in pwnadmin (zip, tar, gzip, bzip2, xz,
+// anche annidati) e restituisce i file di testo che contengono, senza estrarli su disco.
+//
+// Il formato viene riconosciuto dai primi byte del contenuto, non dall'estensione. Contro le zip bomb
+// la lettura si interrompe quando i byte decompressi da tutti i livelli superano Limits.MaxRatio volte
+// i byte letti dall'input, così gli archivi annidati non moltiplicano il rapporto, e gli archivi non
+// possono essere annidati oltre Limits.MaxDepth livelli.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/ulikunitz/xz"
+)
+
+// sniffBytes è il numero di byte letti per riconoscere il formato; comprende l'intestazione tar (offset 257).
+const sniffBytes = 512
+
+// ratioSlack è il numero di byte decompressi sempre ammessi, prima di applicare Limits.MaxRatio:
+// i file molto piccoli e ripetitivi possono superare il rapporto senza essere un pericolo.
+const ratioSlack = 1 << 20
+
+var (
+	// ErrTooDeep indica un archivio annidato oltre Limits.MaxDepth livelli
+	ErrTooDeep = errors.New("troppi archivi annidati")
+	// ErrRatio indica un file che si decomprime oltre Limits.MaxRatio volte la sua dimensione: probabile zip bomb
+	ErrRatio = errors.New("rapporto di decompressione oltre il limite")
+)
+
+// Limits limita l'apertura degli archivi.
+type Limits struct {
+	// MaxDepth è il numero massimo di livelli di archivi e compressione (un .tar.gz ne usa due)
+	MaxDepth int
+	// MaxRatio è il rapporto massimo tra i byte decompressi da tutti i livelli e i byte letti dall'input
+	MaxRatio int64
+}
+
+// DefaultLimits sono i valori predefiniti di Limits.
+var DefaultLimits = Limits{MaxDepth: 4, MaxRatio: 200}
+
+// Validate verifica che i limiti permettano di aprire almeno un livello.
+func (l Limits) Validate() error {
+	if l.MaxDepth < 1 {
+		return fmt.Errorf("la profondità massima degli archivi deve essere almeno 1 (attuale: %d)", l.MaxDepth)
+	}
+	if l.MaxRatio < 1 {
+		return fmt.Errorf("il rapporto di decompressione massimo deve essere almeno 1 (attuale: %d)", l.MaxRatio)
+	}
+	return nil
+}
+
+// Entry è un file trovato da Walk.
+type Entry struct {
+	// Name è il percorso del file preceduto da quelli degli archivi che lo contengono,
+	// ad esempio "dump.zip/users.tar.gz/users.txt"
+	Name string
+	// Archived è false quando il file è l'input stesso, non compresso
+	Archived bool
+	// Size è la dimensione dichiarata dall'archivio, o -1 se non è nota
+	Size int64
+	// Skip è il motivo per cui il file non va importato (binario, cifrato), o vuoto
+	Skip string
+	// Reader legge il contenuto decompresso; non è valido dopo il ritorno della funzione di Walk
+	io.Reader
+}
+
+// Walk chiama fn per ogni file contenuto in r, che si chiama name, aprendo gli archivi e
+// decomprimendo i file compressi. Se r non è né un archivio né un file compresso, fn viene chiamata
+// una sola volta con r stesso. I file binari e quelli cifrati vengono passati a fn con Skip valorizzato.
+// Uno zip viene letto senza copie se r implementa SizedReaderAt.
+// Walk si interrompe al primo errore di fn, di decompressione o di superamento dei limiti,
+// oppure quando ctx viene annullato.
+func Walk(ctx context.Context, r io.Reader, name string, limits Limits, fn func(Entry) error) error {
+	if err := limits.Validate(); err != nil {
+		return err
+	}
+	w := &walker{ctx: ctx, limits: limits, fn: fn, input: r, read: &countingReader{r: r}}
+	return w.walk(w.read, name, 0, -1)
+}
+
+// walker contiene lo stato di Walk.
+type walker struct {
+	ctx    context.Context
+	limits Limits
+	fn     func(Entry) error
+	// input è l'input di Walk e read conta i byte letti da input
+	input io.Reader
+	read  *countingReader
+	// inputSize è la dimensione dell'input quando è uno zip letto direttamente con io.ReaderAt,
+	// senza passare da read
+	inputSize int64
+	// expanded è il numero di byte decompressi da tutti i livelli
+	expanded int64
+}
+
+// compressed restituisce il numero di byte dell'input letti fino a quel momento.
+func (w *walker) compressed() int64 {
+	return max(w.read.Count(), w.inputSize)
+}
+
+// format è un formato di archivio o di compressione.
+type format int
+
+const (
+	formatNone format = iota
+	formatGzip
+	formatBzip2
+	formatXz
+	formatZip
+	formatTar
+)
+
+// detect riconosce il formato dai primi byte del contenuto.
+func detect(head []byte) format {
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return formatGzip
+	case bytes.HasPrefix(head, []byte("BZh")) && len(head) > 3 && head[3] >= '1' && head[3] <= '9':
+		return formatBzip2
+	case bytes.HasPrefix(head, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+		return formatXz
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return formatZip
+	case len(head) >= 262 && bytes.Equal(head[257:262], []byte("ustar")):
+		return formatTar
+	}
+	return formatNone
+}
+
+// walk apre r, che si trova a depth livelli di archivi dall'input.
+func (w *walker) walk(r io.Reader, name string, depth int, size int64) error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	br := bufio.NewReaderSize(r, sniffBytes)
+	head, err := br.Peek(sniffBytes)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	kind := detect(head)
+	if kind == formatNone {
+		entry := Entry{Name: name, Archived: depth > 0, Size: size, Reader: br}
+		if !strings.HasPrefix(http.DetectContentType(head), "text/") {
+			entry.Skip = "file binario"
+		}
+		return w.fn(entry)
+	}
+	if depth == w.limits.MaxDepth {
+		return fmt.Errorf("%s: %w (massimo %d livelli)", name, ErrTooDeep, w.limits.MaxDepth)
+	}
+
+	switch kind {
+	case formatTar:
+		return w.walkTar(br, name, depth)
+	case formatZip:
+		return w.walkZip(br, name, depth)
+	}
+
+	var decompressed io.Reader
+	switch kind {
+	case formatGzip:
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		defer gz.Close()
+		decompressed = gz
+	case formatBzip2:
+		decompressed = bzip2.NewReader(br)
+	case formatXz:
+		xzr, err := xz.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		decompressed = xzr
+	}
+	inner := &ratioReader{r: decompressed, w: w, name: name}
+	return w.walk(inner, decompressedName(name), depth+1, -1)
+}
+
+// walkTar apre i file regolari di un archivio tar.
+func (w *walker) walkTar(r io.Reader, name string, depth int) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if header.Typeflag != tar.TypeReg || ignored(header.Name) {
+			continue
+		}
+		if err := w.walk(tr, name+"/"+header.Name, depth+1, header.Size); err != nil {
+			return err
+		}
+	}
+}
+
+// SizedReaderAt è un input che può essere letto in qualsiasi posizione, come io.SectionReader.
+type SizedReaderAt interface {
+	io.ReaderAt
+	Size() int64
+}
+
+// walkZip apre i file di un archivio zip. Lo zip si legge dall'indice in fondo al file, quindi serve
+// un io.ReaderAt: l'input di Walk viene letto direttamente se implementa SizedReaderAt, altrimenti
+// (ad esempio uno zip dentro un altro archivio) viene copiato in un file temporaneo. La copia passa
+// dai ratioReader dei livelli esterni, quindi non può superare il limite di rapporto.
+func (w *walker) walkZip(br *bufio.Reader, name string, depth int) error {
+	var source io.ReaderAt
+	var size int64
+	if sized, ok := w.input.(SizedReaderAt); ok && depth == 0 {
+		source, size = sized, sized.Size()
+		w.inputSize = size
+	} else {
+		temp, err := os.CreateTemp("", "pwnadmin-zip-*")
+		if err != nil {
+			return fmt.Errorf("%s: impossibile creare il file temporaneo: %w", name, err)
+		}
+		defer os.Remove(temp.Name())
+		defer temp.Close()
+		if size, err = io.Copy(temp, br); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		source = temp
+	}
+
+	zr, err := zip.NewReader(source, size)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || !f.Mode().IsRegular() || ignored(f.Name) {
+			continue
+		}
+		entryName := name + "/" + f.Name
+		// Bit 0 dei flag: contenuto cifrato, non supportato da archive/zip
+		if f.Flags&0x1 != 0 {
+			if err := w.fn(Entry{Name: entryName, Archived: true, Size: int64(f.UncompressedSize64), Skip: "file cifrato"}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := w.walkZipFile(f, entryName, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkZipFile apre un file di un archivio zip, applicando il limite di rapporto al suo contenuto decompresso.
+func (w *walker) walkZipFile(f *zip.File, name string, depth int) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	defer rc.Close()
+	inner := &ratioReader{r: rc, w: w, name: name}
+	return w.walk(inner, name, depth+1, int64(f.UncompressedSize64))
+}
+
+// ignored indica i file da non aprire: i metadati aggiunti dagli archiviatori di macOS.
+func ignored(name string) bool {
+	return strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), "._")
+}
+
+// decompressedName restituisce il nome del file compresso senza l'estensione della compressione,
+// se è riconosciuta.
+func decompressedName(name string) string {
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".gz", ".bz2", ".xz"} {
+		if strings.HasSuffix(lower, ext) {
+			return name[:len(name)-len(ext)]
+		}
+	}
+	for ext, replacement := range map[string]string{".tgz": ".tar", ".tbz2": ".tar", ".txz": ".tar"} {
+		if strings.HasSuffix(lower, ext) {
+			return name[:len(name)-len(ext)] + replacement
+		}
+	}
+	return name
+}
+
+// countingReader conta i byte letti.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Count restituisce il numero di byte letti.
+func (c *countingReader) Count() int64 {
+	return c.n
+}
+
+// ratioReader legge il contenuto decompresso di un livello e fallisce con ErrRatio quando i byte
+// decompressi da tutti i livelli superano Limits.MaxRatio volte i byte letti dall'input.
+type ratioReader struct {
+	r    io.Reader
+	w    *walker
+	name string
+}
+
+func (rr *ratioReader) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+	w := rr.w
+	w.expanded += int64(n)
+	if w.expanded > ratioSlack && w.expanded > w.limits.MaxRatio*w.compressed() {
+		return n, fmt.Errorf("%s: %w (%d byte decompressi da %d letti, massimo %d volte)", rr.name, ErrRatio, w.expanded, w.compressed(), w.limits.MaxRatio)
+	}
+	return n, err
+}
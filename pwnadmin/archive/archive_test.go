@@ -0,0 +1,115 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// gzipBytes comprime data con gzip.
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// comboLines restituisce n righe di combo list, poco ripetitive come un file reale.
+func comboLines(n int) []byte {
+	var buf bytes.Buffer
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&buf, "user%d@example.com:password%d\n", i, i*7919)
+	}
+	return buf.Bytes()
+}
+
+// walkAll esegue Walk e restituisce il contenuto dei file trovati, per nome.
+func walkAll(r io.Reader, name string, limits Limits) (map[string]string, error) {
+	files := make(map[string]string)
+	err := Walk(context.Background(), r, name, limits, func(entry Entry) error {
+		data, err := io.ReadAll(entry)
+		if err != nil {
+			return err
+		}
+		files[entry.Name] = string(data)
+		return nil
+	})
+	return files, err
+}
+
+func TestWalk(t *testing.T) {
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	for _, f := range []struct{ name, body string }{
+		{"dump/users.txt", "alice@example.com:password\n"},
+		{"dump/other.txt", "bob@example.com:123456\n"},
+	} {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0o644, Size: int64(len(f.body)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(f.body))
+	}
+	tw.Close()
+
+	got, err := walkAll(bytes.NewReader(gzipBytes(t, tarBuf.Bytes())), "dump.tgz", DefaultLimits)
+	if err != nil {
+		t.Fatalf("Walk: errore inatteso: %v", err)
+	}
+	want := map[string]string{
+		"dump.tar/dump/users.txt": "alice@example.com:password\n",
+		"dump.tar/dump/other.txt": "bob@example.com:123456\n",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("file = %v, attesi %v", got, want)
+	}
+}
+
+// Uno zip letto con io.ReaderAt non passa dal contatore dell'input: il rapporto usa la sua dimensione.
+func TestWalkZipReaderAt(t *testing.T) {
+	lines := comboLines(80000)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	f, err := zw.Create("users.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(lines)
+	zw.Close()
+
+	got, err := walkAll(io.NewSectionReader(bytes.NewReader(buf.Bytes()), 0, int64(buf.Len())), "dump.zip", DefaultLimits)
+	if err != nil {
+		t.Fatalf("Walk: errore inatteso: %v", err)
+	}
+	if got["dump.zip/users.txt"] != string(lines) {
+		t.Errorf("contenuto di dump.zip/users.txt errato (%d byte, attesi %d)", len(got["dump.zip/users.txt"]), len(lines))
+	}
+}
+
+// Ogni livello di una gzip bomb annidata resta sotto il rapporto massimo, ma il totale lo supera.
+func TestWalkNestedBomb(t *testing.T) {
+	payload := bytes.Repeat([]byte("a"), 8<<20)
+	inner := gzipBytes(t, payload)
+	outer := gzipBytes(t, inner)
+	limits := Limits{MaxDepth: 4, MaxRatio: 1000}
+	if int64(len(payload)) > limits.MaxRatio*int64(len(inner)) || int64(len(inner)) > limits.MaxRatio*int64(len(outer)) {
+		t.Fatalf("un livello supera da solo il rapporto (%d, %d, %d byte)", len(payload), len(inner), len(outer))
+	}
+
+	_, err := walkAll(bytes.NewReader(outer), "bomb.gz.gz", limits)
+	if !errors.Is(err, ErrRatio) {
+		t.Errorf("Walk = %v, atteso ErrRatio", err)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"pwnscanner/pkg/database"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// breachesPageData sono i dati passati al template breaches.html.
+type breachesPageData struct {
+	Breaches []breachRow
+	Form     database.Breach
+	Editing  bool
+	Error    string
+}
+
+// breachRow è una riga dell'elenco: un breach del catalogo e/o presente nei dati.
+type breachRow struct {
+	database.Breach
+	Accounts  int64
+	InCatalog bool
+}
+
+// catalogWriter restituisce il catalogo dei breach del database, se supportato.
+func catalogWriter() (database.BreachCatalogWriter, bool) {
+	catalog, ok := writer.(database.BreachCatalogWriter)
+	return catalog, ok
+}
+
+// Handler per la pagina del catalogo dei breach: elenco, modifica (?name=) e salvataggio
+func breachesHandler(w http.ResponseWriter, r *http.Request) {
+	catalog, ok := catalogWriter()
+	if !ok {
+		http.Error(w, "Il database configurato non supporta il catalogo dei breach", http.StatusNotImplemented)
+		return
+	}
+	ctx := context.Background()
+
+	data := breachesPageData{}
+	switch r.Method {
+	case http.MethodGet:
+		if name := r.URL.Query().Get("name"); name != "" {
+			breach, err := catalog.GetBreach(ctx, name)
+			if err != nil {
+				http.Error(w, "Errore nel recupero del breach", http.StatusInternalServerError)
+				log.Printf("Errore nel recupero del breach %s: %v", name, err)
+				return
+			}
+			// Un breach presente nei dati ma non nel catalogo si modifica partendo dal solo nome
+			if breach == nil {
+				breach = &database.Breach{Name: name, Title: name}
+			}
+			data.Form = *breach
+			data.Editing = true
+		}
+	case http.MethodPost:
+		breach, err := breachFromForm(ctx, catalog, r)
+		if err == nil {
+			err = catalog.UpsertBreach(ctx, breach)
+		}
+		if err == nil {
+			log.Printf("Catalogo aggiornato per il breach %s", breach.Name)
+			http.Redirect(w, r, "/breaches", http.StatusSeeOther)
+			return
+		}
+		// Il form viene mostrato di nuovo con i valori inseriti e l'errore
+		log.Printf("Errore nel salvataggio del breach %s: %v", breach.Name, err)
+		data.Form = breach
+		data.Editing = true
+		data.Error = err.Error()
+	default:
+		http.Error(w, "Metodo non consentito", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rows, err := breachRows(ctx, catalog)
+	if err != nil {
+		http.Error(w, "Errore nel recupero del catalogo", http.StatusInternalServerError)
+		log.Printf("Errore nel recupero del catalogo: %v", err)
+		return
+	}
+	data.Breaches = rows
+	renderTemplate(w, r, "breaches", data)
+}
+
+// breachRows unisce il catalogo ai contatori dei breach, così compaiono anche i breach
+// caricati prima del catalogo, in ordine alfabetico di nome.
+func breachRows(ctx context.Context, catalog database.BreachCatalog) ([]breachRow, error) {
+	breaches, err := catalog.ListBreaches(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows := make(map[string]breachRow, len(breaches))
+	for _, breach := range breaches {
+		rows[breach.Name] = breachRow{Breach: breach, InCatalog: true}
+	}
+
+	if reader, ok := writer.(database.StatsReader); ok {
+		stats, err := reader.BreachStats(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, stat := range stats {
+			row, found := rows[stat.Name]
+			if !found {
+				row.Breach = database.Breach{Name: stat.Name}
+			}
+			row.Accounts = stat.Accounts
+			rows[stat.Name] = row
+		}
+	}
+
+	list := make([]breachRow, 0, len(rows))
+	for _, row := range rows {
+		list = append(list, row)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Handler per l'eliminazione di un breach dal catalogo (le email associate non vengono toccate)
+func deleteBreachHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Metodo non consentito", http.StatusMethodNotAllowed)
+		return
+	}
+	catalog, ok := catalogWriter()
+	if !ok {
+		http.Error(w, "Il database configurato non supporta il catalogo dei breach", http.StatusNotImplemented)
+		return
+	}
+
+	name := r.FormValue("name")
+	if err := catalog.DeleteBreach(context.Background(), name); err != nil {
+		http.Error(w, "Errore nell'eliminazione del breach", http.StatusInternalServerError)
+		log.Printf("Errore nell'eliminazione del breach %s: %v", name, err)
+		return
+	}
+	log.Printf("Breach %s eliminato dal catalogo", name)
+	http.Redirect(w, r, "/breaches", http.StatusSeeOther)
+}
+
+// breachFromForm legge i campi del form. La data di aggiunta di un breach già presente viene conservata.
+func breachFromForm(ctx context.Context, catalog database.BreachCatalog, r *http.Request) (database.Breach, error) {
+	breach := database.Breach{
+		Name:        strings.TrimSpace(r.FormValue("name")),
+		Title:       strings.TrimSpace(r.FormValue("title")),
+		Domain:      strings.TrimSpace(r.FormValue("domain")),
+		BreachDate:  r.FormValue("breachDate"),
+		Description: strings.TrimSpace(r.FormValue("description")),
+		IsVerified:  r.FormValue("isVerified") != "",
+		IsSensitive: r.FormValue("isSensitive") != "",
+		LogoPath:    strings.TrimSpace(r.FormValue("logoPath")),
+		AddedDate:   time.Now().UTC(),
+	}
+
+	// Le classi di dati sono separate da virgole (es. "Email addresses, Passwords")
+	breach.DataClasses = []string{}
+	for _, class := range strings.Split(r.FormValue("dataClasses"), ",") {
+		if class = strings.TrimSpace(class); class != "" {
+			breach.DataClasses = append(breach.DataClasses, class)
+		}
+	}
+
+	if value := strings.TrimSpace(r.FormValue("pwnCount")); value != "" {
+		count, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return breach, err
+		}
+		breach.PwnCount = count
+	}
+
+	existing, err := catalog.GetBreach(ctx, breach.Name)
+	if err != nil {
+		return breach, err
+	}
+	if existing != nil && !existing.AddedDate.IsZero() {
+		breach.AddedDate = existing.AddedDate
+	}
+	return breach, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+)
+
+// command è un'operazione di manutenzione eseguibile da riga di comando: ./main <nome> [argomenti]
+type command struct {
+	description string
+	run         func(ctx context.Context, args []string) error
+}
+
+// commands elenca i comandi disponibili. Senza argomenti pwnadmin avvia il server web.
+var commands = map[string]command{
+	"api-key-domains": {
+		description: "aggiunge (-grant) o toglie (-revoke) i domini consultabili da una chiave API",
+		run:         apiKeyDomainsCommand,
+	},
+	"create-api-key": {
+		description: "crea una chiave API per PwnScannerFront e la stampa (una sola volta)",
+		run:         createAPIKeyCommand,
+	},
+	"export-snapshot": {
+		description: "esporta tutte le email in un file snapshot per i nodi di sola lettura",
+		run:         exportSnapshotCommand,
+	},
+	"list-api-keys": {
+		description: "elenca le chiavi API con permessi, scadenza e stato",
+		run:         listAPIKeysCommand,
+	},
+	"migrate": {
+		description: "applica le migrazioni mancanti dello schema del database (indici, validatori)",
+		run:         migrateCommand,
+	},
+	"normalize-emails": {
+		description: "riscrive nella forma canonica le email importate prima della normalizzazione",
+		run:         normalizeEmailsCommand,
+	},
+	"reconcile-stats": {
+		description: "ricostruisce dalle email i contatori per breach, per dominio e globali",
+		run:         reconcileStatsCommand,
+	},
+	"remove-breach": {
+		description: "elimina un breach da tutte le email e aggiorna i contatori",
+		run:         removeBreachCommand,
+	},
+	"revoke-api-key": {
+		description: "revoca una chiave API",
+		run:         revokeAPIKeyCommand,
+	},
+	"rotate-email-keys": {
+		description: "ricalcola le email con l'ultima chiave di EMAIL_HMAC_KEYS (o le converte da chiaro a HMAC)",
+		run:         rotateEmailKeysCommand,
+	},
+}
+
+// runCommand esegue il comando indicato e termina il processo con il codice di uscita appropriato.
+func runCommand(name string, args []string) {
+	cmd, found := commands[name]
+	if !found {
+		fmt.Fprintf(os.Stderr, "Comando sconosciuto: %s\n\nComandi disponibili:\n", name)
+		names := make([]string, 0, len(commands))
+		for n := range commands {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		for _, n := range names {
+			fmt.Fprintf(os.Stderr, "  %-20s %s\n", n, commands[n].description)
+		}
+		os.Exit(2)
+	}
+
+	if err := cmd.run(context.Background(), args); err != nil {
+		log.Fatalf("Errore durante l'esecuzione di %s: %v", name, err)
+	}
+}
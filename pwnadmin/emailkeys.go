@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"pwnscanner/pkg/database"
+	"time"
+)
+
+// rotateEmailKeysCommand ricalcola con l'ultima chiave di EMAIL_HMAC_KEYS le email conservate in chiaro
+// o con le chiavi precedenti. Procedura: aggiungere la nuova chiave in coda a EMAIL_HMAC_KEYS di pwnadmin
+// e a database.email_hmac_keys di PwnScannerFront, con la lettura doppia attiva; eseguire questo comando;
+// disattivare la lettura doppia. Letture e import possono continuare durante la rotazione.
+func rotateEmailKeysCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("rotate-email-keys", flag.ExitOnError)
+	flags.Parse(args)
+
+	keys, err := emailKeysFromEnv()
+	if err != nil {
+		return err
+	}
+	if keys == nil {
+		return fmt.Errorf("la variabile d'ambiente EMAIL_HMAC_KEYS non è impostata")
+	}
+	if !keys.DualRead {
+		log.Println("Attenzione: senza lettura doppia le email non ancora ruotate non vengono trovate fino alla fine della rotazione.")
+	}
+
+	db, err := openWriter(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rotator, ok := db.(database.EmailKeyRotator)
+	if !ok {
+		return fmt.Errorf("il database configurato non supporta le email come HMAC")
+	}
+
+	log.Printf("Rotazione delle email verso la chiave %s...", keys.Current())
+	start := time.Now()
+	rotation, err := rotator.RotateEmailKeys(ctx)
+	log.Printf("Documenti ricalcolati: %d email, %d classi di dati, %d uniti a documenti già ruotati",
+		rotation.Emails, rotation.DataClasses, rotation.Merged)
+	if err != nil {
+		return err
+	}
+	log.Printf("Rotazione completata in %s: la lettura doppia (EMAIL_HMAC_DUAL_READ, database.email_hmac_dual_read) può essere disattivata.",
+		time.Since(start).Round(time.Millisecond))
+	return nil
+}
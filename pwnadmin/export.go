@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"pwnscanner/pkg/database"
+	"pwnscanner/pkg/snapshot"
+	"time"
+)
+
+// exportSnapshotCommand esporta il database in un file snapshot.
+// Il file di destinazione viene sostituito in modo atomico: i nodi che lo usano lo ricaricano a caldo.
+func exportSnapshotCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("export-snapshot", flag.ExitOnError)
+	out := flags.String("out", "", "percorso del file snapshot da scrivere (obbligatorio)")
+	tempDir := flags.String("tmp", "", "directory per i file temporanei dell'ordinamento (default: directory di sistema)")
+	chunk := flags.Int("chunk", snapshot.DefaultChunkRecords, "email tenute in memoria prima di scrivere un blocco ordinato")
+	version := flags.Uint64("version", uint64(time.Now().Unix()), "versione dei dati scritta nello snapshot")
+	flags.Parse(args)
+
+	if *out == "" {
+		flags.Usage()
+		return fmt.Errorf("il parametro -out è obbligatorio")
+	}
+
+	source, err := openWriter(ctx)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	exporter, ok := source.(database.Exporter)
+	if !ok {
+		return fmt.Errorf("il database configurato non supporta l'esportazione")
+	}
+
+	writer, err := snapshot.NewWriter(*tempDir, *chunk)
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	log.Printf("Esportazione dello snapshot in %s...", *out)
+	start := time.Now()
+	var exported int64
+	err = exporter.ForEachEmail(ctx, func(record database.Record) error {
+		exported++
+		if exported%1_000_000 == 0 {
+			log.Printf("Email lette: %d", exported)
+		}
+		return writer.Add(record.Email, record.Breaches)
+	})
+	if err != nil {
+		return fmt.Errorf("errore durante la lettura del database: %w", err)
+	}
+
+	log.Printf("Lettura completata (%d email), scrittura del file...", exported)
+	info, err := writer.Commit(*out, *version)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Snapshot scritto in %s: %s", time.Since(start).Round(time.Second), info)
+	return nil
+}
@@ -0,0 +1,276 @@
+package extractor
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"pwnscanner/pkg/database"
+	"pwnscanner/pkg/normalize"
+	"regexp"
+	"strings"
+)
+
+// comboDelimiters sono i separatori riconosciuti nelle combo list, in ordine di preferenza.
+// La virgola non è tra questi: le righe "email, testo" sono più spesso CSV o testo libero.
+var comboDelimiters = []rune{':', ';', '|', '\t'}
+
+// comboMinShare è la frazione minima di righe esaminate che devono avere un'email tra i primi valori
+// perché il file sia riconosciuto come combo list: le combo list contengono spesso righe malformate.
+const comboMinShare = 0.6
+
+// phoneRegex riconosce i valori che sembrano numeri di telefono: almeno 7 cifre, con prefisso
+// internazionale, spazi, punti, trattini e parentesi facoltativi.
+var phoneRegex = regexp.MustCompile(`^\+?[0-9][0-9 ().-]{5,18}[0-9]$`)
+
+// hexHashes sono gli algoritmi degli hash esadecimali, riconosciuti dalla lunghezza.
+// Un hash MD5 e uno NTLM non si distinguono: vengono classificati come MD5.
+var hexHashes = map[int]string{32: "md5", 40: "sha1", 56: "sha224", 64: "sha256", 96: "sha384", 128: "sha512"}
+
+// hashPrefixes sono i prefissi dei formati di hash con un identificativo dell'algoritmo.
+var hashPrefixes = []struct{ prefix, algorithm string }{
+	{"$2a$", "bcrypt"}, {"$2b$", "bcrypt"}, {"$2x$", "bcrypt"}, {"$2y$", "bcrypt"},
+	{"$argon2i$", "argon2"}, {"$argon2d$", "argon2"}, {"$argon2id$", "argon2"},
+	{"$scrypt$", "scrypt"}, {"$7$", "scrypt"},
+	{"$1$", "md5crypt"}, {"$apr1$", "md5crypt"},
+	{"$5$", "sha256crypt"}, {"$6$", "sha512crypt"},
+	{"$P$", "phpass"}, {"$H$", "phpass"},
+	{"pbkdf2_sha256$", "pbkdf2"}, {"pbkdf2_sha1$", "pbkdf2"}, {"$pbkdf2", "pbkdf2"},
+	{"{SSHA}", "ssha"}, {"{SSHA512}", "ssha512"}, {"{SHA}", "sha1"},
+}
+
+// HashType restituisce l'algoritmo dell'hash di password secret, o "" se sembra una password in chiaro.
+// Gli hash esadecimali vengono riconosciuti dalla lunghezza e devono contenere almeno una lettera,
+// per non scambiare per hash le password composte da sole cifre.
+func HashType(secret string) string {
+	for _, hash := range hashPrefixes {
+		if strings.HasPrefix(secret, hash.prefix) && len(secret) > len(hash.prefix)+8 {
+			return hash.algorithm
+		}
+	}
+	// Hash di MySQL 4.1 e successivi: "*" seguito dallo SHA-1 esadecimale
+	if len(secret) == 41 && secret[0] == '*' && isHex(secret[1:]) {
+		return "mysql41"
+	}
+	if algorithm, ok := hexHashes[len(secret)]; ok && isHex(secret) && strings.ContainsAny(strings.ToLower(secret), "abcdef") {
+		return algorithm
+	}
+	return ""
+}
+
+// isHex indica se s contiene solo cifre esadecimali.
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// DataClasses restituisce le classi di dati esposte dal record (vedi database.DataClassPassword e le altre),
+// senza i valori: la password diventa DataClassPassword se è in chiaro o la classe del suo hash.
+func (r Record) DataClasses() []string {
+	var classes []string
+	if r.Password != "" {
+		if algorithm := HashType(r.Password); algorithm != "" {
+			classes = append(classes, database.PasswordHashClass(algorithm))
+		} else {
+			classes = append(classes, database.DataClassPassword)
+		}
+	}
+	for _, field := range []struct{ value, class string }{
+		{r.Username, database.DataClassUsername},
+		{r.Phone, database.DataClassPhone},
+		{r.IP, database.DataClassIP},
+		{r.Name, database.DataClassName},
+	} {
+		if field.value != "" {
+			classes = append(classes, field.class)
+		}
+	}
+	return classes
+}
+
+// parseCombo legge una combo list: una riga per account, con i valori separati da delimiter, come
+// "email:password" o "email;hash;salt". L'email è il primo valore valido della riga e il valore che la
+// segue è la password o il suo hash; degli altri valori vengono riconosciuti indirizzi IP e numeri di
+// telefono, e un valore non numerico che precede l'email è lo username. Gli altri valori, come i salt
+// e gli identificativi numerici, vengono ignorati. Se le prime righe hanno di solito due valori, come
+// "email:password", tutto ciò che segue l'email è la password, anche se contiene il separatore.
+func parseCombo(ctx context.Context, r *bufio.Reader, normalizer *normalize.Normalizer, delimiter rune, stats *Stats, emit func(Record) error) error {
+	head, err := r.Peek(sniffBytes)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	pairs := comboFields(head, delimiter, normalizer) == 2
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), MaxLineBytes)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := splitLines(data, atEOF)
+		stats.Read += int64(advance)
+		return advance, token, err
+	})
+
+	for lines := 1; scanner.Scan(); lines++ {
+		if lines%contextCheckLines == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		values := strings.Split(line, string(delimiter))
+		if pairs && len(values) > 2 {
+			if _, err := normalizer.Email(strings.TrimSpace(values[0])); err == nil {
+				values = strings.SplitN(line, string(delimiter), 2)
+			}
+		}
+		index := -1
+		var email string
+		for i, value := range values {
+			if candidate, err := normalizer.Email(strings.TrimSpace(value)); err == nil {
+				index, email = i, candidate
+				break
+			}
+		}
+		if index < 0 {
+			if strings.Contains(line, "@") {
+				stats.Rejected++
+			}
+			continue
+		}
+
+		record := comboRecord(email, values, index)
+		stats.Emails++
+		stats.Fields.count(record)
+		if err := emit(record); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// comboRecord costruisce il record di una riga di combo list, con l'email in posizione index.
+func comboRecord(email string, values []string, index int) Record {
+	record := Record{Email: email}
+	for i, value := range values {
+		if i == index {
+			continue
+		}
+		trimmed := strings.TrimSpace(value)
+		if trimmed == "" {
+			continue
+		}
+		phone := phoneRegex.MatchString(trimmed) && countDigits(trimmed) >= 7
+		switch {
+		case net.ParseIP(trimmed) != nil:
+			if record.IP == "" {
+				record.IP = trimmed
+			}
+		case i == index+1 && !(phone && trimmed[0] == '+'):
+			// Gli spazi possono far parte della password: il valore non viene ripulito.
+			// Dopo l'email solo un numero con prefisso internazionale è un telefono, non una password numerica
+			record.Password = value
+		case phone:
+			if record.Phone == "" {
+				record.Phone = trimmed
+			}
+		case i < index && record.Username == "" && countDigits(trimmed) < len(trimmed):
+			// Un valore di sole cifre prima dell'email è un identificativo, non uno username
+			record.Username = trimmed
+		}
+	}
+	return record
+}
+
+// countDigits restituisce il numero di cifre di s.
+func countDigits(s string) int {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] >= '0' && s[i] <= '9' {
+			n++
+		}
+	}
+	return n
+}
+
+// sniffCombo restituisce il separatore delle combo list con cui almeno comboMinShare delle righe
+// esaminate hanno un'email valida come primo o secondo valore, seguita da un altro valore, o 0.
+// Un file la cui prima riga è un'intestazione con nomi di colonna noti, senza email, non è una combo list.
+// Se delimiter non è 0 prova solo quello.
+func sniffCombo(head []byte, delimiter rune, normalizer *normalize.Normalizer) rune {
+	lines := sniffedLines(head)
+	if len(lines) == 0 {
+		return 0
+	}
+	candidates := comboDelimiters
+	if delimiter != 0 {
+		candidates = []rune{delimiter}
+	}
+	var best rune
+	bestCount := 0
+	for _, candidate := range candidates {
+		count := 0
+		for i, line := range lines {
+			values := strings.Split(string(line), string(candidate))
+			found := false
+			for j := 0; j < min(2, len(values)-1); j++ {
+				if _, err := normalizer.Email(strings.TrimSpace(values[j])); err == nil {
+					found = true
+					break
+				}
+			}
+			// Una riga con un'email non è un'intestazione, anche se la password è "password"
+			if i == 0 && !found && isHeader(values) {
+				count = 0
+				break
+			}
+			if found {
+				count++
+			}
+		}
+		if count > bestCount && float64(count) >= comboMinShare*float64(len(lines)) {
+			best, bestCount = candidate, count
+		}
+	}
+	return best
+}
+
+// comboFields restituisce il numero di valori più frequente tra le righe esaminate con un'email
+// come primo o secondo valore, a parità il maggiore, così una password con il separatore deve essere
+// un'eccezione per essere letta per intero; 0 se nessuna riga ha un'email.
+func comboFields(head []byte, delimiter rune, normalizer *normalize.Normalizer) int {
+	counts := make(map[int]int)
+	for _, line := range sniffedLines(head) {
+		values := strings.Split(strings.TrimRight(string(line), "\r"), string(delimiter))
+		for j := 0; j < min(2, len(values)); j++ {
+			if _, err := normalizer.Email(strings.TrimSpace(values[j])); err == nil {
+				counts[len(values)]++
+				break
+			}
+		}
+	}
+	best := 0
+	for fields, count := range counts {
+		if count > counts[best] || count == counts[best] && fields > best {
+			best = fields
+		}
+	}
+	return best
+}
+
+// isHeader indica se i valori contengono un nome di colonna noto, come in un'intestazione CSV.
+func isHeader(values []string) bool {
+	for _, value := range values {
+		if _, ok := knownField(strings.Trim(strings.TrimSpace(value), `"`)); ok {
+			return true
+		}
+	}
+	return false
+}
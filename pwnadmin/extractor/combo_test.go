@@ -0,0 +1,93 @@
+package extractor
+
+import (
+	"pwnscanner/pkg/database"
+	"reflect"
+	"testing"
+)
+
+func TestCombo(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		input string
+		want  []Record
+	}{
+		{
+			name:  "separatore nella password",
+			input: "a@example.com:pa:ss\nb@example.com:secret\nc@example.com: con spazi \nd@example.com:x\n",
+			want: []Record{
+				{Email: "a@example.com", Password: "pa:ss"},
+				{Email: "b@example.com", Password: "secret"},
+				{Email: "c@example.com", Password: " con spazi "},
+				{Email: "d@example.com", Password: "x"},
+			},
+		},
+		{
+			name:  "email;hash;salt",
+			input: "a@example.com;5f4dcc3b5aa765d61d8327deb882cf99;s4lt\nb@example.com;e10adc3949ba59abbe56e057f20f883e;x9\n",
+			want: []Record{
+				{Email: "a@example.com", Password: "5f4dcc3b5aa765d61d8327deb882cf99"},
+				{Email: "b@example.com", Password: "e10adc3949ba59abbe56e057f20f883e"},
+			},
+		},
+		{
+			name:  "user|email|password|ip",
+			input: "alice|a@example.com|secret|10.0.0.1\n42|b@example.com|pa|ss|2001:db8::1\n",
+			want: []Record{
+				{Email: "a@example.com", Username: "alice", Password: "secret", IP: "10.0.0.1"},
+				{Email: "b@example.com", Password: "pa", IP: "2001:db8::1"},
+			},
+		},
+		{
+			name:  "telefono e righe senza email",
+			input: "a@example.com\t+39 333 1234567\t1.2.3.4\nriga senza email\n\nb@example.com\t123456\n",
+			want: []Record{
+				{Email: "a@example.com", Phone: "+39 333 1234567", IP: "1.2.3.4"},
+				{Email: "b@example.com", Password: "123456"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseRecords(t, "combo.txt", tc.input, Mapping{})
+			if err != nil {
+				t.Fatalf("errore inatteso: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("record = %#v, attesi %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHashType(t *testing.T) {
+	for _, tc := range []struct {
+		secret string
+		want   string
+	}{
+		{"password", ""},
+		{"123456", ""},
+		{"12345678901234567890123456789012", ""},
+		{"5f4dcc3b5aa765d61d8327deb882cf99", "md5"},
+		{"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8", "sha1"},
+		{"5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8", "sha256"},
+		{"*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19", "mysql41"},
+		{"$2y$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy", "bcrypt"},
+		{"$argon2id$v=19$m=65536,t=3,p=4$c2FsdA$aGFzaA", "argon2"},
+		{"$6$rounds=5000$salt$hash", "sha512crypt"},
+		{"$P$BqT1ZyKx8gYJgWb0", "phpass"},
+		{"{SSHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=", "ssha"},
+		{"$2y$short", ""},
+	} {
+		if got := HashType(tc.secret); got != tc.want {
+			t.Errorf("HashType(%q) = %q, atteso %q", tc.secret, got, tc.want)
+		}
+	}
+}
+
+func TestRecordDataClasses(t *testing.T) {
+	record := Record{Email: "a@example.com", Username: "alice", Password: "5f4dcc3b5aa765d61d8327deb882cf99", IP: "10.0.0.1"}
+	want := []string{database.PasswordHashClass("md5"), database.DataClassUsername, database.DataClassIP}
+	if got := record.DataClasses(); !reflect.DeepEqual(got, want) {
+		t.Errorf("DataClasses() = %v, attese %v", got, want)
+	}
+}
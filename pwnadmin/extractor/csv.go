@@ -0,0 +1,149 @@
+package extractor
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"pwnscanner/pkg/normalize"
+	"strings"
+)
+
+// parseCSV legge un file di valori separati da delimiter. Le colonne dei campi vengono prese dalla
+// mappatura o riconosciute dall'intestazione; senza indicazioni, la colonna dell'email è la prima
+// che contiene esattamente un'email valida nella prima riga di dati che ne ha una.
+// Le email dentro campi di testo libero non vengono estratte.
+func parseCSV(ctx context.Context, r io.Reader, normalizer *normalize.Normalizer, mapping Mapping, delimiter rune, stats *Stats, emit func(Record) error) error {
+	reader := csv.NewReader(r)
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.ReuseRecord = true
+
+	columns := map[Field]int{}
+	resolved := false
+	for rows := 1; ; rows++ {
+		if rows%contextCheckLines == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		row, err := reader.Read()
+		stats.Read = reader.InputOffset()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("CSV non valido: %w", err)
+		}
+
+		if !resolved {
+			resolved = true
+			header := csvHeader(row, mapping.Header, normalizer)
+			if columns, err = csvColumns(mapping.Columns, header); err != nil {
+				return err
+			}
+			if header != nil {
+				continue
+			}
+		}
+
+		index, ok := columns[FieldEmail]
+		if !ok {
+			// Colonna dell'email non ancora nota: la prima che contiene un'email valida
+			for i, value := range row {
+				if _, err := normalizer.Email(strings.TrimSpace(value)); err == nil {
+					index, ok = i, true
+					columns[FieldEmail] = i
+					break
+				}
+			}
+			if !ok {
+				continue
+			}
+		}
+		if index >= len(row) || strings.TrimSpace(row[index]) == "" {
+			continue
+		}
+		email, err := normalizer.Email(strings.TrimSpace(row[index]))
+		if err != nil {
+			stats.Rejected++
+			continue
+		}
+
+		record := Record{Email: email}
+		for field, i := range columns {
+			if field != FieldEmail && i < len(row) {
+				record.set(field, strings.TrimSpace(row[i]))
+			}
+		}
+		stats.Emails++
+		stats.Fields.count(record)
+		if err := emit(record); err != nil {
+			return err
+		}
+	}
+}
+
+// csvHeader restituisce la prima riga se è l'intestazione, altrimenti nil. Con HeaderAuto
+// la prima riga è l'intestazione se nessun valore è un'email valida.
+func csvHeader(row []string, mode Header, normalizer *normalize.Normalizer) []string {
+	switch mode {
+	case HeaderNo:
+		return nil
+	case HeaderAuto:
+		for _, value := range row {
+			if _, err := normalizer.Email(strings.TrimSpace(value)); err == nil {
+				return nil
+			}
+		}
+	}
+	// La riga viene riusata dal lettore: l'intestazione va copiata
+	header := make([]string, len(row))
+	for i, value := range row {
+		header[i] = strings.TrimPrefix(value, "\ufeff")
+	}
+	return header
+}
+
+// csvColumns risolve le colonne dei campi: quelle indicate nella mappatura, per numero o per nome
+// nell'intestazione, e quelle riconosciute dai nomi dell'intestazione.
+func csvColumns(specs map[Field]string, header []string) (map[Field]int, error) {
+	columns := map[Field]int{}
+	for field, spec := range specs {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		if i := column(spec); i >= 0 {
+			columns[field] = i
+			continue
+		}
+		if header == nil {
+			return nil, fmt.Errorf("la colonna %q del campo %s è indicata per nome, ma il file non ha un'intestazione", spec, field)
+		}
+		i := headerIndex(header, spec)
+		if i < 0 {
+			return nil, fmt.Errorf("colonna %q del campo %s non trovata nell'intestazione (%s)", spec, field, strings.Join(header, ", "))
+		}
+		columns[field] = i
+	}
+	for i, name := range header {
+		if field, ok := knownField(name); ok {
+			if _, mapped := columns[field]; !mapped {
+				columns[field] = i
+			}
+		}
+	}
+	return columns, nil
+}
+
+// headerIndex restituisce la posizione della colonna name nell'intestazione, senza distinguere
+// maiuscole e minuscole, o -1.
+func headerIndex(header []string, name string) int {
+	for i, column := range header {
+		if strings.EqualFold(strings.TrimSpace(column), strings.TrimSpace(name)) {
+			return i
+		}
+	}
+	return -1
+}
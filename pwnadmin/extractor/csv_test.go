@@ -0,0 +1,98 @@
+package extractor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCSV(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		file    string
+		input   string
+		mapping Mapping
+		want    []Record
+	}{
+		{
+			name:  "intestazione riconosciuta",
+			file:  "users.csv",
+			input: "\ufeffID,E-Mail,User_Name,Password,Phone\n1,Alice@Example.com,alice,secret,+39 06 1234\n2,non valida,bob,x,\n3,,carol,y,\n",
+			want:  []Record{{Email: "alice@example.com", Username: "alice", Password: "secret", Phone: "+39 06 1234"}},
+		},
+		{
+			name:  "senza intestazione: colonna dell'email dal contenuto",
+			file:  "users.csv",
+			input: "1,\"Rossi, Mario\",a@example.com\n2,Bianchi,b@example.com\n",
+			want:  []Record{{Email: "a@example.com"}, {Email: "b@example.com"}},
+		},
+		{
+			name:    "colonne indicate per nome e per numero",
+			file:    "users.csv",
+			input:   "id,contatto,nick,secret\n1,a@example.com,alice,p1\n",
+			mapping: Mapping{Columns: map[Field]string{FieldEmail: "Contatto", FieldPassword: "4", FieldName: "nick"}},
+			// nick è anche un nome riconosciuto dello username
+			want: []Record{{Email: "a@example.com", Username: "alice", Password: "p1", Name: "alice"}},
+		},
+		{
+			name:    "intestazione forzata",
+			file:    "users.csv",
+			input:   "a@example.com,x\nb@example.com,y\n",
+			mapping: Mapping{Header: HeaderYes, Columns: map[Field]string{FieldPassword: "2"}},
+			want:    []Record{{Email: "b@example.com", Password: "y"}},
+		},
+		{
+			name:    "prima riga di dati forzata",
+			file:    "users.csv",
+			input:   "email,password\na@example.com,x\n",
+			mapping: Mapping{Header: HeaderNo, Columns: map[Field]string{FieldEmail: "1", FieldPassword: "2"}},
+			want:    []Record{{Email: "a@example.com", Password: "x"}},
+		},
+		{
+			name:    "separatore indicato",
+			file:    "users.txt",
+			input:   "email|password\na@example.com|x\n",
+			mapping: Mapping{Format: FormatCSV, Delimiter: "|"},
+			want:    []Record{{Email: "a@example.com", Password: "x"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseRecords(t, tc.file, tc.input, tc.mapping)
+			if err != nil {
+				t.Fatalf("errore inatteso: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("record = %#v, attesi %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCSVColumnErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		input   string
+		mapping Mapping
+		want    string
+	}{
+		{
+			name:    "colonna per nome senza intestazione",
+			input:   "a@example.com,x\n",
+			mapping: Mapping{Columns: map[Field]string{FieldPassword: "secret"}},
+			want:    "il file non ha un'intestazione",
+		},
+		{
+			name:    "colonna assente",
+			input:   "email,password\na@example.com,x\n",
+			mapping: Mapping{Columns: map[Field]string{FieldPhone: "telefono"}},
+			want:    "non trovata nell'intestazione",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseRecords(t, "users.csv", tc.input, tc.mapping)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("errore = %v, atteso %q", err, tc.want)
+			}
+		})
+	}
+}
@@ -2,38 +2,98 @@ package extractor
 
 import (
 	"bufio"
-	"os"
+	"bytes"
+	"context"
+	"io"
+	"pwnscanner/pkg/normalize"
 	"regexp"
-	"strings"
+	"unicode"
 )
 
-// ExtractEmailsFromFile estrae email valide da un file di testo.
-func ExtractEmailsFromFile(filePath string) ([]string, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	var emails []string
-	scanner := bufio.NewScanner(file)
-	emailRegex := regexp.MustCompile(`[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}`)
-	emailValidationRegex := regexp.MustCompile(`^[a-zA-Z0-9.%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		matches := emailRegex.FindAllString(line, -1)
-		for _, email := range matches {
-			sanitized := strings.TrimSpace(strings.TrimRight(email, ":;"))
-			if emailValidationRegex.MatchString(sanitized) {
-				emails = append(emails, sanitized)
+// emailRegex individua i candidati email nel testo; accetta lettere Unicode per i domini internazionalizzati.
+// La validazione vera e propria è affidata al Normalizer.
+var emailRegex = regexp.MustCompile(`[\p{L}\p{N}._%+-]+@[\p{L}\p{N}.-]+\.[\p{L}\p{N}-]{2,}`)
+
+// MaxLineBytes è la lunghezza massima di una riga. Le righe più lunghe, ad esempio i dump SQL
+// scritti su una sola riga, vengono spezzate su un carattere che non può far parte di un'email.
+const MaxLineBytes = 1 << 20
+
+// contextCheckLines è ogni quante righe Extract verifica se il contesto è stato annullato.
+const contextCheckLines = 1024
+
+// Stats conta l'avanzamento dell'estrazione.
+type Stats struct {
+	// Read è il numero di byte elaborati
+	Read int64
+	// Emails è il numero di email valide estratte, duplicati compresi
+	Emails int64
+	// Rejected è il numero di candidati scartati dal Normalizer
+	Rejected int64
+	// Fields conta gli altri campi dei record, nei formati strutturati
+	Fields FieldCounts
+	// Format è il formato con cui il file viene letto, riconosciuto da NewParser
+	Format string
+}
+
+// Extract legge il testo riga per riga e chiama emit per ogni email valida, nella forma canonica
+// prodotta dal Normalizer, la stessa usata da PwnScannerFront per le ricerche. La memoria usata
+// non dipende dalla dimensione del testo. stats viene aggiornato prima di ogni chiamata a emit;
+// l'estrazione si interrompe al primo errore di emit o quando ctx viene annullato.
+func Extract(ctx context.Context, r io.Reader, normalizer *normalize.Normalizer, stats *Stats, emit func(email string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), MaxLineBytes)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := splitLines(data, atEOF)
+		stats.Read += int64(advance)
+		return advance, token, err
+	})
+
+	for lines := 1; scanner.Scan(); lines++ {
+		if lines%contextCheckLines == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		matches := emailRegex.FindAll(scanner.Bytes(), -1)
+		for _, match := range matches {
+			email, err := normalizer.Email(string(match))
+			if err != nil {
+				stats.Rejected++
+				continue
+			}
+			stats.Emails++
+			if err := emit(email); err != nil {
+				return err
 			}
 		}
 	}
+	return scanner.Err()
+}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+// splitLines è la funzione di split di Extract: restituisce una riga alla volta, senza il ritorno a capo,
+// e spezza le righe più lunghe di MaxLineBytes.
+func splitLines(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		if len(data) == 0 {
+			return 0, nil, nil
+		}
+		return len(data), data, nil
+	}
+	if len(data) < MaxLineBytes {
+		return 0, nil, nil
 	}
+	// Riga troppo lunga: taglia dopo l'ultimo separatore, così nessuna email viene divisa a metà
+	cut := bytes.LastIndexFunc(data, func(r rune) bool { return !isEmailRune(r) })
+	if cut < 0 {
+		cut = len(data) - 1
+	}
+	return cut + 1, data[:cut+1], nil
+}
 
-	return emails, nil
+// isEmailRune indica se il carattere può comparire in un candidato email di emailRegex.
+func isEmailRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || bytes.ContainsRune([]byte("._%+-@"), r)
 }
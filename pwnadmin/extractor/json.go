@@ -0,0 +1,188 @@
+package extractor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"pwnscanner/pkg/normalize"
+	"sort"
+	"strings"
+)
+
+// parseJSON legge un array JSON o una sequenza di valori JSON, come NDJSON, un elemento alla volta.
+// Gli elementi stringa sono email; negli oggetti i campi vengono presi dalle chiavi della mappatura
+// o riconosciuti dal nome della chiave. Senza indicazioni, la chiave dell'email è la prima
+// (in ordine alfabetico, anche negli oggetti annidati) che contiene un'email valida nel primo
+// oggetto che ne ha una.
+func parseJSON(ctx context.Context, r *bufio.Reader, normalizer *normalize.Normalizer, mapping Mapping, stats *Stats, emit func(Record) error) error {
+	// Il decoder non accetta il BOM
+	if bom, _ := r.Peek(3); bytes.Equal(bom, []byte("\xef\xbb\xbf")) {
+		r.Discard(3)
+	}
+	array := false
+	for i := 1; ; i++ {
+		head, err := r.Peek(i)
+		if len(head) < i {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if c := head[i-1]; c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			array = c == '['
+			break
+		}
+	}
+
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	if array {
+		if _, err := decoder.Token(); err != nil {
+			return fmt.Errorf("JSON non valido: %w", err)
+		}
+	}
+
+	var emailKey string
+	for items := 1; ; items++ {
+		if items%contextCheckLines == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		if array && !decoder.More() {
+			stats.Read = decoder.InputOffset()
+			return nil
+		}
+		var value any
+		err := decoder.Decode(&value)
+		stats.Read = decoder.InputOffset()
+		if err == io.EOF && !array {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("JSON non valido dopo %d elementi: %w", items-1, err)
+		}
+
+		candidate, record := jsonRecord(value, mapping.Columns, &emailKey, normalizer)
+		if candidate == "" {
+			continue
+		}
+		email, err := normalizer.Email(candidate)
+		if err != nil {
+			stats.Rejected++
+			continue
+		}
+		record.Email = email
+		stats.Emails++
+		stats.Fields.count(record)
+		if err := emit(record); err != nil {
+			return err
+		}
+	}
+}
+
+// jsonRecord restituisce il valore da usare come email e gli altri campi di un elemento.
+// emailKey conserva la chiave dell'email riconosciuta dal contenuto, per gli elementi successivi.
+func jsonRecord(value any, specs map[Field]string, emailKey *string, normalizer *normalize.Normalizer) (string, Record) {
+	var record Record
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v), record
+	case map[string]any:
+		var email string
+		for _, field := range Fields {
+			var fieldValue string
+			if spec := strings.TrimSpace(specs[field]); spec != "" {
+				fieldValue = jsonLookup(v, spec)
+			} else {
+				fieldValue = jsonKnown(v, field)
+			}
+			if field == FieldEmail {
+				email = fieldValue
+			} else {
+				record.set(field, fieldValue)
+			}
+		}
+		if email == "" && strings.TrimSpace(specs[FieldEmail]) == "" {
+			if *emailKey == "" {
+				*emailKey = jsonEmailKey(v, normalizer)
+			}
+			if *emailKey != "" {
+				email = jsonLookup(v, *emailKey)
+			}
+		}
+		return email, record
+	}
+	return "", record
+}
+
+// jsonLookup restituisce il valore della chiave path, in cui i punti separano le chiavi degli oggetti annidati.
+func jsonLookup(object map[string]any, path string) string {
+	var value any = object
+	for _, key := range strings.Split(path, ".") {
+		current, ok := value.(map[string]any)
+		if !ok {
+			return ""
+		}
+		if value, ok = current[key]; !ok {
+			return ""
+		}
+	}
+	return jsonString(value)
+}
+
+// jsonKnown restituisce il primo valore non vuoto, in ordine alfabetico delle chiavi, tra quelli
+// delle chiavi dell'oggetto il cui nome è riconosciuto per il campo.
+func jsonKnown(object map[string]any, field Field) string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		if known, ok := knownField(key); ok && known == field {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if value := jsonString(object[key]); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// jsonEmailKey restituisce la prima chiave, in ordine alfabetico, che contiene un'email valida, o "".
+// Gli oggetti annidati vengono esaminati dopo le chiavi del loro livello; la chiave restituita
+// ha i punti come quelle della mappatura.
+func jsonEmailKey(object map[string]any, normalizer *normalize.Normalizer) string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, err := normalizer.Email(jsonString(object[key])); err == nil {
+			return key
+		}
+	}
+	for _, key := range keys {
+		if nested, ok := object[key].(map[string]any); ok {
+			if found := jsonEmailKey(nested, normalizer); found != "" {
+				return key + "." + found
+			}
+		}
+	}
+	return ""
+}
+
+// jsonString converte in testo i valori stringa e numerici; gli altri valori sono vuoti.
+func jsonString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case json.Number:
+		return v.String()
+	}
+	return ""
+}
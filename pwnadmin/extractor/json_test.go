@@ -0,0 +1,65 @@
+package extractor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		input   string
+		mapping Mapping
+		want    []Record
+	}{
+		{
+			name:  "array di oggetti con chiavi riconosciute",
+			input: `[{"Email": "Alice@Example.com", "username": "alice", "password": "secret", "id": 1}, {"email": "non valida"}, {"email": null}]`,
+			want:  []Record{{Email: "alice@example.com", Username: "alice", Password: "secret"}},
+		},
+		{
+			name:  "NDJSON con la chiave dell'email dal contenuto",
+			input: "{\"contatto\": \"a@example.com\", \"tel\": 3912345678}\n{\"contatto\": \"b@example.com\"}\n",
+			want:  []Record{{Email: "a@example.com", Phone: "3912345678"}, {Email: "b@example.com"}},
+		},
+		{
+			name:  "oggetti annidati",
+			input: `{"profile": {"contact": {"address": "a@example.com"}}, "nick": "alice"}`,
+			want:  []Record{{Email: "a@example.com", Username: "alice"}},
+		},
+		{
+			name:    "chiavi indicate",
+			input:   `[{"user": {"mail": "a@example.com", "pw": "x"}, "mail": "altra@example.com"}]`,
+			mapping: Mapping{Columns: map[Field]string{FieldEmail: "user.mail", FieldPassword: "user.pw"}},
+			want:    []Record{{Email: "a@example.com", Password: "x"}},
+		},
+		{
+			name:  "array di stringhe",
+			input: `["a@example.com", " B@example.com ", 42]`,
+			want:  []Record{{Email: "a@example.com"}, {Email: "b@example.com"}},
+		},
+		{
+			name:  "vuoto",
+			input: " \n",
+			want:  nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseRecords(t, "users.json", tc.input, tc.mapping)
+			if err != nil {
+				t.Fatalf("errore inatteso: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("record = %#v, attesi %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestJSONInvalid(t *testing.T) {
+	_, err := parseRecords(t, "users.json", `[{"email": "a@example.com"}, {"email": `, Mapping{})
+	if err == nil || !strings.Contains(err.Error(), "JSON non valido dopo 1 elementi") {
+		t.Errorf("errore = %v, atteso JSON non valido dopo 1 elementi", err)
+	}
+}
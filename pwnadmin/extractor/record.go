@@ -0,0 +1,384 @@
+package extractor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"pwnscanner/pkg/normalize"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// sniffBytes è il numero di byte esaminati per riconoscere il formato e il separatore.
+const sniffBytes = 64 * 1024
+
+// sniffLines è il numero massimo di righe esaminate per riconoscere il separatore CSV.
+const sniffLines = 10
+
+// Record è un record estratto da un file: l'email, nella forma canonica, e i campi
+// che la mappatura associa all'email, così come compaiono nel file.
+type Record struct {
+	Email    string
+	Username string
+	Password string
+	Phone    string
+	Name     string
+	IP       string
+}
+
+// Field è un campo di Record che può essere associato a una colonna.
+type Field string
+
+const (
+	FieldEmail    Field = "email"
+	FieldUsername Field = "username"
+	FieldPassword Field = "password"
+	FieldPhone    Field = "phone"
+	FieldName     Field = "name"
+	FieldIP       Field = "ip"
+)
+
+// Fields sono i campi di Record, nell'ordine del form di upload.
+var Fields = []Field{FieldEmail, FieldUsername, FieldPassword, FieldPhone, FieldName, FieldIP}
+
+// set assegna al campo f del record il valore value.
+func (r *Record) set(f Field, value string) {
+	switch f {
+	case FieldUsername:
+		r.Username = value
+	case FieldPassword:
+		r.Password = value
+	case FieldPhone:
+		r.Phone = value
+	case FieldName:
+		r.Name = value
+	case FieldIP:
+		r.IP = value
+	}
+}
+
+// knownColumns sono i nomi di colonna riconosciuti per ogni campo, confrontati con columnKey.
+var knownColumns = map[Field][]string{
+	FieldEmail:    {"email", "mail", "emailaddress", "useremail", "courriel"},
+	FieldUsername: {"username", "user", "login", "nickname", "nick", "userid", "account"},
+	FieldPassword: {"password", "pass", "passwd", "pwd", "hash", "passwordhash", "passhash"},
+	FieldPhone:    {"phone", "phonenumber", "telephone", "tel", "mobile", "cell", "telefono", "cellulare"},
+	FieldName:     {"name", "fullname", "displayname", "nome"},
+	FieldIP:       {"ip", "ipaddress", "ipaddr", "lastip", "regip", "registrationip", "loginip"},
+}
+
+// columnKey riduce il nome di una colonna alla forma confrontata con knownColumns:
+// minuscolo, senza spazi, trattini e underscore.
+func columnKey(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '_', '.':
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(name)))
+}
+
+// knownField restituisce il campo che corrisponde al nome di colonna, se è riconosciuto.
+func knownField(name string) (Field, bool) {
+	key := columnKey(name)
+	for _, field := range Fields {
+		for _, known := range knownColumns[field] {
+			if key == known {
+				return field, true
+			}
+		}
+	}
+	return "", false
+}
+
+// FieldCounts conta i valori non vuoti dei campi diversi dall'email nei record estratti.
+type FieldCounts struct {
+	Username int64 `json:"username"`
+	Password int64 `json:"password"`
+	Phone    int64 `json:"phone"`
+	Name     int64 `json:"name"`
+	IP       int64 `json:"ip"`
+}
+
+// count conta i campi valorizzati del record.
+func (c *FieldCounts) count(r Record) {
+	if r.Username != "" {
+		c.Username++
+	}
+	if r.Password != "" {
+		c.Password++
+	}
+	if r.Phone != "" {
+		c.Phone++
+	}
+	if r.Name != "" {
+		c.Name++
+	}
+	if r.IP != "" {
+		c.IP++
+	}
+}
+
+// Add somma i conteggi di altri record.
+func (c *FieldCounts) Add(other FieldCounts) {
+	c.Username += other.Username
+	c.Password += other.Password
+	c.Phone += other.Phone
+	c.Name += other.Name
+	c.IP += other.IP
+}
+
+// Format è il formato di un file.
+type Format string
+
+const (
+	// FormatAuto riconosce il formato dal contenuto e dall'estensione
+	FormatAuto Format = ""
+	// FormatText cerca le email nel testo con un'espressione regolare (Extract)
+	FormatText Format = "text"
+	// FormatCSV legge righe di valori separati da un delimitatore (CSV, TSV, ...)
+	FormatCSV Format = "csv"
+	// FormatJSON legge un array di oggetti o una sequenza di oggetti, compreso NDJSON
+	FormatJSON Format = "json"
+	// FormatCombo legge le combo list: email e password o hash, con altri valori, separati da un delimitatore
+	FormatCombo Format = "combo"
+	// FormatSQL legge le righe di un dump SQL (INSERT INTO ... VALUES, COPY ... FROM stdin)
+	FormatSQL Format = "sql"
+)
+
+// Header indica se la prima riga di un CSV è l'intestazione.
+type Header string
+
+const (
+	// HeaderAuto considera intestazione la prima riga se non contiene email valide
+	HeaderAuto Header = ""
+	HeaderYes  Header = "yes"
+	HeaderNo   Header = "no"
+)
+
+// Mapping indica come leggere i file strutturati: formato, separatore e colonne dei campi.
+// I valori vuoti vengono riconosciuti dal contenuto.
+type Mapping struct {
+	Format Format `json:"format,omitempty"`
+	// Delimiter è il separatore delle colonne CSV e dei valori delle combo list
+	Delimiter string `json:"delimiter,omitempty"`
+	Header    Header `json:"header,omitempty"`
+	// Table è la tabella di un dump SQL da leggere; vuota per tutte
+	Table string `json:"table,omitempty"`
+	// Columns associa ai campi la colonna CSV o SQL (nome nell'intestazione o numero, da 1)
+	// o la chiave JSON (i punti separano le chiavi degli oggetti annidati)
+	Columns map[Field]string `json:"columns,omitempty"`
+}
+
+// Validate verifica i valori della mappatura.
+func (m Mapping) Validate() error {
+	switch m.Format {
+	case FormatAuto, FormatText, FormatCSV, FormatJSON, FormatSQL, FormatCombo:
+	default:
+		return fmt.Errorf("formato %q non supportato (text, csv, json, sql o combo)", m.Format)
+	}
+	switch m.Header {
+	case HeaderAuto, HeaderYes, HeaderNo:
+	default:
+		return fmt.Errorf("valore %q non valido per l'intestazione (yes, no o vuoto)", m.Header)
+	}
+	if _, err := m.delimiter(); err != nil {
+		return err
+	}
+	for field := range m.Columns {
+		if _, ok := knownColumns[field]; !ok {
+			return fmt.Errorf("campo %q sconosciuto", field)
+		}
+	}
+	return nil
+}
+
+// delimiter restituisce il separatore indicato, o 0 se va riconosciuto. "tab" e "\t" indicano la tabulazione.
+func (m Mapping) delimiter() (rune, error) {
+	switch m.Delimiter {
+	case "":
+		return 0, nil
+	case "tab", `\t`:
+		return '\t', nil
+	}
+	runes := []rune(m.Delimiter)
+	if len(runes) != 1 || runes[0] == '"' || runes[0] == '\r' || runes[0] == '\n' {
+		return 0, fmt.Errorf("separatore %q non valido: deve essere un solo carattere", m.Delimiter)
+	}
+	return runes[0], nil
+}
+
+// column restituisce l'indice, da 0, della colonna indicata per numero (da 1), o -1.
+func column(spec string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(spec))
+	if err != nil || n < 1 {
+		return -1
+	}
+	return n - 1
+}
+
+// Parser estrae i record da r, aggiornando stats, e chiama emit per ognuno;
+// si interrompe al primo errore di emit o quando ctx viene annullato.
+type Parser func(ctx context.Context, r io.Reader, stats *Stats, emit func(Record) error) error
+
+// NewParser restituisce il Parser per il file name. Con FormatAuto il formato viene scelto
+// all'inizio della lettura: SQL se l'estensione è .sql o il contenuto ha istruzioni CREATE TABLE,
+// INSERT INTO o COPY, JSON se il contenuto inizia con '[' o '{', CSV se l'estensione
+// è .csv o .tsv, combo list se la maggior parte delle prime righe ha un'email come primo o secondo valore
+// separato da ':', ';', '|' o da una tabulazione, CSV se le prime righe hanno lo stesso numero di separatori e contengono
+// un'email o un'intestazione riconosciuta, altrimenti testo.
+func NewParser(name string, normalizer *normalize.Normalizer, mapping Mapping) Parser {
+	return func(ctx context.Context, r io.Reader, stats *Stats, emit func(Record) error) error {
+		delimiter, err := mapping.delimiter()
+		if err != nil {
+			return err
+		}
+		br := bufio.NewReaderSize(r, sniffBytes)
+		format := mapping.Format
+		if format == FormatAuto {
+			head, err := br.Peek(sniffBytes)
+			if err != nil && err != io.EOF {
+				return err
+			}
+			format, delimiter = detectFormat(name, head, delimiter, normalizer)
+		}
+
+		switch format {
+		case FormatCSV:
+			if delimiter == 0 {
+				head, err := br.Peek(sniffBytes)
+				if err != nil && err != io.EOF {
+					return err
+				}
+				if delimiter = sniffDelimiter(head); delimiter == 0 {
+					delimiter = ','
+				}
+			}
+			stats.Format = fmt.Sprintf("csv (%q)", delimiter)
+			return parseCSV(ctx, br, normalizer, mapping, delimiter, stats, emit)
+		case FormatJSON:
+			stats.Format = string(FormatJSON)
+			return parseJSON(ctx, br, normalizer, mapping, stats, emit)
+		case FormatCombo:
+			if delimiter == 0 {
+				head, err := br.Peek(sniffBytes)
+				if err != nil && err != io.EOF {
+					return err
+				}
+				if delimiter = sniffCombo(head, 0, normalizer); delimiter == 0 {
+					delimiter = ':'
+				}
+			}
+			stats.Format = fmt.Sprintf("combo (%q)", delimiter)
+			return parseCombo(ctx, br, normalizer, delimiter, stats, emit)
+		case FormatSQL:
+			stats.Format = string(FormatSQL)
+			return parseSQL(ctx, br, normalizer, mapping, stats, emit)
+		default:
+			stats.Format = string(FormatText)
+			return Extract(ctx, br, normalizer, stats, func(email string) error {
+				return emit(Record{Email: email})
+			})
+		}
+	}
+}
+
+// detectFormat riconosce il formato dall'inizio del contenuto e dall'estensione del file.
+func detectFormat(name string, head []byte, delimiter rune, normalizer *normalize.Normalizer) (Format, rune) {
+	if strings.EqualFold(path.Ext(name), ".sql") || sqlStatements.Match(head) {
+		return FormatSQL, delimiter
+	}
+	trimmed := bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")), " \t\r\n")
+	if len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		return FormatJSON, delimiter
+	}
+	switch strings.ToLower(path.Ext(name)) {
+	case ".json", ".ndjson", ".jsonl":
+		return FormatJSON, delimiter
+	case ".tsv":
+		if delimiter == 0 {
+			delimiter = '\t'
+		}
+		return FormatCSV, delimiter
+	case ".csv":
+		return FormatCSV, delimiter
+	}
+
+	if combo := sniffCombo(head, delimiter, normalizer); combo != 0 {
+		return FormatCombo, combo
+	}
+	if delimiter == 0 {
+		delimiter = sniffDelimiter(head)
+	}
+	if delimiter == 0 {
+		return FormatText, 0
+	}
+	// Un testo qualsiasi può contenere virgole: è un CSV solo se un valore è un'email o un'intestazione nota
+	for _, line := range sniffedLines(head) {
+		for _, value := range strings.Split(string(line), string(delimiter)) {
+			value = strings.Trim(strings.TrimSpace(value), `"`)
+			if _, ok := knownField(value); ok {
+				return FormatCSV, delimiter
+			}
+			if _, err := normalizer.Email(value); err == nil {
+				return FormatCSV, delimiter
+			}
+		}
+	}
+	return FormatText, 0
+}
+
+// sqlStatements riconosce un dump SQL: un'istruzione CREATE TABLE, INSERT INTO o COPY ... FROM stdin a inizio riga.
+var sqlStatements = regexp.MustCompile(`(?im)^\s*(CREATE\s+TABLE\s|INSERT\s+INTO\s|COPY\s+\S+.*\sFROM\s+stdin)`)
+
+// sniffedLines restituisce le prime righe complete di head, al massimo sniffLines.
+func sniffedLines(head []byte) [][]byte {
+	lines := bytes.Split(head, []byte("\n"))
+	if len(lines) > 1 {
+		// L'ultima riga potrebbe essere troncata
+		lines = lines[:len(lines)-1]
+	}
+	var result [][]byte
+	for _, line := range lines {
+		if line = bytes.TrimRight(line, "\r"); len(line) > 0 {
+			result = append(result, line)
+		}
+		if len(result) == sniffLines {
+			break
+		}
+	}
+	return result
+}
+
+// sniffDelimiter restituisce il separatore che compare lo stesso numero di volte, almeno una,
+// in tutte le prime righe, preferendo quello più frequente; 0 se nessuno è coerente.
+func sniffDelimiter(head []byte) rune {
+	lines := sniffedLines(head)
+	if len(lines) == 0 {
+		return 0
+	}
+	var best rune
+	bestCount := 0
+	for _, candidate := range []rune{',', ';', '\t', '|'} {
+		count := bytes.Count(lines[0], []byte(string(candidate)))
+		if count == 0 || count <= bestCount {
+			continue
+		}
+		consistent := true
+		for _, line := range lines[1:] {
+			if bytes.Count(line, []byte(string(candidate))) != count {
+				consistent = false
+				break
+			}
+		}
+		if consistent {
+			best, bestCount = candidate, count
+		}
+	}
+	return best
+}
@@ -0,0 +1,107 @@
+package extractor
+
+import (
+	"pwnscanner/pkg/normalize"
+	"testing"
+)
+
+func TestDetectFormat(t *testing.T) {
+	normalizer := normalize.New(normalize.Options{})
+	for _, tc := range []struct {
+		name      string
+		file      string
+		head      string
+		delimiter rune
+		format    Format
+		want      rune
+	}{
+		{name: "estensione .sql", file: "dump.sql", head: "qualsiasi testo\n", format: FormatSQL},
+		{name: "INSERT INTO", file: "dump.txt", head: "-- dump\nINSERT INTO users VALUES ('a@example.com');\n", format: FormatSQL},
+		{name: "COPY FROM stdin", file: "dump", head: "COPY public.users (email) FROM stdin;\n", format: FormatSQL},
+		{name: "array JSON", file: "users.txt", head: "\xef\xbb\xbf  [{\"email\": \"a@example.com\"}]", format: FormatJSON},
+		{name: "NDJSON", file: "users.txt", head: "{\"email\": \"a@example.com\"}\n{\"email\": \"b@example.com\"}\n", format: FormatJSON},
+		{name: "estensione .jsonl", file: "users.jsonl", head: "\n", format: FormatJSON},
+		{name: "estensione .tsv", file: "users.tsv", head: "a\tb\n", format: FormatCSV, want: '\t'},
+		{name: "estensione .tsv, separatore indicato", file: "users.tsv", head: "a;b\n", delimiter: ';', format: FormatCSV, want: ';'},
+		{name: "estensione .csv", file: "users.csv", head: "a;b\n", format: FormatCSV},
+		{
+			name:   "combo list",
+			file:   "combo.txt",
+			head:   "a@example.com:password\nb@example.com:123456\nriga malformata\n",
+			format: FormatCombo, want: ':',
+		},
+		{
+			name:   "combo list con username",
+			file:   "combo.txt",
+			head:   "alice|a@example.com|password\nbob|b@example.com|123456\n",
+			format: FormatCombo, want: '|',
+		},
+		{
+			name:   "CSV con intestazione nota",
+			file:   "users.txt",
+			head:   "id,email,name\n1,a@example.com,Alice\n2,b@example.com,Bob\n",
+			format: FormatCSV, want: ',',
+		},
+		{
+			name:   "intestazione nota: non è una combo list",
+			file:   "users.txt",
+			head:   "email;password\na@example.com;x\nb@example.com;y\n",
+			format: FormatCSV, want: ';',
+		},
+		{
+			name:   "virgole senza email né intestazione",
+			file:   "notes.txt",
+			head:   "uno, due, tre\nquattro, cinque, sei\n",
+			format: FormatText,
+		},
+		{name: "testo", file: "paste.txt", head: "contatti: a@example.com e b@example.com\n", format: FormatText},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			format, delimiter := detectFormat(tc.file, []byte(tc.head), tc.delimiter, normalizer)
+			if format != tc.format || delimiter != tc.want {
+				t.Errorf("detectFormat = %q, %q; attesi %q, %q", format, delimiter, tc.format, tc.want)
+			}
+		})
+	}
+}
+
+func TestSniffDelimiter(t *testing.T) {
+	for _, tc := range []struct {
+		head string
+		want rune
+	}{
+		{"a,b,c\n1,2,3\n", ','},
+		{"a;b\n1;2\n", ';'},
+		{"a\tb\n1\t2\n", '\t'},
+		// la virgola non è coerente tra le righe, il punto e virgola sì
+		{"a;b,c\n1;2\n", ';'},
+		{"a,b\n1,2,3\n", 0},
+		{"", 0},
+	} {
+		if got := sniffDelimiter([]byte(tc.head)); got != tc.want {
+			t.Errorf("sniffDelimiter(%q) = %q, atteso %q", tc.head, got, tc.want)
+		}
+	}
+}
+
+func TestMappingValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		mapping Mapping
+		valid   bool
+	}{
+		{"vuota", Mapping{}, true},
+		{"completa", Mapping{Format: FormatCSV, Delimiter: "tab", Header: HeaderYes, Columns: map[Field]string{FieldEmail: "2"}}, true},
+		{"formato sconosciuto", Mapping{Format: "xml"}, false},
+		{"intestazione non valida", Mapping{Header: "forse"}, false},
+		{"separatore di più caratteri", Mapping{Delimiter: "::"}, false},
+		{"separatore virgolette", Mapping{Delimiter: `"`}, false},
+		{"campo sconosciuto", Mapping{Columns: map[Field]string{"address": "1"}}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.mapping.Validate(); (err == nil) != tc.valid {
+				t.Errorf("Validate() = %v, valida attesa: %v", err, tc.valid)
+			}
+		})
+	}
+}
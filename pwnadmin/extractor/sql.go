@@ -0,0 +1,867 @@
+package extractor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"pwnscanner/pkg/normalize"
+	"strings"
+)
+
+// maxValueBytes è la lunghezza massima conservata di un valore SQL: i valori più lunghi, come i blob,
+// vengono letti per intero ma troncati, perché non possono essere un'email o un altro campo di Record.
+const maxValueBytes = 4096
+
+// createSkipWords sono le parole che iniziano le definizioni di CREATE TABLE che non sono colonne.
+var createSkipWords = map[string]bool{
+	"PRIMARY": true, "KEY": true, "UNIQUE": true, "CONSTRAINT": true, "INDEX": true, "FOREIGN": true,
+	"CHECK": true, "FULLTEXT": true, "SPATIAL": true, "EXCLUDE": true, "LIKE": true, "PERIOD": true,
+}
+
+// insertModifiers sono le parole che possono precedere il nome della tabella in INSERT e REPLACE.
+var insertModifiers = map[string]bool{
+	"LOW_PRIORITY": true, "DELAYED": true, "HIGH_PRIORITY": true, "IGNORE": true, "INTO": true,
+}
+
+// parseSQL legge un dump SQL di MySQL/MariaDB o PostgreSQL un'istruzione alla volta: i nomi delle colonne
+// vengono presi da CREATE TABLE o dalla lista di colonne di INSERT e COPY, i record dalle tuple di
+// INSERT INTO ... VALUES e dai dati di COPY ... FROM stdin. Le altre istruzioni vengono saltate.
+// Con Mapping.Table vengono lette solo le righe di quella tabella; senza, quelle di tutte le tabelle
+// in cui si trova la colonna dell'email, indicata, riconosciuta dal nome o dal contenuto come nei CSV.
+func parseSQL(ctx context.Context, r io.Reader, normalizer *normalize.Normalizer, mapping Mapping, stats *Stats, emit func(Record) error) error {
+	p := &sqlParser{
+		ctx:        ctx,
+		s:          &sqlScanner{r: bufio.NewReader(r), stats: stats},
+		normalizer: normalizer,
+		mapping:    mapping,
+		stats:      stats,
+		emit:       emit,
+		tables:     make(map[string]*sqlTable),
+	}
+	err := p.parse()
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("dump SQL troncato: %w", err)
+	}
+	return err
+}
+
+// sqlTable è lo stato di una tabella del dump.
+type sqlTable struct {
+	// columns sono i nomi delle colonne da CREATE TABLE
+	columns []string
+	// email è la colonna dell'email riconosciuta dal contenuto, o -1
+	email int
+}
+
+// sqlParser contiene lo stato di parseSQL.
+type sqlParser struct {
+	ctx        context.Context
+	s          *sqlScanner
+	normalizer *normalize.Normalizer
+	mapping    Mapping
+	stats      *Stats
+	emit       func(Record) error
+	tables     map[string]*sqlTable
+	rows       int
+}
+
+// parse legge le istruzioni fino alla fine del dump.
+func (p *sqlParser) parse() error {
+	for {
+		if err := p.s.skipSpace(); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		c, err := p.s.peek()
+		if err != nil {
+			return err
+		}
+		if c == ';' {
+			p.s.next()
+			continue
+		}
+		word, err := p.s.word()
+		if err != nil {
+			return err
+		}
+		switch word {
+		case "CREATE":
+			err = p.create()
+		case "INSERT", "REPLACE":
+			err = p.insert()
+		case "COPY":
+			err = p.copy()
+		case "LOCK":
+			// LOCK TABLES compare solo nei dump di MySQL
+			p.s.backslashes = true
+			err = p.s.skipStatement()
+		case "SET":
+			err = p.set()
+		default:
+			err = p.s.skipStatement()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// set legge SET standard_conforming_strings di PostgreSQL, che con off fa interpretare la barra
+// rovesciata nelle stringhe come in MySQL; le altre istruzioni SET vengono saltate.
+func (p *sqlParser) set() error {
+	// SET [SESSION | LOCAL] standard_conforming_strings { = | TO } { on | off | 'on' | 'off' };
+	name, err := p.s.identifier()
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(name, "SESSION") || strings.EqualFold(name, "LOCAL") {
+		if name, err = p.s.identifier(); err != nil {
+			return err
+		}
+	}
+	if !strings.EqualFold(name, "standard_conforming_strings") {
+		return p.s.skipStatement()
+	}
+	if err := p.s.skipSpace(); err != nil {
+		return err
+	}
+	if c, err := p.s.peek(); err == nil && c == '=' {
+		p.s.next()
+	} else if _, err := p.s.word(); err != nil {
+		return err
+	}
+	if err := p.s.skipSpace(); err != nil {
+		return err
+	}
+	var value string
+	if c, err := p.s.peek(); err == nil && c == '\'' {
+		p.s.next()
+		if value, err = p.s.quoted('\'', false); err != nil {
+			return err
+		}
+	} else if value, err = p.s.word(); err != nil {
+		return err
+	}
+	switch strings.ToUpper(value) {
+	case "OFF":
+		p.s.backslashes = true
+	case "ON":
+		p.s.backslashes = false
+	}
+	return p.s.skipStatement()
+}
+
+// table restituisce lo stato della tabella name, creandolo se serve.
+func (p *sqlParser) table(name string) *sqlTable {
+	key := strings.ToLower(name)
+	t, ok := p.tables[key]
+	if !ok {
+		t = &sqlTable{email: -1}
+		p.tables[key] = t
+	}
+	return t
+}
+
+// wanted indica se le righe della tabella vanno lette.
+func (p *sqlParser) wanted(name string) bool {
+	table := strings.TrimSpace(p.mapping.Table)
+	return table == "" || strings.EqualFold(table, name)
+}
+
+// create legge le colonne di CREATE TABLE; le altre istruzioni CREATE vengono saltate.
+func (p *sqlParser) create() error {
+	// CREATE [TEMPORARY | UNLOGGED | ...] TABLE [IF NOT EXISTS] nome (definizioni) opzioni;
+	for i := 0; ; i++ {
+		if err := p.s.skipSpace(); err != nil {
+			return err
+		}
+		word, err := p.s.word()
+		if err != nil {
+			return err
+		}
+		if word == "TABLE" {
+			break
+		}
+		if word == "" || i == 3 {
+			return p.s.skipStatement()
+		}
+	}
+	name, err := p.s.identifier()
+	if err != nil {
+		return err
+	}
+	for _, keyword := range []string{"IF", "NOT", "EXISTS"} {
+		if !strings.EqualFold(name, keyword) {
+			break
+		}
+		if name, err = p.s.identifier(); err != nil {
+			return err
+		}
+	}
+	if err := p.s.skipSpace(); err != nil {
+		return err
+	}
+	if c, err := p.s.peek(); err != nil || c != '(' {
+		// CREATE TABLE ... AS SELECT o LIKE: nessuna colonna da leggere
+		return p.s.skipStatement()
+	}
+	p.s.next()
+
+	var columns []string
+	for {
+		column, err := p.s.identifier()
+		if err != nil {
+			return err
+		}
+		if column != "" && !createSkipWords[strings.ToUpper(column)] {
+			columns = append(columns, column)
+		}
+		// Salta il resto della definizione, fino alla virgola o alla parentesi che chiude la lista
+		end, err := p.s.skipUntil(',', ')')
+		if err != nil {
+			return err
+		}
+		if end == ')' {
+			break
+		}
+	}
+	p.table(name).columns = columns
+	return p.s.skipStatement()
+}
+
+// insert legge le tuple di INSERT INTO ... VALUES; le altre forme di INSERT vengono saltate.
+func (p *sqlParser) insert() error {
+	var name string
+	for {
+		word, err := p.s.identifier()
+		if err != nil {
+			return err
+		}
+		if !insertModifiers[strings.ToUpper(word)] {
+			name = word
+			break
+		}
+	}
+	columns, err := p.columnList()
+	if err != nil {
+		return err
+	}
+	if err := p.s.skipSpace(); err != nil {
+		return err
+	}
+	word, err := p.s.word()
+	if err != nil {
+		return err
+	}
+	if name == "" || (word != "VALUES" && word != "VALUE") {
+		return p.s.skipStatement()
+	}
+
+	read := p.wanted(name)
+	fields, table, err := p.resolve(name, columns, read)
+	if err != nil {
+		return err
+	}
+	var values []string
+	for {
+		if err := p.s.skipSpace(); err != nil {
+			return err
+		}
+		c, err := p.s.next()
+		if err != nil {
+			return err
+		}
+		if c != '(' {
+			return fmt.Errorf("dump SQL non valido: atteso '(' nella tupla di INSERT INTO %s, trovato %q", name, c)
+		}
+		values = values[:0]
+		for {
+			value, end, err := p.s.value()
+			if err != nil {
+				return err
+			}
+			values = append(values, value)
+			if end == ')' {
+				break
+			}
+		}
+		if read && fields != nil {
+			if err := p.row(table, fields, values); err != nil {
+				return err
+			}
+		}
+
+		if err := p.s.skipSpace(); err != nil {
+			return err
+		}
+		c, err = p.s.peek()
+		if err != nil {
+			return err
+		}
+		if c != ',' {
+			// Fine delle tuple: ';' oppure ON DUPLICATE KEY UPDATE ... / ON CONFLICT ...
+			return p.s.skipStatement()
+		}
+		p.s.next()
+	}
+}
+
+// copy legge i dati di COPY ... FROM stdin, nel formato testo di pg_dump: una riga per record,
+// valori separati da tabulazioni, \N per NULL e sequenze di escape con la barra rovesciata.
+func (p *sqlParser) copy() error {
+	name, err := p.s.identifier()
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(name, "ONLY") {
+		if name, err = p.s.identifier(); err != nil {
+			return err
+		}
+	}
+	columns, err := p.columnList()
+	if err != nil {
+		return err
+	}
+	statement, err := p.s.statementText()
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(strings.ToUpper(statement), "STDIN") {
+		return nil
+	}
+
+	read := p.wanted(name)
+	fields, table, err := p.resolve(name, columns, read)
+	if err != nil {
+		return err
+	}
+	// I dati iniziano alla riga successiva all'istruzione
+	if _, err := p.s.line(); err != nil {
+		return err
+	}
+	var values []string
+	for {
+		line, err := p.s.line()
+		if err != nil {
+			return err
+		}
+		if line == `\.` {
+			return nil
+		}
+		if !read || fields == nil {
+			continue
+		}
+		values = values[:0]
+		for _, value := range strings.Split(line, "\t") {
+			values = append(values, copyUnescape(value))
+		}
+		if err := p.row(table, fields, values); err != nil {
+			return err
+		}
+	}
+}
+
+// columnList legge la lista di colonne tra parentesi che segue il nome della tabella, se presente.
+func (p *sqlParser) columnList() ([]string, error) {
+	if err := p.s.skipSpace(); err != nil {
+		return nil, err
+	}
+	if c, err := p.s.peek(); err != nil || c != '(' {
+		return nil, err
+	}
+	p.s.next()
+	var columns []string
+	for {
+		column, err := p.s.identifier()
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+		if err := p.s.skipSpace(); err != nil {
+			return nil, err
+		}
+		c, err := p.s.next()
+		if err != nil {
+			return nil, err
+		}
+		if c == ')' {
+			return columns, nil
+		}
+		if c != ',' {
+			return nil, fmt.Errorf("dump SQL non valido: carattere %q nella lista di colonne", c)
+		}
+	}
+}
+
+// resolve restituisce le colonne dei campi per le righe di un'istruzione sulla tabella name, con le
+// colonne dell'istruzione o, se mancano, quelle di CREATE TABLE. Restituisce campi nil se la tabella
+// va saltata perché una colonna indicata per nome non esiste: è un errore solo se la tabella è
+// quella scelta con Mapping.Table.
+func (p *sqlParser) resolve(name string, columns []string, read bool) (map[Field]int, *sqlTable, error) {
+	table := p.table(name)
+	if !read {
+		return nil, table, nil
+	}
+	if columns == nil {
+		columns = table.columns
+	}
+	fields, err := csvColumns(p.mapping.Columns, columns)
+	if err != nil {
+		if p.mapping.Table != "" {
+			return nil, table, fmt.Errorf("tabella %s: %w", name, err)
+		}
+		return nil, table, nil
+	}
+	return fields, table, nil
+}
+
+// row emette il record di una riga della tabella.
+func (p *sqlParser) row(table *sqlTable, fields map[Field]int, values []string) error {
+	if p.rows++; p.rows%contextCheckLines == 0 {
+		if err := p.ctx.Err(); err != nil {
+			return err
+		}
+	}
+	index, ok := fields[FieldEmail]
+	if !ok {
+		if table.email < 0 {
+			for i, value := range values {
+				if _, err := p.normalizer.Email(strings.TrimSpace(value)); err == nil {
+					table.email = i
+					break
+				}
+			}
+		}
+		if index = table.email; index < 0 {
+			return nil
+		}
+	}
+	if index >= len(values) || strings.TrimSpace(values[index]) == "" {
+		return nil
+	}
+	email, err := p.normalizer.Email(strings.TrimSpace(values[index]))
+	if err != nil {
+		p.stats.Rejected++
+		return nil
+	}
+
+	record := Record{Email: email}
+	for field, i := range fields {
+		if field != FieldEmail && i < len(values) {
+			record.set(field, strings.TrimSpace(values[i]))
+		}
+	}
+	p.stats.Emails++
+	p.stats.Fields.count(record)
+	return p.emit(record)
+}
+
+// copyUnescape decodifica un valore del formato testo di COPY.
+func copyUnescape(value string) string {
+	if value == `\N` {
+		return ""
+	}
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i == len(value)-1 {
+			b.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			b.WriteByte(value[i])
+		}
+	}
+	return b.String()
+}
+
+// sqlScanner legge il dump un byte alla volta, contando i byte letti in stats.Read.
+type sqlScanner struct {
+	r     *bufio.Reader
+	stats *Stats
+	// backslashes indica che nelle stringhe tra apici la barra rovesciata introduce una sequenza di escape,
+	// come nei dump di MySQL, riconosciuti da nomi tra backtick, commenti /*! ... */ o LOCK TABLES,
+	// e in PostgreSQL con standard_conforming_strings = off. Altrimenti la barra è un carattere come
+	// gli altri, tranne nelle stringhe E'...' di PostgreSQL.
+	backslashes bool
+}
+
+// next legge un byte.
+func (s *sqlScanner) next() (byte, error) {
+	c, err := s.r.ReadByte()
+	if err == nil {
+		s.stats.Read++
+	}
+	return c, err
+}
+
+// peek restituisce il prossimo byte senza leggerlo.
+func (s *sqlScanner) peek() (byte, error) {
+	b, err := s.r.Peek(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// skipSpace salta spazi e commenti (-- e # fino a fine riga, /* ... */). I commenti condizionali
+// di MySQL (/*!40101 ... */) contengono solo impostazioni e vengono saltati anch'essi.
+func (s *sqlScanner) skipSpace() error {
+	for {
+		b, err := s.r.Peek(2)
+		if len(b) == 0 {
+			return err
+		}
+		switch {
+		case b[0] == ' ' || b[0] == '\t' || b[0] == '\r' || b[0] == '\n':
+			s.next()
+		case b[0] == '#' || bytes.HasPrefix(b, []byte("--")):
+			if _, err := s.line(); err != nil {
+				return err
+			}
+		case bytes.HasPrefix(b, []byte("/*")):
+			s.next()
+			s.next()
+			if c, err := s.peek(); err == nil && c == '!' {
+				s.backslashes = true
+			}
+			for previous := byte(0); ; {
+				c, err := s.next()
+				if err != nil {
+					return unexpectedEOF(err)
+				}
+				if previous == '*' && c == '/' {
+					break
+				}
+				previous = c
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// word legge una parola chiave e la restituisce in maiuscolo; "" se il prossimo carattere non è una lettera.
+func (s *sqlScanner) word() (string, error) {
+	var b strings.Builder
+	for {
+		c, err := s.peek()
+		if err == io.EOF && b.Len() > 0 {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if !isWordByte(c) {
+			break
+		}
+		s.next()
+		b.WriteByte(c)
+	}
+	return strings.ToUpper(b.String()), nil
+}
+
+// identifier legge un nome, anche tra virgolette (`nome`, "nome", [nome]) o qualificato con lo schema,
+// e ne restituisce l'ultima parte: public.users diventa users.
+func (s *sqlScanner) identifier() (string, error) {
+	var name string
+	for {
+		if err := s.skipSpace(); err != nil {
+			return "", unexpectedEOF(err)
+		}
+		c, err := s.peek()
+		if err != nil {
+			return "", unexpectedEOF(err)
+		}
+		switch c {
+		case '`', '"', '[':
+			s.next()
+			closing := c
+			switch c {
+			case '[':
+				closing = ']'
+			case '`':
+				s.backslashes = true
+			}
+			if name, err = s.quoted(closing, false); err != nil {
+				return "", err
+			}
+		default:
+			var b strings.Builder
+			for {
+				c, err := s.peek()
+				if err != nil && err != io.EOF {
+					return "", err
+				}
+				if err == io.EOF || !(isWordByte(c) || c == '$') {
+					break
+				}
+				s.next()
+				b.WriteByte(c)
+			}
+			name = b.String()
+		}
+		if c, err := s.peek(); err != nil || c != '.' {
+			return name, nil
+		}
+		s.next()
+	}
+}
+
+// value legge un valore di una tupla di INSERT e restituisce il carattere che lo termina, ',' o ')'.
+// I valori tra apici vengono decodificati; NULL e gli altri valori senza apici restano come sono,
+// tranne le stringhe con prefisso (_utf8mb4'...', E'...', N'...') di cui viene restituito il contenuto.
+// La barra rovesciata introduce una sequenza di escape secondo s.backslashes e nelle stringhe E'...'.
+func (s *sqlScanner) value() (string, byte, error) {
+	var b strings.Builder
+	quoted := false
+	depth := 0
+	if err := s.skipSpace(); err != nil {
+		return "", 0, unexpectedEOF(err)
+	}
+	for {
+		c, err := s.next()
+		if err != nil {
+			return "", 0, unexpectedEOF(err)
+		}
+		switch {
+		case c == '\'' || c == '"':
+			escapes := s.backslashes || strings.EqualFold(strings.TrimSpace(b.String()), "E")
+			content, err := s.quoted(c, escapes)
+			if err != nil {
+				return "", 0, err
+			}
+			b.Reset()
+			b.WriteString(truncate(content))
+			quoted = true
+		case c == '(':
+			depth++
+			b.WriteByte(c)
+		case c == ')' && depth > 0:
+			depth--
+			b.WriteByte(c)
+		case (c == ',' || c == ')') && depth == 0:
+			value := b.String()
+			if !quoted {
+				value = strings.TrimSpace(value)
+				if strings.EqualFold(value, "NULL") {
+					value = ""
+				}
+			}
+			return value, c, nil
+		case !quoted && b.Len() < maxValueBytes:
+			b.WriteByte(c)
+		}
+	}
+}
+
+// quoted legge il contenuto tra apici fino a closing, già letto quello di apertura. closing ripetuto
+// vale come carattere; con escapes la barra rovesciata introduce una sequenza di escape (MySQL, E'...').
+// Il contenuto oltre maxValueBytes viene letto ma scartato.
+func (s *sqlScanner) quoted(closing byte, escapes bool) (string, error) {
+	var b strings.Builder
+	write := func(c byte) {
+		if b.Len() < maxValueBytes {
+			b.WriteByte(c)
+		}
+	}
+	for {
+		c, err := s.next()
+		if err != nil {
+			return "", unexpectedEOF(err)
+		}
+		switch {
+		case c == '\\' && escapes:
+			c, err := s.next()
+			if err != nil {
+				return "", unexpectedEOF(err)
+			}
+			switch c {
+			case 'n':
+				write('\n')
+			case 't':
+				write('\t')
+			case 'r':
+				write('\r')
+			case '0':
+				write(0)
+			default:
+				write(c)
+			}
+		case c == closing:
+			if next, err := s.peek(); err == nil && next == closing {
+				s.next()
+				write(c)
+				continue
+			}
+			return b.String(), nil
+		default:
+			write(c)
+		}
+	}
+}
+
+// skipUntil salta il testo fino a uno dei caratteri indicati, fuori da apici e parentesi,
+// e restituisce quello trovato.
+func (s *sqlScanner) skipUntil(stops ...byte) (byte, error) {
+	depth := 0
+	for previous := byte(0); ; {
+		c, err := s.next()
+		if err != nil {
+			return 0, unexpectedEOF(err)
+		}
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			if _, err := s.quoted(c, s.escapes(c, previous)); err != nil {
+				return 0, err
+			}
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		case depth == 0 && bytes.IndexByte(stops, c) >= 0:
+			return c, nil
+		}
+		previous = c
+	}
+}
+
+// skipStatement salta il resto dell'istruzione, fino al punto e virgola fuori da apici, parentesi
+// e blocchi $tag$ ... $tag$ di PostgreSQL.
+func (s *sqlScanner) skipStatement() error {
+	_, err := s.statementText()
+	return err
+}
+
+// statementText legge il resto dell'istruzione come skipStatement e ne restituisce il testo fuori dagli apici,
+// al più maxValueBytes byte.
+func (s *sqlScanner) statementText() (string, error) {
+	var text strings.Builder
+	for previous := byte(0); ; {
+		c, err := s.next()
+		if err == io.EOF {
+			return text.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		switch c {
+		case '\'', '"', '`':
+			if _, err := s.quoted(c, s.escapes(c, previous)); err != nil {
+				return "", err
+			}
+		case '$':
+			if err := s.skipDollarQuoted(); err != nil {
+				return "", err
+			}
+		case ';':
+			return text.String(), nil
+		default:
+			if text.Len() < maxValueBytes {
+				text.WriteByte(c)
+			}
+		}
+		previous = c
+	}
+}
+
+// escapes indica se la stringa che inizia con l'apice quote, preceduto dal carattere previous, usa le
+// sequenze di escape: solo le stringhe tra apici singoli, secondo s.backslashes o con il prefisso E.
+// Un nome tra backtick rivela un dump di MySQL.
+func (s *sqlScanner) escapes(quote, previous byte) bool {
+	if quote == '`' {
+		s.backslashes = true
+	}
+	return quote == '\'' && (s.backslashes || previous == 'E' || previous == 'e')
+}
+
+// skipDollarQuoted salta un blocco $tag$ ... $tag$, già letto il primo '$'. Se il '$' non apre un blocco
+// (ad esempio $1) non salta nulla oltre al tag.
+func (s *sqlScanner) skipDollarQuoted() error {
+	tag := []byte{'$'}
+	for {
+		c, err := s.peek()
+		if err != nil {
+			return nil
+		}
+		if c == '$' {
+			s.next()
+			tag = append(tag, c)
+			break
+		}
+		if !isWordByte(c) || (len(tag) == 1 && c >= '0' && c <= '9') {
+			return nil
+		}
+		s.next()
+		tag = append(tag, c)
+	}
+	var window []byte
+	for {
+		c, err := s.next()
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		window = append(window, c)
+		if len(window) > len(tag) {
+			window = window[1:]
+		}
+		if bytes.Equal(window, tag) {
+			return nil
+		}
+	}
+}
+
+// line legge il resto della riga, senza il ritorno a capo; le righe più lunghe di MaxLineBytes vengono troncate.
+func (s *sqlScanner) line() (string, error) {
+	var b []byte
+	for {
+		chunk, err := s.r.ReadSlice('\n')
+		s.stats.Read += int64(len(chunk))
+		if len(b) < MaxLineBytes {
+			b = append(b, chunk[:min(len(chunk), MaxLineBytes-len(b))]...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && (err != io.EOF || len(b) == 0) {
+			return "", unexpectedEOF(err)
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+}
+
+// isWordByte indica i caratteri delle parole chiave e dei nomi senza virgolette.
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+// truncate limita un valore a maxValueBytes.
+func truncate(value string) string {
+	if len(value) > maxValueBytes {
+		return value[:maxValueBytes]
+	}
+	return value
+}
+
+// unexpectedEOF trasforma la fine del dump a metà di un'istruzione in io.ErrUnexpectedEOF.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,233 @@
+package extractor
+
+import (
+	"context"
+	"pwnscanner/pkg/normalize"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parseRecords legge input con il Parser del file name e restituisce i record estratti.
+func parseRecords(t *testing.T, name, input string, mapping Mapping) ([]Record, error) {
+	t.Helper()
+	var records []Record
+	var stats Stats
+	parse := NewParser(name, normalize.New(normalize.Options{}), mapping)
+	err := parse(context.Background(), strings.NewReader(input), &stats, func(record Record) error {
+		records = append(records, record)
+		return nil
+	})
+	return records, err
+}
+
+func TestSQLBackslashes(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		input string
+		want  []Record
+	}{
+		{
+			name: "PostgreSQL --inserts: la barra rovesciata è un carattere",
+			input: "SET standard_conforming_strings = on;\n" +
+				"INSERT INTO public.users (id, path, email) VALUES (1, 'C:\\', 'a@example.com');\n" +
+				"INSERT INTO public.users (id, path, email) VALUES (2, 'x', 'b@example.com');\n",
+			want: []Record{{Email: "a@example.com"}, {Email: "b@example.com"}},
+		},
+		{
+			name:  "PostgreSQL senza SET",
+			input: "INSERT INTO users (email, password) VALUES ('a@example.com', 'pa\\ss');\n",
+			want:  []Record{{Email: "a@example.com", Password: `pa\ss`}},
+		},
+		{
+			name:  "PostgreSQL E'...'",
+			input: "INSERT INTO users (email, password) VALUES ('a@example.com', E'it\\'s');\n",
+			want:  []Record{{Email: "a@example.com", Password: "it's"}},
+		},
+		{
+			name: "PostgreSQL standard_conforming_strings = off",
+			input: "SET standard_conforming_strings = 'off';\n" +
+				"INSERT INTO users (email, password) VALUES ('a@example.com', 'it\\'s');\n",
+			want: []Record{{Email: "a@example.com", Password: "it's"}},
+		},
+		{
+			name: "MySQL: nomi tra backtick",
+			input: "INSERT INTO `users` (`email`, `password`) VALUES ('a@example.com', 'it\\'s\\\\'), " +
+				"('b@example.com', 'x');\n",
+			want: []Record{{Email: "a@example.com", Password: `it's\`}, {Email: "b@example.com", Password: "x"}},
+		},
+		{
+			name: "MySQL: commento condizionale",
+			input: "/*!40101 SET NAMES utf8mb4 */;\n" +
+				"INSERT INTO users (email, password) VALUES ('a@example.com', 'it\\'s');\n",
+			want: []Record{{Email: "a@example.com", Password: "it's"}},
+		},
+		{
+			name: "MySQL: LOCK TABLES",
+			input: "LOCK TABLES users WRITE;\n" +
+				"INSERT INTO users (email, password) VALUES ('a@example.com', 'it\\'s');\nUNLOCK TABLES;\n",
+			want: []Record{{Email: "a@example.com", Password: "it's"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseRecords(t, "dump.sql", tc.input, Mapping{})
+			if err != nil {
+				t.Fatalf("errore inatteso: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("record = %#v, attesi %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSQL(t *testing.T) {
+	mysql := "-- MySQL dump 10.13\n" +
+		"/*!40101 SET NAMES utf8mb4 */;\n" +
+		"DROP TABLE IF EXISTS `users`;\n" +
+		"CREATE TABLE `users` (\n" +
+		"  `id` int(11) NOT NULL AUTO_INCREMENT,\n" +
+		"  `login` varchar(64) DEFAULT 'a,b',\n" +
+		"  `email` varchar(255) NOT NULL,\n" +
+		"  `pass` varchar(255) DEFAULT NULL,\n" +
+		"  `bio` text,\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  UNIQUE KEY `email` (`email`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;\n" +
+		"LOCK TABLES `users` WRITE;\n" +
+		"INSERT INTO `users` VALUES (1,'alice','Alice@Example.com','it''s','riga\\nnuova'),(2,'bob','bob@example.com',NULL,_binary 0x00FF)," +
+		"(3,'carol','non valida','x',''),(4,NULL,'dave@example.com','p;a)s(s','');\n" +
+		"INSERT INTO `users` (`email`, `login`) VALUES ('erin@example.com', 'erin') ON DUPLICATE KEY UPDATE login = VALUES(login);\n" +
+		"UNLOCK TABLES;\n"
+
+	postgres := "--\n-- PostgreSQL database dump\n--\n" +
+		"SET standard_conforming_strings = on;\n" +
+		"CREATE FUNCTION public.touch() RETURNS trigger LANGUAGE plpgsql AS $body$\n" +
+		"BEGIN\n  INSERT INTO audit VALUES ('x@example.com'); RETURN NEW;\nEND;\n$body$;\n" +
+		"CREATE TABLE public.accounts (\n    id integer NOT NULL,\n    email text,\n    phone text,\n    note text\n);\n" +
+		"COPY public.accounts (id, email, phone, note) FROM stdin;\n" +
+		"1\talice@example.com\t+39 06 1234\tprima\\triga\n" +
+		"2\t\\N\t\\N\t\\N\n" +
+		"3\tbob@example.com\t\\N\tbarra \\\\ rovesciata\n" +
+		"\\.\n" +
+		"CREATE TABLE public.logs (id integer, message text);\n" +
+		"INSERT INTO public.logs VALUES (1, 'nessuna email');\n" +
+		"INSERT INTO public.accounts VALUES (4, 'carol@example.com', NULL, 'C:\\');\n"
+
+	for _, tc := range []struct {
+		name    string
+		input   string
+		mapping Mapping
+		want    []Record
+	}{
+		{
+			name:  "MySQL: colonne da CREATE TABLE e dalla lista di INSERT",
+			input: mysql,
+			want: []Record{
+				{Email: "alice@example.com", Username: "alice", Password: "it's"},
+				{Email: "bob@example.com", Username: "bob"},
+				{Email: "dave@example.com", Password: "p;a)s(s"},
+				{Email: "erin@example.com", Username: "erin"},
+			},
+		},
+		{
+			name:    "MySQL: colonne indicate per nome e per numero",
+			input:   mysql,
+			mapping: Mapping{Columns: map[Field]string{FieldName: "bio", FieldUsername: "1"}},
+			want: []Record{
+				{Email: "alice@example.com", Username: "1", Password: "it's", Name: "riga\nnuova"},
+				{Email: "bob@example.com", Username: "2", Name: "_binary 0x00FF"},
+				{Email: "dave@example.com", Username: "4", Password: "p;a)s(s"},
+				// la lista di colonne del secondo INSERT non ha bio: le sue righe vengono saltate
+			},
+		},
+		{
+			name:  "PostgreSQL: COPY con \\N ed escape, blocchi $tag$ saltati",
+			input: postgres,
+			want: []Record{
+				{Email: "alice@example.com", Phone: "+39 06 1234"},
+				{Email: "bob@example.com"},
+				{Email: "carol@example.com"},
+			},
+		},
+		{
+			name:    "PostgreSQL: tabella scelta",
+			input:   postgres,
+			mapping: Mapping{Table: "Accounts", Columns: map[Field]string{FieldName: "note"}},
+			want: []Record{
+				{Email: "alice@example.com", Phone: "+39 06 1234", Name: "prima\triga"},
+				{Email: "bob@example.com", Name: `barra \ rovesciata`},
+				{Email: "carol@example.com", Name: `C:\`},
+			},
+		},
+		{
+			name:    "tabella senza righe",
+			input:   postgres,
+			mapping: Mapping{Table: "audit"},
+			want:    nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseRecords(t, "dump.sql", tc.input, tc.mapping)
+			if err != nil {
+				t.Fatalf("errore inatteso: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("record = %#v, attesi %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSQLErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		input   string
+		mapping Mapping
+		want    string
+	}{
+		{
+			name:  "apice non chiuso",
+			input: "INSERT INTO users (email) VALUES ('a@example.com);\n",
+			want:  "dump SQL troncato",
+		},
+		{
+			name:  "tupla interrotta",
+			input: "INSERT INTO users (email) VALUES ('a@example.com', ",
+			want:  "dump SQL troncato",
+		},
+		{
+			name:  "COPY senza \\.",
+			input: "COPY users (email) FROM stdin;\na@example.com\n",
+			want:  "dump SQL troncato",
+		},
+		{
+			name:    "colonna assente nella tabella scelta",
+			input:   "INSERT INTO users (email) VALUES ('a@example.com');\n",
+			mapping: Mapping{Table: "users", Columns: map[Field]string{FieldPassword: "pass"}},
+			want:    "tabella users",
+		},
+		{
+			name:  "tupla senza parentesi",
+			input: "INSERT INTO users (email) VALUES 'a@example.com';\n",
+			want:  "atteso '('",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseRecords(t, "dump.sql", tc.input, tc.mapping)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("errore = %v, atteso %q", err, tc.want)
+			}
+		})
+	}
+
+	// Senza tabella scelta, una tabella in cui manca la colonna indicata viene saltata
+	input := "INSERT INTO logs (message) VALUES ('x');\nINSERT INTO users (email, pass) VALUES ('a@example.com', 'p');\n"
+	got, err := parseRecords(t, "dump.sql", input, Mapping{Columns: map[Field]string{FieldPassword: "pass"}})
+	if err != nil {
+		t.Fatalf("errore inatteso: %v", err)
+	}
+	if want := []Record{{Email: "a@example.com", Password: "p"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("record = %#v, attesi %#v", got, want)
+	}
+}
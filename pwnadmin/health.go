@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"pwnscanner/pkg/database"
+	"sync/atomic"
+	"time"
+)
+
+// readinessTimeout è il tempo massimo concesso al ping del database da /readyz.
+const readinessTimeout = 2 * time.Second
+
+// Valori predefiniti dell'arresto ordinato, modificabili con SHUTDOWN_DRAIN_SECONDS e SHUTDOWN_TIMEOUT_SECONDS.
+// Il tempo di arresto è lungo perché il job di import in corso viene atteso prima di interromperlo.
+const (
+	defaultShutdownDrain   = 5 * time.Second
+	defaultShutdownTimeout = 5 * time.Minute
+)
+
+// draining diventa true alla ricezione del segnale di arresto
+var draining atomic.Bool
+
+// healthzHandler risponde 200 finché il processo è in grado di servire richieste HTTP.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// readyzHandler risponde 200 se il database risponde al ping, 503 se non è raggiungibile
+// o se è in corso l'arresto del server.
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	status, code := "ready", http.StatusOK
+	if draining.Load() {
+		status, code = "draining", http.StatusServiceUnavailable
+	} else if pinger, ok := writer.(database.Pinger); ok {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+		if err := pinger.Ping(ctx); err != nil {
+			log.Printf("Readiness: il database non risponde: %v", err)
+			status, code = "not_ready", http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"status": status})
+}
+
+// serve avvia il server e, quando ctx viene annullato dal segnale di arresto, lo spegne in modo ordinato:
+// /readyz inizia a rispondere 503, dopo il periodo di drain il server smette di accettare connessioni
+// e attende le richieste in corso, poi il job di import in esecuzione, fino al tempo di arresto (0 = senza limite).
+// Allo scadere il job si ferma alla fine del blocco in corso e riprende al prossimo avvio.
+func serve(ctx context.Context, server *http.Server) error {
+	drain := durationFromEnv("SHUTDOWN_DRAIN_SECONDS", defaultShutdownDrain)
+	timeout := durationFromEnv("SHUTDOWN_TIMEOUT_SECONDS", defaultShutdownTimeout)
+
+	// Gli stream SSE dei job non terminano da soli: vanno chiusi perché Shutdown non li attenda
+	server.RegisterOnShutdown(importJobs.CloseSubscribers)
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("Segnale di arresto ricevuto: /readyz risponde 503, chiusura del server tra %s", drain)
+	draining.Store(true)
+	time.Sleep(drain)
+
+	shutdownCtx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, timeout)
+		defer cancel()
+	}
+	log.Println("Attesa del completamento delle richieste in corso...")
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Richieste ancora in corso allo scadere del tempo di arresto: connessioni chiuse (%v)", err)
+		server.Close()
+	}
+	log.Println("Attesa del completamento del job di import in corso...")
+	if err := importJobs.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Job di import interrotto allo scadere del tempo di arresto: riprenderà al prossimo avvio (%v)", err)
+	}
+	return nil
+}
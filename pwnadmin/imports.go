@@ -0,0 +1,533 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"extract/archive"
+	"extract/extractor"
+	"extract/ingest"
+	"extract/jobs"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"pwnscanner/pkg/database"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// sseHeartbeat è l'intervallo dei commenti inviati sugli stream SSE inattivi, perché i proxy non li chiudano.
+const sseHeartbeat = 15 * time.Second
+
+var (
+	// importJobs accoda ed esegue gli import caricati dalla pagina principale
+	importJobs *jobs.Manager
+	// importOptions configura la pipeline di ingest degli import
+	importOptions ingest.Options
+	// archiveLimits limita l'apertura degli archivi caricati
+	archiveLimits archive.Limits
+)
+
+// defaultFileWorkers è il numero predefinito di file di un job elaborati in parallelo.
+const defaultFileWorkers = 2
+
+// newImportJobs prepara i job di import nella directory JOBS_DIR (default: jobs) e avvia il worker.
+// I job rimasti a metà all'arresto precedente vengono ripresi. Ogni job elabora IMPORT_FILE_WORKERS file
+// in parallelo; per ogni file la pipeline usa IMPORT_WRITERS scritture concorrenti di blocchi di
+// IMPORT_BATCH_SIZE email, ripetendo fino a IMPORT_WRITE_RETRIES volte quelle fallite per errori transitori.
+// IMPORT_MEMORY_MB è la memoria massima indicativa, divisa tra i file elaborati in parallelo.
+// Gli archivi vengono aperti fino a ARCHIVE_MAX_DEPTH livelli e con un rapporto di decompressione
+// massimo di ARCHIVE_MAX_RATIO.
+func newImportJobs() (*jobs.Manager, error) {
+	fileWorkers := intFromEnv("IMPORT_FILE_WORKERS", defaultFileWorkers)
+	if fileWorkers < 1 {
+		return nil, fmt.Errorf("configurazione degli import non valida: IMPORT_FILE_WORKERS deve essere almeno 1 (attuale: %d)", fileWorkers)
+	}
+	memoryLimit := int64(intFromEnv("IMPORT_MEMORY_MB", int(ingest.DefaultOptions.MemoryLimit>>20))) << 20
+	importOptions = ingest.Options{
+		BatchSize:   intFromEnv("IMPORT_BATCH_SIZE", ingest.DefaultOptions.BatchSize),
+		MemoryLimit: memoryLimit / int64(fileWorkers),
+		Writers:     intFromEnv("IMPORT_WRITERS", ingest.DefaultOptions.Writers),
+		Retries:     intFromEnv("IMPORT_WRITE_RETRIES", ingest.DefaultOptions.Retries),
+	}
+	if err := importOptions.Validate(); err != nil {
+		return nil, fmt.Errorf("configurazione degli import non valida (IMPORT_*): %w", err)
+	}
+	archiveLimits = archive.Limits{
+		MaxDepth: intFromEnv("ARCHIVE_MAX_DEPTH", archive.DefaultLimits.MaxDepth),
+		MaxRatio: int64(intFromEnv("ARCHIVE_MAX_RATIO", int(archive.DefaultLimits.MaxRatio))),
+	}
+	if err := archiveLimits.Validate(); err != nil {
+		return nil, fmt.Errorf("configurazione degli archivi non valida (ARCHIVE_MAX_DEPTH, ARCHIVE_MAX_RATIO): %w", err)
+	}
+
+	dir := os.Getenv("JOBS_DIR")
+	if dir == "" {
+		dir = "jobs"
+	}
+	store, err := jobs.NewStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	manager, err := jobs.NewManager(store, importFile, fileWorkers)
+	if err != nil {
+		return nil, fmt.Errorf("impossibile caricare i job di import da %s: %w", dir, err)
+	}
+	manager.Start()
+	log.Printf("Job di import salvati in %s (%d file in parallelo, %d scritture concorrenti per file, blocchi di %d email, memoria massima %d MB)",
+		dir, fileWorkers, importOptions.Writers, importOptions.BatchSize, memoryLimit>>20)
+	return manager, nil
+}
+
+// jobView è lo stato di un job mostrato da job.html e inviato dallo stream SSE.
+type jobView struct {
+	jobs.Job
+	StatusLabel string          `json:"status_label"`
+	Progress    float64         `json:"progress"`
+	Totals      jobs.FileReport `json:"totals"`
+	Files       []jobFileView   `json:"files"`
+	Finished    bool            `json:"finished"`
+	Actions     map[string]bool `json:"actions"`
+}
+
+// jobFileView è un file di jobView, con i file contenuti se è un archivio.
+type jobFileView struct {
+	jobs.FileReport
+	StatusLabel string        `json:"status_label"`
+	FieldsLabel string        `json:"fields_label"`
+	Entries     []jobFileView `json:"entries,omitempty"`
+}
+
+// newJobFileView prepara la vista di un file e dei file che contiene.
+func newJobFileView(file jobs.FileReport) jobFileView {
+	view := jobFileView{FileReport: file, StatusLabel: file.Status.Label(), FieldsLabel: fieldsLabel(file.Fields)}
+	for _, entry := range file.Entries {
+		view.Entries = append(view.Entries, newJobFileView(entry))
+	}
+	return view
+}
+
+// newJobView prepara la vista del job con le descrizioni degli stati e le azioni disponibili.
+func newJobView(job jobs.Job) jobView {
+	view := jobView{
+		Job:         job,
+		StatusLabel: job.Status.Label(),
+		Progress:    job.Progress(),
+		Totals:      job.Totals(),
+		Finished:    job.Status.Finished(),
+		Actions: map[string]bool{
+			"cancel": job.Status == jobs.StatusQueued || job.Status == jobs.StatusRunning,
+			"retry":  job.Status == jobs.StatusFailed || job.Status == jobs.StatusCancelled,
+		},
+	}
+	for _, file := range job.Files {
+		view.Files = append(view.Files, newJobFileView(file))
+	}
+	return view
+}
+
+// fieldsLabel descrive i campi trovati oltre all'email, ad esempio "username 10 · password 10".
+func fieldsLabel(counts extractor.FieldCounts) string {
+	var parts []string
+	for _, field := range []struct {
+		name  string
+		count int64
+	}{{"username", counts.Username}, {"password", counts.Password}, {"telefono", counts.Phone}, {"nome", counts.Name}, {"IP", counts.IP}} {
+		if field.count > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", field.name, field.count))
+		}
+	}
+	return strings.Join(parts, " · ")
+}
+
+// maxFieldBytes è la dimensione massima dei campi di testo del form di upload.
+const maxFieldBytes = 1 << 10
+
+// Handler per l'upload: legge il form multipart in streaming, salvando ogni file direttamente nella
+// directory di un nuovo job senza copie intermedie, poi accoda il job e reindirizza alla sua pagina,
+// che ne mostra l'avanzamento. Con "Accept: application/json" risponde 202 con l'ID del job.
+func uploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Metodo non consentito", http.StatusMethodNotAllowed)
+		return
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "Errore durante l'analisi dei dati del form", http.StatusBadRequest)
+		log.Printf("Errore durante l'analisi dei dati del form: %v", err)
+		return
+	}
+
+	id, err := jobs.NewID()
+	if err != nil {
+		http.Error(w, "Errore nella creazione del job di import", http.StatusInternalServerError)
+		log.Printf("Errore nella generazione dell'ID del job: %v", err)
+		return
+	}
+	job := jobs.Job{ID: id}
+	dir := importJobs.FilesDir(id)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		http.Error(w, "Errore nella creazione del job di import", http.StatusInternalServerError)
+		log.Printf("Errore nella creazione della directory %s: %v", dir, err)
+		return
+	}
+	submitted := false
+	defer func() {
+		if !submitted {
+			importJobs.Discard(id)
+		}
+	}()
+
+	// I campi arrivano nell'ordine del form; il nome del breach può precedere o seguire i file
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			http.Error(w, "Errore durante l'analisi dei dati del form", http.StatusBadRequest)
+			log.Printf("Errore durante la lettura del form: %v", err)
+			return
+		}
+
+		switch part.FormName() {
+		case "breachName":
+			value, err := io.ReadAll(io.LimitReader(part, maxFieldBytes))
+			if err != nil {
+				http.Error(w, "Errore durante l'analisi dei dati del form", http.StatusBadRequest)
+				return
+			}
+			job.Breach = strings.TrimSpace(string(value))
+		case "format", "delimiter", "header", "table", "column_email", "column_username", "column_password", "column_phone", "column_name", "column_ip":
+			value, err := io.ReadAll(io.LimitReader(part, maxFieldBytes))
+			if err != nil {
+				http.Error(w, "Errore durante l'analisi dei dati del form", http.StatusBadRequest)
+				return
+			}
+			setMapping(&job.Mapping, part.FormName(), string(value))
+		case "passwords":
+			value, err := io.ReadAll(io.LimitReader(part, maxFieldBytes))
+			if err != nil {
+				http.Error(w, "Errore durante l'analisi dei dati del form", http.StatusBadRequest)
+				return
+			}
+			job.Passwords = strings.TrimSpace(string(value)) == "yes"
+		case "files":
+			name := uploadName(part)
+			if name == "" {
+				continue
+			}
+			// Ogni file viene salvato con un prefisso numerico: cartelle diverse possono contenere file con lo stesso nome
+			stored := fmt.Sprintf("%04d-%s", len(job.Files), path.Base(name))
+			size, err := saveUpload(part, filepath.Join(dir, stored))
+			if err != nil {
+				http.Error(w, "Errore nel salvataggio del file caricato", http.StatusInternalServerError)
+				log.Printf("Errore nel salvataggio del file caricato %s: %v", name, err)
+				return
+			}
+			log.Printf("File caricato %s salvato (%d byte)", name, size)
+			job.Files = append(job.Files, jobs.FileReport{Name: name, Stored: stored, Size: size})
+		}
+	}
+
+	if job.Breach == "" {
+		http.Error(w, "Il nome del breach è richiesto", http.StatusBadRequest)
+		return
+	}
+	if len(job.Files) == 0 {
+		http.Error(w, "Nessun file caricato", http.StatusBadRequest)
+		log.Println("Nessun file caricato.")
+		return
+	}
+	if err := job.Mapping.Validate(); err != nil {
+		http.Error(w, "Mappatura delle colonne non valida: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Registra il breach nel catalogo, se non esiste già, con la data di aggiunta
+	if catalog, ok := catalogWriter(); ok {
+		if err := database.EnsureBreach(r.Context(), catalog, job.Breach); err != nil {
+			log.Printf("Errore durante la registrazione del breach %s nel catalogo: %v", job.Breach, err)
+		}
+	}
+
+	if err := importJobs.Submit(job); err != nil {
+		http.Error(w, "Errore nella creazione del job di import", http.StatusInternalServerError)
+		log.Printf("Errore nel salvataggio del job %s: %v", id, err)
+		return
+	}
+	submitted = true
+	log.Printf("Job %s in coda: %d file per il breach %s", id, len(job.Files), job.Breach)
+
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/jobs/"+id)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"id": id})
+		return
+	}
+	http.Redirect(w, r, "/jobs/"+id, http.StatusSeeOther)
+}
+
+// setMapping imposta nella mappatura il campo del form di upload name. Il separatore non viene
+// ripulito dagli spazi, perché può essere uno spazio o una tabulazione.
+func setMapping(mapping *extractor.Mapping, name, value string) {
+	switch name {
+	case "format":
+		mapping.Format = extractor.Format(strings.TrimSpace(value))
+	case "delimiter":
+		mapping.Delimiter = value
+	case "header":
+		mapping.Header = extractor.Header(strings.TrimSpace(value))
+	case "table":
+		mapping.Table = strings.TrimSpace(value)
+	default:
+		if value = strings.TrimSpace(value); value == "" {
+			return
+		}
+		if mapping.Columns == nil {
+			mapping.Columns = make(map[extractor.Field]string)
+		}
+		mapping.Columns[extractor.Field(strings.TrimPrefix(name, "column_"))] = value
+	}
+}
+
+// uploadName restituisce il nome del file caricato con il percorso relativo inviato dal browser per le
+// cartelle, ad esempio "dump/a/users.txt": Part.FileName tiene solo l'ultimo elemento, e file con lo stesso
+// nome in cartelle diverse sarebbero indistinguibili. Il percorso viene ripulito da "..", "." e "/" iniziali.
+func uploadName(part *multipart.Part) string {
+	_, params, err := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+	if err != nil || params["filename"] == "" {
+		return part.FileName()
+	}
+	var elements []string
+	for _, element := range strings.Split(strings.ReplaceAll(params["filename"], "\\", "/"), "/") {
+		if element != "" && element != "." && element != ".." {
+			elements = append(elements, element)
+		}
+	}
+	return path.Join(elements...)
+}
+
+// saveUpload copia il contenuto del file caricato in path e ne restituisce la dimensione.
+func saveUpload(src io.Reader, path string) (int64, error) {
+	out, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	size, err := io.Copy(out, src)
+	if err != nil {
+		out.Close()
+		return 0, err
+	}
+	return size, out.Close()
+}
+
+// importFile è il jobs.Processor degli import: apre gli archivi e i file compressi, estrae le email
+// da ogni file di testo con la pipeline di ingest e le carica nel breach, aggiornando a ogni blocco
+// scritto il report del file e, per gli archivi, quello di ciascun file contenuto.
+func importFile(ctx context.Context, source jobs.Source, update func(func(*jobs.FileReport))) error {
+	file, err := os.Open(source.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	// L'avanzamento di un archivio si misura sui byte compressi letti
+	input := &readCounter{r: file}
+
+	return archive.Walk(ctx, io.NewSectionReader(input, 0, info.Size()), source.Name, archiveLimits, func(entry archive.Entry) error {
+		if !entry.Archived {
+			return importText(ctx, source, entry, update)
+		}
+
+		// Ogni file dell'archivio ha il proprio report, i contatori dell'archivio ne sono la somma
+		var index int
+		update(func(f *jobs.FileReport) {
+			index = len(f.Entries)
+			f.Entries = append(f.Entries, jobs.FileReport{Name: entry.Name, Size: max(entry.Size, 0), Status: jobs.StatusRunning})
+		})
+		err := importText(ctx, source, entry, func(set func(*jobs.FileReport)) {
+			update(func(f *jobs.FileReport) {
+				set(&f.Entries[index])
+				f.SumEntries()
+				f.Read = input.Count()
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.Name, err)
+		}
+		return nil
+	})
+}
+
+// importText importa un file di testo trovato da archive.Walk, nel formato indicato dalla mappatura
+// del job o riconosciuto dal contenuto, aggiornando il suo report con update.
+func importText(ctx context.Context, source jobs.Source, entry archive.Entry, update func(func(*jobs.FileReport))) error {
+	if entry.Skip != "" {
+		log.Printf("File %s ignorato: %s", entry.Name, entry.Skip)
+		update(func(f *jobs.FileReport) {
+			f.Status = jobs.StatusSkipped
+			f.Error = entry.Skip
+		})
+		return nil
+	}
+
+	parse := extractor.NewParser(entry.Name, normalizer, source.Mapping)
+	opts := importOptions
+	opts.Passwords = source.Passwords
+	// Un file con lo stesso percorso importato di nuovo nello stesso breach sostituisce le password contate
+	// in precedenza; il percorso relativo distingue i file con lo stesso nome di cartelle diverse
+	opts.PasswordSource = ingest.PasswordSource(source.Breach, entry.Name)
+	progress, err := ingest.Run(ctx, entry, parse, writer, source.Breach, opts, func(p ingest.Progress) {
+		update(func(f *jobs.FileReport) {
+			f.Format = p.Format
+			f.Read = p.Read
+			f.Extracted = p.Emails
+			f.Rejected = p.Rejected
+			f.Unique = p.Unique
+			f.Processed = p.Written
+			f.Matched = p.Result.MatchedCount
+			f.Modified = p.Result.ModifiedCount
+			f.Upserted = p.Result.UpsertedCount
+			f.Fields = p.Fields
+		})
+	})
+	// Lo stato dei file caricati è gestito da jobs.Manager, quello dei file degli archivi qui
+	if entry.Archived {
+		update(func(f *jobs.FileReport) {
+			switch {
+			case err == nil && f.Unique == 0:
+				f.Status = jobs.StatusSkipped
+			case err == nil:
+				f.Status = jobs.StatusDone
+			case ctx.Err() != nil:
+				f.Status = jobs.StatusPending
+			default:
+				f.Status = jobs.StatusFailed
+				f.Error = err.Error()
+			}
+		})
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("File %s (%s): %d email estratte (%d scritte, %d scartate), %d nuove", entry.Name, progress.Format, progress.Emails, progress.Written, progress.Rejected, progress.Result.UpsertedCount)
+	if source.Passwords {
+		log.Printf("File %s: %d password in chiaro contate", entry.Name, progress.Passwords)
+	}
+	return nil
+}
+
+// readCounter conta i byte letti dal file caricato; Count può essere chiamata durante la lettura.
+type readCounter struct {
+	r io.ReaderAt
+	n atomic.Int64
+}
+
+func (c *readCounter) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// Count restituisce il numero di byte letti.
+func (c *readCounter) Count() int64 {
+	return c.n.Load()
+}
+
+// Handler per la pagina di un job di import
+func jobHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := importJobs.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Job non trovato", http.StatusNotFound)
+		return
+	}
+	renderTemplate(w, r, "job", newJobView(job))
+}
+
+// Handler dello stream SSE con lo stato del job: un evento "job" a ogni avanzamento,
+// finché il job non termina o il client non si disconnette.
+func jobEventsHandler(w http.ResponseWriter, r *http.Request) {
+	updates, unsubscribe, err := importJobs.Subscribe(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Job non trovato", http.StatusNotFound)
+		return
+	}
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	rc := http.NewResponseController(w)
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case job, ok := <-updates:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(newJobView(job))
+			if err != nil {
+				log.Printf("Errore nella codifica dello stato del job %s: %v", job.ID, err)
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: job\ndata: %s\n\n", data); err != nil {
+				return
+			}
+			if job.Status.Finished() || job.Status == jobs.StatusInterrupted {
+				rc.Flush()
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// Handler per l'annullamento di un job
+func cancelJobHandler(w http.ResponseWriter, r *http.Request) {
+	jobAction(w, r, importJobs.Cancel, "l'annullamento")
+}
+
+// Handler per il retry di un job
+func retryJobHandler(w http.ResponseWriter, r *http.Request) {
+	jobAction(w, r, importJobs.Retry, "il retry")
+}
+
+// jobAction esegue un'azione sul job e torna alla sua pagina.
+func jobAction(w http.ResponseWriter, r *http.Request, action func(string) error, name string) {
+	id := r.PathValue("id")
+	switch err := action(id); {
+	case errors.Is(err, jobs.ErrNotFound):
+		http.Error(w, "Job non trovato", http.StatusNotFound)
+	case errors.Is(err, jobs.ErrInvalidState), errors.Is(err, jobs.ErrShutdown):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		http.Error(w, "Errore durante l'operazione sul job", http.StatusInternalServerError)
+		log.Printf("Errore durante %s del job %s: %v", name, id, err)
+	default:
+		log.Printf("Richiesto %s del job %s", name, id)
+		http.Redirect(w, r, "/jobs/"+id, http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"testing"
+)
+
+func TestUploadName(t *testing.T) {
+	for _, tc := range []struct {
+		filename string
+		want     string
+	}{
+		{"users.txt", "users.txt"},
+		{"dump/a/users.txt", "dump/a/users.txt"},
+		{"../../etc/users.txt", "etc/users.txt"},
+		{"/dump/./b//users.txt", "dump/b/users.txt"},
+		{`dump\c\users.txt`, "dump/c/users.txt"},
+	} {
+		var body bytes.Buffer
+		fmt.Fprintf(&body, "--b\r\nContent-Disposition: form-data; name=\"files\"; filename=%q\r\n\r\ndati\r\n--b--\r\n", tc.filename)
+		part, err := multipart.NewReader(&body, "b").NextPart()
+		if err != nil {
+			t.Fatalf("%s: errore inatteso: %v", tc.filename, err)
+		}
+		if got := uploadName(part); got != tc.want {
+			t.Errorf("uploadName(%q) = %q, atteso %q", tc.filename, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,353 @@
+// Package ingest importa in un breach le email estratte da un file con memoria limitata.
+//
+// La pipeline ha due stadi collegati da una coda di blocchi di capacità fissa: l'estrazione
+// (un extractor.Parser) riempie i blocchi di record e Options.Writers scrittori li inviano al database in parallelo.
+// Quando il database è più lento dell'estrazione la coda si riempie e l'estrazione si ferma finché
+// non si libera un posto, così la memoria usata dipende da Options e non dalla dimensione del file.
+package ingest
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"extract/extractor"
+	"fmt"
+	"io"
+	"pwnscanner/pkg/database"
+	"strings"
+	"sync"
+	"time"
+)
+
+// emailCost è l'occupazione stimata in memoria di un record, compreso il costo nella finestra dei duplicati.
+const emailCost = 128
+
+// maxQueueBatches è il numero massimo di blocchi in coda tra estrazione e scrittura.
+const maxQueueBatches = 16
+
+// Attesa prima di ripetere una scrittura fallita per un errore transitorio: raddoppia a ogni tentativo.
+const (
+	retryBaseDelay = 250 * time.Millisecond
+	retryMaxDelay  = 10 * time.Second
+)
+
+// Options configura la pipeline.
+type Options struct {
+	// BatchSize è il numero di email scritte nel database con una singola operazione
+	BatchSize int
+	// MemoryLimit è il tetto indicativo, in byte, della memoria usata dalla pipeline: metà è riservata
+	// alla finestra dei duplicati, un quarto ai blocchi in coda e in scrittura e il resto alla lettura delle righe
+	MemoryLimit int64
+	// Writers è il numero di blocchi scritti contemporaneamente nel database
+	Writers int
+	// Retries è il numero di volte in cui viene ripetuta la scrittura di un blocco fallita per un errore
+	// transitorio (database.IsTransient), con un'attesa crescente tra un tentativo e l'altro
+	Retries int
+	// Passwords indica se contare gli hash SHA-1 delle password in chiaro dei record (database.PasswordWriter).
+	// Le password di tutti i record vengono contate, anche quelle dei duplicati scartati
+	Passwords bool
+	// PasswordSource è l'origine a cui vengono attribuite le password contate, ad esempio il breach e il nome
+	// del file: Run toglie prima le occorrenze già contate per l'origine, così un file importato di nuovo,
+	// o ripreso da capo dopo un'interruzione, non viene contato due volte. Obbligatoria con Passwords
+	PasswordSource string
+}
+
+// PasswordSource restituisce l'origine delle password del file name importato nel breach. name deve
+// distinguere il file dagli altri del breach: con il solo nome, due file users.txt di cartelle diverse
+// caricati insieme si azzererebbero a vicenda i conteggi e avrebbero gli stessi numeri di blocco.
+func PasswordSource(breach, name string) string {
+	return breach + "/" + name
+}
+
+// DefaultOptions sono i valori predefiniti di Options.
+var DefaultOptions = Options{BatchSize: 950, MemoryLimit: 256 << 20, Writers: 4, Retries: 5}
+
+// Validate verifica che le opzioni lascino spazio almeno a un blocco per scrittore, a uno in coda
+// e alla lettura delle righe.
+func (o Options) Validate() error {
+	if o.BatchSize < 1 {
+		return fmt.Errorf("la dimensione dei blocchi deve essere almeno 1 (attuale: %d)", o.BatchSize)
+	}
+	if o.Writers < 1 {
+		return fmt.Errorf("il numero di scrittori deve essere almeno 1 (attuale: %d)", o.Writers)
+	}
+	if o.Retries < 0 {
+		return fmt.Errorf("il numero di tentativi ripetuti non può essere negativo (attuale: %d)", o.Retries)
+	}
+	if o.Passwords && o.PasswordSource == "" {
+		return errors.New("l'origine delle password è obbligatoria per contarle")
+	}
+	if minimum := 4*int64(o.Writers+1)*o.batchCost() + 4*extractor.MaxLineBytes; o.MemoryLimit < minimum {
+		return fmt.Errorf("il limite di memoria deve essere almeno %d MB con blocchi di %d email e %d scrittori",
+			(minimum+1<<20-1)>>20, o.BatchSize, o.Writers)
+	}
+	return nil
+}
+
+// batchCost restituisce l'occupazione stimata di un blocco.
+func (o Options) batchCost() int64 {
+	return int64(o.BatchSize) * emailCost
+}
+
+// window restituisce il numero di email ricordate per scartare i duplicati.
+func (o Options) window() int {
+	return int(o.MemoryLimit / 2 / emailCost)
+}
+
+// queueBatches restituisce la capacità della coda tra estrazione e scrittura,
+// esclusi i blocchi già presi dagli scrittori.
+func (o Options) queueBatches() int {
+	return min(max(int(o.MemoryLimit/4/o.batchCost())-o.Writers, 1), maxQueueBatches)
+}
+
+// retryDelay restituisce l'attesa prima del tentativo successivo al numero attempt (da 0).
+func retryDelay(attempt int) time.Duration {
+	return min(retryBaseDelay<<min(attempt, 16), retryMaxDelay)
+}
+
+// Progress è l'avanzamento dell'import, con contatori cumulativi.
+type Progress struct {
+	// Stats è lo stato dell'estrazione fino all'ultimo blocco scritto per cui sono stati scritti
+	// anche tutti i precedenti: i byte contati in Read sono già nel database
+	extractor.Stats
+	// Unique è il numero di email inviate al database, senza i duplicati trovati nella finestra,
+	// con lo stesso riferimento di Stats
+	Unique int64
+	// Written è il numero di email già scritte nel database
+	Written int64
+	// Result somma l'esito delle scritture
+	Result database.WriteResult
+	// Passwords è il numero di password in chiaro contate, con Options.Passwords
+	Passwords int64
+}
+
+// batch è un blocco di record da scrivere, con lo stato dell'estrazione al momento della sua chiusura.
+type batch struct {
+	seq     int
+	records []extractor.Record
+	stats   extractor.Stats
+	unique  int64
+	// passwords conta le occorrenze degli hash SHA-1 delle password in chiaro del blocco
+	passwords map[string]int64
+}
+
+// Run estrae i record da r con parse e ne aggiunge le email al breach, chiamando onProgress dopo ogni blocco scritto.
+// I duplicati vengono scartati solo entro la finestra stabilita da Options.MemoryLimit: quelli più
+// distanti vengono riscritti, senza effetti perché la scrittura è idempotente.
+// I blocchi vengono scritti in parallelo da Options.Writers scrittori e possono terminare in un ordine
+// diverso da quello del testo; onProgress non viene mai chiamata in modo concorrente.
+// Se ctx viene annullato Run si ferma tra un blocco e l'altro: i blocchi in corso vengono sempre completati.
+func Run(ctx context.Context, r io.Reader, parse extractor.Parser, writer database.Writer, breach string, opts Options, onProgress func(Progress)) (Progress, error) {
+	if err := opts.Validate(); err != nil {
+		return Progress{}, err
+	}
+	if opts.Passwords {
+		passwordWriter, ok := writer.(database.PasswordWriter)
+		if !ok {
+			return Progress{}, errors.New("il database non conserva gli hash delle password")
+		}
+		// Le occorrenze di un import precedente della stessa origine vengono contate di nuovo da capo
+		if err := passwordWriter.ResetPasswordHashes(ctx, opts.PasswordSource); err != nil {
+			return Progress{}, fmt.Errorf("errore durante l'azzeramento delle password di %s: %w", opts.PasswordSource, err)
+		}
+	}
+
+	extractCtx, stopExtract := context.WithCancel(ctx)
+	defer stopExtract()
+	batches := make(chan batch, opts.queueBatches())
+	var extractErr error
+	go func() {
+		defer close(batches)
+		extractErr = extract(extractCtx, r, parse, opts, batches)
+	}()
+
+	var (
+		mu       sync.Mutex
+		progress Progress
+		runErr   error
+		// written contiene i blocchi scritti prima di quelli che li precedono, in attesa che arrivino
+		written = make(map[int]batch)
+		nextSeq int
+	)
+	// fail registra il primo errore e ferma l'estrazione; gli scrittori svuotano la coda senza scrivere.
+	// Va chiamata con il lock.
+	fail := func(err error) {
+		if runErr == nil {
+			runErr = err
+			stopExtract()
+		}
+	}
+
+	var writers sync.WaitGroup
+	for range opts.Writers {
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			for b := range batches {
+				mu.Lock()
+				stopped := runErr != nil
+				if !stopped && ctx.Err() != nil {
+					fail(fmt.Errorf("import interrotto dopo %d email: %w", progress.Written, ctx.Err()))
+					stopped = true
+				}
+				mu.Unlock()
+				if stopped {
+					continue
+				}
+
+				var result database.WriteResult
+				var err error
+				if len(b.records) > 0 || len(b.passwords) > 0 {
+					emails := make([]string, len(b.records))
+					var classes map[string][]string
+					for i, record := range b.records {
+						emails[i] = record.Email
+						if recordClasses := record.DataClasses(); len(recordClasses) > 0 {
+							if classes == nil {
+								classes = make(map[string][]string)
+							}
+							classes[record.Email] = recordClasses
+						}
+					}
+					result, err = write(ctx, writer, breach, emails, classes, opts.PasswordSource, b.seq, b.passwords, opts.Retries)
+				}
+
+				mu.Lock()
+				if err != nil {
+					fail(fmt.Errorf("errore durante la scrittura dopo %d email: %w", progress.Written, err))
+					mu.Unlock()
+					continue
+				}
+				progress.Written += int64(len(b.records))
+				progress.Result.Add(result)
+				for _, count := range b.passwords {
+					progress.Passwords += count
+				}
+				written[b.seq] = b
+				for {
+					done, ok := written[nextSeq]
+					if !ok {
+						break
+					}
+					delete(written, nextSeq)
+					progress.Stats = done.stats
+					progress.Unique = done.unique
+					nextSeq++
+				}
+				onProgress(progress)
+				mu.Unlock()
+			}
+		}()
+	}
+	writers.Wait()
+
+	if runErr != nil {
+		return progress, runErr
+	}
+	if extractErr != nil {
+		if err := ctx.Err(); err != nil {
+			return progress, fmt.Errorf("import interrotto dopo %d email: %w", progress.Written, err)
+		}
+		return progress, fmt.Errorf("errore durante l'estrazione: %w", extractErr)
+	}
+	return progress, nil
+}
+
+// write scrive un blocco e, se il database le conserva (database.DataClassWriter e database.PasswordWriter),
+// le classi di dati esposte dalle sue email e gli hash delle password come blocco seq dell'origine source,
+// ripetendo fino a retries volte le scritture fallite per un errore transitorio. Il blocco viene riscritto
+// per intero: le email scritte dal tentativo fallito risultano già presenti e gli hash delle password
+// già sommati per il blocco vengono ignorati.
+// L'attesa tra i tentativi si interrompe se ctx viene annullato; la scrittura in corso invece viene
+// sempre completata.
+func write(ctx context.Context, writer database.Writer, breach string, emails []string, classes map[string][]string, source string, seq int, passwords map[string]int64, retries int) (database.WriteResult, error) {
+	classWriter, _ := writer.(database.DataClassWriter)
+	passwordWriter, _ := writer.(database.PasswordWriter)
+	if passwordWriter == nil && len(passwords) > 0 {
+		return database.WriteResult{}, errors.New("il database non conserva gli hash delle password")
+	}
+	for attempt := 0; ; attempt++ {
+		var result database.WriteResult
+		var err error
+		if len(emails) > 0 {
+			result, err = writer.AddBreachEmails(context.WithoutCancel(ctx), breach, emails)
+		}
+		if err == nil && classWriter != nil && len(classes) > 0 {
+			err = classWriter.AddDataClasses(context.WithoutCancel(ctx), breach, classes)
+		}
+		if err == nil && len(passwords) > 0 {
+			err = passwordWriter.AddPasswordHashes(context.WithoutCancel(ctx), source, seq, passwords)
+		}
+		if err == nil || !database.IsTransient(err) {
+			return result, err
+		}
+		if attempt == retries {
+			return result, fmt.Errorf("%d tentativi falliti: %w", attempt+1, err)
+		}
+		select {
+		case <-time.After(retryDelay(attempt)):
+		case <-ctx.Done():
+			return result, fmt.Errorf("%w (tentativi interrotti: %w)", err, ctx.Err())
+		}
+	}
+}
+
+// extract riempie i blocchi con i record estratti da r, scartando quelli con un'email già vista
+// nella finestra, e li accoda. Con Options.Passwords conta nel blocco anche gli hash delle password
+// in chiaro di tutti i record. L'ultimo blocco, anche vuoto, riporta le statistiche finali.
+func extract(ctx context.Context, r io.Reader, parse extractor.Parser, opts Options, batches chan<- batch) error {
+	var stats extractor.Stats
+	var unique int64
+	seq := 0
+	window := opts.window()
+	seen := make(map[string]struct{}, min(window, 1<<16))
+	current := make([]extractor.Record, 0, opts.BatchSize)
+	var passwords map[string]int64
+
+	send := func() error {
+		select {
+		case batches <- batch{seq: seq, records: current, stats: stats, unique: unique, passwords: passwords}:
+			seq++
+			current = make([]extractor.Record, 0, opts.BatchSize)
+			passwords = nil
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	err := parse(ctx, r, &stats, func(record extractor.Record) error {
+		if opts.Passwords && record.Password != "" && extractor.HashType(record.Password) == "" {
+			if passwords == nil {
+				passwords = make(map[string]int64)
+			}
+			sum := sha1.Sum([]byte(record.Password))
+			passwords[strings.ToUpper(hex.EncodeToString(sum[:]))]++
+			// Un blocco con molti duplicati non deve accumulare hash oltre la dimensione di un blocco
+			if len(passwords) >= opts.BatchSize {
+				if err := send(); err != nil {
+					return err
+				}
+			}
+		}
+		if _, found := seen[record.Email]; found {
+			return nil
+		}
+		// Finestra piena: ricomincia da zero invece di crescere oltre il limite di memoria
+		if len(seen) >= window {
+			clear(seen)
+		}
+		seen[record.Email] = struct{}{}
+		unique++
+		current = append(current, record)
+		if len(current) == opts.BatchSize {
+			return send()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return send()
+}
@@ -0,0 +1,254 @@
+package ingest
+
+import (
+	"context"
+	"extract/extractor"
+	"io"
+	"pwnscanner/pkg/database"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// SHA-1 in maiuscolo di "password" e di "123456"
+const (
+	sha1Password = "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8"
+	sha1Numbers  = "7C4A8D09CA3762AF61E59520943DC26494F8941B"
+)
+
+// recordsParser restituisce un extractor.Parser che emette i record indicati senza leggere il file.
+func recordsParser(records []extractor.Record) extractor.Parser {
+	return func(ctx context.Context, r io.Reader, stats *extractor.Stats, emit func(extractor.Record) error) error {
+		for _, record := range records {
+			stats.Emails++
+			if err := emit(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// extractPasswords esegue extract e somma gli hash delle password di tutti i blocchi.
+func extractPasswords(t *testing.T, records []extractor.Record, opts Options) map[string]int64 {
+	t.Helper()
+	batches := make(chan batch, 1024)
+	if err := extract(context.Background(), strings.NewReader(""), recordsParser(records), opts, batches); err != nil {
+		t.Fatalf("extract: errore inatteso: %v", err)
+	}
+	close(batches)
+
+	counts := make(map[string]int64)
+	seq := 0
+	for b := range batches {
+		if b.seq != seq {
+			t.Errorf("blocco %d ricevuto al posto del %d", b.seq, seq)
+		}
+		seq++
+		for hash, count := range b.passwords {
+			counts[hash] += count
+		}
+	}
+	return counts
+}
+
+func TestExtractPasswords(t *testing.T) {
+	opts := DefaultOptions
+	opts.Passwords = true
+	opts.PasswordSource = "Test/dump.txt"
+
+	for _, tc := range []struct {
+		name    string
+		records []extractor.Record
+		want    map[string]int64
+	}{
+		{
+			name: "password in chiaro, duplicati compresi",
+			records: []extractor.Record{
+				{Email: "alice@example.com", Password: "password"},
+				{Email: "bob@example.com", Password: "password"},
+				{Email: "alice@example.com", Password: "password"},
+				{Email: "carol@example.com", Password: "123456"},
+			},
+			want: map[string]int64{sha1Password: 3, sha1Numbers: 1},
+		},
+		{
+			name: "hash e password vuote esclusi",
+			records: []extractor.Record{
+				{Email: "alice@example.com", Password: "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"},
+				{Email: "bob@example.com", Password: "5f4dcc3b5aa765d61d8327deb882cf99"},
+				{Email: "carol@example.com", Password: "*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19"},
+				{Email: "dave@example.com"},
+				{Email: "erin@example.com", Password: "password"},
+			},
+			want: map[string]int64{sha1Password: 1},
+		},
+		{
+			name:    "nessun record",
+			records: nil,
+			want:    map[string]int64{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := extractPasswords(t, tc.records, opts); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("hash contati = %v, attesi %v", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("senza Options.Passwords", func(t *testing.T) {
+		records := []extractor.Record{{Email: "alice@example.com", Password: "password"}}
+		if got := extractPasswords(t, records, DefaultOptions); len(got) != 0 {
+			t.Errorf("hash contati = %v, attesi nessuno", got)
+		}
+	})
+
+	// Un blocco con molti duplicati viene chiuso quando raggiunge BatchSize hash distinti
+	t.Run("blocchi limitati dagli hash", func(t *testing.T) {
+		small := opts
+		small.BatchSize = 2
+		records := []extractor.Record{
+			{Email: "alice@example.com", Password: "a"},
+			{Email: "alice@example.com", Password: "b"},
+			{Email: "alice@example.com", Password: "c"},
+			{Email: "alice@example.com", Password: "a"},
+		}
+		got := extractPasswords(t, records, small)
+		var total int64
+		for _, count := range got {
+			total += count
+		}
+		if len(got) != 3 || total != 4 {
+			t.Errorf("hash contati = %v, attesi 3 hash e 4 occorrenze", got)
+		}
+	})
+}
+
+// flakyWriter simula un errore transitorio dopo la prima scrittura degli hash delle password,
+// già applicata dal database.
+type flakyWriter struct {
+	*database.Memory
+	failed bool
+}
+
+func (w *flakyWriter) AddPasswordHashes(ctx context.Context, source string, block int, counts map[string]int64) error {
+	if err := w.Memory.AddPasswordHashes(ctx, source, block, counts); err != nil {
+		return err
+	}
+	if !w.failed {
+		w.failed = true
+		return database.ErrUnavailable
+	}
+	return nil
+}
+
+func TestRunPasswordsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	records := []extractor.Record{
+		{Email: "alice@example.com", Password: "password"},
+		{Email: "bob@example.com", Password: "password"},
+		{Email: "carol@example.com", Password: "123456"},
+	}
+	opts := DefaultOptions
+	opts.Passwords = true
+	opts.Retries = 1
+	opts.PasswordSource = "Test/dump.txt"
+
+	db := &flakyWriter{Memory: database.NewMemory()}
+	check := func(when string, want map[string]int64) {
+		t.Helper()
+		for hash, count := range want {
+			hashes, err := db.PasswordRange(ctx, hash[:database.PasswordPrefixLength])
+			if err != nil {
+				t.Fatalf("PasswordRange: errore inatteso: %v", err)
+			}
+			var got int64
+			for _, h := range hashes {
+				if h.Suffix == hash[database.PasswordPrefixLength:] {
+					got = h.Count
+				}
+			}
+			if got != count {
+				t.Errorf("%s: %s contato %d volte, attese %d", when, hash, got, count)
+			}
+		}
+	}
+	run := func(opts Options) {
+		t.Helper()
+		if _, err := Run(ctx, strings.NewReader(""), recordsParser(records), db, "Test", opts, func(Progress) {}); err != nil {
+			t.Fatalf("Run: errore inatteso: %v", err)
+		}
+	}
+
+	// Il primo import ripete la scrittura del blocco dopo l'errore transitorio
+	run(opts)
+	if !db.failed {
+		t.Fatal("la scrittura degli hash non è stata ripetuta")
+	}
+	check("dopo il tentativo ripetuto", map[string]int64{sha1Password: 2, sha1Numbers: 1})
+
+	// Lo stesso file importato di nuovo, o ripreso da capo, sostituisce i conteggi precedenti
+	run(opts)
+	check("dopo il secondo import", map[string]int64{sha1Password: 2, sha1Numbers: 1})
+
+	// Un altro file dello stesso breach si somma
+	other := opts
+	other.PasswordSource = "Test/altro.txt"
+	run(other)
+	check("dopo un altro file", map[string]int64{sha1Password: 4, sha1Numbers: 2})
+}
+
+// Due file con lo stesso nome in cartelle diverse, importati in parallelo, hanno origini distinte:
+// nessuno dei due azzera i conteggi dell'altro o ne salta i blocchi con lo stesso numero.
+func TestRunPasswordsSameName(t *testing.T) {
+	ctx := context.Background()
+	db := database.NewMemory()
+	files := map[string][]extractor.Record{
+		"dump/a/users.txt": {
+			{Email: "alice@example.com", Password: "password"},
+			{Email: "bob@example.com", Password: "123456"},
+		},
+		"dump/b/users.txt": {
+			{Email: "carol@example.com", Password: "password"},
+			{Email: "dave@example.com", Password: "password"},
+		},
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(files))
+	for name, records := range files {
+		opts := DefaultOptions
+		opts.Passwords = true
+		opts.PasswordSource = PasswordSource("Test", name)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := Run(ctx, strings.NewReader(""), recordsParser(records), db, "Test", opts, func(Progress) {})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Run: errore inatteso: %v", err)
+		}
+	}
+
+	for hash, want := range map[string]int64{sha1Password: 3, sha1Numbers: 1} {
+		hashes, err := db.PasswordRange(ctx, hash[:database.PasswordPrefixLength])
+		if err != nil {
+			t.Fatalf("PasswordRange: errore inatteso: %v", err)
+		}
+		var got int64
+		for _, h := range hashes {
+			if h.Suffix == hash[database.PasswordPrefixLength:] {
+				got = h.Count
+			}
+		}
+		if got != want {
+			t.Errorf("%s contato %d volte, attese %d", hash, got, want)
+		}
+	}
+}
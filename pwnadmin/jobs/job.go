@@ -0,0 +1,189 @@
+// Package jobs gestisce gli import asincroni di pwnadmin: l'upload crea un job e risponde subito,
+// un worker lo elabora file per file e lo stato del job viene salvato su disco a ogni avanzamento,
+// così sopravvive a un riavvio e può essere seguito in tempo reale, annullato o ripetuto.
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"extract/extractor"
+	"slices"
+	"time"
+)
+
+// Status è lo stato di un job o di un suo file.
+type Status string
+
+const (
+	// StatusQueued indica un job in attesa del worker
+	StatusQueued Status = "queued"
+	// StatusRunning indica un job, o un file, in elaborazione
+	StatusRunning Status = "running"
+	// StatusCompleted indica un job terminato senza errori
+	StatusCompleted Status = "completed"
+	// StatusFailed indica un job terminato con almeno un file non caricato, o un file non caricato
+	StatusFailed Status = "failed"
+	// StatusCancelled indica un job, o un file, annullato dall'amministratore
+	StatusCancelled Status = "cancelled"
+	// StatusInterrupted indica un job fermato dall'arresto di pwnadmin, che riprende al riavvio
+	StatusInterrupted Status = "interrupted"
+	// StatusPending indica un file non ancora elaborato
+	StatusPending Status = "pending"
+	// StatusDone indica un file caricato completamente
+	StatusDone Status = "done"
+	// StatusSkipped indica un file vuoto o senza email valide
+	StatusSkipped Status = "skipped"
+)
+
+// Finished indica se lo stato è definitivo: il job non verrà più elaborato senza un retry.
+func (s Status) Finished() bool {
+	return s == StatusCompleted || s == StatusFailed || s == StatusCancelled
+}
+
+// statusLabels sono le descrizioni degli stati mostrate nelle pagine di pwnadmin.
+var statusLabels = map[Status]string{
+	StatusQueued:      "In coda",
+	StatusRunning:     "In corso",
+	StatusCompleted:   "Completato",
+	StatusFailed:      "Non riuscito",
+	StatusCancelled:   "Annullato",
+	StatusInterrupted: "Interrotto",
+	StatusPending:     "In attesa",
+	StatusDone:        "Caricato",
+	StatusSkipped:     "Nessuna email",
+}
+
+// Label restituisce la descrizione dello stato.
+func (s Status) Label() string {
+	if label, ok := statusLabels[s]; ok {
+		return label
+	}
+	return string(s)
+}
+
+// Job è un import di uno o più file in un breach.
+type Job struct {
+	ID     string `json:"id"`
+	Breach string `json:"breach"`
+	Status Status `json:"status"`
+	// Mapping indica come leggere i file strutturati del job
+	Mapping extractor.Mapping `json:"mapping"`
+	// Passwords indica se contare gli hash delle password in chiaro trovate nei file
+	Passwords  bool         `json:"passwords,omitempty"`
+	Files      []FileReport `json:"files"`
+	CreatedAt  time.Time    `json:"created_at"`
+	StartedAt  time.Time    `json:"started_at"`
+	FinishedAt time.Time    `json:"finished_at"`
+	// Attempts è il numero di esecuzioni, compresi i retry
+	Attempts int `json:"attempts"`
+	// Error è il motivo del fallimento o dell'interruzione del job
+	Error string `json:"error,omitempty"`
+}
+
+// FileReport è lo stato di un file del job.
+type FileReport struct {
+	// Name è il nome del file caricato, con il percorso relativo se fa parte di una cartella
+	Name string `json:"name"`
+	// Stored è il nome della copia salvata nella directory dei file del job
+	Stored string `json:"stored"`
+	Size   int64  `json:"size"`
+	Status Status `json:"status"`
+	// Read è il numero di byte del file già elaborati
+	Read int64 `json:"read"`
+	// Extracted è il numero di email valide estratte, duplicati compresi
+	Extracted int64 `json:"extracted"`
+	// Rejected è il numero di indirizzi scartati perché non normalizzabili
+	Rejected int64 `json:"rejected"`
+	// Unique è il numero di email inviate al database, senza i duplicati scartati durante l'estrazione
+	Unique int64 `json:"unique"`
+	// Processed è il numero di email già scritte nel database
+	Processed int64 `json:"processed"`
+	// Matched, Modified e Upserted sommano l'esito delle scritture (vedi database.WriteResult)
+	Matched  int64 `json:"matched"`
+	Modified int64 `json:"modified"`
+	Upserted int64 `json:"upserted"`
+	// Fields conta gli altri campi dei record estratti dai file strutturati
+	Fields extractor.FieldCounts `json:"fields"`
+	// Format è il formato riconosciuto del file
+	Format string `json:"format,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// Entries sono i file contenuti in un archivio, ciascuno con i propri contatori;
+	// per gli archivi Size e Read contano i byte compressi
+	Entries []FileReport `json:"entries,omitempty"`
+}
+
+// SumEntries riporta nei contatori del file la somma di quelli di Entries.
+func (f *FileReport) SumEntries() {
+	f.Extracted, f.Rejected, f.Unique, f.Processed = 0, 0, 0, 0
+	f.Matched, f.Modified, f.Upserted = 0, 0, 0
+	f.Fields = extractor.FieldCounts{}
+	for _, e := range f.Entries {
+		f.Fields.Add(e.Fields)
+		f.Extracted += e.Extracted
+		f.Rejected += e.Rejected
+		f.Unique += e.Unique
+		f.Processed += e.Processed
+		f.Matched += e.Matched
+		f.Modified += e.Modified
+		f.Upserted += e.Upserted
+	}
+}
+
+// Progress restituisce l'avanzamento del job in percentuale, in proporzione ai byte elaborati:
+// i file terminati, anche con errori, contano per intero.
+func (j *Job) Progress() float64 {
+	var total, done int64
+	for _, f := range j.Files {
+		total += f.Size
+		switch f.Status {
+		case StatusDone, StatusSkipped, StatusFailed:
+			done += f.Size
+		default:
+			done += min(f.Read, f.Size)
+		}
+	}
+	if total == 0 {
+		if len(j.Files) > 0 && j.Status == StatusCompleted {
+			return 100
+		}
+		return 0
+	}
+	return float64(done) / float64(total) * 100
+}
+
+// Totals somma i contatori di tutti i file del job.
+func (j *Job) Totals() FileReport {
+	var t FileReport
+	for _, f := range j.Files {
+		t.Size += f.Size
+		t.Read += f.Read
+		t.Extracted += f.Extracted
+		t.Rejected += f.Rejected
+		t.Unique += f.Unique
+		t.Processed += f.Processed
+		t.Matched += f.Matched
+		t.Modified += f.Modified
+		t.Upserted += f.Upserted
+		t.Fields.Add(f.Fields)
+	}
+	return t
+}
+
+// clone restituisce una copia del job che può essere letta senza il lock del Manager.
+func (j *Job) clone() Job {
+	c := *j
+	c.Files = slices.Clone(j.Files)
+	for i := range c.Files {
+		c.Files[i].Entries = slices.Clone(c.Files[i].Entries)
+	}
+	return c
+}
+
+// NewID genera l'identificativo di un nuovo job.
+func NewID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,487 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"extract/extractor"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// saveInterval è l'intervallo minimo tra due salvataggi dell'avanzamento di un job su disco.
+// I cambi di stato vengono sempre salvati; gli aggiornamenti ai subscriber non sono limitati.
+const saveInterval = time.Second
+
+var (
+	// ErrNotFound indica un job inesistente
+	ErrNotFound = errors.New("job non trovato")
+	// ErrInvalidState indica un'operazione non ammessa nello stato attuale del job
+	ErrInvalidState = errors.New("operazione non ammessa nello stato attuale del job")
+	// ErrCancelled è la causa dell'annullamento di un job da parte dell'amministratore
+	ErrCancelled = errors.New("import annullato")
+	// ErrShutdown è la causa dell'interruzione di un job per l'arresto di pwnadmin
+	ErrShutdown = errors.New("import interrotto dall'arresto di pwnadmin")
+)
+
+// Source è un file da importare.
+type Source struct {
+	Breach string
+	// Name è il nome del file caricato, Path quello della copia salvata
+	Name    string
+	Path    string
+	Mapping extractor.Mapping
+	// Passwords indica se contare gli hash delle password in chiaro (vedi ingest.Options.Passwords)
+	Passwords bool
+}
+
+// Processor importa un file nel breach. Aggiorna il report del file con update, che lo salva e
+// lo notifica a chi segue il job. Quando ctx viene annullato deve fermarsi appena possibile,
+// senza lasciare a metà una scrittura nel database, e restituire l'errore del contesto.
+type Processor func(ctx context.Context, source Source, update func(func(*FileReport))) error
+
+// Manager accoda i job, li elabora con un worker e ne notifica l'avanzamento.
+// I file di un job vengono elaborati in parallelo, fino a fileWorkers alla volta.
+type Manager struct {
+	store       *Store
+	process     Processor
+	fileWorkers int
+
+	mu          sync.Mutex
+	wake        *sync.Cond
+	jobs        map[string]*Job
+	queue       []string
+	running     map[string]context.CancelCauseFunc
+	subscribers map[string][]chan Job
+	savedAt     map[string]time.Time
+	closing     bool
+	closed      bool // i subscriber sono stati chiusi: Subscribe restituisce un canale chiuso
+
+	ctx     context.Context
+	stop    context.CancelCauseFunc
+	workers sync.WaitGroup
+}
+
+// NewManager carica i job salvati nello store. I job rimasti in coda o in elaborazione
+// all'arresto precedente vengono rimessi in coda e ripresi dai file non completati.
+// fileWorkers è il numero di file di un job elaborati contemporaneamente.
+func NewManager(store *Store, process Processor, fileWorkers int) (*Manager, error) {
+	if fileWorkers < 1 {
+		return nil, fmt.Errorf("il numero di file elaborati in parallelo deve essere almeno 1 (attuale: %d)", fileWorkers)
+	}
+	saved, err := store.LoadAll()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(saved, func(i, j int) bool { return saved[i].CreatedAt.Before(saved[j].CreatedAt) })
+
+	m := &Manager{
+		store:       store,
+		process:     process,
+		fileWorkers: fileWorkers,
+		jobs:        make(map[string]*Job, len(saved)),
+		running:     make(map[string]context.CancelCauseFunc),
+		subscribers: make(map[string][]chan Job),
+		savedAt:     make(map[string]time.Time),
+	}
+	m.wake = sync.NewCond(&m.mu)
+	m.ctx, m.stop = context.WithCancelCause(context.Background())
+
+	for i := range saved {
+		job := &saved[i]
+		m.jobs[job.ID] = job
+		if job.Status.Finished() {
+			continue
+		}
+		if job.Status != StatusQueued {
+			log.Printf("Il job %s (%s) non era terminato all'arresto precedente (stato %s): viene ripreso", job.ID, job.Breach, job.Status)
+		}
+		for f := range job.Files {
+			if job.Files[f].Status == StatusRunning {
+				job.Files[f].Status = StatusPending
+			}
+		}
+		job.Status = StatusQueued
+		m.queue = append(m.queue, job.ID)
+		m.save(job)
+	}
+	return m, nil
+}
+
+// Start avvia il worker che elabora i job in coda.
+func (m *Manager) Start() {
+	m.workers.Add(1)
+	go func() {
+		defer m.workers.Done()
+		for {
+			id, ok := m.next()
+			if !ok {
+				return
+			}
+			m.run(id)
+		}
+	}()
+}
+
+// FilesDir restituisce la directory in cui salvare i file del job prima di Submit.
+func (m *Manager) FilesDir(id string) string {
+	return m.store.FilesDir(id)
+}
+
+// Discard elimina i file di un job non ancora accodato, quando il suo upload non è andato a buon fine.
+func (m *Manager) Discard(id string) error {
+	return m.store.Remove(id)
+}
+
+// Submit accoda un nuovo job. I file devono essere già stati salvati in FilesDir(job.ID).
+func (m *Manager) Submit(job Job) error {
+	job.Status = StatusQueued
+	job.CreatedAt = time.Now().UTC()
+	for i := range job.Files {
+		job.Files[i].Status = StatusPending
+	}
+	if err := m.store.Save(job); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobs[job.ID] = &job
+	m.queue = append(m.queue, job.ID)
+	m.wake.Broadcast()
+	return nil
+}
+
+// Get restituisce una copia del job.
+func (m *Manager) Get(id string) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return job.clone(), true
+}
+
+// List restituisce una copia di tutti i job, dal più recente.
+func (m *Manager) List() []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		list = append(list, job.clone())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+// Cancel annulla un job in coda, o ferma quello in elaborazione alla fine delle scritture in corso.
+func (m *Manager) Cancel(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	switch job.Status {
+	case StatusQueued:
+		for i, queued := range m.queue {
+			if queued == id {
+				m.queue = append(m.queue[:i], m.queue[i+1:]...)
+				break
+			}
+		}
+		for i := range job.Files {
+			if job.Files[i].Status == StatusPending {
+				job.Files[i].Status = StatusCancelled
+			}
+		}
+		job.Status = StatusCancelled
+		job.Error = ErrCancelled.Error()
+		job.FinishedAt = time.Now().UTC()
+		m.changed(job)
+		return nil
+	case StatusRunning:
+		m.running[id](ErrCancelled)
+		return nil
+	default:
+		return ErrInvalidState
+	}
+}
+
+// Retry rimette in coda un job terminato con errori o annullato: vengono rielaborati
+// solo i file non completati.
+func (m *Manager) Retry(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if job.Status != StatusFailed && job.Status != StatusCancelled {
+		return ErrInvalidState
+	}
+	if m.closing {
+		return ErrShutdown
+	}
+
+	for i := range job.Files {
+		if f := &job.Files[i]; f.Status != StatusDone && f.Status != StatusSkipped {
+			*f = FileReport{Name: f.Name, Stored: f.Stored, Size: f.Size, Status: StatusPending}
+		}
+	}
+	job.Status = StatusQueued
+	job.Error = ""
+	job.FinishedAt = time.Time{}
+	m.queue = append(m.queue, id)
+	m.changed(job)
+	m.wake.Broadcast()
+	return nil
+}
+
+// Subscribe restituisce un canale che riceve lo stato del job a ogni cambiamento, a partire da quello attuale.
+// Se gli aggiornamenti arrivano più velocemente di quanto vengono letti, il canale conserva solo l'ultimo.
+// Il canale viene chiuso da CloseSubscribers; unsubscribe va chiamata quando non serve più.
+func (m *Manager) Subscribe(id string) (updates <-chan Job, unsubscribe func(), err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, nil, ErrNotFound
+	}
+
+	ch := make(chan Job, 1)
+	ch <- job.clone()
+	if m.closed {
+		close(ch)
+		return ch, func() {}, nil
+	}
+	m.subscribers[id] = append(m.subscribers[id], ch)
+
+	return ch, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		subs := m.subscribers[id]
+		for i, sub := range subs {
+			if sub == ch {
+				m.subscribers[id] = append(subs[:i], subs[i+1:]...)
+				break
+			}
+		}
+		if len(m.subscribers[id]) == 0 {
+			delete(m.subscribers, id)
+		}
+	}, nil
+}
+
+// CloseSubscribers chiude i canali di tutti i subscriber, così le connessioni che seguono
+// i job terminano e l'arresto del server HTTP non le attende.
+func (m *Manager) CloseSubscribers() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, subs := range m.subscribers {
+		for _, ch := range subs {
+			close(ch)
+		}
+		delete(m.subscribers, id)
+	}
+	m.closed = true
+}
+
+// Shutdown smette di avviare i job in coda e attende quello in elaborazione. Se ctx scade prima,
+// il job viene interrotto alla fine delle scritture in corso e ripreso al prossimo avvio.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	m.closing = true
+	m.wake.Broadcast()
+	m.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		m.stop(ErrShutdown)
+		<-done
+		return ctx.Err()
+	}
+}
+
+// next attende il prossimo job in coda; restituisce false quando il Manager si sta arrestando.
+func (m *Manager) next() (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for len(m.queue) == 0 && !m.closing {
+		m.wake.Wait()
+	}
+	if m.closing {
+		return "", false
+	}
+	id := m.queue[0]
+	m.queue = m.queue[1:]
+	return id, true
+}
+
+// run elabora i file ancora da completare del job.
+func (m *Manager) run(id string) {
+	ctx, cancel := context.WithCancelCause(m.ctx)
+	defer cancel(nil)
+
+	m.mu.Lock()
+	job := m.jobs[id]
+	job.Status = StatusRunning
+	job.StartedAt = time.Now().UTC()
+	job.Attempts++
+	m.running[id] = cancel
+	m.changed(job)
+	m.mu.Unlock()
+	log.Printf("Avvio del job %s: %d file nel breach %s", id, len(job.Files), job.Breach)
+
+	// Ogni worker prende il prossimo file in attesa finché non ne restano o il job viene fermato
+	next := 0
+	var files sync.WaitGroup
+	for range min(m.fileWorkers, len(job.Files)) {
+		files.Add(1)
+		go func() {
+			defer files.Done()
+			for {
+				m.mu.Lock()
+				for next < len(job.Files) && job.Files[next].Status != StatusPending {
+					next++
+				}
+				if next == len(job.Files) || ctx.Err() != nil {
+					m.mu.Unlock()
+					return
+				}
+				i := next
+				next++
+				m.mu.Unlock()
+				m.runFile(ctx, job, i)
+			}
+		}()
+	}
+	files.Wait()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.running, id)
+	job.FinishedAt = time.Now().UTC()
+	failed := 0
+	for i := range job.Files {
+		if job.Files[i].Status == StatusFailed {
+			failed++
+		}
+	}
+
+	switch cause := context.Cause(ctx); {
+	case errors.Is(cause, ErrShutdown):
+		// Il job resta in coda su disco e riprende al prossimo avvio
+		job.Status = StatusInterrupted
+		job.Error = cause.Error()
+		job.FinishedAt = time.Time{}
+	case errors.Is(cause, ErrCancelled):
+		for i := range job.Files {
+			if job.Files[i].Status == StatusPending {
+				job.Files[i].Status = StatusCancelled
+			}
+		}
+		job.Status = StatusCancelled
+		job.Error = cause.Error()
+	case failed > 0:
+		job.Status = StatusFailed
+		job.Error = fmt.Sprintf("%d file su %d non caricati", failed, len(job.Files))
+	default:
+		job.Status = StatusCompleted
+		job.Error = ""
+		if err := m.store.RemoveFiles(id); err != nil {
+			log.Printf("Job %s: impossibile eliminare i file caricati: %v", id, err)
+		}
+	}
+	m.changed(job)
+	delete(m.savedAt, id)
+
+	totals := job.Totals()
+	log.Printf("Job %s %s in %s: %d email estratte, %d scartate, %d nuove, %d già presenti",
+		id, job.Status, time.Since(job.StartedAt).Round(time.Second), totals.Extracted, totals.Rejected, totals.Upserted, totals.Matched)
+}
+
+// runFile elabora il file i del job, che deve essere in attesa.
+func (m *Manager) runFile(ctx context.Context, job *Job, i int) {
+	m.mu.Lock()
+	file := &job.Files[i]
+	// Un file interrotto viene ricaricato da capo: la scrittura è idempotente
+	*file = FileReport{Name: file.Name, Stored: file.Stored, Size: file.Size, Status: StatusRunning}
+	m.changed(job)
+	source := Source{Breach: job.Breach, Name: file.Name, Path: filepath.Join(m.store.FilesDir(job.ID), file.Stored), Mapping: job.Mapping, Passwords: job.Passwords}
+	m.mu.Unlock()
+
+	log.Printf("Job %s: elaborazione del file %s", job.ID, source.Name)
+	err := m.process(ctx, source, func(update func(*FileReport)) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		update(file)
+		m.progressed(job)
+	})
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case err == nil && file.Unique == 0:
+		file.Status = StatusSkipped
+	case err == nil:
+		file.Status = StatusDone
+	case ctx.Err() != nil:
+		file.Status = StatusPending
+	default:
+		log.Printf("Job %s: errore durante l'import del file %s: %v", job.ID, source.Name, err)
+		file.Status = StatusFailed
+		file.Error = err.Error()
+	}
+	m.changed(job)
+}
+
+// changed salva il job e lo invia ai subscriber. Va chiamata con il lock.
+func (m *Manager) changed(job *Job) {
+	m.save(job)
+	m.notify(job)
+}
+
+// progressed invia ai subscriber l'avanzamento del job e lo salva al più ogni saveInterval.
+// Va chiamata con il lock.
+func (m *Manager) progressed(job *Job) {
+	if time.Since(m.savedAt[job.ID]) >= saveInterval {
+		m.save(job)
+	}
+	m.notify(job)
+}
+
+// notify invia lo stato del job ai subscriber. Va chiamata con il lock.
+func (m *Manager) notify(job *Job) {
+	snapshot := job.clone()
+	for _, ch := range m.subscribers[job.ID] {
+		// Il canale ha capacità 1: un aggiornamento non ancora letto viene sostituito dall'ultimo
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- snapshot
+	}
+}
+
+// save salva il job; un errore non interrompe l'import ma lo stato su disco resta indietro.
+func (m *Manager) save(job *Job) {
+	if err := m.store.Save(job.clone()); err != nil {
+		log.Printf("Impossibile salvare lo stato del job %s: %v", job.ID, err)
+		return
+	}
+	m.savedAt[job.ID] = time.Now()
+}
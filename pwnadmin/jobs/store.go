@@ -0,0 +1,101 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// jobFile è il nome del file con lo stato del job, nella directory del job.
+const jobFile = "job.json"
+
+// Store salva i job su disco: ogni job ha una directory con lo stato (job.json)
+// e, in files/, le copie dei file caricati, eliminate quando il job termina con successo.
+type Store struct {
+	dir string
+}
+
+// NewStore crea, se non esiste, la directory dei job.
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("impossibile creare la directory dei job %s: %w", dir, err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// FilesDir restituisce la directory in cui salvare i file caricati del job.
+func (s *Store) FilesDir(id string) string {
+	return filepath.Join(s.dir, id, "files")
+}
+
+// Save scrive lo stato del job, sostituendo atomicamente quello precedente.
+func (s *Store) Save(job Job) error {
+	dir := filepath.Join(s.dir, job.ID)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".job-*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, jobFile))
+}
+
+// LoadAll legge tutti i job salvati. Le directory senza stato, lasciate da un upload
+// interrotto prima della creazione del job, vengono eliminate.
+func (s *Store) LoadAll() ([]Job, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []Job
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.dir, entry.Name(), jobFile))
+		if errors.Is(err, fs.ErrNotExist) {
+			if err := os.RemoveAll(filepath.Join(s.dir, entry.Name())); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			return nil, fmt.Errorf("stato del job %s non valido: %w", entry.Name(), err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// RemoveFiles elimina i file caricati del job, conservandone lo stato.
+func (s *Store) RemoveFiles(id string) error {
+	return os.RemoveAll(s.FilesDir(id))
+}
+
+// Remove elimina il job e i suoi file, ad esempio quando l'upload fallisce prima di Submit.
+func (s *Store) Remove(id string) error {
+	return os.RemoveAll(filepath.Join(s.dir, id))
+}
@@ -2,28 +2,41 @@ package main
 
 import (
 	"context"
-	"extract/extractor"
+	"crypto/subtle"
 	"fmt"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"html/template"
 	"log"
 	"net/http"
 	"os"
-	"path/filepath"
-	"sync/atomic"
+	"os/signal"
+	"pwnscanner/pkg/database"
+	"pwnscanner/pkg/normalize"
+	"strconv"
+	"syscall"
 	"time"
 )
 
 var (
-	mongoClient   *mongo.Client
-	dbName        string
+	writer        database.Writer
+	normalizer    *normalize.Normalizer
 	adminUsername string
 	adminPassword string
 )
 
 func main() {
+	// Le email vengono normalizzate come in PwnScannerFront, che deve usare le stesse regole
+	var err error
+	normalizer, err = newNormalizer()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Con un argomento pwnadmin esegue un comando di manutenzione invece di avviare il server
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1], os.Args[2:])
+		return
+	}
+
 	// Leggi le credenziali admin dalle variabili d'ambiente
 	adminUsername = os.Getenv("ADMIN_USERNAME")
 	adminPassword = os.Getenv("ADMIN_PASSWORD")
@@ -31,41 +44,175 @@ func main() {
 		log.Fatal("Le credenziali admin (ADMIN_USERNAME e ADMIN_PASSWORD) devono essere definite nelle variabili d'ambiente")
 	}
 
-	// Configura la connessione a MongoDB
-	mongoURI := os.Getenv("MONGODB_URI")
-	if mongoURI == "" {
-		log.Fatal("La variabile d'ambiente MONGODB_URI non è impostata")
-	}
-	dbName = os.Getenv("MONGODB_DBNAME")
-	if dbName == "" {
-		dbName = "extract"
-	}
+	// Il contesto viene annullato alla ricezione di SIGINT o SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	clientOptions := options.Client().ApplyURI(mongoURI)
-	var err error
-	mongoClient, err = mongo.Connect(context.Background(), clientOptions)
+	// Configura il database di destinazione degli import
+	writer, err = openWriter(context.Background())
 	if err != nil {
-		log.Fatalf("Errore nella connessione a MongoDB: %v", err)
+		log.Fatalf("Errore nella connessione al database: %v", err)
 	}
 
 	defer func() {
-		if err := mongoClient.Disconnect(context.Background()); err != nil {
-			log.Fatalf("Errore durante la disconnessione da MongoDB: %v", err)
+		if err := writer.Close(); err != nil {
+			log.Fatalf("Errore durante la disconnessione dal database: %v", err)
 		}
 	}()
 
-	// Configura gli handler HTTP
+	if err := autoMigrate(context.Background(), writer); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ensureStats(context.Background(), writer); err != nil {
+		log.Fatal(err)
+	}
+
+	// Avvia il worker dei job di import
+	importJobs, err = newImportJobs()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Configura gli handler HTTP; /healthz e /readyz non richiedono autenticazione
+	http.HandleFunc("GET /healthz", healthzHandler)
+	http.HandleFunc("GET /readyz", readyzHandler)
 	http.HandleFunc("/login", loginHandler)
 	http.HandleFunc("/", authMiddleware(indexHandler))
 	http.HandleFunc("/upload", authMiddleware(uploadHandler))
+	http.HandleFunc("GET /jobs/{id}", authMiddleware(jobHandler))
+	http.HandleFunc("GET /jobs/{id}/events", authMiddleware(jobEventsHandler))
+	http.HandleFunc("POST /jobs/{id}/cancel", authMiddleware(cancelJobHandler))
+	http.HandleFunc("POST /jobs/{id}/retry", authMiddleware(retryJobHandler))
+	http.HandleFunc("/breaches", authMiddleware(breachesHandler))
+	http.HandleFunc("/breaches/delete", authMiddleware(deleteBreachHandler))
+	http.HandleFunc("/breaches/remove", authMiddleware(removeBreachHandler))
+	http.HandleFunc("/apikeys", authMiddleware(apiKeysHandler))
+	http.HandleFunc("/apikeys/revoke", authMiddleware(revokeAPIKeyHandler))
+	http.HandleFunc("/apikeys/domains", authMiddleware(apiKeyDomainsHandler))
 
 	fmt.Println("Il server è in esecuzione sulla porta 8081...")
-	log.Fatal(http.ListenAndServe(":8081", nil))
+	if err := serve(ctx, &http.Server{Addr: ":8081"}); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("pwnadmin arrestato.")
+}
+
+// openWriter apre il database indicato da DB_TYPE (default: mongodb).
+func openWriter(ctx context.Context) (database.Writer, error) {
+	dbType := os.Getenv("DB_TYPE")
+	if dbType == "" {
+		dbType = "mongodb"
+	}
+	keys, err := emailKeysFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if keys != nil && dbType != "mongodb" {
+		return nil, fmt.Errorf("EMAIL_HMAC_KEYS: le email come HMAC richiedono MongoDB (DB_TYPE=%s)", dbType)
+	}
+
+	switch dbType {
+	case "mongodb":
+		mongoURI := os.Getenv("MONGODB_URI")
+		if mongoURI == "" {
+			return nil, fmt.Errorf("la variabile d'ambiente MONGODB_URI non è impostata")
+		}
+		dbName := os.Getenv("MONGODB_DBNAME")
+		if dbName == "" {
+			dbName = "extract"
+		}
+		db, err := database.NewMongoDBFromURI(ctx, mongoURI, dbName, "breaches")
+		if err != nil {
+			return nil, err
+		}
+		// Ogni comando rifiuta uno schema più recente; le migrazioni le applica il server o il comando migrate
+		if err := checkSchema(ctx, db); err != nil {
+			db.Close()
+			return nil, err
+		}
+		if keys != nil {
+			db.SetEmailKeys(keys)
+			log.Printf("Email conservate come HMAC con la chiave %s (lettura doppia: %t)", keys.Current(), keys.DualRead)
+		}
+		return db, nil
+	case "embedded":
+		embeddedPath := os.Getenv("EMBEDDED_PATH")
+		if embeddedPath == "" {
+			return nil, fmt.Errorf("la variabile d'ambiente EMBEDDED_PATH non è impostata")
+		}
+		log.Printf("Database embedded: %s", embeddedPath)
+		return database.NewBolt(embeddedPath, false)
+	case "postgres":
+		postgresURL := os.Getenv("POSTGRES_URL")
+		if postgresURL == "" {
+			return nil, fmt.Errorf("la variabile d'ambiente POSTGRES_URL non è impostata")
+		}
+		return database.NewPostgres(ctx, postgresURL)
+	default:
+		return nil, fmt.Errorf("tipo di database non supportato: %s", dbType)
+	}
+}
+
+// emailKeysFromEnv legge le chiavi HMAC delle email da EMAIL_HMAC_KEYS ("id:segreto in base64" separati
+// da virgole, dalla più vecchia alla più recente) e EMAIL_HMAC_DUAL_READ (default true). Restituisce nil
+// se EMAIL_HMAC_KEYS non è impostata: le email vengono conservate in chiaro.
+func emailKeysFromEnv() (*database.EmailKeys, error) {
+	spec := os.Getenv("EMAIL_HMAC_KEYS")
+	if spec == "" {
+		return nil, nil
+	}
+	keys, err := database.ParseEmailKeys(spec)
+	if err != nil {
+		return nil, fmt.Errorf("EMAIL_HMAC_KEYS: %w", err)
+	}
+	if value := os.Getenv("EMAIL_HMAC_DUAL_READ"); value != "" {
+		dualRead, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("EMAIL_HMAC_DUAL_READ: valore booleano non valido %q", value)
+		}
+		keys.DualRead = dualRead
+	}
+	return keys, nil
+}
+
+// newNormalizer crea il Normalizer delle email. Le regole dei provider si abilitano con
+// NORMALIZE_PROVIDER_RULES=true e devono corrispondere a normalization.provider_rules di PwnScannerFront.
+func newNormalizer() (*normalize.Normalizer, error) {
+	var opts normalize.Options
+	if value := os.Getenv("NORMALIZE_PROVIDER_RULES"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("NORMALIZE_PROVIDER_RULES: valore booleano non valido %q", value)
+		}
+		opts.ProviderRules = enabled
+	}
+	return normalize.New(opts), nil
+}
+
+// intFromEnv legge un intero non negativo dalla variabile d'ambiente name, o restituisce fallback.
+func intFromEnv(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Fatalf("Valore non valido per %s: %q (atteso un numero intero non negativo)", name, value)
+	}
+	return n
+}
+
+// durationFromEnv legge una durata in secondi dalla variabile d'ambiente name, o restituisce fallback.
+// 0 è ammesso e, per il tempo di arresto, indica nessun limite.
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	return time.Duration(intFromEnv(name, int(fallback/time.Second))) * time.Second
 }
 
-// Renderizza un template HTML
-func renderTemplate(w http.ResponseWriter, tmpl string, data interface{}) {
-	t, err := template.ParseFiles(fmt.Sprintf("templates/%s.html", tmpl))
+// Renderizza un template HTML; csrfToken restituisce il token CSRF della sessione da inserire nei form
+func renderTemplate(w http.ResponseWriter, r *http.Request, tmpl string, data interface{}) {
+	funcs := template.FuncMap{"csrfToken": func() string { return csrfToken(r) }}
+	t, err := template.New(tmpl + ".html").Funcs(funcs).ParseFiles(fmt.Sprintf("templates/%s.html", tmpl))
 	if err != nil {
 		http.Error(w, "Errore nel caricamento del template", http.StatusInternalServerError)
 		log.Printf("Errore nel caricamento del template %s: %v", tmpl, err)
@@ -77,7 +224,7 @@ func renderTemplate(w http.ResponseWriter, tmpl string, data interface{}) {
 // Handler per il login
 func loginHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		renderTemplate(w, "login", nil)
+		renderTemplate(w, r, "login", nil)
 		return
 	}
 
@@ -85,11 +232,23 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 		username := r.FormValue("username")
 		password := r.FormValue("password")
 
-		if username == adminUsername && password == adminPassword {
+		// Il confronto a tempo costante non rivela quanti caratteri iniziali delle credenziali sono corretti
+		validUsername := subtle.ConstantTimeCompare([]byte(username), []byte(adminUsername)) == 1
+		validPassword := subtle.ConstantTimeCompare([]byte(password), []byte(adminPassword)) == 1
+		if validUsername && validPassword {
+			id, s, err := newSession(time.Now())
+			if err != nil {
+				http.Error(w, "Errore nella creazione della sessione", http.StatusInternalServerError)
+				log.Printf("Errore nella creazione della sessione: %v", err)
+				return
+			}
 			http.SetCookie(w, &http.Cookie{
-				Name:    "session_token",
-				Value:   "authenticated",
-				Expires: time.Now().Add(1 * time.Hour),
+				Name:     sessionCookie,
+				Value:    id,
+				Path:     "/",
+				Expires:  s.expires,
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
 			})
 			http.Redirect(w, r, "/", http.StatusSeeOther)
 		} else {
@@ -101,200 +260,34 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "Metodo non consentito", http.StatusMethodNotAllowed)
 }
 
-// Middleware per autenticazione
+// Middleware per autenticazione: richiede una sessione creata dal login e, per le richieste che
+// possono modificare i dati, il suo token CSRF
 func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie("session_token")
-		if err != nil || cookie.Value != "authenticated" {
+		s, ok := requestSession(r, time.Now())
+		if !ok {
 			http.Redirect(w, r, "/login", http.StatusSeeOther)
 			return
 		}
-		next.ServeHTTP(w, r)
-	}
-}
-
-// Handler per la pagina principale
-func indexHandler(w http.ResponseWriter, r *http.Request) {
-	renderTemplate(w, "index", nil)
-}
-
-// Handler per l'upload
-
-func uploadHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Metodo non consentito", http.StatusMethodNotAllowed)
-		return
-	}
-
-	breachName := r.FormValue("breachName")
-	if breachName == "" {
-		http.Error(w, "Il nome del breach è richiesto", http.StatusBadRequest)
-		return
-	}
-	collectionName := "breaches" // Nome fisso della collezione
-
-	// Analizza il form multipart
-	err := r.ParseMultipartForm(0)
-	if err != nil {
-		http.Error(w, "Errore durante l'analisi dei dati del form", http.StatusInternalServerError)
-		log.Printf("Errore durante l'analisi dei dati del form: %v", err)
-		return
-	}
-
-	files := r.MultipartForm.File["files"]
-	if len(files) == 0 {
-		http.Error(w, "Nessun file caricato", http.StatusBadRequest)
-		log.Println("Nessun file caricato.")
-		return
-	}
-
-	var filePaths []string
-	for _, fileHeader := range files {
-		file, err := fileHeader.Open()
-		if err != nil {
-			http.Error(w, "Errore nell'apertura del file caricato", http.StatusInternalServerError)
-			log.Printf("Errore nell'apertura del file caricato %s: %v", fileHeader.Filename, err)
-			continue
-		}
-		defer file.Close()
-
-		// Salva il file caricato in una directory temporanea
-		tempDir := os.TempDir()
-		// Mantieni la struttura delle sottocartelle
-		tempFilePath := filepath.Join(tempDir, fileHeader.Filename)
-		os.MkdirAll(filepath.Dir(tempFilePath), os.ModePerm)
-		tempFile, err := os.Create(tempFilePath)
-		if err != nil {
-			http.Error(w, "Errore nella creazione del file temporaneo", http.StatusInternalServerError)
-			log.Printf("Errore nella creazione del file temporaneo %s: %v", tempFilePath, err)
-			continue
-		}
-		defer tempFile.Close()
-
-		_, err = tempFile.ReadFrom(file)
-		if err != nil {
-			http.Error(w, "Errore nel salvataggio del file caricato", http.StatusInternalServerError)
-			log.Printf("Errore nel salvataggio del file caricato %s: %v", tempFilePath, err)
-			continue
-		}
-
-		// Verifica la dimensione del file
-		fileInfo, err := tempFile.Stat()
-		if err != nil {
-			log.Printf("Errore nel recupero delle informazioni del file %s: %v", tempFilePath, err)
-			continue
-		}
-		if fileInfo.Size() == 0 {
-			log.Printf("Il file %s è vuoto e verrà ignorato.", tempFilePath)
-			continue
-		}
-
-		log.Printf("File caricato salvato in: %s", tempFilePath)
-		filePaths = append(filePaths, tempFilePath)
-	}
-
-	ctx := context.Background()
-
-	// Estrae le email dai file e le carica nel database con progressione
-	totalFiles := len(filePaths)
-	var filesProcessed int32 = 0
-
-	// Processa i file uno alla volta
-	for _, filePath := range filePaths {
-		log.Printf("Inizio estrazione email dal file: %s", filePath)
-		emails, err := extractor.ExtractEmailsFromFile(filePath)
-		if err != nil {
-			log.Printf("Errore durante l'estrazione dal file %s: %v", filePath, err)
-			continue
-		}
-
-		log.Printf("Numero di email estratte dal file %s: %d", filePath, len(emails))
-
-		if len(emails) > 0 {
-			// Carica le email nel database
-			err = uploadEmailsToMongo(ctx, mongoClient, dbName, collectionName, emails, breachName)
-			if err != nil {
-				log.Printf("Errore durante il caricamento delle email in MongoDB dal file %s: %v", filePath, err)
-				continue
-			}
-			log.Printf("Email dal file %s caricate con successo.", filePath)
-		} else {
-			log.Printf("Nessuna email valida trovata nel file %s.", filePath)
+		if !validCSRF(r, s) {
+			http.Error(w, "Token CSRF non valido", http.StatusForbidden)
+			return
 		}
-
-		// Aggiorna il conteggio dei file processati
-		atomic.AddInt32(&filesProcessed, 1)
+		next.ServeHTTP(w, withSession(r, s))
 	}
-
-	// Calcola la percentuale di avanzamento
-	progress := (float64(filesProcessed) / float64(totalFiles)) * 100
-
-	// Mostra il risultato all'utente
-	fmt.Fprintf(w, "Caricamento completato! Percentuale di avanzamento: %.2f%%", progress)
-	log.Printf("Processamento completato. Files processati: %d su %d", filesProcessed, totalFiles)
 }
 
-func uploadEmailsToMongo(ctx context.Context, client *mongo.Client, dbName, collectionName string, emails []string, breachName string) error {
-	collection := client.Database(dbName).Collection(collectionName)
-
-	// Rimuovi le email duplicate
-	emailSet := make(map[string]struct{})
-	for _, email := range emails {
-		emailSet[email] = struct{}{}
-	}
-	uniqueEmails := make([]string, 0, len(emailSet))
-	for email := range emailSet {
-		uniqueEmails = append(uniqueEmails, email)
-	}
-
-	log.Printf("Numero di email uniche da processare: %d", len(uniqueEmails))
-
-	var models []mongo.WriteModel
-	for _, email := range uniqueEmails {
-		// Crea un modello di aggiornamento con upsert
-		filter := bson.M{"email": email}
-		update := bson.M{
-			"$addToSet": bson.M{
-				"breaches": breachName,
-			},
-		}
-		model := mongo.NewUpdateOneModel().
-			SetFilter(filter).
-			SetUpdate(update).
-			SetUpsert(true)
-		models = append(models, model)
-	}
-
-	if len(models) > 0 {
-		batchSize := 950 // Imposta il batchSize
-		totalModels := len(models)
-		for i := 0; i < totalModels; i += batchSize {
-			end := i + batchSize
-			if end > totalModels {
-				end = totalModels
-			}
+// recentJobs è il numero di job di import mostrati nella pagina principale
+const recentJobs = 20
 
-			batch := models[i:end]
-			log.Printf("Esecuzione di un batch di %d operazioni di upsert (da %d a %d).", len(batch), i, end)
-			result, err := collection.BulkWrite(ctx, batch)
-			if err != nil {
-				log.Printf("Errore durante l'operazione BulkWrite: %v", err)
-				return err
-			}
-			log.Printf("Risultati del BulkWrite: MatchedCount=%d, ModifiedCount=%d, UpsertedCount=%d", result.MatchedCount, result.ModifiedCount, result.UpsertedCount)
-		}
-		log.Printf("Operazioni di upsert completate per %d email nella collezione %s.", len(uniqueEmails), collectionName)
-
-		// Conta il numero di documenti nella collezione
-		count, err := collection.CountDocuments(ctx, bson.M{})
-		if err != nil {
-			log.Printf("Errore durante il conteggio dei documenti nella collezione %s: %v", collectionName, err)
-		} else {
-			log.Printf("La collezione %s contiene ora %d documenti.", collectionName, count)
+// Handler per la pagina principale: form di upload e ultimi job di import
+func indexHandler(w http.ResponseWriter, r *http.Request) {
+	var views []jobView
+	for _, job := range importJobs.List() {
+		if len(views) == recentJobs {
+			break
 		}
-	} else {
-		log.Println("Nessuna email da inserire nel database.")
+		views = append(views, newJobView(job))
 	}
-
-	return nil
+	renderTemplate(w, r, "index", map[string]any{"Jobs": views})
 }
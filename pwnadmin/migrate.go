@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"pwnscanner/pkg/database"
+	"strconv"
+)
+
+// migrateCommand applica le migrazioni mancanti, oppure con -status mostra soltanto lo stato dello schema.
+func migrateCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	statusOnly := flags.Bool("status", false, "mostra la versione dello schema e le migrazioni mancanti senza applicarle")
+	flags.Parse(args)
+
+	db, err := openWriter(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, ok := db.(database.Migrator)
+	if !ok {
+		log.Println("Il database configurato non ha uno schema versionato: nessuna migrazione da applicare.")
+		return nil
+	}
+
+	if *statusOnly {
+		status, err := migrator.SchemaStatus(ctx)
+		if err != nil {
+			return err
+		}
+		log.Printf("Schema alla versione %d (più recente conosciuta: %d)", status.Current, status.Latest)
+		for _, m := range status.Pending {
+			log.Printf("  da applicare: %d - %s", m.Version, m.Description)
+		}
+		return nil
+	}
+
+	return migrateSchema(ctx, migrator)
+}
+
+// checkSchema verifica che lo schema non sia più recente di quello supportato
+// e segnala le migrazioni ancora da applicare.
+func checkSchema(ctx context.Context, migrator database.Migrator) error {
+	status, err := migrator.SchemaStatus(ctx)
+	if err != nil {
+		return fmt.Errorf("errore durante la lettura della versione dello schema: %w", err)
+	}
+	if err := status.Check(); err != nil {
+		return err
+	}
+	if len(status.Pending) > 0 {
+		log.Printf("Schema alla versione %d: %d migrazioni da applicare", status.Current, len(status.Pending))
+	}
+	return nil
+}
+
+// autoMigrate applica le migrazioni all'avvio del server, salvo AUTO_MIGRATE=false.
+func autoMigrate(ctx context.Context, db database.Writer) error {
+	migrator, ok := db.(database.Migrator)
+	if !ok {
+		return nil
+	}
+	if value := os.Getenv("AUTO_MIGRATE"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("AUTO_MIGRATE: valore booleano non valido %q", value)
+		}
+		if !enabled {
+			return nil
+		}
+	}
+	return migrateSchema(ctx, migrator)
+}
+
+// migrateSchema applica le migrazioni mancanti registrandone l'esito nel log.
+func migrateSchema(ctx context.Context, migrator database.Migrator) error {
+	applied, err := migrator.Migrate(ctx)
+	for _, m := range applied {
+		log.Printf("Migrazione %d applicata: %s", m.Version, m.Description)
+	}
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		log.Println("Lo schema del database è aggiornato.")
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"pwnscanner/pkg/database"
+	"sort"
+)
+
+// normalizeEmailsCommand riscrive nella forma canonica le email importate prima della normalizzazione
+// (o con regole dei provider diverse): le associazioni e le classi di dati esposte vengono spostate
+// sull'email normalizzata, unendo eventuali duplicati, e l'email originale viene eliminata.
+func normalizeEmailsCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("normalize-emails", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "mostra quante email verrebbero modificate senza scrivere nulla")
+	deleteInvalid := flags.Bool("delete-invalid", false, "elimina le email che non possono essere normalizzate")
+	batchSize := flags.Int("batch", 950, "email scritte o eliminate per ogni operazione")
+	flags.Parse(args)
+
+	if *batchSize <= 0 {
+		return fmt.Errorf("il parametro -batch deve essere positivo")
+	}
+
+	db, err := openWriter(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	exporter, ok := db.(database.Exporter)
+	if !ok {
+		return fmt.Errorf("il database configurato non supporta la scansione delle email")
+	}
+	deleter, ok := db.(database.EmailDeleter)
+	if !ok {
+		return fmt.Errorf("il database configurato non supporta l'eliminazione delle email")
+	}
+
+	// Raccoglie le email da riscrivere prima di modificare il database, così la scansione
+	// non vede le email appena create
+	var (
+		scanned    int64
+		obsolete   []string
+		invalid    []string
+		moved      = make(map[string][]string) // breach -> email normalizzate
+		normalized = make(map[string]string)   // email originale -> email normalizzata
+	)
+	err = exporter.ForEachEmail(ctx, func(record database.Record) error {
+		scanned++
+		email, err := normalizer.Email(record.Email)
+		if err != nil {
+			invalid = append(invalid, record.Email)
+			return nil
+		}
+		if email == record.Email {
+			return nil
+		}
+		obsolete = append(obsolete, record.Email)
+		normalized[record.Email] = email
+		for _, breach := range record.Breaches {
+			moved[breach] = append(moved[breach], email)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("errore durante la scansione delle email: %w", err)
+	}
+	log.Printf("Email analizzate: %d, da normalizzare: %d, non valide: %d", scanned, len(obsolete), len(invalid))
+
+	if *dryRun {
+		log.Println("Modalità dry-run: nessuna modifica eseguita.")
+		return nil
+	}
+
+	breaches := make([]string, 0, len(moved))
+	for breach := range moved {
+		breaches = append(breaches, breach)
+	}
+	sort.Strings(breaches)
+
+	var inserted, matched int64
+	for _, breach := range breaches {
+		emails := moved[breach]
+		for i := 0; i < len(emails); i += *batchSize {
+			end := min(i+*batchSize, len(emails))
+			result, err := db.AddBreachEmails(ctx, breach, emails[i:end])
+			if err != nil {
+				return fmt.Errorf("errore durante la scrittura delle email normalizzate del breach %s: %w", breach, err)
+			}
+			inserted += result.UpsertedCount
+			matched += result.MatchedCount
+		}
+	}
+	log.Printf("Email normalizzate scritte: %d nuove, %d unite a email già presenti", inserted, matched)
+
+	// Le classi di dati vanno copiate prima di eliminare le email originali, che le portano con sé
+	if err := moveDataClasses(ctx, db, obsolete, normalized, *batchSize); err != nil {
+		return err
+	}
+
+	if *deleteInvalid {
+		obsolete = append(obsolete, invalid...)
+	}
+	var deleted int64
+	for i := 0; i < len(obsolete); i += *batchSize {
+		end := min(i+*batchSize, len(obsolete))
+		count, err := deleter.DeleteEmails(ctx, obsolete[i:end])
+		if err != nil {
+			return fmt.Errorf("errore durante l'eliminazione delle email originali: %w", err)
+		}
+		deleted += count
+	}
+	log.Printf("Email originali eliminate: %d", deleted)
+	if len(invalid) > 0 && !*deleteInvalid {
+		log.Printf("%d email non valide sono state lasciate invariate; usa -delete-invalid per eliminarle.", len(invalid))
+	}
+	return nil
+}
+
+// moveDataClasses copia sull'email normalizzata le classi di dati esposte dalle email originali,
+// se il database le conserva. Le email normalizzate devono essere già associate ai breach.
+func moveDataClasses(ctx context.Context, db database.Writer, obsolete []string, normalized map[string]string, batchSize int) error {
+	reader, ok := db.(database.DataClassReader)
+	if !ok {
+		return nil
+	}
+	writer, ok := db.(database.DataClassWriter)
+	if !ok {
+		return nil
+	}
+
+	classes := make(map[string]map[string][]string) // breach -> email normalizzata -> classi
+	for _, email := range obsolete {
+		found, err := reader.FindDataClasses(ctx, email)
+		if err != nil {
+			return fmt.Errorf("errore durante la lettura delle classi di dati di %s: %w", email, err)
+		}
+		for breach, list := range found {
+			if classes[breach] == nil {
+				classes[breach] = make(map[string][]string)
+			}
+			target := normalized[email]
+			classes[breach][target] = append(classes[breach][target], list...)
+		}
+	}
+
+	breaches := make([]string, 0, len(classes))
+	for breach := range classes {
+		breaches = append(breaches, breach)
+	}
+	sort.Strings(breaches)
+
+	var copied int
+	for _, breach := range breaches {
+		batch := make(map[string][]string, batchSize)
+		for email, list := range classes[breach] {
+			batch[email] = list
+			if len(batch) == batchSize {
+				if err := writer.AddDataClasses(ctx, breach, batch); err != nil {
+					return fmt.Errorf("errore durante la scrittura delle classi di dati del breach %s: %w", breach, err)
+				}
+				copied += len(batch)
+				batch = make(map[string][]string, batchSize)
+			}
+		}
+		if len(batch) > 0 {
+			if err := writer.AddDataClasses(ctx, breach, batch); err != nil {
+				return fmt.Errorf("errore durante la scrittura delle classi di dati del breach %s: %w", breach, err)
+			}
+			copied += len(batch)
+		}
+	}
+	log.Printf("Classi di dati copiate sulle email normalizzate: %d associazioni email-breach", copied)
+	return nil
+}
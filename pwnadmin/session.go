@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// sessionCookie è il cookie con l'identificativo della sessione dell'amministratore.
+const sessionCookie = "session_token"
+
+// sessionTTL è la durata di una sessione dal login.
+const sessionTTL = time.Hour
+
+// csrfField è il campo dei form (o il parametro dell'URL, per gli upload multipart) con il token CSRF.
+const csrfField = "csrf_token"
+
+// session è una sessione dell'amministratore, creata dal login.
+type session struct {
+	// csrf è il token che le richieste che modificano i dati devono inviare insieme al cookie
+	csrf    string
+	expires time.Time
+}
+
+// sessions conserva in memoria le sessioni attive, indicizzate per identificativo: un riavvio
+// di pwnadmin richiede un nuovo login.
+var sessions = struct {
+	sync.Mutex
+	m map[string]session
+}{m: make(map[string]session)}
+
+// sessionContextKey è la chiave della sessione nel contesto delle richieste autenticate.
+type sessionContextKey struct{}
+
+// randomToken restituisce 32 byte casuali in base64 per URL.
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// newSession crea una sessione e ne restituisce l'identificativo, eliminando quelle scadute.
+func newSession(now time.Time) (string, session, error) {
+	id, err := randomToken()
+	if err != nil {
+		return "", session{}, err
+	}
+	csrf, err := randomToken()
+	if err != nil {
+		return "", session{}, err
+	}
+	s := session{csrf: csrf, expires: now.Add(sessionTTL)}
+
+	sessions.Lock()
+	defer sessions.Unlock()
+	for key, existing := range sessions.m {
+		if !now.Before(existing.expires) {
+			delete(sessions.m, key)
+		}
+	}
+	sessions.m[id] = s
+	return id, s, nil
+}
+
+// requestSession restituisce la sessione valida indicata dal cookie della richiesta.
+func requestSession(r *http.Request, now time.Time) (session, bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return session{}, false
+	}
+	sessions.Lock()
+	defer sessions.Unlock()
+	s, ok := sessions.m[cookie.Value]
+	if !ok || !now.Before(s.expires) {
+		return session{}, false
+	}
+	return s, true
+}
+
+// validCSRF verifica il token CSRF delle richieste che possono modificare i dati. Il token viene letto
+// dall'header X-CSRF-Token, dall'URL per i form multipart, il cui corpo viene letto in streaming
+// dall'handler, o dai campi del form.
+func validCSRF(r *http.Request, s session) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	token := r.Header.Get("X-CSRF-Token")
+	if token == "" {
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+			token = r.URL.Query().Get(csrfField)
+		} else {
+			token = r.PostFormValue(csrfField)
+		}
+	}
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.csrf)) == 1
+}
+
+// csrfToken restituisce il token CSRF della sessione della richiesta, da inserire nei form.
+func csrfToken(r *http.Request) string {
+	if s, ok := r.Context().Value(sessionContextKey{}).(session); ok {
+		return s.csrf
+	}
+	return ""
+}
+
+// withSession restituisce la richiesta con la sessione nel contesto, per csrfToken.
+func withSession(r *http.Request, s session) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), sessionContextKey{}, s))
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	id, s, err := newSession(time.Now())
+	if err != nil {
+		t.Fatalf("newSession: errore inatteso: %v", err)
+	}
+	handler := authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		// Il token della sessione è disponibile ai template
+		if csrfToken(r) != s.csrf {
+			t.Errorf("csrfToken = %q, atteso il token della sessione", csrfToken(r))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	form := url.Values{"name": {"Test"}}
+	withToken := url.Values{"name": {"Test"}, csrfField: {s.csrf}}
+	for _, tc := range []struct {
+		name        string
+		method      string
+		target      string
+		cookie      string
+		contentType string
+		body        string
+		header      string
+		want        int
+	}{
+		{name: "senza cookie", method: http.MethodGet, target: "/", want: http.StatusSeeOther},
+		{name: "cookie contraffatto", method: http.MethodGet, target: "/", cookie: "authenticated", want: http.StatusSeeOther},
+		{name: "GET con la sessione", method: http.MethodGet, target: "/", cookie: id, want: http.StatusNoContent},
+		{name: "POST senza token", method: http.MethodPost, target: "/breaches/remove", cookie: id,
+			contentType: "application/x-www-form-urlencoded", body: form.Encode(), want: http.StatusForbidden},
+		{name: "POST con un token errato", method: http.MethodPost, target: "/breaches/remove", cookie: id,
+			contentType: "application/x-www-form-urlencoded", body: form.Encode() + "&csrf_token=x", want: http.StatusForbidden},
+		{name: "POST con il token nel form", method: http.MethodPost, target: "/breaches/remove", cookie: id,
+			contentType: "application/x-www-form-urlencoded", body: withToken.Encode(), want: http.StatusNoContent},
+		{name: "POST con il token nell'header", method: http.MethodPost, target: "/jobs/1/cancel", cookie: id,
+			header: s.csrf, want: http.StatusNoContent},
+		// Il corpo degli upload non viene letto dal middleware: il token è nell'URL
+		{name: "upload con il token nell'URL", method: http.MethodPost, target: "/upload?csrf_token=" + s.csrf, cookie: id,
+			contentType: "multipart/form-data; boundary=b", body: "--b--\r\n", want: http.StatusNoContent},
+		{name: "upload senza token", method: http.MethodPost, target: "/upload", cookie: id,
+			contentType: "multipart/form-data; boundary=b", body: "--b--\r\n", want: http.StatusForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body))
+			if tc.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: sessionCookie, Value: tc.cookie})
+			}
+			if tc.contentType != "" {
+				r.Header.Set("Content-Type", tc.contentType)
+			}
+			if tc.header != "" {
+				r.Header.Set("X-CSRF-Token", tc.header)
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+			if w.Code != tc.want {
+				t.Errorf("%s %s = %d, atteso %d", tc.method, tc.target, w.Code, tc.want)
+			}
+		})
+	}
+}
+
+func TestSessionExpired(t *testing.T) {
+	id, _, err := newSession(time.Now().Add(-2 * sessionTTL))
+	if err != nil {
+		t.Fatalf("newSession: errore inatteso: %v", err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: sessionCookie, Value: id})
+	if _, ok := requestSession(r, time.Now()); ok {
+		t.Error("sessione scaduta accettata")
+	}
+}
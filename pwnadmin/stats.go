@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"pwnscanner/pkg/database"
+	"time"
+)
+
+// reconcileStatsCommand ricostruisce i contatori materializzati a partire dalle email.
+func reconcileStatsCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("reconcile-stats", flag.ExitOnError)
+	flags.Parse(args)
+
+	db, err := openWriter(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return reconcileStats(ctx, db)
+}
+
+// removeBreachCommand elimina da riga di comando tutte le associazioni di un breach.
+func removeBreachCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("remove-breach", flag.ExitOnError)
+	name := flags.String("name", "", "nome del breach da eliminare (obbligatorio)")
+	flags.Parse(args)
+
+	if *name == "" {
+		flags.Usage()
+		return fmt.Errorf("il parametro -name è obbligatorio")
+	}
+
+	db, err := openWriter(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return removeBreach(ctx, db, *name)
+}
+
+// reconcileStats ricostruisce i contatori, se il database li supporta.
+func reconcileStats(ctx context.Context, db database.Writer) error {
+	reconciler, ok := db.(database.StatsReconciler)
+	if !ok {
+		return fmt.Errorf("il database configurato non supporta la ricostruzione delle statistiche")
+	}
+
+	log.Println("Ricostruzione delle statistiche...")
+	start := time.Now()
+	stats, err := reconciler.ReconcileStats(ctx)
+	if err != nil {
+		return fmt.Errorf("errore durante la ricostruzione delle statistiche: %w", err)
+	}
+	log.Printf("Statistiche ricostruite in %s: %d email, %d associazioni, %d breach",
+		time.Since(start).Round(time.Millisecond), stats.Emails, stats.Associations, stats.Breaches)
+	return nil
+}
+
+// ensureStats ricostruisce i contatori all'avvio se non sono mai stati ricostruiti,
+// così i dati caricati prima della loro introduzione vengono contati.
+func ensureStats(ctx context.Context, db database.Writer) error {
+	reader, ok := db.(database.StatsReader)
+	if !ok {
+		return nil
+	}
+	stats, err := reader.GlobalStats(ctx)
+	if err != nil {
+		return fmt.Errorf("errore durante la lettura delle statistiche: %w", err)
+	}
+	if !stats.ReconciledAt.IsZero() {
+		return nil
+	}
+
+	log.Println("Le statistiche non sono mai state ricostruite: vengono calcolate ora dai dati presenti.")
+	return reconcileStats(ctx, db)
+}
+
+// removeBreach elimina le associazioni del breach e la sua voce nel catalogo.
+func removeBreach(ctx context.Context, db database.Writer, name string) error {
+	remover, ok := db.(database.BreachRemover)
+	if !ok {
+		return fmt.Errorf("il database configurato non supporta l'eliminazione dei breach")
+	}
+
+	log.Printf("Eliminazione del breach %s...", name)
+	result, err := remover.RemoveBreach(ctx, name)
+	if err != nil {
+		return fmt.Errorf("errore durante l'eliminazione del breach %s: %w", name, err)
+	}
+	log.Printf("Breach %s eliminato: rimosso da %d email, %d email eliminate perché rimaste senza breach",
+		name, result.UnlinkedCount, result.DeletedCount)
+
+	if catalog, ok := db.(database.BreachCatalogWriter); ok {
+		if err := catalog.DeleteBreach(ctx, name); err != nil {
+			return fmt.Errorf("errore durante l'eliminazione del breach %s dal catalogo: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Handler per l'eliminazione dei dati di un breach (email associate e voce nel catalogo)
+func removeBreachHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Metodo non consentito", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := writer.(database.BreachRemover); !ok {
+		http.Error(w, "Il database configurato non supporta l'eliminazione dei breach", http.StatusNotImplemented)
+		return
+	}
+
+	name := r.FormValue("name")
+	if name == "" {
+		http.Error(w, "Il nome del breach è richiesto", http.StatusBadRequest)
+		return
+	}
+	if err := removeBreach(context.Background(), writer, name); err != nil {
+		http.Error(w, "Errore nell'eliminazione del breach", http.StatusInternalServerError)
+		log.Print(err)
+		return
+	}
+	http.Redirect(w, r, "/breaches", http.StatusSeeOther)
+}